@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/authz"
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/sessions"
+)
+
+// fakeserver stands in for a dedicated game server in local testing. It registers with the sessions
+// service's fleet, heartbeats, accepts TCP connections on its port, starts each session it is given and
+// completes it after -game-length. On SIGINT or SIGTERM it drains, abandons its sessions and deregisters.
+//
+// A client that sends "join <session_id>" as its first line counts as a player of that session in the
+// heartbeats. -fail-after stops the heartbeats to try out failover.
+func main() {
+	hostname, _ := os.Hostname()
+	var (
+		sessionsURL  = flag.String("sessions", envOr("SESSIONS_URL", "http://localhost:8083"), "sessions service base URL")
+		loginURL     = flag.String("login", envOr("LOGIN_URL", "http://localhost:8081"), "login service base URL, for the client-credentials grant")
+		clientID     = flag.String("client-id", envOr("FAKESERVER_CLIENT_ID", "fakeserver"), "service account granted "+authz.ScopeFleetWrite)
+		clientSecret = flag.String("client-secret", os.Getenv("FAKESERVER_CLIENT_SECRET"), "service account secret")
+		token        = flag.String("token", os.Getenv("FAKESERVER_TOKEN"), "service token to use instead of the client-credentials grant")
+		id           = flag.String("id", "", "server ID (default: hostname and port)")
+		ip           = flag.String("ip", "127.0.0.1", "address players connect to")
+		port         = flag.Int("port", 7777, "TCP port to listen on and advertise")
+		region       = flag.String("region", "local", "region the server runs in")
+		capacity     = flag.Int("capacity", 4, "sessions hosted at once")
+		labels       = flag.String("labels", "", "comma-separated key=value labels, such as mode=ranked,map=dust")
+		heartbeat    = flag.Duration("heartbeat", sessions.HeartbeatInterval, "heartbeat interval")
+		gameLength   = flag.Duration("game-length", 5*time.Minute, "how long each session runs before the server ends it (0: until shutdown)")
+		failAfter    = flag.Duration("fail-after", 0, "stop heartbeating after this long, as if the server hung (0: never)")
+	)
+	flag.Parse()
+
+	reg := sessions.ServerRegistration{ID: *id, IP: *ip, Port: *port, Region: *region, Capacity: *capacity}
+	if reg.ID == "" {
+		reg.ID = fmt.Sprintf("%s-%d", hostname, *port)
+	}
+	if *labels != "" {
+		reg.Labels = map[string]string{}
+		for _, pair := range strings.Split(*labels, ",") {
+			key, value, ok := strings.Cut(pair, "=")
+			if !ok {
+				log.Fatalf("label %q is not key=value", pair)
+			}
+			reg.Labels[key] = value
+		}
+	}
+	if *token == "" && *clientSecret == "" {
+		log.Fatal("set -token or -client-secret")
+	}
+
+	listener, err := net.Listen("tcp", ":"+strconv.Itoa(*port))
+	if err != nil {
+		log.Fatalf("listen: %v", err)
+	}
+	defer func() { _ = listener.Close() }()
+	players := &playerCounts{counts: map[string]int{}}
+	go serve(listener, reg.ID, players)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	c := &client{http: &http.Client{Timeout: 5 * time.Second}, sessionsURL: *sessionsURL, loginURL: *loginURL, clientID: *clientID, clientSecret: *clientSecret, token: *token}
+	server, err := c.call(ctx, http.MethodPost, "/v1/fleet/servers", reg)
+	if err != nil {
+		log.Fatalf("register: %v", err)
+	}
+	log.Printf("registered %s at %s:%d in %s with room for %d sessions", server.ID, server.IP, server.Port, server.Region, server.Capacity)
+
+	started := map[string]time.Time{}
+	registeredAt := time.Now()
+	ticker := time.NewTicker(*heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			shutdown(c, server.ID, started)
+			return
+		case <-ticker.C:
+		}
+		if *failAfter > 0 && time.Since(registeredAt) >= *failAfter {
+			continue
+		}
+		beat, err := c.call(ctx, http.MethodPost, "/v1/fleet/servers/"+server.ID+"/heartbeat", sessions.ServerHeartbeat{Health: sessions.HealthOK, Players: players.snapshot()})
+		var status *statusError
+		if errors.As(err, &status) && status.code == http.StatusGone {
+			// Declared lost: the sessions were moved, so start over empty.
+			log.Printf("declared lost, registering again")
+			started = map[string]time.Time{}
+			beat, err = c.call(ctx, http.MethodPost, "/v1/fleet/servers", reg)
+		}
+		if err != nil {
+			log.Printf("heartbeat: %v", err)
+			continue
+		}
+		server = beat
+		hosted := map[string]bool{}
+		for _, sessionID := range server.Sessions {
+			hosted[sessionID] = true
+			if _, ok := started[sessionID]; !ok {
+				if err := c.setStatus(ctx, server.ID, sessionID, sessions.StatusInProgress, ""); err != nil {
+					log.Printf("start session %s: %v", sessionID, err)
+					continue
+				}
+				started[sessionID] = time.Now()
+				log.Printf("session %s started", sessionID)
+			}
+		}
+		for sessionID, at := range started {
+			switch {
+			case !hosted[sessionID]:
+				delete(started, sessionID)
+			case *gameLength > 0 && time.Since(at) >= *gameLength:
+				// Completing the session also frees its place on the server.
+				if err := c.setStatus(ctx, server.ID, sessionID, sessions.StatusCompleted, "game over"); err != nil {
+					log.Printf("end session %s: %v", sessionID, err)
+					continue
+				}
+				delete(started, sessionID)
+				log.Printf("session %s ended", sessionID)
+			}
+		}
+	}
+}
+
+// playerCounts counts the connections that joined each session.
+type playerCounts struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (p *playerCounts) add(sessionID string, n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.counts[sessionID] += n
+	if p.counts[sessionID] <= 0 {
+		delete(p.counts, sessionID)
+	}
+}
+
+func (p *playerCounts) snapshot() map[string]int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := make(map[string]int, len(p.counts))
+	for sessionID, n := range p.counts {
+		out[sessionID] = n
+	}
+	return out
+}
+
+// serve greets each connection with the server's ID and echoes what it is sent. A first line of
+// "join <session_id>" counts the connection as a player of that session until it closes.
+func serve(listener net.Listener, serverID string, players *playerCounts) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer func() { _ = conn.Close() }()
+			_, _ = fmt.Fprintf(conn, "pcgb fake server %s\n", serverID)
+			reader := bufio.NewReader(conn)
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if sessionID, ok := strings.CutPrefix(strings.TrimSpace(line), "join "); ok && sessionID != "" {
+				players.add(sessionID, 1)
+				defer players.add(sessionID, -1)
+			}
+			if _, err := io.WriteString(conn, line); err != nil {
+				return
+			}
+			_, _ = io.Copy(conn, reader)
+		}()
+	}
+}
+
+func shutdown(c *client, serverID string, started map[string]time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := c.call(ctx, http.MethodPost, "/v1/fleet/servers/"+serverID+"/drain", nil); err != nil {
+		log.Printf("drain: %v", err)
+	}
+	for sessionID := range started {
+		if err := c.setStatus(ctx, serverID, sessionID, sessions.StatusAbandoned, "server shut down"); err != nil {
+			log.Printf("abandon session %s: %v", sessionID, err)
+		}
+		// Free the place even if the session could not be abandoned.
+		if _, err := c.call(ctx, http.MethodDelete, "/v1/fleet/servers/"+serverID+"/sessions/"+sessionID, nil); err != nil {
+			log.Printf("end session %s: %v", sessionID, err)
+		}
+	}
+	if _, err := c.call(ctx, http.MethodDelete, "/v1/fleet/servers/"+serverID, nil); err != nil {
+		log.Printf("deregister: %v", err)
+		return
+	}
+	log.Printf("deregistered %s", serverID)
+}
+
+// client calls the fleet endpoints with a service token, fetched with the client-credentials grant and
+// renewed before it expires unless a fixed token was given.
+type client struct {
+	http         *http.Client
+	sessionsURL  string
+	loginURL     string
+	clientID     string
+	clientSecret string
+	token        string
+	expiresAt    time.Time
+}
+
+func (c *client) bearer(ctx context.Context) (string, error) {
+	if c.token != "" && (c.clientSecret == "" || time.Until(c.expiresAt) > time.Minute) {
+		return c.token, nil
+	}
+	form := url.Values{"grant_type": {"client_credentials"}, "scope": {authz.ScopeFleetWrite}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.loginURL+"/v1/oauth/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(c.clientID, c.clientSecret)
+	res, err := c.http.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = res.Body.Close() }()
+	if res.StatusCode != http.StatusOK {
+		raw, _ := io.ReadAll(res.Body)
+		return "", fmt.Errorf("token: %s: %s", res.Status, bytes.TrimSpace(raw))
+	}
+	var body struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return "", err
+	}
+	c.token, c.expiresAt = body.AccessToken, time.Now().Add(time.Duration(body.ExpiresIn)*time.Second)
+	return c.token, nil
+}
+
+// call sends body as JSON and returns the server in the reply, if any.
+func (c *client) call(ctx context.Context, method, path string, body any) (sessions.GameServer, error) {
+	token, err := c.bearer(ctx)
+	if err != nil {
+		return sessions.GameServer{}, err
+	}
+	var payload io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return sessions.GameServer{}, err
+		}
+		payload = bytes.NewReader(raw)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.sessionsURL+path, payload)
+	if err != nil {
+		return sessions.GameServer{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	res, err := c.http.Do(req)
+	if err != nil {
+		return sessions.GameServer{}, err
+	}
+	defer func() { _ = res.Body.Close() }()
+	if res.StatusCode >= 300 {
+		raw, _ := io.ReadAll(res.Body)
+		return sessions.GameServer{}, &statusError{code: res.StatusCode, msg: fmt.Sprintf("%s %s: %s: %s", method, path, res.Status, bytes.TrimSpace(raw))}
+	}
+	var reply struct {
+		Server sessions.GameServer `json:"server"`
+	}
+	if res.StatusCode == http.StatusNoContent {
+		return reply.Server, nil
+	}
+	if err := json.NewDecoder(res.Body).Decode(&reply); err != nil && !errors.Is(err, io.EOF) {
+		return sessions.GameServer{}, err
+	}
+	return reply.Server, nil
+}
+
+// setStatus reports that a session the server hosts started or ended.
+func (c *client) setStatus(ctx context.Context, serverID, sessionID, status, reason string) error {
+	_, err := c.call(ctx, http.MethodPost, "/v1/fleet/servers/"+serverID+"/sessions/"+sessionID+"/status", sessions.StatusRequest{Status: status, Reason: reason})
+	return err
+}
+
+type statusError struct {
+	code int
+	msg  string
+}
+
+func (e *statusError) Error() string { return e.msg }
+
+func envOr(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
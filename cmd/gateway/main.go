@@ -13,6 +13,7 @@ import (
 
 	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/gateway"
 	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/login"
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/sanctions"
 	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/pkg/bus"
 	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/pkg/config"
 	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/pkg/httpserver"
@@ -63,7 +64,7 @@ func main() {
 	}
 
 	parser := login.NewAuthenticator(secret, 24*time.Hour)
-	sender := gateway.NewSender(instanceID, logger, redisClient, parser)
+	sender := gateway.NewSender(instanceID, logger, redisClient, parser).WithSanctionChecker(sanctions.NewRedisStore(redisClient))
 
 	sub, err := gateway.SubscribeSendToUser(nc, logger, sender)
 	if err != nil {
@@ -71,6 +72,18 @@ func main() {
 	}
 	defer func() { _ = sub.Unsubscribe() }()
 
+	sanctionSub, err := gateway.SubscribeSanctions(nc, logger, sender)
+	if err != nil {
+		log.Fatalf("subscribe to sanctions subject: %v", err)
+	}
+	defer func() { _ = sanctionSub.Unsubscribe() }()
+
+	deletionSub, err := gateway.SubscribeDeletions(nc, logger, sender)
+	if err != nil {
+		log.Fatalf("subscribe to user deletions subject: %v", err)
+	}
+	defer func() { _ = deletionSub.Unsubscribe() }()
+
 	mux := httpserver.NewMux(cfg.ServiceName)
 	sender.Register(mux)
 
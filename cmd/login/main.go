@@ -2,19 +2,25 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"log"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/login"
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/sanctions"
 	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/pkg/bus"
 	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/pkg/config"
 	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/pkg/httpserver"
 	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/pkg/logging"
 	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/pkg/observability"
 	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/pkg/storage"
+	"github.com/rs/zerolog"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func main() {
@@ -56,9 +62,21 @@ func main() {
 		secret = "local-dev-secret"
 	}
 
+	redisClient := storage.NewRedis(cfg.RedisAddr)
+	defer func() {
+		if closeErr := redisClient.Close(); closeErr != nil {
+			log.Printf("close redis client: %v", closeErr)
+		}
+	}()
+
 	repo := login.NewPostgresRepository(db)
-	auth := login.NewAuthenticator(secret, 24*time.Hour)
-	svc := login.NewService(repo, auth, nc)
+	auth := login.NewAuthenticator(secret, 24*time.Hour).WithBcryptCost(envInt("LOGIN_BCRYPT_COST", bcrypt.DefaultCost))
+	limiter := login.NewRedisAttemptLimiter(redisClient, throttleConfig())
+	svc := login.NewService(repo, auth, nc).WithAttemptLimiter(limiter).WithNotifier(resetNotifier(logger)).WithMFAConfig(mfaConfig())
+	svc.WithSanctionMirror(sanctions.NewRedisStore(redisClient))
+	if providers := oidcProviders(); len(providers) > 0 {
+		svc.WithOIDC(providers, login.NewRedisOIDCStateStore(redisClient))
+	}
 	handler := login.NewHandler(svc)
 
 	mux := httpserver.NewMux(cfg.ServiceName)
@@ -71,3 +89,86 @@ func main() {
 		log.Fatalf("login service failed: %v", err)
 	}
 }
+
+func throttleConfig() login.ThrottleConfig {
+	cfg := login.DefaultThrottleConfig()
+	cfg.MaxUserFailures = envInt("LOGIN_MAX_USER_FAILURES", cfg.MaxUserFailures)
+	cfg.MaxIPFailures = envInt("LOGIN_MAX_IP_FAILURES", cfg.MaxIPFailures)
+	cfg.Window = time.Duration(envInt("LOGIN_FAILURE_WINDOW_SECONDS", int(cfg.Window/time.Second))) * time.Second
+	cfg.BaseLockout = time.Duration(envInt("LOGIN_LOCKOUT_BASE_SECONDS", int(cfg.BaseLockout/time.Second))) * time.Second
+	cfg.MaxLockout = time.Duration(envInt("LOGIN_LOCKOUT_MAX_SECONDS", int(cfg.MaxLockout/time.Second))) * time.Second
+	cfg.MaxUserResets = envInt("LOGIN_MAX_USER_RESETS", cfg.MaxUserResets)
+	cfg.MaxIPResets = envInt("LOGIN_MAX_IP_RESETS", cfg.MaxIPResets)
+	return cfg
+}
+
+// mfaConfig reads LOGIN_MFA_ISSUER and LOGIN_MFA_REQUIRED_ROLES, a comma-separated role list. Setting
+// the list to "none" turns the requirement off.
+func mfaConfig() login.MFAConfig {
+	cfg := login.DefaultMFAConfig()
+	if issuer := os.Getenv("LOGIN_MFA_ISSUER"); issuer != "" {
+		cfg.Issuer = issuer
+	}
+	switch raw := os.Getenv("LOGIN_MFA_REQUIRED_ROLES"); raw {
+	case "":
+	case "none":
+		cfg.RequiredRoles = nil
+	default:
+		cfg.RequiredRoles = nil
+		for _, role := range strings.Split(raw, ",") {
+			if role = strings.TrimSpace(role); role != "" {
+				cfg.RequiredRoles = append(cfg.RequiredRoles, role)
+			}
+		}
+	}
+	return cfg
+}
+
+// resetNotifier picks where password reset tokens go. Only "log" and "file" exist so far; both are
+// for local development until a real delivery channel is wired in, so password reset stays disabled
+// unless LOGIN_RESET_NOTIFIER asks for one of them.
+func resetNotifier(logger zerolog.Logger) login.Notifier {
+	switch notifier := os.Getenv("LOGIN_RESET_NOTIFIER"); notifier {
+	case "":
+		return nil
+	case "log":
+		return login.NewLogNotifier(logger)
+	case "file":
+		path := os.Getenv("LOGIN_RESET_NOTIFY_FILE")
+		if path == "" {
+			path = "password-resets.jsonl"
+		}
+		return login.NewFileNotifier(path)
+	default:
+		log.Fatalf("LOGIN_RESET_NOTIFIER must be log or file, got %q", notifier)
+		return nil
+	}
+}
+
+// oidcProviders reads LOGIN_OIDC_PROVIDERS, a JSON array of login.OIDCProviderConfig objects.
+func oidcProviders() []*login.OIDCProvider {
+	raw := os.Getenv("LOGIN_OIDC_PROVIDERS")
+	if raw == "" {
+		return nil
+	}
+	var configs []login.OIDCProviderConfig
+	if err := json.Unmarshal([]byte(raw), &configs); err != nil {
+		log.Fatalf("parse LOGIN_OIDC_PROVIDERS: %v", err)
+	}
+	providers := make([]*login.OIDCProvider, 0, len(configs))
+	for _, c := range configs {
+		if c.Name == "" || c.Issuer == "" || c.ClientID == "" || c.RedirectURL == "" {
+			log.Fatalf("LOGIN_OIDC_PROVIDERS: name, issuer, client_id and redirect_url are required")
+		}
+		providers = append(providers, login.NewOIDCProvider(c, nil))
+	}
+	return providers
+}
+
+func envInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || value <= 0 {
+		return defaultValue
+	}
+	return value
+}
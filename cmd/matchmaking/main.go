@@ -2,14 +2,22 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
+	"github.com/nats-io/nats.go"
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/contracts"
 	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/login"
 	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/matchmaking"
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/ratings"
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/sanctions"
 	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/pkg/bus"
 	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/pkg/config"
 	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/pkg/httpserver"
@@ -36,6 +44,16 @@ func main() {
 		port = cfg.HTTPPort
 	}
 
+	db, err := storage.NewPostgres(cfg.PostgresURL)
+	if err != nil {
+		log.Fatalf("postgres: %v", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			log.Printf("close postgres connection: %v", closeErr)
+		}
+	}()
+
 	redisClient := storage.NewRedis(cfg.RedisAddr)
 	defer func() {
 		if closeErr := redisClient.Close(); closeErr != nil {
@@ -57,13 +75,67 @@ func main() {
 		secret = "local-dev-secret"
 	}
 
+	ratingsRepo := ratings.NewPostgresRepository(db)
 	queue := matchmaking.NewRedisQueue(redisClient)
-	svc := matchmaking.NewService(queue, nc)
+	svc := matchmaking.NewService(queue, nc).
+		WithQueues(queueConfig()).
+		WithRatings(ratingsRepo).
+		WithMatchRecorder(ratingsRepo).
+		WithSanctionChecker(sanctions.NewRedisStore(redisClient)).
+		WithParties(matchmaking.NewRedisPartyStore(redisClient)).
+		WithReadyChecks(matchmaking.NewRedisReadyChecks(redisClient)).
+		WithBackfills(matchmaking.NewRedisBackfills(redisClient)).
+		WithStatsStore(matchmaking.NewRedisStatsStore(redisClient))
+	if sharded, _ := strconv.ParseBool(os.Getenv("MATCHMAKING_SHARDING")); sharded {
+		instanceID := os.Getenv("MATCHMAKING_INSTANCE_ID")
+		if instanceID == "" {
+			id, idErr := newInstanceID()
+			if idErr != nil {
+				log.Fatalf("generate matchmaking instance id: %v", idErr)
+			}
+			instanceID = id
+		}
+		svc.WithSharding(matchmaking.NewRedisQueueLeases(redisClient), instanceID)
+		logger.Info().Str("instance_id", instanceID).Msg("sharing queues with other matchmaking replicas")
+	}
+	httpserver.RegisterMetrics(svc.WriteMetrics)
+	// A queue group hands each backfill request to one replica.
+	if _, err := nc.QueueSubscribe(contracts.SubjectSessionBackfill, "matchmaking", func(msg *nats.Msg) {
+		if err := svc.HandleBackfillRequest(context.Background(), msg.Data); err != nil {
+			logger.Warn().Err(err).Msg("ignoring backfill request")
+		}
+	}); err != nil {
+		log.Fatalf("subscribe backfill requests: %v", err)
+	}
+	if _, err := nc.QueueSubscribe(contracts.SubjectSessionStatus, "matchmaking", func(msg *nats.Msg) {
+		if err := svc.HandleSessionStatus(context.Background(), msg.Data); err != nil {
+			logger.Warn().Err(err).Msg("closing backfills of an ended session")
+		}
+	}); err != nil {
+		log.Fatalf("subscribe session status changes: %v", err)
+	}
+	if _, err := nc.QueueSubscribe(contracts.SubjectUserDeleted, "matchmaking", func(msg *nats.Msg) {
+		if err := svc.HandleUserDeleted(context.Background(), msg.Data); err != nil {
+			logger.Warn().Err(err).Msg("removing a deleted user from matchmaking")
+		}
+	}); err != nil {
+		log.Fatalf("subscribe user deletions: %v", err)
+	}
 	auth := login.NewAuthenticator(secret, 24*time.Hour)
 	handler := matchmaking.NewHandler(svc, auth)
+	ratingsSvc := ratings.NewService(ratingsRepo, nc)
+	if _, err := nc.QueueSubscribe(contracts.SubjectSessionAssigned, "ratings", func(msg *nats.Msg) {
+		if err := ratingsSvc.HandleSessionAssigned(context.Background(), msg.Data); err != nil {
+			logger.Warn().Err(err).Msg("recording the host of a match")
+		}
+	}); err != nil {
+		log.Fatalf("subscribe session assignments: %v", err)
+	}
+	ratingsHandler := ratings.NewHandler(ratingsSvc, auth)
 
 	mux := httpserver.NewMux(cfg.ServiceName)
 	handler.Register(mux)
+	ratingsHandler.Register(mux)
 
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
@@ -74,3 +146,28 @@ func main() {
 		log.Fatalf("matchmaking service failed: %v", err)
 	}
 }
+
+// queueConfig reads MATCHMAKING_QUEUES, a JSON array of matchmaking.QueueConfig objects. Without it a
+// single 1v1 "default" queue is used.
+func queueConfig() []matchmaking.QueueConfig {
+	raw := os.Getenv("MATCHMAKING_QUEUES")
+	if raw == "" {
+		return matchmaking.DefaultQueues()
+	}
+	queues, err := matchmaking.ParseQueues([]byte(raw))
+	if err != nil {
+		log.Fatalf("parse MATCHMAKING_QUEUES: %v", err)
+	}
+	return queues
+}
+
+func newInstanceID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	h := hex.EncodeToString(b)
+	return fmt.Sprintf("%s-%s-%s-%s-%s", h[0:8], h[8:12], h[12:16], h[16:20], h[20:32]), nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/matchmaking"
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/mmsim"
+)
+
+func main() {
+	var (
+		queuesPath = flag.String("queues", "", "JSON file of queue configs, as in MATCHMAKING_QUEUES (default: MATCHMAKING_QUEUES, then the default queue)")
+		input      = flag.String("input", "", "JSON lines file of recorded arrivals, or - for stdin (default: synthetic traffic)")
+		dump       = flag.String("dump", "", "write the arrivals to this file before simulating, to replay them later")
+		asJSON     = flag.Bool("json", false, "print the report as JSON")
+		step       = flag.Duration("step", mmsim.DefaultStep, "how often the matcher runs")
+
+		tickets      = flag.Int("tickets", 1000, "synthetic: number of tickets")
+		rate         = flag.Float64("rate", 2, "synthetic: tickets arriving per second")
+		queue        = flag.String("queue", matchmaking.DefaultQueueName, "synthetic: queue the tickets join")
+		ratingMean   = flag.Float64("rating-mean", matchmaking.DefaultRating, "synthetic: mean player rating")
+		ratingStdDev = flag.Float64("rating-stddev", 250, "synthetic: rating standard deviation")
+		partyRate    = flag.Float64("party-rate", 0, "synthetic: share of tickets that are parties")
+		maxParty     = flag.Int("max-party", 2, "synthetic: largest party")
+		regions      = flag.String("regions", "", "synthetic: comma-separated regions players report pings to")
+		seed         = flag.Int64("seed", 1, "synthetic: random seed")
+	)
+	flag.Parse()
+
+	queues, err := loadQueues(*queuesPath)
+	if err != nil {
+		log.Fatalf("load queues: %v", err)
+	}
+
+	var arrivals []mmsim.Arrival
+	switch *input {
+	case "":
+		synthetic := mmsim.Synthetic{
+			Tickets: *tickets, PerSecond: *rate, Queue: *queue, RatingMean: *ratingMean, RatingStdDev: *ratingStdDev,
+			PartyRate: *partyRate, MaxPartySize: *maxParty, Seed: *seed,
+		}
+		if *regions != "" {
+			synthetic.Regions = strings.Split(*regions, ",")
+		}
+		arrivals, err = synthetic.Generate()
+	case "-":
+		arrivals, err = mmsim.ReadArrivals(os.Stdin)
+	default:
+		arrivals, err = readArrivalsFile(*input)
+	}
+	if err != nil {
+		log.Fatalf("load arrivals: %v", err)
+	}
+	if *dump != "" {
+		if err := writeArrivalsFile(*dump, arrivals); err != nil {
+			log.Fatalf("write arrivals: %v", err)
+		}
+	}
+
+	report, err := mmsim.Run(context.Background(), mmsim.Options{Queues: queues, Step: *step}, arrivals)
+	if err != nil {
+		log.Fatalf("simulate: %v", err)
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(report)
+	} else {
+		err = report.WriteText(os.Stdout)
+	}
+	if err != nil {
+		log.Fatalf("write report: %v", err)
+	}
+}
+
+func loadQueues(path string) ([]matchmaking.QueueConfig, error) {
+	raw := []byte(os.Getenv("MATCHMAKING_QUEUES"))
+	if path != "" {
+		var err error
+		if raw, err = os.ReadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if len(raw) == 0 {
+		return matchmaking.DefaultQueues(), nil
+	}
+	return matchmaking.ParseQueues(raw)
+}
+
+func readArrivalsFile(path string) ([]mmsim.Arrival, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	return mmsim.ReadArrivals(f)
+}
+
+func writeArrivalsFile(path string, arrivals []mmsim.Arrival) (err error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+	return mmsim.WriteArrivals(f, arrivals)
+}
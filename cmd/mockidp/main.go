@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/oidcmock"
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/pkg/httpserver"
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/pkg/logging"
+)
+
+// mockidp runs the in-repo OpenID Connect provider for local login testing.
+func main() {
+	logger := logging.New("paul-cloud-game-backend", "mockidp", "local")
+
+	port := envOr("MOCK_IDP_PORT", "8090")
+	portNum, err := strconv.Atoi(port)
+	if err != nil {
+		log.Fatalf("invalid MOCK_IDP_PORT: %v", err)
+	}
+
+	server, err := oidcmock.New(oidcmock.Client{
+		ID:           envOr("MOCK_IDP_CLIENT_ID", "pcgb-local"),
+		Secret:       envOr("MOCK_IDP_CLIENT_SECRET", "pcgb-local-secret"),
+		RedirectURIs: strings.Split(envOr("MOCK_IDP_REDIRECT_URIS", "http://localhost:8081/v1/login/oidc/mock/callback"), ","),
+	})
+	if err != nil {
+		log.Fatalf("mock idp: %v", err)
+	}
+	server.SetIssuer(envOr("MOCK_IDP_ISSUER", "http://localhost:"+port))
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if err := httpserver.Run(ctx, logger, portNum, server, 5*time.Second); err != nil {
+		log.Fatalf("mock idp failed: %v", err)
+	}
+}
+
+func envOr(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
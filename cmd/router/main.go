@@ -7,7 +7,9 @@ import (
 	"os/signal"
 	"strings"
 	"syscall"
+	"time"
 
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/login"
 	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/router"
 	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/pkg/bus"
 	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/pkg/config"
@@ -49,9 +51,14 @@ func main() {
 	}
 	defer nc.Close()
 
+	secret := os.Getenv("LOGIN_JWT_SECRET")
+	if secret == "" {
+		secret = "local-dev-secret"
+	}
+
 	lookup := router.NewRedisLookup(redisClient)
 	routeService := router.NewService(lookup, nc, partitioningEnabled())
-	handler := router.NewHandler(routeService)
+	handler := router.NewHandler(routeService, login.NewAuthenticator(secret, 24*time.Hour))
 
 	mux := httpserver.NewMux(cfg.ServiceName)
 	handler.Register(mux)
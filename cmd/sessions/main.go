@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
@@ -68,11 +69,23 @@ func main() {
 	}()
 
 	svc := sessions.NewService(repo, auth, nc, redisClient)
+	servers := gameServers()
+	if servers != nil {
+		svc.WithServers(servers)
+	} else {
+		svc.WithFleet(sessions.NewRedisFleet(redisClient))
+		if fallback, _ := strconv.ParseBool(os.Getenv("SESSIONS_LOCAL_FALLBACK")); fallback {
+			svc.WithLocalFallback()
+		}
+	}
 	handler := sessions.NewHandler(svc)
 
 	if _, err := nc.Subscribe(contracts.SubjectMatchmakingMatch, svc.HandleMatchedEvent); err != nil {
 		log.Fatalf("subscribe matched events: %v", err)
 	}
+	if _, err := nc.Subscribe(contracts.SubjectMatchmakingBackfill, svc.HandleBackfilledEvent); err != nil {
+		log.Fatalf("subscribe backfilled events: %v", err)
+	}
 
 	mux := httpserver.NewMux(cfg.ServiceName)
 	handler.Register(mux)
@@ -80,7 +93,25 @@ func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
+	if servers == nil {
+		go svc.RunFailover(ctx, sessions.HeartbeatInterval)
+	}
+
 	if err := httpserver.Run(ctx, logger, port, mux, cfg.ShutdownTimeout); err != nil {
 		log.Fatalf("sessions service failed: %v", err)
 	}
 }
+
+// gameServers reads SESSIONS_GAME_SERVERS, a JSON array of sessions.ServerAllocation objects, one per
+// region. Without it sessions are allocated from the fleet of registered game servers.
+func gameServers() []sessions.ServerAllocation {
+	raw := os.Getenv("SESSIONS_GAME_SERVERS")
+	if raw == "" {
+		return nil
+	}
+	servers, err := sessions.ParseServers([]byte(raw))
+	if err != nil {
+		log.Fatalf("parse SESSIONS_GAME_SERVERS: %v", err)
+	}
+	return servers
+}
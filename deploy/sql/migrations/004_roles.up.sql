@@ -0,0 +1,35 @@
+CREATE TABLE user_roles (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role TEXT NOT NULL,
+    granted_by UUID,
+    granted_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, role)
+);
+
+CREATE TABLE role_scopes (
+    role TEXT NOT NULL,
+    scope TEXT NOT NULL,
+    PRIMARY KEY (role, scope)
+);
+
+INSERT INTO role_scopes (role, scope) VALUES
+    ('admin', 'admin:users:read'),
+    ('admin', 'admin:sessions:read'),
+    ('admin', 'admin:broadcast'),
+    ('admin', 'admin:roles:write'),
+    ('moderator', 'admin:users:read'),
+    ('moderator', 'admin:sessions:read'),
+    ('game_server', 'admin:sessions:read');
+
+CREATE TABLE admin_audit_log (
+    id UUID PRIMARY KEY,
+    actor_user_id UUID NOT NULL,
+    actor_roles TEXT NOT NULL DEFAULT '',
+    action TEXT NOT NULL,
+    target TEXT NOT NULL DEFAULT '',
+    correlation_id TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_user_roles_role ON user_roles (role);
+CREATE INDEX idx_admin_audit_log_actor ON admin_audit_log (actor_user_id, created_at);
@@ -0,0 +1,2 @@
+DELETE FROM role_scopes WHERE scope = 'admin:service_accounts:write';
+DROP TABLE IF EXISTS service_accounts;
@@ -0,0 +1,11 @@
+CREATE TABLE service_accounts (
+    client_id TEXT PRIMARY KEY,
+    secret_hash TEXT NOT NULL,
+    scopes TEXT NOT NULL DEFAULT '',
+    description TEXT NOT NULL DEFAULT '',
+    created_by UUID,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    disabled_at TIMESTAMPTZ
+);
+
+INSERT INTO role_scopes (role, scope) VALUES ('admin', 'admin:service_accounts:write');
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_users_device_id_hash;
+ALTER TABLE users DROP COLUMN IF EXISTS upgraded_at;
+ALTER TABLE users DROP COLUMN IF EXISTS device_id_hash;
+ALTER TABLE users DROP COLUMN IF EXISTS is_guest;
@@ -0,0 +1,5 @@
+ALTER TABLE users ADD COLUMN is_guest BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN device_id_hash TEXT;
+ALTER TABLE users ADD COLUMN upgraded_at TIMESTAMPTZ;
+
+CREATE UNIQUE INDEX idx_users_device_id_hash ON users (device_id_hash) WHERE device_id_hash IS NOT NULL;
@@ -0,0 +1,15 @@
+ALTER TABLE users ADD COLUMN display_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN avatar_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN locale TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN region TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN deleted_at TIMESTAMPTZ;
+
+CREATE TABLE username_history (
+    id BIGSERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    old_username TEXT NOT NULL,
+    new_username TEXT NOT NULL,
+    changed_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_username_history_user_id ON username_history (user_id, changed_at DESC);
@@ -0,0 +1,2 @@
+DELETE FROM role_scopes WHERE scope = 'admin:sanctions:write';
+DROP TABLE IF EXISTS user_sanctions;
@@ -0,0 +1,17 @@
+CREATE TABLE user_sanctions (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    type TEXT NOT NULL CHECK (type IN ('ban', 'suspension', 'mute')),
+    reason TEXT NOT NULL,
+    issued_by UUID,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ,
+    lifted_at TIMESTAMPTZ,
+    lifted_by UUID
+);
+
+CREATE INDEX idx_user_sanctions_active ON user_sanctions (user_id) WHERE lifted_at IS NULL;
+
+INSERT INTO role_scopes (role, scope) VALUES
+    ('admin', 'admin:sanctions:write'),
+    ('moderator', 'admin:sanctions:write');
@@ -0,0 +1,8 @@
+CREATE TABLE player_ratings (
+    user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    queue TEXT NOT NULL,
+    rating DOUBLE PRECISION NOT NULL DEFAULT 1500,
+    games_played INTEGER NOT NULL DEFAULT 0,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, queue)
+);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS rating_history;
+DROP TABLE IF EXISTS matches;
+ALTER TABLE player_ratings DROP COLUMN IF EXISTS volatility, DROP COLUMN IF EXISTS deviation;
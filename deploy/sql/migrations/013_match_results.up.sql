@@ -0,0 +1,29 @@
+ALTER TABLE player_ratings
+    ADD COLUMN deviation DOUBLE PRECISION NOT NULL DEFAULT 350,
+    ADD COLUMN volatility DOUBLE PRECISION NOT NULL DEFAULT 0.06;
+
+CREATE TABLE matches (
+    id UUID PRIMARY KEY,
+    queue TEXT NOT NULL,
+    mode TEXT NOT NULL,
+    teams JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    completed_at TIMESTAMPTZ,
+    result JSONB,
+    reported_by TEXT,
+    rating_changes JSONB
+);
+
+CREATE TABLE rating_history (
+    id BIGSERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    queue TEXT NOT NULL,
+    match_id UUID NOT NULL REFERENCES matches (id),
+    rating_before DOUBLE PRECISION NOT NULL,
+    rating_after DOUBLE PRECISION NOT NULL,
+    deviation_after DOUBLE PRECISION NOT NULL,
+    volatility_after DOUBLE PRECISION NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_rating_history_user ON rating_history (user_id, created_at DESC);
@@ -0,0 +1 @@
+ALTER TABLE sessions ADD COLUMN region TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS session_transitions;
+ALTER TABLE sessions DROP CONSTRAINT IF EXISTS sessions_status_check, DROP COLUMN IF EXISTS updated_at;
@@ -0,0 +1,18 @@
+ALTER TABLE sessions
+    ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    ADD CONSTRAINT sessions_status_check CHECK (status IN ('created', 'allocating', 'ready', 'in_progress', 'completed', 'abandoned'));
+
+CREATE TABLE session_transitions (
+    id BIGSERIAL PRIMARY KEY,
+    session_id UUID NOT NULL REFERENCES sessions (id) ON DELETE CASCADE,
+    from_status TEXT NOT NULL,
+    to_status TEXT NOT NULL,
+    actor TEXT NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_session_transitions_session ON session_transitions (session_id, id);
+
+INSERT INTO session_transitions (session_id, from_status, to_status, actor, created_at)
+SELECT id, '', status, owner_user_id::text, created_at FROM sessions;
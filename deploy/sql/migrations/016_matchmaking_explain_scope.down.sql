@@ -0,0 +1 @@
+DELETE FROM role_scopes WHERE scope = 'admin:matchmaking:read';
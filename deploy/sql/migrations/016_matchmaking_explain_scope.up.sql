@@ -0,0 +1,2 @@
+INSERT INTO role_scopes (role, scope) VALUES
+    ('admin', 'admin:matchmaking:read');
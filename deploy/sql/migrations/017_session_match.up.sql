@@ -0,0 +1 @@
+ALTER TABLE sessions ADD COLUMN match_id TEXT NOT NULL DEFAULT '';
@@ -0,0 +1 @@
+ALTER TABLE matches ADD COLUMN host_owner TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,167 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/pkg/apierror"
+)
+
+// Roles assigned to users in the user_roles table.
+const (
+	RoleAdmin      = "admin"
+	RoleModerator  = "moderator"
+	RoleGameServer = "game_server"
+)
+
+// ValidRole reports whether role is one of the roles known to the platform.
+func ValidRole(role string) bool {
+	switch role {
+	case RoleAdmin, RoleModerator, RoleGameServer:
+		return true
+	}
+	return false
+}
+
+// Scopes granted to roles in the role_scopes table.
+const (
+	ScopeAdminUsersRead      = "admin:users:read"
+	ScopeAdminSessionsRead   = "admin:sessions:read"
+	ScopeAdminBroadcast      = "admin:broadcast"
+	ScopeAdminRolesWrite     = "admin:roles:write"
+	ScopeAdminSanctionsWrite = "admin:sanctions:write"
+
+	ScopeAdminServiceAccountsWrite = "admin:service_accounts:write"
+	ScopeAdminMatchmakingRead      = "admin:matchmaking:read"
+)
+
+// Scopes that can be granted to service accounts for internal endpoints.
+const (
+	ScopeGatewaySend       = "gateway:send"
+	ScopeRouterRoute       = "router:route"
+	ScopeMatchResultsWrite = "matches:results:write"
+	ScopeFleetWrite        = "fleet:servers:write"
+)
+
+// ValidServiceScope reports whether scope may be granted to a service account.
+func ValidServiceScope(scope string) bool {
+	switch scope {
+	case ScopeGatewaySend, ScopeRouterRoute, ScopeMatchResultsWrite, ScopeFleetWrite:
+		return true
+	}
+	return false
+}
+
+// Principal kinds distinguish players and operators from machine callers.
+const (
+	KindUser    = "user"
+	KindService = "service"
+)
+
+var ErrUnauthenticated = errors.New("unauthenticated")
+
+// Principal is the authenticated caller carried in a token.
+type Principal struct {
+	Kind     string   `json:"kind"`
+	Subject  string   `json:"sub"`
+	Username string   `json:"username,omitempty"`
+	Roles    []string `json:"roles,omitempty"`
+	Scopes   []string `json:"scopes,omitempty"`
+	Guest    bool     `json:"guest,omitempty"`
+}
+
+func (p Principal) HasRole(role string) bool { return contains(p.Roles, role) }
+
+func (p Principal) HasScope(scope string) bool { return contains(p.Scopes, scope) }
+
+// AuditEntry attributes an administrative action to the principal that performed it.
+type AuditEntry struct {
+	ActorUserID   string
+	ActorRoles    []string
+	Action        string
+	Target        string
+	CorrelationID string
+}
+
+func NewAuditEntry(p Principal, action, target, correlationID string) AuditEntry {
+	return AuditEntry{ActorUserID: p.Subject, ActorRoles: p.Roles, Action: action, Target: target, CorrelationID: correlationID}
+}
+
+// Verifier turns a bearer token into a Principal.
+type Verifier interface {
+	ParsePrincipal(token string) (Principal, error)
+}
+
+// ServiceVerifier turns a machine bearer token into a service Principal.
+type ServiceVerifier interface {
+	ParseServicePrincipal(token string) (Principal, error)
+}
+
+// VerifierFunc adapts a parse function to the Verifier interface.
+type VerifierFunc func(token string) (Principal, error)
+
+func (f VerifierFunc) ParsePrincipal(token string) (Principal, error) { return f(token) }
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+func FromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// Require authenticates the bearer token and rejects callers missing any of the scopes.
+// The principal is stored on the request context for downstream handlers.
+func Require(verifier Verifier, scopes ...string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			p, err := Authenticate(verifier, r)
+			if err != nil {
+				apierror.Write(w, http.StatusUnauthorized, "unauthorized", "unauthorized")
+				return
+			}
+			for _, scope := range scopes {
+				if !p.HasScope(scope) {
+					apierror.Write(w, http.StatusForbidden, "forbidden", "missing scope "+scope)
+					return
+				}
+			}
+			next(w, r.WithContext(WithPrincipal(r.Context(), p)))
+		}
+	}
+}
+
+// RequireService is Require for internal endpoints: only machine tokens carrying the scopes are accepted.
+func RequireService(verifier ServiceVerifier, scopes ...string) func(http.HandlerFunc) http.HandlerFunc {
+	return Require(VerifierFunc(verifier.ParseServicePrincipal), scopes...)
+}
+
+// Authenticate parses the Authorization bearer token on the request.
+func Authenticate(verifier Verifier, r *http.Request) (Principal, error) {
+	auth := r.Header.Get("Authorization")
+	if auth == "" || !strings.HasPrefix(auth, "Bearer ") {
+		return Principal{}, ErrUnauthenticated
+	}
+	p, err := verifier.ParsePrincipal(strings.TrimPrefix(auth, "Bearer "))
+	if err != nil {
+		return Principal{}, err
+	}
+	if p.Subject == "" {
+		return Principal{}, ErrUnauthenticated
+	}
+	return p, nil
+}
+
+func contains(values []string, want string) bool {
+	for _, v := range values {
+		if v == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package authz
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/pkg/apierror"
+)
+
+type fakeVerifier map[string]Principal
+
+func (f fakeVerifier) ParsePrincipal(token string) (Principal, error) {
+	p, ok := f[token]
+	if !ok {
+		return Principal{}, errors.New("bad token")
+	}
+	return p, nil
+}
+
+func TestRequire(t *testing.T) {
+	t.Parallel()
+	verifier := fakeVerifier{
+		"admin":  {Subject: "u1", Roles: []string{RoleAdmin}, Scopes: []string{ScopeAdminUsersRead, ScopeAdminBroadcast}},
+		"player": {Subject: "u2"},
+	}
+	tests := []struct {
+		name   string
+		header string
+		code   int
+		err    string
+	}{
+		{name: "missing token", header: "", code: http.StatusUnauthorized, err: "unauthorized"},
+		{name: "invalid token", header: "Bearer nope", code: http.StatusUnauthorized, err: "unauthorized"},
+		{name: "missing scope", header: "Bearer player", code: http.StatusForbidden, err: "forbidden"},
+		{name: "granted", header: "Bearer admin", code: http.StatusNoContent},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			handler := Require(verifier, ScopeAdminUsersRead)(func(w http.ResponseWriter, r *http.Request) {
+				p, ok := FromContext(r.Context())
+				if !ok || p.Subject != "u1" {
+					t.Errorf("expected principal on context, got %+v", p)
+				}
+				w.WriteHeader(http.StatusNoContent)
+			})
+			req := httptest.NewRequest(http.MethodGet, "/admin/v1/users", nil)
+			if tc.header != "" {
+				req.Header.Set("Authorization", tc.header)
+			}
+			res := httptest.NewRecorder()
+			handler(res, req)
+			if res.Code != tc.code {
+				t.Fatalf("expected %d got %d", tc.code, res.Code)
+			}
+			if tc.err != "" {
+				var e apierror.Response
+				_ = json.Unmarshal(res.Body.Bytes(), &e)
+				if e.Code != tc.err {
+					t.Fatalf("expected code %s got %s", tc.err, e.Code)
+				}
+			}
+		})
+	}
+}
+
+type fakeServiceVerifier struct{}
+
+func (fakeServiceVerifier) ParseServicePrincipal(token string) (Principal, error) {
+	if token != "svc" {
+		return Principal{}, errors.New("not a service token")
+	}
+	return Principal{Kind: KindService, Subject: "matchmaking", Scopes: []string{ScopeGatewaySend}}, nil
+}
+
+func TestRequireService(t *testing.T) {
+	t.Parallel()
+	ok := RequireService(fakeServiceVerifier{}, ScopeGatewaySend)(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	})
+	denied := RequireService(fakeServiceVerifier{}, ScopeRouterRoute)(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	})
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		token   string
+		code    int
+	}{
+		{name: "service token", handler: ok, token: "svc", code: http.StatusAccepted},
+		{name: "user token rejected", handler: ok, token: "user", code: http.StatusUnauthorized},
+		{name: "scope missing", handler: denied, token: "svc", code: http.StatusForbidden},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			req := httptest.NewRequest(http.MethodPost, "/v1/send", nil)
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+			res := httptest.NewRecorder()
+			tc.handler(res, req)
+			if res.Code != tc.code {
+				t.Fatalf("expected %d got %d", tc.code, res.Code)
+			}
+		})
+	}
+}
@@ -12,19 +12,41 @@ type EventType string
 
 const (
 	EventUserLoggedIn        EventType = "user.logged_in"
+	EventUserLoginFailed     EventType = "user.login_failed"
+	EventUserUpdated         EventType = "user.updated"
+	EventUserDeleted         EventType = "user.deleted"
+	EventUserSanctioned      EventType = "user.sanctioned"
 	EventSessionCreated      EventType = "session.created"
 	EventSessionAssigned     EventType = "session.assigned_server"
+	EventSessionBackfill     EventType = "session.backfill_requested"
+	EventSessionMemberJoined EventType = "session.member_joined"
+	EventSessionServerLost   EventType = "session.server_lost"
+	EventSessionStatus       EventType = "session.status_changed"
 	EventMatchmakingEnqueued EventType = "matchmaking.enqueued"
 	EventMatchmakingMatched  EventType = "matchmaking.matched"
+	EventMatchmakingTimedOut EventType = "matchmaking.timed_out"
+	EventMatchmakingBackfill EventType = "matchmaking.backfilled"
+	EventMatchCompleted      EventType = "match.completed"
 	EventGatewaySendToUser   EventType = "gateway.send_to_user"
 )
 
 var validEventTypes = map[EventType]struct{}{
 	EventUserLoggedIn:        {},
+	EventUserLoginFailed:     {},
+	EventUserUpdated:         {},
+	EventUserDeleted:         {},
+	EventUserSanctioned:      {},
 	EventSessionCreated:      {},
 	EventSessionAssigned:     {},
+	EventSessionBackfill:     {},
+	EventSessionMemberJoined: {},
+	EventSessionServerLost:   {},
+	EventSessionStatus:       {},
 	EventMatchmakingEnqueued: {},
 	EventMatchmakingMatched:  {},
+	EventMatchmakingTimedOut: {},
+	EventMatchmakingBackfill: {},
+	EventMatchCompleted:      {},
 	EventGatewaySendToUser:   {},
 }
 
@@ -88,13 +110,93 @@ type UserLoggedInV1 struct {
 	AuthMethod string `json:"auth_method,omitempty"`
 }
 
+type UserLoginFailedV1 struct {
+	Username          string `json:"username"`
+	ClientIP          string `json:"client_ip,omitempty"`
+	Reason            string `json:"reason"`
+	FailureCount      int    `json:"failure_count,omitempty"`
+	RetryAfterSeconds int    `json:"retry_after_seconds,omitempty"`
+}
+
+// UserUpdatedV1 lists the profile fields that changed. PreviousUsername is set on username changes.
+type UserUpdatedV1 struct {
+	Fields           []string `json:"fields"`
+	Username         string   `json:"username,omitempty"`
+	PreviousUsername string   `json:"previous_username,omitempty"`
+}
+
+// UserDeletedV1 is published after an account is anonymized; consumers should drop any data they hold for the user.
+type UserDeletedV1 struct {
+	Reason string `json:"reason"`
+}
+
+// UserSanctionedV1 is published when a ban, suspension or mute is applied. Gateways disconnect the user
+// for bans and suspensions.
+type UserSanctionedV1 struct {
+	SanctionID string     `json:"sanction_id"`
+	Type       string     `json:"type"`
+	Reason     string     `json:"reason"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+}
+
 type SessionCreatedV1 struct {
 	SessionID string `json:"session_id"`
 }
 
+// SessionAssignedServerV1 names the game server hosting a session and where players connect to it.
+// MatchID is the match the session plays, if a match created it, and ServerOwner the subject of the
+// service account that registered the server, if it is a fleet server.
 type SessionAssignedServerV1 struct {
+	SessionID   string `json:"session_id"`
+	ServerID    string `json:"server_id"`
+	IP          string `json:"ip,omitempty"`
+	Port        int    `json:"port,omitempty"`
+	Region      string `json:"region,omitempty"`
+	MatchID     string `json:"match_id,omitempty"`
+	ServerOwner string `json:"server_owner,omitempty"`
+}
+
+// SessionBackfillRequestedV1 asks matchmaking to fill OpenSlots[i] more places on team i of a running
+// session. Members are the session's current players, so that nobody they blocked is brought in.
+type SessionBackfillRequestedV1 struct {
+	BackfillID string            `json:"backfill_id"`
+	SessionID  string            `json:"session_id"`
+	MatchID    string            `json:"match_id,omitempty"`
+	Queue      string            `json:"queue"`
+	Region     string            `json:"region,omitempty"`
+	OpenSlots  []int             `json:"open_slots"`
+	Members    []string          `json:"members"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// SessionMemberJoinedV1 is published when a player is added to a running session.
+type SessionMemberJoinedV1 struct {
+	SessionID  string `json:"session_id"`
+	Team       int    `json:"team"`
+	BackfillID string `json:"backfill_id,omitempty"`
+}
+
+// SessionServerLostV1 is published when a session's game server missed its heartbeats or reported
+// itself unhealthy. NewServerID and the address are the server the session moved to; they are empty
+// when no server could take it.
+type SessionServerLostV1 struct {
+	SessionID   string `json:"session_id"`
+	ServerID    string `json:"server_id"`
+	Reason      string `json:"reason"`
+	NewServerID string `json:"new_server_id,omitempty"`
+	IP          string `json:"ip,omitempty"`
+	Port        int    `json:"port,omitempty"`
+	Region      string `json:"region,omitempty"`
+}
+
+// SessionStatusChangedV1 is published on every step of a session's lifecycle after it was created.
+// Actor is the user or game server ("server:{id}") that caused it, or "system".
+type SessionStatusChangedV1 struct {
 	SessionID string `json:"session_id"`
-	ServerID  string `json:"server_id"`
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Actor     string `json:"actor"`
+	Reason    string `json:"reason,omitempty"`
 }
 
 type MatchmakingEnqueuedV1 struct {
@@ -102,10 +204,55 @@ type MatchmakingEnqueuedV1 struct {
 	Queue    string `json:"queue"`
 }
 
+// MatchmakingMatchedV1 lists every player in UserIDs; Teams splits the same players by team, in team order.
+// Region is where the players should play; it is empty when they reported no pings.
 type MatchmakingMatchedV1 struct {
-	MatchID    string   `json:"match_id"`
-	SessionIDs []string `json:"session_ids,omitempty"`
-	UserIDs    []string `json:"user_ids,omitempty"`
+	MatchID    string     `json:"match_id"`
+	Queue      string     `json:"queue,omitempty"`
+	Mode       string     `json:"mode,omitempty"`
+	Region     string     `json:"region,omitempty"`
+	SessionIDs []string   `json:"session_ids,omitempty"`
+	UserIDs    []string   `json:"user_ids,omitempty"`
+	Teams      [][]string `json:"teams,omitempty"`
+}
+
+// MatchmakingTimedOutV1 is published when a ticket waited longer than its queue's ticket timeout
+// without being matched.
+type MatchmakingTimedOutV1 struct {
+	TicketID      string `json:"ticket_id"`
+	Queue         string `json:"queue"`
+	WaitedSeconds int    `json:"waited_seconds"`
+}
+
+// MatchmakingBackfilledV1 is published when a queued ticket fills places on team Team of a session.
+type MatchmakingBackfilledV1 struct {
+	BackfillID string   `json:"backfill_id"`
+	SessionID  string   `json:"session_id"`
+	MatchID    string   `json:"match_id,omitempty"`
+	Queue      string   `json:"queue"`
+	TicketID   string   `json:"ticket_id"`
+	Team       int      `json:"team"`
+	UserIDs    []string `json:"user_ids"`
+}
+
+// MatchCompletedV1 is published once a game server has reported how a match ended and ratings have
+// been updated. WinningTeam indexes Teams and is absent for a draw.
+type MatchCompletedV1 struct {
+	MatchID       string                        `json:"match_id"`
+	Queue         string                        `json:"queue"`
+	Mode          string                        `json:"mode,omitempty"`
+	Teams         [][]string                    `json:"teams"`
+	WinningTeam   *int                          `json:"winning_team,omitempty"`
+	TeamScores    []float64                     `json:"team_scores,omitempty"`
+	PlayerStats   map[string]map[string]float64 `json:"player_stats,omitempty"`
+	RatingChanges []MatchRatingChangeV1         `json:"rating_changes,omitempty"`
+	ReportedBy    string                        `json:"reported_by"`
+}
+
+type MatchRatingChangeV1 struct {
+	UserID       string  `json:"user_id"`
+	RatingBefore float64 `json:"rating_before"`
+	RatingAfter  float64 `json:"rating_after"`
 }
 
 type GatewaySendToUserV1 struct {
@@ -119,18 +266,51 @@ func DecodeV1Payload(env Envelope) (any, error) {
 	case EventUserLoggedIn:
 		var payload UserLoggedInV1
 		return payload, json.Unmarshal(env.Payload, &payload)
+	case EventUserLoginFailed:
+		var payload UserLoginFailedV1
+		return payload, json.Unmarshal(env.Payload, &payload)
+	case EventUserUpdated:
+		var payload UserUpdatedV1
+		return payload, json.Unmarshal(env.Payload, &payload)
+	case EventUserDeleted:
+		var payload UserDeletedV1
+		return payload, json.Unmarshal(env.Payload, &payload)
+	case EventUserSanctioned:
+		var payload UserSanctionedV1
+		return payload, json.Unmarshal(env.Payload, &payload)
 	case EventSessionCreated:
 		var payload SessionCreatedV1
 		return payload, json.Unmarshal(env.Payload, &payload)
 	case EventSessionAssigned:
 		var payload SessionAssignedServerV1
 		return payload, json.Unmarshal(env.Payload, &payload)
+	case EventSessionBackfill:
+		var payload SessionBackfillRequestedV1
+		return payload, json.Unmarshal(env.Payload, &payload)
+	case EventSessionMemberJoined:
+		var payload SessionMemberJoinedV1
+		return payload, json.Unmarshal(env.Payload, &payload)
+	case EventSessionServerLost:
+		var payload SessionServerLostV1
+		return payload, json.Unmarshal(env.Payload, &payload)
+	case EventSessionStatus:
+		var payload SessionStatusChangedV1
+		return payload, json.Unmarshal(env.Payload, &payload)
 	case EventMatchmakingEnqueued:
 		var payload MatchmakingEnqueuedV1
 		return payload, json.Unmarshal(env.Payload, &payload)
 	case EventMatchmakingMatched:
 		var payload MatchmakingMatchedV1
 		return payload, json.Unmarshal(env.Payload, &payload)
+	case EventMatchmakingTimedOut:
+		var payload MatchmakingTimedOutV1
+		return payload, json.Unmarshal(env.Payload, &payload)
+	case EventMatchmakingBackfill:
+		var payload MatchmakingBackfilledV1
+		return payload, json.Unmarshal(env.Payload, &payload)
+	case EventMatchCompleted:
+		var payload MatchCompletedV1
+		return payload, json.Unmarshal(env.Payload, &payload)
 	case EventGatewaySendToUser:
 		var payload GatewaySendToUserV1
 		return payload, json.Unmarshal(env.Payload, &payload)
@@ -141,12 +321,23 @@ func DecodeV1Payload(env Envelope) (any, error) {
 
 // NATS subject mapping.
 const (
-	SubjectUserLoggedIn      = "pcgb.user.logged_in"
-	SubjectSessionCreated    = "pcgb.session.created"
-	SubjectSessionAssigned   = "pcgb.session.assigned_server"
-	SubjectMatchmakingQueued = "pcgb.mm.enqueued"
-	SubjectMatchmakingMatch  = "pcgb.mm.matched"
-	SubjectGatewaySendToUser = "pcgb.gateway.send_to_user"
+	SubjectUserLoggedIn        = "pcgb.user.logged_in"
+	SubjectUserLoginFailed     = "pcgb.user.login_failed"
+	SubjectUserUpdated         = "pcgb.user.updated"
+	SubjectUserDeleted         = "pcgb.user.deleted"
+	SubjectUserSanctioned      = "pcgb.user.sanctioned"
+	SubjectSessionCreated      = "pcgb.session.created"
+	SubjectSessionAssigned     = "pcgb.session.assigned_server"
+	SubjectSessionBackfill     = "pcgb.session.backfill_requested"
+	SubjectSessionMemberJoined = "pcgb.session.member_joined"
+	SubjectSessionServerLost   = "pcgb.session.server_lost"
+	SubjectSessionStatus       = "pcgb.session.status_changed"
+	SubjectMatchmakingQueued   = "pcgb.mm.enqueued"
+	SubjectMatchmakingMatch    = "pcgb.mm.matched"
+	SubjectMatchmakingTimedOut = "pcgb.mm.timed_out"
+	SubjectMatchmakingBackfill = "pcgb.mm.backfilled"
+	SubjectMatchCompleted      = "pcgb.match.completed"
+	SubjectGatewaySendToUser   = "pcgb.gateway.send_to_user"
 )
 
 // SubjectForType maps a contract event type to its NATS subject.
@@ -154,14 +345,36 @@ func SubjectForType(eventType EventType) (string, error) {
 	switch eventType {
 	case EventUserLoggedIn:
 		return SubjectUserLoggedIn, nil
+	case EventUserLoginFailed:
+		return SubjectUserLoginFailed, nil
+	case EventUserUpdated:
+		return SubjectUserUpdated, nil
+	case EventUserDeleted:
+		return SubjectUserDeleted, nil
+	case EventUserSanctioned:
+		return SubjectUserSanctioned, nil
 	case EventSessionCreated:
 		return SubjectSessionCreated, nil
 	case EventSessionAssigned:
 		return SubjectSessionAssigned, nil
+	case EventSessionBackfill:
+		return SubjectSessionBackfill, nil
+	case EventSessionMemberJoined:
+		return SubjectSessionMemberJoined, nil
+	case EventSessionServerLost:
+		return SubjectSessionServerLost, nil
+	case EventSessionStatus:
+		return SubjectSessionStatus, nil
 	case EventMatchmakingEnqueued:
 		return SubjectMatchmakingQueued, nil
 	case EventMatchmakingMatched:
 		return SubjectMatchmakingMatch, nil
+	case EventMatchmakingTimedOut:
+		return SubjectMatchmakingTimedOut, nil
+	case EventMatchmakingBackfill:
+		return SubjectMatchmakingBackfill, nil
+	case EventMatchCompleted:
+		return SubjectMatchCompleted, nil
 	case EventGatewaySendToUser:
 		return SubjectGatewaySendToUser, nil
 	default:
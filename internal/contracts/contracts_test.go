@@ -40,16 +40,29 @@ func TestMarshalRoundTripAllV1Types(t *testing.T) {
 	t.Parallel()
 	ts := time.Now().UTC().Round(time.Second)
 	userID := "user-123"
+	winner := 0
 	tests := []struct {
 		name    string
 		typ     EventType
 		payload any
 	}{
 		{"user", EventUserLoggedIn, UserLoggedInV1{AuthMethod: "steam"}},
+		{"login failed", EventUserLoginFailed, UserLoginFailedV1{Username: "alice", ClientIP: "10.0.0.1", Reason: "invalid_credentials", FailureCount: 3}},
+		{"user updated", EventUserUpdated, UserUpdatedV1{Fields: []string{"username"}, Username: "alice2", PreviousUsername: "alice"}},
+		{"user deleted", EventUserDeleted, UserDeletedV1{Reason: "self_service"}},
+		{"user sanctioned", EventUserSanctioned, UserSanctionedV1{SanctionID: "sn-1", Type: "suspension", Reason: "toxicity", ExpiresAt: &ts}},
 		{"session created", EventSessionCreated, SessionCreatedV1{SessionID: "s-1"}},
-		{"session assigned", EventSessionAssigned, SessionAssignedServerV1{SessionID: "s-1", ServerID: "srv-1"}},
+		{"session assigned", EventSessionAssigned, SessionAssignedServerV1{SessionID: "s-1", ServerID: "srv-1", IP: "10.0.1.5", Port: 7777, Region: "eu-west"}},
+		{"backfill requested", EventSessionBackfill, SessionBackfillRequestedV1{BackfillID: "bf-1", SessionID: "s-1", MatchID: "m-1", Queue: "squads", Region: "eu-west", OpenSlots: []int{0, 1}, Members: []string{"u-1", "u-2", "u-3"}}},
+		{"member joined", EventSessionMemberJoined, SessionMemberJoinedV1{SessionID: "s-1", Team: 1, BackfillID: "bf-1"}},
+		{"server lost", EventSessionServerLost, SessionServerLostV1{SessionID: "s-1", ServerID: "gs-eu-1", Reason: "heartbeat_missed", NewServerID: "gs-eu-2", IP: "10.0.1.6", Port: 7777, Region: "eu-west"}},
+		{"status changed", EventSessionStatus, SessionStatusChangedV1{SessionID: "s-1", From: "ready", To: "in_progress", Actor: "server:gs-eu-1"}},
 		{"queue", EventMatchmakingEnqueued, MatchmakingEnqueuedV1{TicketID: "t-1", Queue: "ranked"}},
 		{"matched", EventMatchmakingMatched, MatchmakingMatchedV1{MatchID: "m-1", UserIDs: []string{"u-1", "u-2"}}},
+		{"matched teams", EventMatchmakingMatched, MatchmakingMatchedV1{MatchID: "m-2", Queue: "squads", Mode: "battle", UserIDs: []string{"u-1", "u-2", "u-3", "u-4"}, Teams: [][]string{{"u-1", "u-3"}, {"u-2", "u-4"}}}},
+		{"backfilled", EventMatchmakingBackfill, MatchmakingBackfilledV1{BackfillID: "bf-1", SessionID: "s-1", MatchID: "m-1", Queue: "squads", TicketID: "t-5", Team: 1, UserIDs: []string{"u-5"}}},
+		{"timed out", EventMatchmakingTimedOut, MatchmakingTimedOutV1{TicketID: "t-1", Queue: "ranked", WaitedSeconds: 300}},
+		{"match completed", EventMatchCompleted, MatchCompletedV1{MatchID: "m-1", Queue: "duel", Mode: "duel", Teams: [][]string{{"u-1"}, {"u-2"}}, WinningTeam: &winner, TeamScores: []float64{16, 9}, PlayerStats: map[string]map[string]float64{"u-1": {"kills": 12}}, RatingChanges: []MatchRatingChangeV1{{UserID: "u-1", RatingBefore: 1500, RatingAfter: 1662.3}}, ReportedBy: "gs-eu-1"}},
 		{"send", EventGatewaySendToUser, GatewaySendToUserV1{TargetUserID: "u-1", Message: json.RawMessage(`{"op":"notify"}`)}},
 	}
 	for _, tt := range tests {
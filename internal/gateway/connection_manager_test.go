@@ -1,11 +1,21 @@
 package gateway
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"sync"
 	"testing"
+	"time"
+
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/login"
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/sanctions"
+	"github.com/rs/zerolog"
 )
 
 func TestSendToUserOffline(t *testing.T) {
@@ -37,3 +47,66 @@ func TestSendToUserOnlineAndConcurrent(t *testing.T) {
 	}
 	wg.Wait()
 }
+
+func TestDisconnectClosesConnection(t *testing.T) {
+	t.Parallel()
+	server, client := net.Pipe()
+	defer func() { _ = client.Close() }()
+
+	received := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(server)
+		received <- data
+	}()
+	s := &userSender{conns: map[string]*clientConn{"u1": {conn: &wsConn{netConn: client}}}}
+	if err := s.Disconnect("u1", json.RawMessage(`{"type":"sanctioned"}`), "account sanctioned"); err != nil {
+		t.Fatal(err)
+	}
+	// Server frames are unmasked: a text frame with a short payload, then a close frame.
+	data := <-received
+	if len(data) < 2 || data[0] != 0x80|opcodeText {
+		t.Fatalf("expected a text frame first, got % x", data)
+	}
+	next := 2 + int(data[1])
+	if len(data) <= next || data[next] != 0x80|opcodeClose {
+		t.Fatalf("expected a close frame after the notice, got % x", data)
+	}
+	if err := s.Disconnect("missing", nil, ""); err != ErrUserNotConnected {
+		t.Fatalf("expected ErrUserNotConnected, got %v", err)
+	}
+}
+
+type fakeChecker struct {
+	sanction *sanctions.Sanction
+	err      error
+}
+
+func (f fakeChecker) Blocking(context.Context, string) (*sanctions.Sanction, error) {
+	return f.sanction, f.err
+}
+
+func TestConnectRefusedWhenSanctioned(t *testing.T) {
+	t.Parallel()
+	auth := login.NewAuthenticator("test-secret", time.Hour)
+	token, err := auth.GenerateToken("u1", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewSender("gw-1", zerolog.Nop(), nil, auth).WithSanctionChecker(fakeChecker{sanction: &sanctions.Sanction{Type: sanctions.TypeBan, Reason: "cheating"}})
+	mux := http.NewServeMux()
+	s.Register(mux)
+	res := httptest.NewRecorder()
+	mux.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/v1/ws?token="+token, nil))
+	if res.Code != http.StatusForbidden || !strings.Contains(res.Body.String(), "account_banned") {
+		t.Fatalf("expected 403 account_banned, got %d %s", res.Code, res.Body.String())
+	}
+
+	unchecked := NewSender("gw-1", zerolog.Nop(), nil, auth).WithSanctionChecker(fakeChecker{err: errors.New("redis down")})
+	mux = http.NewServeMux()
+	unchecked.Register(mux)
+	res = httptest.NewRecorder()
+	mux.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/v1/ws?token="+token, nil))
+	if res.Code != http.StatusServiceUnavailable || !strings.Contains(res.Body.String(), "sanctions_unavailable") {
+		t.Fatalf("expected 503 sanctions_unavailable, got %d %s", res.Code, res.Body.String())
+	}
+}
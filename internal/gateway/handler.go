@@ -9,6 +9,8 @@ import (
 	"sync"
 	"time"
 
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/authz"
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/sanctions"
 	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/pkg/apierror"
 	"github.com/redis/go-redis/v9"
 	"github.com/rs/zerolog"
@@ -20,10 +22,14 @@ const (
 	writeWait               = 10 * time.Second
 	pongWait                = 70 * time.Second
 	pingPeriod              = 25 * time.Second
+
+	// closePolicyViolation is the WebSocket close code sent when a sanctioned user is disconnected.
+	closePolicyViolation = 1008
 )
 
 type TokenParser interface {
 	ParseToken(token string) (string, string, error)
+	ParseServicePrincipal(token string) (authz.Principal, error)
 }
 
 type SendRequest struct {
@@ -36,6 +42,7 @@ type userSender struct {
 	logger     zerolog.Logger
 	redis      *redis.Client
 	parser     TokenParser
+	sanctions  sanctions.Checker
 
 	presenceTTL      time.Duration
 	presenceInterval time.Duration
@@ -53,6 +60,13 @@ func NewSender(instanceID string, logger zerolog.Logger, redisClient *redis.Clie
 	return &userSender{instanceID: instanceID, logger: logger, redis: redisClient, parser: parser, presenceTTL: defaultPresenceTTL, presenceInterval: defaultPresenceInterval, conns: make(map[string]*clientConn)}
 }
 
+// WithSanctionChecker refuses connections from banned or suspended users, and all connections while
+// sanctions cannot be checked.
+func (s *userSender) WithSanctionChecker(c sanctions.Checker) *userSender {
+	s.sanctions = c
+	return s
+}
+
 func (s *userSender) Register(mux *http.ServeMux) {
 	mux.HandleFunc("/v1/ws", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
@@ -70,6 +84,20 @@ func (s *userSender) Register(mux *http.ServeMux) {
 			apierror.Write(w, http.StatusUnauthorized, "unauthorized", "invalid token")
 			return
 		}
+		if s.sanctions != nil {
+			sanction, err := s.sanctions.Blocking(r.Context(), userID)
+			switch {
+			case err != nil:
+				// Like matchmaking, refuse rather than let a possibly banned player in.
+				s.logger.Warn().Err(err).Str("user_id", userID).Msg("sanction check failed")
+				apierror.Write(w, http.StatusServiceUnavailable, "sanctions_unavailable", sanctions.ErrUnavailable.Error())
+				return
+			case sanction != nil:
+				sanctionErr := &sanctions.Error{Sanction: *sanction}
+				apierror.Write(w, http.StatusForbidden, sanctionErr.Code(), sanctionErr.Error())
+				return
+			}
+		}
 
 		conn, err := upgradeWebSocket(w, r)
 		if err != nil {
@@ -79,7 +107,7 @@ func (s *userSender) Register(mux *http.ServeMux) {
 		s.handleConnection(r.Context(), userID, conn)
 	})
 
-	mux.HandleFunc("/v1/send", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/v1/send", authz.RequireService(s.parser, authz.ScopeGatewaySend)(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			apierror.Write(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
 			return
@@ -102,7 +130,7 @@ func (s *userSender) Register(mux *http.ServeMux) {
 			return
 		}
 		w.WriteHeader(http.StatusAccepted)
-	})
+	}))
 }
 
 func (s *userSender) handleConnection(reqCtx context.Context, userID string, conn *wsConn) {
@@ -209,4 +237,22 @@ func (s *userSender) SendToUser(userID string, message json.RawMessage) error {
 	return cc.conn.WriteText(message)
 }
 
+// Disconnect sends notice to the user, if connected here, and closes the connection.
+func (s *userSender) Disconnect(userID string, notice json.RawMessage, reason string) error {
+	s.mu.RLock()
+	cc, ok := s.conns[userID]
+	s.mu.RUnlock()
+	if !ok {
+		return ErrUserNotConnected
+	}
+
+	cc.mu.Lock()
+	_ = cc.conn.SetWriteDeadline(time.Now().Add(writeWait))
+	_ = cc.conn.WriteText(notice)
+	_ = cc.conn.WriteClose(closePolicyViolation, reason)
+	cc.mu.Unlock()
+	// Closing the socket ends the read loop, which removes the connection and its presence key.
+	return cc.conn.Close()
+}
+
 func presenceKey(userID string) string { return "pcgb:gateway:user:" + userID }
@@ -6,6 +6,7 @@ import (
 
 	"github.com/nats-io/nats.go"
 	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/contracts"
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/sanctions"
 	"github.com/rs/zerolog"
 )
 
@@ -54,4 +55,77 @@ func decodeSendToUser(data []byte) (string, json.RawMessage, error) {
 	return payload.TargetUserID, payload.Message, nil
 }
 
-var ErrInvalidMessage = errors.New("invalid gateway send_to_user message")
+// SubscribeSanctions disconnects users as soon as a ban or suspension is applied. Every gateway
+// instance receives the event; only the one holding the connection acts on it.
+func SubscribeSanctions(nc *nats.Conn, logger zerolog.Logger, sender *userSender) (*nats.Subscription, error) {
+	return nc.Subscribe(contracts.SubjectUserSanctioned, func(msg *nats.Msg) {
+		userID, notice, ok, err := decodeSanctioned(msg.Data)
+		if err != nil {
+			logger.Warn().Err(err).Msg("invalid nats user.sanctioned payload")
+			return
+		}
+		if !ok {
+			return
+		}
+		if err := sender.Disconnect(userID, notice, "account sanctioned"); err != nil && !errors.Is(err, ErrUserNotConnected) {
+			logger.Warn().Err(err).Str("user_id", userID).Msg("failed to disconnect sanctioned user")
+		}
+	})
+}
+
+// decodeSanctioned returns the user to disconnect and the notice to send them. ok is false for
+// sanctions, such as mutes, that do not end the connection.
+func decodeSanctioned(data []byte) (string, json.RawMessage, bool, error) {
+	env, err := contracts.UnmarshalEnvelope(data)
+	if err != nil {
+		return "", nil, false, err
+	}
+	if env.Type != contracts.EventUserSanctioned || env.UserID == nil || *env.UserID == "" {
+		return "", nil, false, ErrInvalidSanctionEvent
+	}
+	var payload contracts.UserSanctionedV1
+	if err := json.Unmarshal(env.Payload, &payload); err != nil {
+		return "", nil, false, err
+	}
+	if !(sanctions.Sanction{Type: payload.Type}).BlocksAccess() {
+		return "", nil, false, nil
+	}
+	notice, err := json.Marshal(map[string]any{"type": "sanctioned", "sanction_type": payload.Type, "reason": payload.Reason, "expires_at": payload.ExpiresAt})
+	if err != nil {
+		return "", nil, false, err
+	}
+	return *env.UserID, notice, true, nil
+}
+
+// SubscribeDeletions disconnects users whose account was deleted. Like SubscribeSanctions, only the
+// instance holding the connection acts on the event.
+func SubscribeDeletions(nc *nats.Conn, logger zerolog.Logger, sender *userSender) (*nats.Subscription, error) {
+	return nc.Subscribe(contracts.SubjectUserDeleted, func(msg *nats.Msg) {
+		userID, err := decodeDeleted(msg.Data)
+		if err != nil {
+			logger.Warn().Err(err).Msg("invalid nats user.deleted payload")
+			return
+		}
+		notice := json.RawMessage(`{"type":"account_deleted"}`)
+		if err := sender.Disconnect(userID, notice, "account deleted"); err != nil && !errors.Is(err, ErrUserNotConnected) {
+			logger.Warn().Err(err).Str("user_id", userID).Msg("failed to disconnect deleted user")
+		}
+	})
+}
+
+func decodeDeleted(data []byte) (string, error) {
+	env, err := contracts.UnmarshalEnvelope(data)
+	if err != nil {
+		return "", err
+	}
+	if env.Type != contracts.EventUserDeleted || env.UserID == nil || *env.UserID == "" {
+		return "", ErrInvalidDeletedEvent
+	}
+	return *env.UserID, nil
+}
+
+var (
+	ErrInvalidMessage       = errors.New("invalid gateway send_to_user message")
+	ErrInvalidSanctionEvent = errors.New("invalid user.sanctioned event")
+	ErrInvalidDeletedEvent  = errors.New("invalid user.deleted event")
+)
@@ -2,6 +2,7 @@ package gateway
 
 import (
 	"encoding/json"
+	"strings"
 	"testing"
 	"time"
 
@@ -42,3 +43,43 @@ func TestDecodeSendToUserEnvelope(t *testing.T) {
 		t.Fatalf("payload mismatch: %s", payload)
 	}
 }
+
+func TestDecodeSanctioned(t *testing.T) {
+	t.Parallel()
+	userID := "u3"
+	for _, tc := range []struct {
+		typ        string
+		disconnect bool
+	}{{"ban", true}, {"suspension", true}, {"mute", false}} {
+		raw, err := contracts.MarshalV1("id1", contracts.EventUserSanctioned, time.Now().UTC(), "corr", &userID, contracts.UserSanctionedV1{SanctionID: "sn-1", Type: tc.typ, Reason: "cheating"})
+		if err != nil {
+			t.Fatalf("marshal envelope: %v", err)
+		}
+		uid, notice, ok, err := decodeSanctioned(raw)
+		if err != nil || ok != tc.disconnect {
+			t.Fatalf("%s: expected disconnect=%v, got %v (%v)", tc.typ, tc.disconnect, ok, err)
+		}
+		if ok && (uid != "u3" || !strings.Contains(string(notice), `"type":"sanctioned"`)) {
+			t.Fatalf("%s: unexpected result %q %s", tc.typ, uid, notice)
+		}
+	}
+}
+
+func TestDecodeDeleted(t *testing.T) {
+	t.Parallel()
+	userID := "u4"
+	raw, err := contracts.MarshalV1("id1", contracts.EventUserDeleted, time.Now().UTC(), "corr", &userID, contracts.UserDeletedV1{})
+	if err != nil {
+		t.Fatalf("marshal envelope: %v", err)
+	}
+	if uid, err := decodeDeleted(raw); err != nil || uid != "u4" {
+		t.Fatalf("expected u4, got %q (%v)", uid, err)
+	}
+	raw, err = contracts.MarshalV1("id2", contracts.EventUserDeleted, time.Now().UTC(), "corr", nil, contracts.UserDeletedV1{})
+	if err != nil {
+		t.Fatalf("marshal envelope: %v", err)
+	}
+	if _, err := decodeDeleted(raw); err != ErrInvalidDeletedEvent {
+		t.Fatalf("expected ErrInvalidDeletedEvent without a user, got %v", err)
+	}
+}
@@ -107,6 +107,16 @@ func (c *wsConn) WritePing(payload []byte) error {
 	return c.writeFrame(opcodePing, payload)
 }
 
+// WriteClose sends a close frame with a status code and a reason of at most 123 bytes.
+func (c *wsConn) WriteClose(code uint16, reason string) error {
+	if len(reason) > 123 {
+		reason = reason[:123]
+	}
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, code)
+	return c.writeFrame(opcodeClose, append(payload, reason...))
+}
+
 func (c *wsConn) writeFrame(op byte, payload []byte) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -9,6 +9,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/authz"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -17,21 +18,47 @@ var ErrInvalidToken = errors.New("invalid token")
 type Authenticator struct {
 	secret []byte
 	ttl    time.Duration
+	cost   int
 }
 
+// Token types carried in the typ claim. An empty typ is a user token issued before typ existed.
+const (
+	tokenTypeUser    = "user"
+	tokenTypeService = "service"
+	tokenTypeMFA     = "mfa"
+)
+
 type tokenClaims struct {
-	Sub      string `json:"sub"`
-	Username string `json:"username"`
-	Iat      int64  `json:"iat"`
-	Exp      int64  `json:"exp"`
+	Typ      string   `json:"typ,omitempty"`
+	Sub      string   `json:"sub"`
+	Username string   `json:"username"`
+	Roles    []string `json:"roles,omitempty"`
+	Scopes   []string `json:"scopes,omitempty"`
+	Guest    bool     `json:"guest,omitempty"`
+	Amr      string   `json:"amr,omitempty"` // first-factor method, set on MFA challenge tokens
+	Iat      int64    `json:"iat"`
+	Exp      int64    `json:"exp"`
 }
 
 func NewAuthenticator(secret string, ttl time.Duration) *Authenticator {
-	return &Authenticator{secret: []byte(secret), ttl: ttl}
+	return &Authenticator{secret: []byte(secret), ttl: ttl, cost: bcrypt.DefaultCost}
+}
+
+// WithBcryptCost sets the cost for new password hashes, clamped to the range bcrypt accepts.
+// Existing hashes with a lower cost are upgraded on the user's next successful login.
+func (a *Authenticator) WithBcryptCost(cost int) *Authenticator {
+	switch {
+	case cost < bcrypt.MinCost:
+		cost = bcrypt.MinCost
+	case cost > bcrypt.MaxCost:
+		cost = bcrypt.MaxCost
+	}
+	a.cost = cost
+	return a
 }
 
 func (a *Authenticator) HashPassword(password string) (string, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), a.cost)
 	if err != nil {
 		return "", err
 	}
@@ -42,11 +69,52 @@ func (a *Authenticator) VerifyPassword(hash, password string) error {
 	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 }
 
+// NeedsRehash reports whether hash was produced with a lower cost than the current setting.
+func (a *Authenticator) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err == nil && cost < a.cost
+}
+
 func (a *Authenticator) GenerateToken(userID, username string) (string, error) {
-	header := map[string]string{"alg": "HS256", "typ": "JWT"}
+	return a.GeneratePrincipalToken(authz.Principal{Subject: userID, Username: username})
+}
+
+// GeneratePrincipalToken issues a token embedding the principal's roles and scopes.
+func (a *Authenticator) GeneratePrincipalToken(p authz.Principal) (string, error) {
+	now := time.Now().UTC()
+	claims := tokenClaims{Typ: tokenTypeUser, Sub: p.Subject, Username: p.Username, Roles: p.Roles, Scopes: p.Scopes, Guest: p.Guest, Iat: now.Unix(), Exp: now.Add(a.ttl).Unix()}
+	return a.encode(claims)
+}
+
+// GenerateServiceToken issues a machine token for a service account.
+func (a *Authenticator) GenerateServiceToken(clientID string, scopes []string, ttl time.Duration) (string, error) {
+	now := time.Now().UTC()
+	claims := tokenClaims{Typ: tokenTypeService, Sub: clientID, Scopes: scopes, Iat: now.Unix(), Exp: now.Add(ttl).Unix()}
+	return a.encode(claims)
+}
+
+// GenerateMFAChallenge issues a short-lived token proving the first factor was accepted. It is only
+// accepted by the second login step, never as a session token.
+func (a *Authenticator) GenerateMFAChallenge(userID, username, authMethod string, ttl time.Duration) (string, error) {
 	now := time.Now().UTC()
-	claims := tokenClaims{Sub: userID, Username: username, Iat: now.Unix(), Exp: now.Add(a.ttl).Unix()}
+	claims := tokenClaims{Typ: tokenTypeMFA, Sub: userID, Username: username, Amr: authMethod, Iat: now.Unix(), Exp: now.Add(ttl).Unix()}
+	return a.encode(claims)
+}
 
+// ParseMFAChallenge returns the user and primary auth method of a challenge token.
+func (a *Authenticator) ParseMFAChallenge(token string) (string, string, error) {
+	claims, err := a.parseClaims(token)
+	if err != nil {
+		return "", "", err
+	}
+	if claims.Typ != tokenTypeMFA {
+		return "", "", ErrInvalidToken
+	}
+	return claims.Sub, claims.Amr, nil
+}
+
+func (a *Authenticator) encode(claims tokenClaims) (string, error) {
+	header := map[string]string{"alg": "HS256", "typ": "JWT"}
 	headerRaw, err := json.Marshal(header)
 	if err != nil {
 		return "", err
@@ -63,28 +131,60 @@ func (a *Authenticator) GenerateToken(userID, username string) (string, error) {
 }
 
 func (a *Authenticator) ParseToken(token string) (string, string, error) {
+	p, err := a.ParsePrincipal(token)
+	if err != nil {
+		return "", "", err
+	}
+	return p.Subject, p.Username, nil
+}
+
+// ParsePrincipal verifies the token and returns the caller with its roles and scopes.
+func (a *Authenticator) ParsePrincipal(token string) (authz.Principal, error) {
+	claims, err := a.parseClaims(token)
+	if err != nil {
+		return authz.Principal{}, err
+	}
+	if (claims.Typ != "" && claims.Typ != tokenTypeUser) || claims.Username == "" {
+		return authz.Principal{}, ErrInvalidToken
+	}
+	return authz.Principal{Kind: authz.KindUser, Subject: claims.Sub, Username: claims.Username, Roles: claims.Roles, Scopes: claims.Scopes, Guest: claims.Guest}, nil
+}
+
+// ParseServicePrincipal verifies a machine token; user tokens are rejected.
+func (a *Authenticator) ParseServicePrincipal(token string) (authz.Principal, error) {
+	claims, err := a.parseClaims(token)
+	if err != nil {
+		return authz.Principal{}, err
+	}
+	if claims.Typ != tokenTypeService {
+		return authz.Principal{}, ErrInvalidToken
+	}
+	return authz.Principal{Kind: authz.KindService, Subject: claims.Sub, Scopes: claims.Scopes}, nil
+}
+
+func (a *Authenticator) parseClaims(token string) (tokenClaims, error) {
 	parts := strings.Split(token, ".")
 	if len(parts) != 3 {
-		return "", "", ErrInvalidToken
+		return tokenClaims{}, ErrInvalidToken
 	}
 
 	expected := a.sign(parts[0] + "." + parts[1])
 	if !hmac.Equal([]byte(expected), []byte(parts[2])) {
-		return "", "", ErrInvalidToken
+		return tokenClaims{}, ErrInvalidToken
 	}
 
 	claimsBytes, err := base64.RawURLEncoding.DecodeString(parts[1])
 	if err != nil {
-		return "", "", ErrInvalidToken
+		return tokenClaims{}, ErrInvalidToken
 	}
 	var claims tokenClaims
 	if err := json.Unmarshal(claimsBytes, &claims); err != nil {
-		return "", "", ErrInvalidToken
+		return tokenClaims{}, ErrInvalidToken
 	}
-	if claims.Sub == "" || claims.Username == "" || claims.Exp < time.Now().UTC().Unix() {
-		return "", "", ErrInvalidToken
+	if claims.Sub == "" || claims.Exp < time.Now().UTC().Unix() {
+		return tokenClaims{}, ErrInvalidToken
 	}
-	return claims.Sub, claims.Username, nil
+	return claims, nil
 }
 
 func (a *Authenticator) sign(payload string) string {
@@ -31,3 +31,21 @@ func TestHashVerifyAndToken(t *testing.T) {
 		t.Fatalf("unexpected claims: %s %s", userID, username)
 	}
 }
+
+func TestUserAndServiceTokensAreNotInterchangeable(t *testing.T) {
+	auth := NewAuthenticator("test-secret", time.Hour)
+	userToken, err := auth.GenerateToken("u1", "alice")
+	if err != nil {
+		t.Fatalf("GenerateToken error: %v", err)
+	}
+	if _, err := auth.ParseServicePrincipal(userToken); err == nil {
+		t.Fatal("expected user token to be rejected as a service token")
+	}
+	serviceToken, err := auth.GenerateServiceToken("router", []string{"gateway:send"}, time.Minute)
+	if err != nil {
+		t.Fatalf("GenerateServiceToken error: %v", err)
+	}
+	if _, err := auth.ParsePrincipal(serviceToken); err == nil {
+		t.Fatal("expected service token to be rejected as a user token")
+	}
+}
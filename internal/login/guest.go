@@ -0,0 +1,94 @@
+package login
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// GuestLogin signs in the guest bound to the device, creating one on first use.
+func (s *Service) GuestLogin(ctx context.Context, req GuestLoginRequest, correlationID string) (LoginResponse, error) {
+	if err := req.Validate(); err != nil {
+		return LoginResponse{}, err
+	}
+	var err error
+	if correlationID == "" {
+		correlationID, err = newUUID()
+		if err != nil {
+			return LoginResponse{}, err
+		}
+	}
+
+	deviceHash := hashDeviceID(req.DeviceID)
+	user, err := s.repo.GetByDevice(ctx, deviceHash)
+	if errors.Is(err, ErrUserNotFound) {
+		var username string
+		username, err = newGuestUsername()
+		if err != nil {
+			return LoginResponse{}, err
+		}
+		user, err = s.repo.CreateGuest(ctx, username, deviceHash)
+	}
+	if err != nil {
+		return LoginResponse{}, err
+	}
+	if err := s.checkSanctions(ctx, user.ID); err != nil {
+		return LoginResponse{}, err
+	}
+
+	token, err := s.auth.GeneratePrincipalToken(principalFor(user, Grants{}))
+	if err != nil {
+		return LoginResponse{}, err
+	}
+	if err := s.publishLoggedInWith(correlationID, user, "guest"); err != nil {
+		return LoginResponse{}, err
+	}
+	return LoginResponse{Token: token, User: mapUser(user, Grants{})}, nil
+}
+
+// UpgradeGuest turns a guest into a regular account with a username and password. The user ID is
+// unchanged so sessions and history carry over; the returned token replaces the guest token. Sanctioned
+// guests cannot upgrade, and the token is issued as for any login without a second factor.
+func (s *Service) UpgradeGuest(ctx context.Context, userID string, req UpgradeGuestRequest, correlationID string) (LoginResponse, error) {
+	if err := req.Validate(); err != nil {
+		return LoginResponse{}, err
+	}
+	if err := s.checkSanctions(ctx, userID); err != nil {
+		return LoginResponse{}, err
+	}
+	hash, err := s.auth.HashPassword(req.Password)
+	if err != nil {
+		return LoginResponse{}, err
+	}
+	user, err := s.repo.UpgradeGuest(ctx, userID, strings.TrimSpace(req.Username), hash)
+	if err != nil {
+		return LoginResponse{}, err
+	}
+	grants, err := s.repo.GetGrants(ctx, user.ID)
+	if err != nil {
+		return LoginResponse{}, err
+	}
+	if correlationID == "" {
+		correlationID, err = newUUID()
+		if err != nil {
+			return LoginResponse{}, err
+		}
+	}
+	return s.issueSession(correlationID, user, grants, "guest_upgrade", false)
+}
+
+// hashDeviceID keeps raw device identifiers out of the database.
+func hashDeviceID(deviceID string) string {
+	sum := sha256.Sum256([]byte(deviceID))
+	return hex.EncodeToString(sum[:])
+}
+
+func newGuestUsername() (string, error) {
+	id, err := newUUID()
+	if err != nil {
+		return "", err
+	}
+	return "guest-" + strings.ReplaceAll(id, "-", "")[:12], nil
+}
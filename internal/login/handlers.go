@@ -4,9 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
 
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/authz"
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/sanctions"
 	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/pkg/apierror"
 )
 
@@ -16,6 +20,27 @@ type LoginService interface {
 	Login(ctx context.Context, req LoginRequest, correlationID string) (LoginResponse, error)
 	Me(ctx context.Context, userID string) (UserProfile, error)
 	ParseToken(token string) (string, string, error)
+	ParsePrincipal(token string) (authz.Principal, error)
+	GrantRole(ctx context.Context, actor authz.Principal, userID, role, correlationID string) error
+	RevokeRole(ctx context.Context, actor authz.Principal, userID, role, correlationID string) error
+	IssueServiceToken(ctx context.Context, clientID, clientSecret string, scopes []string) (ServiceTokenResponse, error)
+	CreateServiceAccount(ctx context.Context, actor authz.Principal, req CreateServiceAccountRequest, correlationID string) (CreateServiceAccountResponse, error)
+	GuestLogin(ctx context.Context, req GuestLoginRequest, correlationID string) (LoginResponse, error)
+	UpgradeGuest(ctx context.Context, userID string, req UpgradeGuestRequest, correlationID string) (LoginResponse, error)
+	StartOIDC(ctx context.Context, provider, linkUserID string) (OIDCStartResponse, error)
+	CompleteOIDC(ctx context.Context, provider, code, state, correlationID string) (LoginResponse, error)
+	UpdateProfile(ctx context.Context, caller authz.Principal, req UpdateProfileRequest, correlationID string) (UpdateProfileResponse, error)
+	DeleteAccount(ctx context.Context, userID, correlationID string) error
+	ChangePassword(ctx context.Context, userID string, req ChangePasswordRequest) error
+	RequestPasswordReset(ctx context.Context, req PasswordResetRequest) error
+	ConfirmPasswordReset(ctx context.Context, req ConfirmPasswordResetRequest) error
+	CompleteMFALogin(ctx context.Context, req MFALoginRequest, correlationID string) (LoginResponse, error)
+	EnrollTOTP(ctx context.Context, userID string) (TOTPEnrollResponse, error)
+	ActivateTOTP(ctx context.Context, userID string, req MFACodeRequest) (RecoveryCodesResponse, error)
+	DisableTOTP(ctx context.Context, userID string, req MFACodeRequest) error
+	ApplySanction(ctx context.Context, actor authz.Principal, userID string, req ApplySanctionRequest, correlationID string) (sanctions.Sanction, error)
+	LiftSanction(ctx context.Context, actor authz.Principal, userID, sanctionID, correlationID string) error
+	ListSanctions(ctx context.Context, userID string) ([]sanctions.Sanction, error)
 }
 
 type Handler struct {
@@ -26,7 +51,19 @@ func NewHandler(svc LoginService) *Handler { return &Handler{svc: svc} }
 
 func (h *Handler) Register(mux *http.ServeMux) {
 	mux.HandleFunc("/v1/login", h.handleLogin)
+	mux.HandleFunc("/v1/login/guest", h.handleGuestLogin)
+	mux.HandleFunc("/v1/login/guest/upgrade", h.handleGuestUpgrade)
+	mux.HandleFunc("/v1/login/oidc/", h.handleOIDC)
+	mux.HandleFunc("/v1/login/mfa", h.handleMFALogin)
 	mux.HandleFunc("/v1/me", h.handleMe)
+	mux.HandleFunc("/v1/me/password", h.handleChangePassword)
+	mux.HandleFunc("/v1/me/mfa/totp", h.handleTOTP)
+	mux.HandleFunc("/v1/me/mfa/totp/activate", h.handleActivateTOTP)
+	mux.HandleFunc("/v1/password/reset", h.handlePasswordReset)
+	mux.HandleFunc("/v1/password/reset/confirm", h.handleConfirmPasswordReset)
+	mux.HandleFunc("/v1/oauth/token", h.handleServiceToken)
+	mux.HandleFunc("/admin/v1/users/", h.handleAdminUsers)
+	mux.HandleFunc("/admin/v1/service-accounts", authz.Require(h.svc, authz.ScopeAdminServiceAccountsWrite)(h.handleCreateServiceAccount))
 }
 
 func (h *Handler) handleLogin(w http.ResponseWriter, r *http.Request) {
@@ -44,37 +81,322 @@ func (h *Handler) handleLogin(w http.ResponseWriter, r *http.Request) {
 		apierror.Write(w, http.StatusBadRequest, "validation_failed", err.Error())
 		return
 	}
+	req.ClientIP = clientIP(r)
 
-	correlationID := r.Header.Get("X-Correlation-Id")
-	if correlationID == "" {
-		generatedID, err := newUUID()
-		if err != nil {
-			apierror.Write(w, http.StatusInternalServerError, "internal_error", "could not create correlation id")
-			return
-		}
-		correlationID = generatedID
+	correlationID, ok := correlationIDFrom(w, r)
+	if !ok {
+		return
 	}
 	resp, err := h.svc.Login(r.Context(), req, correlationID)
 	if err != nil {
+		var locked *LockedError
+		var sanctioned *sanctions.Error
 		status := http.StatusInternalServerError
 		code := "internal_error"
-		if errors.Is(err, ErrInvalidCredentials) {
+		switch {
+		case errors.As(err, &locked):
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(locked.RetryAfter)))
+			status = http.StatusTooManyRequests
+			code = "too_many_attempts"
+		case errors.Is(err, ErrInvalidCredentials):
 			status = http.StatusUnauthorized
 			code = "invalid_credentials"
+		case errors.As(err, &sanctioned):
+			status = http.StatusForbidden
+			code = sanctioned.Code()
 		}
 		apierror.Write(w, status, code, err.Error())
 		return
 	}
 
+	writeLoginResponse(w, resp)
+}
+
+func (h *Handler) handleGuestLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.Write(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+	var req GuestLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, "invalid_json", "invalid json")
+		return
+	}
+	if err := req.Validate(); err != nil {
+		apierror.Write(w, http.StatusBadRequest, "validation_failed", err.Error())
+		return
+	}
+	correlationID, ok := correlationIDFrom(w, r)
+	if !ok {
+		return
+	}
+	resp, err := h.svc.GuestLogin(r.Context(), req, correlationID)
+	if err != nil {
+		var sanctioned *sanctions.Error
+		if errors.As(err, &sanctioned) {
+			apierror.Write(w, http.StatusForbidden, sanctioned.Code(), err.Error())
+			return
+		}
+		apierror.Write(w, http.StatusInternalServerError, "internal_error", err.Error())
+		return
+	}
 	writeJSON(w, http.StatusOK, resp)
 }
 
-func (h *Handler) handleMe(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) handleGuestUpgrade(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.Write(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+	principal, err := authz.Authenticate(h.svc, r)
+	if err != nil {
+		apierror.Write(w, http.StatusUnauthorized, "unauthorized", "invalid token")
+		return
+	}
+	var req UpgradeGuestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, "invalid_json", "invalid json")
+		return
+	}
+	if err := req.Validate(); err != nil {
+		apierror.Write(w, http.StatusBadRequest, "validation_failed", err.Error())
+		return
+	}
+	correlationID, ok := correlationIDFrom(w, r)
+	if !ok {
+		return
+	}
+	resp, err := h.svc.UpgradeGuest(r.Context(), principal.Subject, req, correlationID)
+	if err != nil {
+		var sanctioned *sanctions.Error
+		switch {
+		case errors.As(err, &sanctioned):
+			apierror.Write(w, http.StatusForbidden, sanctioned.Code(), err.Error())
+		case errors.Is(err, ErrNotGuest):
+			apierror.Write(w, http.StatusConflict, "not_guest", err.Error())
+		case errors.Is(err, ErrUsernameTaken):
+			apierror.Write(w, http.StatusConflict, "username_taken", err.Error())
+		default:
+			apierror.Write(w, http.StatusInternalServerError, "internal_error", err.Error())
+		}
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleOIDC serves GET /v1/login/oidc/{provider}/start and /v1/login/oidc/{provider}/callback.
+// A start request carrying a bearer token links the provider identity to the caller instead of signing in.
+func (h *Handler) handleOIDC(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/v1/login/oidc/"), "/")
+	if len(parts) != 2 || parts[0] == "" {
+		http.NotFound(w, r)
+		return
+	}
 	if r.Method != http.MethodGet {
 		apierror.Write(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
 		return
 	}
+	provider := parts[0]
+
+	switch parts[1] {
+	case "start":
+		var linkUserID string
+		if r.Header.Get("Authorization") != "" {
+			principal, err := authz.Authenticate(h.svc, r)
+			if err != nil {
+				apierror.Write(w, http.StatusUnauthorized, "unauthorized", "invalid token")
+				return
+			}
+			linkUserID = principal.Subject
+		}
+		resp, err := h.svc.StartOIDC(r.Context(), provider, linkUserID)
+		if err != nil {
+			writeOIDCError(w, err)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		writeJSON(w, http.StatusOK, resp)
+	case "callback":
+		q := r.URL.Query()
+		if providerErr := q.Get("error"); providerErr != "" {
+			apierror.Write(w, http.StatusUnauthorized, "oidc_failed", "identity provider returned "+providerErr)
+			return
+		}
+		if q.Get("code") == "" || q.Get("state") == "" {
+			apierror.Write(w, http.StatusBadRequest, "validation_failed", "code and state are required")
+			return
+		}
+		correlationID, ok := correlationIDFrom(w, r)
+		if !ok {
+			return
+		}
+		resp, err := h.svc.CompleteOIDC(r.Context(), provider, q.Get("code"), q.Get("state"), correlationID)
+		if err != nil {
+			writeOIDCError(w, err)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		writeLoginResponse(w, resp)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func writeOIDCError(w http.ResponseWriter, err error) {
+	var sanctioned *sanctions.Error
+	switch {
+	case errors.As(err, &sanctioned):
+		apierror.Write(w, http.StatusForbidden, sanctioned.Code(), err.Error())
+	case errors.Is(err, ErrUnknownProvider), errors.Is(err, errOIDCNotConfigured):
+		apierror.Write(w, http.StatusNotFound, "unknown_provider", err.Error())
+	case errors.Is(err, ErrInvalidOIDCState):
+		apierror.Write(w, http.StatusBadRequest, "invalid_state", err.Error())
+	case errors.Is(err, ErrOIDCVerification):
+		apierror.Write(w, http.StatusUnauthorized, "oidc_failed", err.Error())
+	case errors.Is(err, ErrIdentityLinked):
+		apierror.Write(w, http.StatusConflict, "identity_linked", err.Error())
+	default:
+		apierror.Write(w, http.StatusInternalServerError, "internal_error", err.Error())
+	}
+}
 
+// handleMFALogin serves POST /v1/login/mfa, the second step of a login for accounts with TOTP.
+func (h *Handler) handleMFALogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.Write(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+	var req MFALoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, "invalid_json", "invalid json")
+		return
+	}
+	if err := req.Validate(); err != nil {
+		apierror.Write(w, http.StatusBadRequest, "validation_failed", err.Error())
+		return
+	}
+	correlationID, ok := correlationIDFrom(w, r)
+	if !ok {
+		return
+	}
+	resp, err := h.svc.CompleteMFALogin(r.Context(), req, correlationID)
+	if err != nil {
+		if errors.Is(err, ErrInvalidToken) {
+			apierror.Write(w, http.StatusUnauthorized, "invalid_mfa_token", "invalid or expired mfa token")
+			return
+		}
+		writeMFAError(w, err)
+		return
+	}
+	writeLoginResponse(w, resp)
+}
+
+// handleTOTP serves POST (start enrollment) and DELETE (disable) on /v1/me/mfa/totp.
+func (h *Handler) handleTOTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		apierror.Write(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+	principal, err := authz.Authenticate(h.svc, r)
+	if err != nil {
+		apierror.Write(w, http.StatusUnauthorized, "unauthorized", "invalid token")
+		return
+	}
+	if r.Method == http.MethodPost {
+		resp, err := h.svc.EnrollTOTP(r.Context(), principal.Subject)
+		if err != nil {
+			writeMFAError(w, err)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	var req MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, "invalid_json", "invalid json")
+		return
+	}
+	if err := h.svc.DisableTOTP(r.Context(), principal.Subject, req); err != nil {
+		writeMFAError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) handleActivateTOTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.Write(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+	principal, err := authz.Authenticate(h.svc, r)
+	if err != nil {
+		apierror.Write(w, http.StatusUnauthorized, "unauthorized", "invalid token")
+		return
+	}
+	var req MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, "invalid_json", "invalid json")
+		return
+	}
+	resp, err := h.svc.ActivateTOTP(r.Context(), principal.Subject, req)
+	if err != nil {
+		writeMFAError(w, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func writeMFAError(w http.ResponseWriter, err error) {
+	var locked *LockedError
+	var sanctioned *sanctions.Error
+	switch {
+	case errors.As(err, &sanctioned):
+		apierror.Write(w, http.StatusForbidden, sanctioned.Code(), err.Error())
+	case errors.As(err, &locked):
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(locked.RetryAfter)))
+		apierror.Write(w, http.StatusTooManyRequests, "too_many_attempts", err.Error())
+	case errors.Is(err, ErrInvalidMFACode):
+		apierror.Write(w, http.StatusUnauthorized, "invalid_mfa_code", err.Error())
+	case errors.Is(err, ErrMFANotEnrolled):
+		apierror.Write(w, http.StatusNotFound, "mfa_not_enrolled", err.Error())
+	case errors.Is(err, ErrMFAAlreadyEnabled):
+		apierror.Write(w, http.StatusConflict, "mfa_already_enabled", err.Error())
+	case errors.Is(err, ErrMFAUnavailable):
+		apierror.Write(w, http.StatusConflict, "mfa_unavailable", err.Error())
+	case errors.Is(err, ErrUserNotFound):
+		apierror.Write(w, http.StatusUnauthorized, "unauthorized", err.Error())
+	default:
+		apierror.Write(w, http.StatusInternalServerError, "internal_error", err.Error())
+	}
+}
+
+// writeLoginResponse hides the empty profile while a second factor is still pending.
+func writeLoginResponse(w http.ResponseWriter, resp LoginResponse) {
+	if resp.MFARequired {
+		w.Header().Set("Cache-Control", "no-store")
+		writeJSON(w, http.StatusOK, MFAChallengeResponse{MFARequired: true, MFAToken: resp.MFAToken})
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *Handler) handleMe(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.handleGetMe(w, r)
+	case http.MethodPatch:
+		h.handleUpdateMe(w, r)
+	case http.MethodDelete:
+		h.handleDeleteMe(w, r)
+	default:
+		apierror.Write(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+	}
+}
+
+func (h *Handler) handleGetMe(w http.ResponseWriter, r *http.Request) {
 	auth := r.Header.Get("Authorization")
 	if auth == "" || !strings.HasPrefix(auth, "Bearer ") {
 		apierror.Write(w, http.StatusUnauthorized, "unauthorized", "missing bearer token")
@@ -95,6 +417,363 @@ func (h *Handler) handleMe(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, MeResponse{User: user})
 }
 
+func (h *Handler) handleUpdateMe(w http.ResponseWriter, r *http.Request) {
+	principal, err := authz.Authenticate(h.svc, r)
+	if err != nil {
+		apierror.Write(w, http.StatusUnauthorized, "unauthorized", "invalid token")
+		return
+	}
+	var req UpdateProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, "invalid_json", "invalid json")
+		return
+	}
+	if err := req.Validate(); err != nil {
+		apierror.Write(w, http.StatusBadRequest, "validation_failed", err.Error())
+		return
+	}
+	correlationID, ok := correlationIDFrom(w, r)
+	if !ok {
+		return
+	}
+	resp, err := h.svc.UpdateProfile(r.Context(), principal, req, correlationID)
+	if err != nil {
+		var sanctioned *sanctions.Error
+		switch {
+		case errors.As(err, &sanctioned):
+			apierror.Write(w, http.StatusForbidden, sanctioned.Code(), err.Error())
+		case errors.Is(err, ErrUserNotFound):
+			apierror.Write(w, http.StatusUnauthorized, "unauthorized", err.Error())
+		case errors.Is(err, ErrUsernameTaken):
+			apierror.Write(w, http.StatusConflict, "username_taken", err.Error())
+		case errors.Is(err, ErrGuestUsername):
+			apierror.Write(w, http.StatusConflict, "guest_username", err.Error())
+		default:
+			apierror.Write(w, http.StatusInternalServerError, "internal_error", err.Error())
+		}
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *Handler) handleDeleteMe(w http.ResponseWriter, r *http.Request) {
+	principal, err := authz.Authenticate(h.svc, r)
+	if err != nil {
+		apierror.Write(w, http.StatusUnauthorized, "unauthorized", "invalid token")
+		return
+	}
+	correlationID, ok := correlationIDFrom(w, r)
+	if !ok {
+		return
+	}
+	if err := h.svc.DeleteAccount(r.Context(), principal.Subject, correlationID); err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			apierror.Write(w, http.StatusUnauthorized, "unauthorized", err.Error())
+			return
+		}
+		apierror.Write(w, http.StatusInternalServerError, "internal_error", err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) handleChangePassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.Write(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+	principal, err := authz.Authenticate(h.svc, r)
+	if err != nil {
+		apierror.Write(w, http.StatusUnauthorized, "unauthorized", "invalid token")
+		return
+	}
+	var req ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, "invalid_json", "invalid json")
+		return
+	}
+	if err := req.Validate(); err != nil {
+		apierror.Write(w, http.StatusBadRequest, "validation_failed", err.Error())
+		return
+	}
+	if err := h.svc.ChangePassword(r.Context(), principal.Subject, req); err != nil {
+		var locked *LockedError
+		switch {
+		case errors.As(err, &locked):
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(locked.RetryAfter)))
+			apierror.Write(w, http.StatusTooManyRequests, "too_many_attempts", err.Error())
+		case errors.Is(err, ErrInvalidCredentials):
+			apierror.Write(w, http.StatusUnauthorized, "invalid_credentials", err.Error())
+		default:
+			apierror.Write(w, http.StatusInternalServerError, "internal_error", err.Error())
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlePasswordReset always answers 202 for valid input, whether or not the user exists.
+func (h *Handler) handlePasswordReset(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.Write(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+	var req PasswordResetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, "invalid_json", "invalid json")
+		return
+	}
+	if err := req.Validate(); err != nil {
+		apierror.Write(w, http.StatusBadRequest, "validation_failed", err.Error())
+		return
+	}
+	req.ClientIP = clientIP(r)
+	if err := h.svc.RequestPasswordReset(r.Context(), req); err != nil {
+		writePasswordResetError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *Handler) handleConfirmPasswordReset(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.Write(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+	var req ConfirmPasswordResetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, "invalid_json", "invalid json")
+		return
+	}
+	if err := req.Validate(); err != nil {
+		apierror.Write(w, http.StatusBadRequest, "validation_failed", err.Error())
+		return
+	}
+	if err := h.svc.ConfirmPasswordReset(r.Context(), req); err != nil {
+		writePasswordResetError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writePasswordResetError(w http.ResponseWriter, err error) {
+	var locked *LockedError
+	switch {
+	case errors.As(err, &locked):
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(locked.RetryAfter)))
+		apierror.Write(w, http.StatusTooManyRequests, "too_many_requests", "too many password reset requests")
+	case errors.Is(err, ErrInvalidResetToken):
+		apierror.Write(w, http.StatusBadRequest, "invalid_token", err.Error())
+	case errors.Is(err, ErrPasswordResetDisabled):
+		apierror.Write(w, http.StatusServiceUnavailable, "unavailable", err.Error())
+	default:
+		apierror.Write(w, http.StatusInternalServerError, "internal_error", err.Error())
+	}
+}
+
+// handleServiceToken serves the client-credentials grant. Credentials may be sent with HTTP
+// Basic auth or as client_id/client_secret form fields.
+func (h *Handler) handleServiceToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.Write(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		apierror.Write(w, http.StatusBadRequest, "invalid_request", "invalid form body")
+		return
+	}
+	if r.PostForm.Get("grant_type") != "client_credentials" {
+		apierror.Write(w, http.StatusBadRequest, "unsupported_grant_type", "grant_type must be client_credentials")
+		return
+	}
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID == "" || clientSecret == "" {
+		apierror.Write(w, http.StatusUnauthorized, "invalid_client", "client credentials are required")
+		return
+	}
+
+	resp, err := h.svc.IssueServiceToken(r.Context(), clientID, clientSecret, strings.Fields(r.PostForm.Get("scope")))
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidClient):
+			apierror.Write(w, http.StatusUnauthorized, "invalid_client", err.Error())
+		case errors.Is(err, ErrInvalidScope):
+			apierror.Write(w, http.StatusBadRequest, "invalid_scope", err.Error())
+		default:
+			apierror.Write(w, http.StatusInternalServerError, "internal_error", err.Error())
+		}
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *Handler) handleCreateServiceAccount(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.Write(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+	var req CreateServiceAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, "invalid_json", "invalid json")
+		return
+	}
+	actor, _ := authz.FromContext(r.Context())
+	resp, err := h.svc.CreateServiceAccount(r.Context(), actor, req, r.Header.Get("X-Correlation-Id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidClientID), errors.Is(err, ErrNoScopes), errors.Is(err, ErrInvalidScope):
+			apierror.Write(w, http.StatusBadRequest, "validation_failed", err.Error())
+		case errors.Is(err, ErrServiceAccountExists):
+			apierror.Write(w, http.StatusConflict, "conflict", err.Error())
+		default:
+			apierror.Write(w, http.StatusInternalServerError, "internal_error", err.Error())
+		}
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+// handleAdminUsers dispatches /admin/v1/users/{id}/roles/... and /admin/v1/users/{id}/sanctions/...,
+// which need different scopes.
+func (h *Handler) handleAdminUsers(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/admin/v1/users/"), "/")
+	if len(parts) < 2 {
+		http.NotFound(w, r)
+		return
+	}
+	switch {
+	case parts[1] == "roles":
+		authz.Require(h.svc, authz.ScopeAdminRolesWrite)(h.handleAdminUserRoles)(w, r)
+	case parts[1] == "sanctions" && r.Method == http.MethodGet:
+		authz.Require(h.svc, authz.ScopeAdminUsersRead)(h.handleAdminUserSanctions)(w, r)
+	case parts[1] == "sanctions":
+		authz.Require(h.svc, authz.ScopeAdminSanctionsWrite)(h.handleAdminUserSanctions)(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleAdminUserSanctions serves GET and POST /admin/v1/users/{id}/sanctions and
+// DELETE /admin/v1/users/{id}/sanctions/{sanctionID}.
+func (h *Handler) handleAdminUserSanctions(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/admin/v1/users/"), "/")
+	if parts[0] == "" || len(parts) > 3 || (len(parts) == 3 && parts[2] == "") {
+		http.NotFound(w, r)
+		return
+	}
+	userID := parts[0]
+	actor, _ := authz.FromContext(r.Context())
+	correlationID := r.Header.Get("X-Correlation-Id")
+
+	switch {
+	case len(parts) == 2 && r.Method == http.MethodGet:
+		list, err := h.svc.ListSanctions(r.Context(), userID)
+		if err != nil {
+			writeSanctionAdminError(w, err)
+			return
+		}
+		if list == nil {
+			list = []sanctions.Sanction{}
+		}
+		writeJSON(w, http.StatusOK, SanctionsResponse{Sanctions: list})
+	case len(parts) == 2 && r.Method == http.MethodPost:
+		var req ApplySanctionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, "invalid_json", "invalid json")
+			return
+		}
+		if err := req.Validate(); err != nil {
+			apierror.Write(w, http.StatusBadRequest, "validation_failed", err.Error())
+			return
+		}
+		sanction, err := h.svc.ApplySanction(r.Context(), actor, userID, req, correlationID)
+		if err != nil {
+			writeSanctionAdminError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, sanction)
+	case len(parts) == 3 && r.Method == http.MethodDelete:
+		if err := h.svc.LiftSanction(r.Context(), actor, userID, parts[2], correlationID); err != nil {
+			writeSanctionAdminError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		apierror.Write(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+	}
+}
+
+func writeSanctionAdminError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidSanctionType), errors.Is(err, ErrInvalidSanctionReason), errors.Is(err, ErrInvalidSanctionDuration):
+		apierror.Write(w, http.StatusBadRequest, "validation_failed", err.Error())
+	case errors.Is(err, ErrUserNotFound), errors.Is(err, ErrSanctionNotFound):
+		apierror.Write(w, http.StatusNotFound, "not_found", err.Error())
+	default:
+		apierror.Write(w, http.StatusInternalServerError, "internal_error", err.Error())
+	}
+}
+
+// handleAdminUserRoles serves PUT and DELETE on /admin/v1/users/{id}/roles/{role}.
+func (h *Handler) handleAdminUserRoles(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/admin/v1/users/"), "/")
+	if len(parts) != 3 || parts[0] == "" || parts[1] != "roles" || parts[2] == "" {
+		http.NotFound(w, r)
+		return
+	}
+	actor, _ := authz.FromContext(r.Context())
+	correlationID := r.Header.Get("X-Correlation-Id")
+
+	var err error
+	switch r.Method {
+	case http.MethodPut:
+		err = h.svc.GrantRole(r.Context(), actor, parts[0], parts[2], correlationID)
+	case http.MethodDelete:
+		err = h.svc.RevokeRole(r.Context(), actor, parts[0], parts[2], correlationID)
+	default:
+		apierror.Write(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrUnknownRole):
+			apierror.Write(w, http.StatusBadRequest, "validation_failed", err.Error())
+		case errors.Is(err, ErrUserNotFound):
+			apierror.Write(w, http.StatusNotFound, "not_found", err.Error())
+		default:
+			apierror.Write(w, http.StatusInternalServerError, "internal_error", err.Error())
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func correlationIDFrom(w http.ResponseWriter, r *http.Request) (string, bool) {
+	correlationID := r.Header.Get("X-Correlation-Id")
+	if correlationID != "" {
+		return correlationID, true
+	}
+	generatedID, err := newUUID()
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, "internal_error", "could not create correlation id")
+		return "", false
+	}
+	return generatedID, true
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
 func writeJSON(w http.ResponseWriter, status int, value any) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -7,9 +7,12 @@ import (
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/authz"
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/sanctions"
 	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/pkg/apierror"
 )
 
@@ -19,6 +22,15 @@ type fakeService struct {
 	meResp    UserProfile
 	meErr     error
 	parseErr  error
+	principal authz.Principal
+	grantErr  error
+	tokenErr  error
+	guestErr  error
+	oidcErr   error
+	pwErr     error
+	meUpdErr  error
+	mfaErr    error
+	sanctErr  error
 }
 
 func (f fakeService) Login(context.Context, LoginRequest, string) (LoginResponse, error) {
@@ -31,6 +43,95 @@ func (f fakeService) ParseToken(string) (string, string, error) {
 	}
 	return "u1", "alice", nil
 }
+func (f fakeService) ParsePrincipal(string) (authz.Principal, error) {
+	if f.parseErr != nil {
+		return authz.Principal{}, f.parseErr
+	}
+	return f.principal, nil
+}
+func (f fakeService) GrantRole(context.Context, authz.Principal, string, string, string) error {
+	return f.grantErr
+}
+func (f fakeService) RevokeRole(context.Context, authz.Principal, string, string, string) error {
+	return f.grantErr
+}
+func (f fakeService) IssueServiceToken(_ context.Context, clientID, _ string, scopes []string) (ServiceTokenResponse, error) {
+	if f.tokenErr != nil {
+		return ServiceTokenResponse{}, f.tokenErr
+	}
+	return ServiceTokenResponse{AccessToken: "svc-" + clientID, TokenType: "Bearer", ExpiresIn: 900, Scope: strings.Join(scopes, " ")}, nil
+}
+func (f fakeService) GuestLogin(context.Context, GuestLoginRequest, string) (LoginResponse, error) {
+	return LoginResponse{Token: "guest-jwt", User: UserProfile{ID: "g1", Username: "guest-1", Guest: true}}, f.guestErr
+}
+func (f fakeService) UpgradeGuest(_ context.Context, userID string, req UpgradeGuestRequest, _ string) (LoginResponse, error) {
+	if f.guestErr != nil {
+		return LoginResponse{}, f.guestErr
+	}
+	return LoginResponse{Token: "jwt", User: UserProfile{ID: userID, Username: req.Username}}, nil
+}
+func (f fakeService) CreateServiceAccount(_ context.Context, _ authz.Principal, req CreateServiceAccountRequest, _ string) (CreateServiceAccountResponse, error) {
+	if err := req.Validate(); err != nil {
+		return CreateServiceAccountResponse{}, err
+	}
+	return CreateServiceAccountResponse{ClientID: req.ClientID, ClientSecret: "secret", Scopes: req.Scopes}, nil
+}
+
+func (f fakeService) StartOIDC(_ context.Context, provider, _ string) (OIDCStartResponse, error) {
+	if f.oidcErr != nil {
+		return OIDCStartResponse{}, f.oidcErr
+	}
+	return OIDCStartResponse{AuthorizationURL: "https://idp.example/authorize?provider=" + provider, State: "st"}, nil
+}
+func (f fakeService) CompleteOIDC(context.Context, string, string, string, string) (LoginResponse, error) {
+	if f.oidcErr != nil {
+		return LoginResponse{}, f.oidcErr
+	}
+	return LoginResponse{Token: "jwt", User: UserProfile{ID: "u1", Username: "alice"}}, nil
+}
+
+func (f fakeService) UpdateProfile(_ context.Context, caller authz.Principal, req UpdateProfileRequest, _ string) (UpdateProfileResponse, error) {
+	if f.meUpdErr != nil {
+		return UpdateProfileResponse{}, f.meUpdErr
+	}
+	resp := UpdateProfileResponse{User: UserProfile{ID: caller.Subject, Username: "alice"}}
+	if req.Username != nil {
+		resp.User.Username, resp.Token = *req.Username, "new-jwt"
+	}
+	return resp, nil
+}
+func (f fakeService) DeleteAccount(context.Context, string, string) error { return f.meUpdErr }
+func (f fakeService) ChangePassword(context.Context, string, ChangePasswordRequest) error {
+	return f.pwErr
+}
+func (f fakeService) RequestPasswordReset(context.Context, PasswordResetRequest) error {
+	return f.pwErr
+}
+func (f fakeService) ConfirmPasswordReset(context.Context, ConfirmPasswordResetRequest) error {
+	return f.pwErr
+}
+func (f fakeService) CompleteMFALogin(context.Context, MFALoginRequest, string) (LoginResponse, error) {
+	if f.mfaErr != nil {
+		return LoginResponse{}, f.mfaErr
+	}
+	return LoginResponse{Token: "jwt", User: UserProfile{ID: "u1", Username: "alice"}}, nil
+}
+func (f fakeService) EnrollTOTP(context.Context, string) (TOTPEnrollResponse, error) {
+	return TOTPEnrollResponse{Secret: "SECRET", ProvisioningURI: "otpauth://totp/x"}, f.mfaErr
+}
+func (f fakeService) ActivateTOTP(context.Context, string, MFACodeRequest) (RecoveryCodesResponse, error) {
+	return RecoveryCodesResponse{RecoveryCodes: []string{"abcde-fghij"}}, f.mfaErr
+}
+func (f fakeService) DisableTOTP(context.Context, string, MFACodeRequest) error { return f.mfaErr }
+func (f fakeService) ApplySanction(_ context.Context, _ authz.Principal, userID string, req ApplySanctionRequest, _ string) (sanctions.Sanction, error) {
+	return sanctions.Sanction{ID: "sn-1", UserID: userID, Type: req.Type, Reason: req.Reason}, f.sanctErr
+}
+func (f fakeService) LiftSanction(context.Context, authz.Principal, string, string, string) error {
+	return f.sanctErr
+}
+func (f fakeService) ListSanctions(context.Context, string) ([]sanctions.Sanction, error) {
+	return nil, f.sanctErr
+}
 
 func TestLoginHandler(t *testing.T) {
 	t.Parallel()
@@ -45,6 +146,7 @@ func TestLoginHandler(t *testing.T) {
 		{name: "bad json", svc: fakeService{}, body: `{`, code: http.StatusBadRequest, err: "invalid_json"},
 		{name: "validation", svc: fakeService{}, body: `{"username":"ab","password":"short"}`, code: http.StatusBadRequest, err: "validation_failed"},
 		{name: "auth failure", svc: fakeService{loginErr: ErrInvalidCredentials}, body: `{"username":"alice","password":"password123"}`, code: http.StatusUnauthorized, err: "invalid_credentials"},
+		{name: "locked out", svc: fakeService{loginErr: &LockedError{RetryAfter: 1500 * time.Millisecond}}, body: `{"username":"alice","password":"password123"}`, code: http.StatusTooManyRequests, err: "too_many_attempts"},
 	}
 	for _, tc := range tests {
 		tc := tc
@@ -68,6 +170,9 @@ func TestLoginHandler(t *testing.T) {
 					t.Fatalf("expected code %s got %s", tc.err, e.Code)
 				}
 			}
+			if tc.code == http.StatusTooManyRequests && res.Header().Get("Retry-After") != "2" {
+				t.Fatalf("expected Retry-After 2 got %q", res.Header().Get("Retry-After"))
+			}
 		})
 	}
 }
@@ -92,3 +197,428 @@ func TestHandleMeUnauthorized(t *testing.T) {
 		t.Fatalf("unexpected error code: %s", e.Code)
 	}
 }
+
+func TestAdminUserRoles(t *testing.T) {
+	t.Parallel()
+	admin := authz.Principal{Subject: "admin-1", Username: "root", Roles: []string{authz.RoleAdmin}, Scopes: []string{authz.ScopeAdminRolesWrite}}
+	moderator := authz.Principal{Subject: "mod-1", Username: "mod", Roles: []string{authz.RoleModerator}, Scopes: []string{authz.ScopeAdminUsersRead}}
+	tests := []struct {
+		name   string
+		svc    fakeService
+		method string
+		path   string
+		code   int
+	}{
+		{name: "grant", svc: fakeService{principal: admin}, method: http.MethodPut, path: "/admin/v1/users/u1/roles/moderator", code: http.StatusNoContent},
+		{name: "revoke", svc: fakeService{principal: admin}, method: http.MethodDelete, path: "/admin/v1/users/u1/roles/moderator", code: http.StatusNoContent},
+		{name: "unknown role", svc: fakeService{principal: admin, grantErr: ErrUnknownRole}, method: http.MethodPut, path: "/admin/v1/users/u1/roles/wizard", code: http.StatusBadRequest},
+		{name: "missing scope", svc: fakeService{principal: moderator}, method: http.MethodPut, path: "/admin/v1/users/u1/roles/admin", code: http.StatusForbidden},
+		{name: "bad path", svc: fakeService{principal: admin}, method: http.MethodPut, path: "/admin/v1/users/u1", code: http.StatusNotFound},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			mux := http.NewServeMux()
+			NewHandler(tc.svc).Register(mux)
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			req.Header.Set("Authorization", "Bearer token")
+			res := httptest.NewRecorder()
+			mux.ServeHTTP(res, req)
+			if res.Code != tc.code {
+				t.Fatalf("expected %d got %d", tc.code, res.Code)
+			}
+		})
+	}
+}
+
+func TestServiceTokenHandler(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name  string
+		svc   fakeService
+		body  string
+		basic bool
+		code  int
+		err   string
+	}{
+		{name: "form credentials", body: "grant_type=client_credentials&client_id=matchmaking&client_secret=s3cret&scope=gateway:send", code: http.StatusOK},
+		{name: "basic credentials", body: "grant_type=client_credentials", basic: true, code: http.StatusOK},
+		{name: "wrong grant", body: "grant_type=password&client_id=matchmaking&client_secret=s3cret", code: http.StatusBadRequest, err: "unsupported_grant_type"},
+		{name: "missing credentials", body: "grant_type=client_credentials", code: http.StatusUnauthorized, err: "invalid_client"},
+		{name: "bad secret", svc: fakeService{tokenErr: ErrInvalidClient}, body: "grant_type=client_credentials&client_id=matchmaking&client_secret=nope", code: http.StatusUnauthorized, err: "invalid_client"},
+		{name: "scope not granted", svc: fakeService{tokenErr: ErrInvalidScope}, body: "grant_type=client_credentials&client_id=matchmaking&client_secret=s3cret&scope=router:route", code: http.StatusBadRequest, err: "invalid_scope"},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			mux := http.NewServeMux()
+			NewHandler(tc.svc).Register(mux)
+			req := httptest.NewRequest(http.MethodPost, "/v1/oauth/token", strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tc.basic {
+				req.SetBasicAuth("matchmaking", "s3cret")
+			}
+			res := httptest.NewRecorder()
+			mux.ServeHTTP(res, req)
+			if res.Code != tc.code {
+				t.Fatalf("expected %d got %d: %s", tc.code, res.Code, res.Body.String())
+			}
+			if tc.err != "" {
+				var e apierror.Response
+				_ = json.Unmarshal(res.Body.Bytes(), &e)
+				if e.Code != tc.err {
+					t.Fatalf("expected code %s got %s", tc.err, e.Code)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateServiceAccountHandler(t *testing.T) {
+	t.Parallel()
+	admin := authz.Principal{Subject: "admin-1", Username: "root", Scopes: []string{authz.ScopeAdminServiceAccountsWrite}}
+	tests := []struct {
+		name string
+		body string
+		code int
+	}{
+		{name: "created", body: `{"client_id":"matchmaking","scopes":["gateway:send"]}`, code: http.StatusCreated},
+		{name: "unknown scope", body: `{"client_id":"matchmaking","scopes":["admin:broadcast"]}`, code: http.StatusBadRequest},
+		{name: "no scopes", body: `{"client_id":"matchmaking"}`, code: http.StatusBadRequest},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			mux := http.NewServeMux()
+			NewHandler(fakeService{principal: admin}).Register(mux)
+			req := httptest.NewRequest(http.MethodPost, "/admin/v1/service-accounts", strings.NewReader(tc.body))
+			req.Header.Set("Authorization", "Bearer token")
+			res := httptest.NewRecorder()
+			mux.ServeHTTP(res, req)
+			if res.Code != tc.code {
+				t.Fatalf("expected %d got %d: %s", tc.code, res.Code, res.Body.String())
+			}
+		})
+	}
+}
+
+func TestGuestHandlers(t *testing.T) {
+	t.Parallel()
+	guest := authz.Principal{Subject: "g1", Username: "guest-1", Guest: true}
+	tests := []struct {
+		name   string
+		svc    fakeService
+		path   string
+		body   string
+		bearer bool
+		code   int
+		err    string
+	}{
+		{name: "guest login", path: "/v1/login/guest", body: `{"device_id":"device-0123456789abcdef"}`, code: http.StatusOK},
+		{name: "short device id", path: "/v1/login/guest", body: `{"device_id":"short"}`, code: http.StatusBadRequest, err: "validation_failed"},
+		{name: "upgrade", svc: fakeService{principal: guest}, path: "/v1/login/guest/upgrade", body: `{"username":"alice","password":"password123"}`, bearer: true, code: http.StatusOK},
+		{name: "upgrade without token", path: "/v1/login/guest/upgrade", body: `{"username":"alice","password":"password123"}`, code: http.StatusUnauthorized, err: "unauthorized"},
+		{name: "upgrade taken", svc: fakeService{principal: guest, guestErr: ErrUsernameTaken}, path: "/v1/login/guest/upgrade", body: `{"username":"alice","password":"password123"}`, bearer: true, code: http.StatusConflict, err: "username_taken"},
+		{name: "upgrade non guest", svc: fakeService{principal: guest, guestErr: ErrNotGuest}, path: "/v1/login/guest/upgrade", body: `{"username":"alice","password":"password123"}`, bearer: true, code: http.StatusConflict, err: "not_guest"},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			mux := http.NewServeMux()
+			NewHandler(tc.svc).Register(mux)
+			req := httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(tc.body))
+			if tc.bearer {
+				req.Header.Set("Authorization", "Bearer guest-jwt")
+			}
+			res := httptest.NewRecorder()
+			mux.ServeHTTP(res, req)
+			if res.Code != tc.code {
+				t.Fatalf("expected %d got %d: %s", tc.code, res.Code, res.Body.String())
+			}
+			if tc.err != "" {
+				var e apierror.Response
+				_ = json.Unmarshal(res.Body.Bytes(), &e)
+				if e.Code != tc.err {
+					t.Fatalf("expected code %s got %s", tc.err, e.Code)
+				}
+			}
+		})
+	}
+}
+
+func TestOIDCHandlers(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		svc  fakeService
+		path string
+		code int
+		err  string
+	}{
+		{name: "start", path: "/v1/login/oidc/mock/start", code: http.StatusOK},
+		{name: "unknown provider", svc: fakeService{oidcErr: ErrUnknownProvider}, path: "/v1/login/oidc/nope/start", code: http.StatusNotFound, err: "unknown_provider"},
+		{name: "callback", path: "/v1/login/oidc/mock/callback?code=c&state=s", code: http.StatusOK},
+		{name: "callback missing code", path: "/v1/login/oidc/mock/callback?state=s", code: http.StatusBadRequest, err: "validation_failed"},
+		{name: "provider error", path: "/v1/login/oidc/mock/callback?error=access_denied&state=s", code: http.StatusUnauthorized, err: "oidc_failed"},
+		{name: "replayed state", svc: fakeService{oidcErr: ErrInvalidOIDCState}, path: "/v1/login/oidc/mock/callback?code=c&state=s", code: http.StatusBadRequest, err: "invalid_state"},
+		{name: "bad id token", svc: fakeService{oidcErr: ErrOIDCVerification}, path: "/v1/login/oidc/mock/callback?code=c&state=s", code: http.StatusUnauthorized, err: "oidc_failed"},
+		{name: "unknown step", path: "/v1/login/oidc/mock/finish", code: http.StatusNotFound},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			mux := http.NewServeMux()
+			NewHandler(tc.svc).Register(mux)
+			res := httptest.NewRecorder()
+			mux.ServeHTTP(res, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			if res.Code != tc.code {
+				t.Fatalf("expected %d got %d: %s", tc.code, res.Code, res.Body.String())
+			}
+			if tc.err != "" {
+				var e apierror.Response
+				_ = json.Unmarshal(res.Body.Bytes(), &e)
+				if e.Code != tc.err {
+					t.Fatalf("expected code %s got %s", tc.err, e.Code)
+				}
+			}
+		})
+	}
+}
+
+func TestPasswordHandlers(t *testing.T) {
+	t.Parallel()
+	user := authz.Principal{Subject: "u1", Username: "alice"}
+	tests := []struct {
+		name   string
+		svc    fakeService
+		path   string
+		body   string
+		bearer bool
+		code   int
+		err    string
+	}{
+		{name: "change", svc: fakeService{principal: user}, path: "/v1/me/password", body: `{"current_password":"password123","new_password":"password456"}`, bearer: true, code: http.StatusNoContent},
+		{name: "change without token", path: "/v1/me/password", body: `{"current_password":"password123","new_password":"password456"}`, code: http.StatusUnauthorized, err: "unauthorized"},
+		{name: "change wrong current", svc: fakeService{principal: user, pwErr: ErrInvalidCredentials}, path: "/v1/me/password", body: `{"current_password":"nope-nope","new_password":"password456"}`, bearer: true, code: http.StatusUnauthorized, err: "invalid_credentials"},
+		{name: "change locked", svc: fakeService{principal: user, pwErr: &LockedError{RetryAfter: time.Minute}}, path: "/v1/me/password", body: `{"current_password":"nope-nope","new_password":"password456"}`, bearer: true, code: http.StatusTooManyRequests, err: "too_many_attempts"},
+		{name: "change short password", svc: fakeService{principal: user}, path: "/v1/me/password", body: `{"current_password":"password123","new_password":"short"}`, bearer: true, code: http.StatusBadRequest, err: "validation_failed"},
+		{name: "reset request", path: "/v1/password/reset", body: `{"username":"alice"}`, code: http.StatusAccepted},
+		{name: "reset disabled", svc: fakeService{pwErr: ErrPasswordResetDisabled}, path: "/v1/password/reset", body: `{"username":"alice"}`, code: http.StatusServiceUnavailable, err: "unavailable"},
+		{name: "reset confirm", path: "/v1/password/reset/confirm", body: `{"token":"t","new_password":"password456"}`, code: http.StatusNoContent},
+		{name: "reset confirm bad token", svc: fakeService{pwErr: ErrInvalidResetToken}, path: "/v1/password/reset/confirm", body: `{"token":"t","new_password":"password456"}`, code: http.StatusBadRequest, err: "invalid_token"},
+		{name: "reset confirm missing token", path: "/v1/password/reset/confirm", body: `{"new_password":"password456"}`, code: http.StatusBadRequest, err: "validation_failed"},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			mux := http.NewServeMux()
+			NewHandler(tc.svc).Register(mux)
+			req := httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(tc.body))
+			if tc.bearer {
+				req.Header.Set("Authorization", "Bearer jwt")
+			}
+			res := httptest.NewRecorder()
+			mux.ServeHTTP(res, req)
+			if res.Code != tc.code {
+				t.Fatalf("expected %d got %d: %s", tc.code, res.Code, res.Body.String())
+			}
+			if tc.err != "" {
+				var e apierror.Response
+				_ = json.Unmarshal(res.Body.Bytes(), &e)
+				if e.Code != tc.err {
+					t.Fatalf("expected code %s got %s", tc.err, e.Code)
+				}
+			}
+		})
+	}
+}
+
+func TestProfileHandlers(t *testing.T) {
+	t.Parallel()
+	user := authz.Principal{Subject: "u1", Username: "alice"}
+	tests := []struct {
+		name   string
+		svc    fakeService
+		method string
+		body   string
+		bearer bool
+		code   int
+		err    string
+	}{
+		{name: "update", svc: fakeService{principal: user}, method: http.MethodPatch, body: `{"display_name":"Alice","locale":"en-GB","region":"eu-west"}`, bearer: true, code: http.StatusOK},
+		{name: "rename", svc: fakeService{principal: user}, method: http.MethodPatch, body: `{"username":"alice2"}`, bearer: true, code: http.StatusOK},
+		{name: "empty update", svc: fakeService{principal: user}, method: http.MethodPatch, body: `{}`, bearer: true, code: http.StatusBadRequest, err: "validation_failed"},
+		{name: "http avatar", svc: fakeService{principal: user}, method: http.MethodPatch, body: `{"avatar_url":"http://cdn.example/a.png"}`, bearer: true, code: http.StatusBadRequest, err: "validation_failed"},
+		{name: "bad locale", svc: fakeService{principal: user}, method: http.MethodPatch, body: `{"locale":"english"}`, bearer: true, code: http.StatusBadRequest, err: "validation_failed"},
+		{name: "username taken", svc: fakeService{principal: user, meUpdErr: ErrUsernameTaken}, method: http.MethodPatch, body: `{"username":"bob"}`, bearer: true, code: http.StatusConflict, err: "username_taken"},
+		{name: "guest rename", svc: fakeService{principal: user, meUpdErr: ErrGuestUsername}, method: http.MethodPatch, body: `{"username":"bob"}`, bearer: true, code: http.StatusConflict, err: "guest_username"},
+		{name: "update without token", method: http.MethodPatch, body: `{"display_name":"Alice"}`, code: http.StatusUnauthorized, err: "unauthorized"},
+		{name: "delete", svc: fakeService{principal: user}, method: http.MethodDelete, bearer: true, code: http.StatusNoContent},
+		{name: "delete twice", svc: fakeService{principal: user, meUpdErr: ErrUserNotFound}, method: http.MethodDelete, bearer: true, code: http.StatusUnauthorized, err: "unauthorized"},
+		{name: "method", method: http.MethodPut, code: http.StatusMethodNotAllowed, err: "method_not_allowed"},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			mux := http.NewServeMux()
+			NewHandler(tc.svc).Register(mux)
+			req := httptest.NewRequest(tc.method, "/v1/me", strings.NewReader(tc.body))
+			if tc.bearer {
+				req.Header.Set("Authorization", "Bearer jwt")
+			}
+			res := httptest.NewRecorder()
+			mux.ServeHTTP(res, req)
+			if res.Code != tc.code {
+				t.Fatalf("expected %d got %d: %s", tc.code, res.Code, res.Body.String())
+			}
+			if tc.err != "" {
+				var e apierror.Response
+				_ = json.Unmarshal(res.Body.Bytes(), &e)
+				if e.Code != tc.err {
+					t.Fatalf("expected code %s got %s", tc.err, e.Code)
+				}
+			}
+		})
+	}
+}
+
+func TestMFAHandlers(t *testing.T) {
+	t.Parallel()
+	user := authz.Principal{Subject: "u1", Username: "alice"}
+	tests := []struct {
+		name   string
+		svc    fakeService
+		method string
+		path   string
+		body   string
+		bearer bool
+		code   int
+		err    string
+	}{
+		{name: "second step", method: http.MethodPost, path: "/v1/login/mfa", body: `{"mfa_token":"t","code":"123456"}`, code: http.StatusOK},
+		{name: "second step bad code", svc: fakeService{mfaErr: ErrInvalidMFACode}, method: http.MethodPost, path: "/v1/login/mfa", body: `{"mfa_token":"t","code":"123456"}`, code: http.StatusUnauthorized, err: "invalid_mfa_code"},
+		{name: "second step expired token", svc: fakeService{mfaErr: ErrInvalidToken}, method: http.MethodPost, path: "/v1/login/mfa", body: `{"mfa_token":"t","code":"123456"}`, code: http.StatusUnauthorized, err: "invalid_mfa_token"},
+		{name: "second step locked", svc: fakeService{mfaErr: &LockedError{RetryAfter: time.Minute}}, method: http.MethodPost, path: "/v1/login/mfa", body: `{"mfa_token":"t","code":"123456"}`, code: http.StatusTooManyRequests, err: "too_many_attempts"},
+		{name: "second step missing token", method: http.MethodPost, path: "/v1/login/mfa", body: `{"code":"123456"}`, code: http.StatusBadRequest, err: "validation_failed"},
+		{name: "enroll", svc: fakeService{principal: user}, method: http.MethodPost, path: "/v1/me/mfa/totp", bearer: true, code: http.StatusOK},
+		{name: "enroll without token", method: http.MethodPost, path: "/v1/me/mfa/totp", code: http.StatusUnauthorized, err: "unauthorized"},
+		{name: "enroll already enabled", svc: fakeService{principal: user, mfaErr: ErrMFAAlreadyEnabled}, method: http.MethodPost, path: "/v1/me/mfa/totp", bearer: true, code: http.StatusConflict, err: "mfa_already_enabled"},
+		{name: "enroll guest", svc: fakeService{principal: user, mfaErr: ErrMFAUnavailable}, method: http.MethodPost, path: "/v1/me/mfa/totp", bearer: true, code: http.StatusConflict, err: "mfa_unavailable"},
+		{name: "activate", svc: fakeService{principal: user}, method: http.MethodPost, path: "/v1/me/mfa/totp/activate", body: `{"code":"123456"}`, bearer: true, code: http.StatusOK},
+		{name: "activate not enrolled", svc: fakeService{principal: user, mfaErr: ErrMFANotEnrolled}, method: http.MethodPost, path: "/v1/me/mfa/totp/activate", body: `{"code":"123456"}`, bearer: true, code: http.StatusNotFound, err: "mfa_not_enrolled"},
+		{name: "disable", svc: fakeService{principal: user}, method: http.MethodDelete, path: "/v1/me/mfa/totp", body: `{"code":"123456"}`, bearer: true, code: http.StatusNoContent},
+		{name: "disable bad code", svc: fakeService{principal: user, mfaErr: ErrInvalidMFACode}, method: http.MethodDelete, path: "/v1/me/mfa/totp", body: `{"code":"123456"}`, bearer: true, code: http.StatusUnauthorized, err: "invalid_mfa_code"},
+		{name: "method", method: http.MethodGet, path: "/v1/me/mfa/totp", code: http.StatusMethodNotAllowed, err: "method_not_allowed"},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			mux := http.NewServeMux()
+			NewHandler(tc.svc).Register(mux)
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			if tc.bearer {
+				req.Header.Set("Authorization", "Bearer jwt")
+			}
+			res := httptest.NewRecorder()
+			mux.ServeHTTP(res, req)
+			if res.Code != tc.code {
+				t.Fatalf("expected %d got %d: %s", tc.code, res.Code, res.Body.String())
+			}
+			if tc.err != "" {
+				var e apierror.Response
+				_ = json.Unmarshal(res.Body.Bytes(), &e)
+				if e.Code != tc.err {
+					t.Fatalf("expected code %s got %s", tc.err, e.Code)
+				}
+			}
+		})
+	}
+}
+
+func TestLoginHandlerMFAChallenge(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	NewHandler(fakeService{loginResp: LoginResponse{MFARequired: true, MFAToken: "challenge"}}).Register(mux)
+	res := httptest.NewRecorder()
+	mux.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/v1/login", strings.NewReader(`{"username":"alice","password":"password123"}`)))
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d", res.Code)
+	}
+	var body map[string]any
+	if err := json.Unmarshal(res.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body["mfa_token"] != "challenge" || body["mfa_required"] != true {
+		t.Fatalf("expected challenge response, got %v", body)
+	}
+	if _, ok := body["user"]; ok {
+		t.Fatalf("challenge response must not include a profile: %v", body)
+	}
+}
+
+func TestAdminSanctionsHandlers(t *testing.T) {
+	t.Parallel()
+	moderator := authz.Principal{Subject: "mod-1", Username: "mod", Roles: []string{authz.RoleModerator}, Scopes: []string{authz.ScopeAdminUsersRead, authz.ScopeAdminSanctionsWrite}}
+	reader := authz.Principal{Subject: "ro-1", Username: "ro", Scopes: []string{authz.ScopeAdminUsersRead}}
+	tests := []struct {
+		name   string
+		svc    fakeService
+		method string
+		path   string
+		body   string
+		code   int
+		err    string
+	}{
+		{name: "apply", svc: fakeService{principal: moderator}, method: http.MethodPost, path: "/admin/v1/users/u1/sanctions", body: `{"type":"suspension","reason":"toxicity","duration_seconds":86400}`, code: http.StatusCreated},
+		{name: "apply ban with duration", svc: fakeService{principal: moderator}, method: http.MethodPost, path: "/admin/v1/users/u1/sanctions", body: `{"type":"ban","reason":"cheating","duration_seconds":60}`, code: http.StatusBadRequest, err: "validation_failed"},
+		{name: "apply unknown user", svc: fakeService{principal: moderator, sanctErr: ErrUserNotFound}, method: http.MethodPost, path: "/admin/v1/users/u9/sanctions", body: `{"type":"mute","reason":"spam"}`, code: http.StatusNotFound, err: "not_found"},
+		{name: "apply without scope", svc: fakeService{principal: reader}, method: http.MethodPost, path: "/admin/v1/users/u1/sanctions", body: `{"type":"mute","reason":"spam"}`, code: http.StatusForbidden, err: "forbidden"},
+		{name: "list", svc: fakeService{principal: reader}, method: http.MethodGet, path: "/admin/v1/users/u1/sanctions", code: http.StatusOK},
+		{name: "lift", svc: fakeService{principal: moderator}, method: http.MethodDelete, path: "/admin/v1/users/u1/sanctions/sn-1", code: http.StatusNoContent},
+		{name: "lift missing", svc: fakeService{principal: moderator, sanctErr: ErrSanctionNotFound}, method: http.MethodDelete, path: "/admin/v1/users/u1/sanctions/sn-9", code: http.StatusNotFound, err: "not_found"},
+		{name: "method", svc: fakeService{principal: moderator}, method: http.MethodPut, path: "/admin/v1/users/u1/sanctions", code: http.StatusMethodNotAllowed, err: "method_not_allowed"},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			mux := http.NewServeMux()
+			NewHandler(tc.svc).Register(mux)
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			req.Header.Set("Authorization", "Bearer jwt")
+			res := httptest.NewRecorder()
+			mux.ServeHTTP(res, req)
+			if res.Code != tc.code {
+				t.Fatalf("expected %d got %d: %s", tc.code, res.Code, res.Body.String())
+			}
+			if tc.err != "" {
+				var e apierror.Response
+				_ = json.Unmarshal(res.Body.Bytes(), &e)
+				if e.Code != tc.err {
+					t.Fatalf("expected code %s got %s", tc.err, e.Code)
+				}
+			}
+		})
+	}
+}
+
+func TestLoginHandlerSanctioned(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	NewHandler(fakeService{loginErr: &sanctions.Error{Sanction: sanctions.Sanction{Type: sanctions.TypeBan, Reason: "cheating"}}}).Register(mux)
+	res := httptest.NewRecorder()
+	mux.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/v1/login", strings.NewReader(`{"username":"alice","password":"password123"}`)))
+	var e apierror.Response
+	_ = json.Unmarshal(res.Body.Bytes(), &e)
+	if res.Code != http.StatusForbidden || e.Code != "account_banned" {
+		t.Fatalf("expected 403 account_banned, got %d %s", res.Code, e.Code)
+	}
+}
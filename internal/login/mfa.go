@@ -0,0 +1,288 @@
+package login
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/authz"
+)
+
+const (
+	mfaChallengeTTL   = 5 * time.Minute
+	recoveryCodeCount = 10
+)
+
+var (
+	ErrMFANotEnrolled    = errors.New("two-factor authentication is not enrolled")
+	ErrMFAAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrInvalidMFACode    = errors.New("invalid two-factor code")
+	ErrMFAUnavailable    = errors.New("guests cannot enroll two-factor authentication")
+)
+
+// MFAConfig controls TOTP provisioning and which roles require a second factor.
+type MFAConfig struct {
+	// Issuer is shown as the account label in authenticator apps.
+	Issuer string
+	// RequiredRoles are only granted in tokens from logins that passed a second factor.
+	RequiredRoles []string
+}
+
+func DefaultMFAConfig() MFAConfig {
+	return MFAConfig{Issuer: "paul-cloud-game-backend", RequiredRoles: []string{authz.RoleAdmin}}
+}
+
+// MFAEnrollment is a user's TOTP state. Secret is set once enrollment starts; Enabled once a code
+// has been confirmed.
+type MFAEnrollment struct {
+	Secret       string
+	Enabled      bool
+	LastUsedStep int64
+}
+
+// WithMFAConfig replaces the default MFA settings.
+func (s *Service) WithMFAConfig(cfg MFAConfig) *Service {
+	s.mfa = cfg
+	return s
+}
+
+// EnrollTOTP starts (or restarts) enrollment with a fresh secret. Nothing changes at login until the
+// enrollment is activated with a valid code.
+func (s *Service) EnrollTOTP(ctx context.Context, userID string) (TOTPEnrollResponse, error) {
+	user, err := s.repo.GetByID(ctx, userID)
+	if err != nil {
+		return TOTPEnrollResponse{}, err
+	}
+	if user.IsGuest {
+		return TOTPEnrollResponse{}, ErrMFAUnavailable
+	}
+	secret, err := newTOTPSecret()
+	if err != nil {
+		return TOTPEnrollResponse{}, err
+	}
+	if err := s.repo.SaveTOTPSecret(ctx, user.ID, secret); err != nil {
+		return TOTPEnrollResponse{}, err
+	}
+	return TOTPEnrollResponse{Secret: secret, ProvisioningURI: totpProvisioningURI(s.mfa.Issuer, user.Username, secret)}, nil
+}
+
+// ActivateTOTP confirms enrollment with a code from the authenticator and returns single-use recovery
+// codes. The codes are only ever shown here.
+func (s *Service) ActivateTOTP(ctx context.Context, userID string, req MFACodeRequest) (RecoveryCodesResponse, error) {
+	if err := req.Validate(); err != nil {
+		return RecoveryCodesResponse{}, err
+	}
+	enrollment, err := s.repo.GetMFA(ctx, userID)
+	if err != nil {
+		return RecoveryCodesResponse{}, err
+	}
+	if enrollment.Enabled {
+		return RecoveryCodesResponse{}, ErrMFAAlreadyEnabled
+	}
+	step, ok := matchTOTP(enrollment.Secret, strings.TrimSpace(req.Code), s.now())
+	if !ok {
+		return RecoveryCodesResponse{}, ErrInvalidMFACode
+	}
+	codes, err := newRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return RecoveryCodesResponse{}, err
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = hashRecoveryCode(code)
+	}
+	if err := s.repo.EnableTOTP(ctx, userID, enrollment.Secret, step, hashes); err != nil {
+		return RecoveryCodesResponse{}, err
+	}
+	return RecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+// DisableTOTP removes the second factor after checking a current code or recovery code.
+func (s *Service) DisableTOTP(ctx context.Context, userID string, req MFACodeRequest) error {
+	if err := req.Validate(); err != nil {
+		return err
+	}
+	enrollment, err := s.repo.GetMFA(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !enrollment.Enabled {
+		return ErrMFANotEnrolled
+	}
+	if _, err := s.checkSecondFactor(ctx, userID, enrollment, req.Code); err != nil {
+		return err
+	}
+	return s.repo.DisableTOTP(ctx, userID)
+}
+
+// CompleteMFALogin is the second login step: it exchanges a challenge token and a code for a session token.
+func (s *Service) CompleteMFALogin(ctx context.Context, req MFALoginRequest, correlationID string) (LoginResponse, error) {
+	if err := req.Validate(); err != nil {
+		return LoginResponse{}, err
+	}
+	userID, firstFactor, err := s.auth.ParseMFAChallenge(req.MFAToken)
+	if err != nil {
+		return LoginResponse{}, err
+	}
+	user, err := s.repo.GetByID(ctx, userID)
+	if err != nil {
+		return LoginResponse{}, err
+	}
+	if s.limiter != nil {
+		retryAfter, err := s.limiter.Check(ctx, user.Username, "")
+		if err != nil {
+			return LoginResponse{}, err
+		}
+		if retryAfter > 0 {
+			return LoginResponse{}, &LockedError{RetryAfter: retryAfter}
+		}
+	}
+	enrollment, err := s.repo.GetMFA(ctx, user.ID)
+	if err != nil {
+		return LoginResponse{}, err
+	}
+	if !enrollment.Enabled {
+		return LoginResponse{}, ErrMFANotEnrolled
+	}
+	method, err := s.checkSecondFactor(ctx, user.ID, enrollment, req.Code)
+	if err != nil {
+		return LoginResponse{}, err
+	}
+	if s.limiter != nil {
+		if err := s.limiter.Reset(ctx, user.Username); err != nil {
+			return LoginResponse{}, err
+		}
+	}
+
+	// A sanction applied between the two steps still applies.
+	if err := s.checkSanctions(ctx, user.ID); err != nil {
+		return LoginResponse{}, err
+	}
+	if correlationID == "" {
+		correlationID, err = newUUID()
+		if err != nil {
+			return LoginResponse{}, err
+		}
+	}
+	grants, err := s.repo.GetGrants(ctx, user.ID)
+	if err != nil {
+		return LoginResponse{}, err
+	}
+	return s.issueSession(correlationID, user, grants, firstFactor+"+"+method, true)
+}
+
+// checkSecondFactor verifies a code under the user's second-factor lockout. Wrong codes are counted per
+// user apart from password failures, and only an accepted code clears them, so logging in with the
+// password again does not buy more guesses.
+func (s *Service) checkSecondFactor(ctx context.Context, userID string, enrollment MFAEnrollment, code string) (string, error) {
+	if s.limiter == nil {
+		return s.verifySecondFactor(ctx, userID, enrollment, code)
+	}
+	retryAfter, err := s.limiter.CheckMFA(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	if retryAfter > 0 {
+		return "", &LockedError{RetryAfter: retryAfter}
+	}
+	method, err := s.verifySecondFactor(ctx, userID, enrollment, code)
+	if errors.Is(err, ErrInvalidMFACode) {
+		_, lockout, recordErr := s.limiter.RecordMFAFailure(ctx, userID)
+		if recordErr != nil {
+			return "", recordErr
+		}
+		if lockout > 0 {
+			return "", &LockedError{RetryAfter: lockout}
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := s.limiter.ResetMFA(ctx, userID); err != nil {
+		return "", err
+	}
+	return method, nil
+}
+
+// verifySecondFactor accepts a TOTP code newer than the last one used, or an unused recovery code.
+// Surrounding whitespace is ignored, as in MFACodeRequest.Validate.
+func (s *Service) verifySecondFactor(ctx context.Context, userID string, enrollment MFAEnrollment, code string) (string, error) {
+	code = strings.TrimSpace(code)
+	if step, ok := matchTOTP(enrollment.Secret, code, s.now()); ok {
+		if step <= enrollment.LastUsedStep {
+			return "", ErrInvalidMFACode
+		}
+		if err := s.repo.UseTOTPStep(ctx, userID, step); err != nil {
+			return "", err
+		}
+		return "totp", nil
+	}
+	if err := s.repo.UseRecoveryCode(ctx, userID, hashRecoveryCode(code)); err != nil {
+		return "", err
+	}
+	return "recovery_code", nil
+}
+
+// finishLogin runs once the first factor is verified. Sanctioned users are refused, and accounts with
+// TOTP get a challenge token instead of a session token.
+func (s *Service) finishLogin(ctx context.Context, correlationID string, user User, authMethod string) (LoginResponse, error) {
+	if err := s.checkSanctions(ctx, user.ID); err != nil {
+		return LoginResponse{}, err
+	}
+	enrollment, err := s.repo.GetMFA(ctx, user.ID)
+	if err != nil && !errors.Is(err, ErrMFANotEnrolled) {
+		return LoginResponse{}, err
+	}
+	if enrollment.Enabled {
+		challenge, err := s.auth.GenerateMFAChallenge(user.ID, user.Username, authMethod, mfaChallengeTTL)
+		if err != nil {
+			return LoginResponse{}, err
+		}
+		return LoginResponse{MFARequired: true, MFAToken: challenge}, nil
+	}
+	grants, err := s.repo.GetGrants(ctx, user.ID)
+	if err != nil {
+		return LoginResponse{}, err
+	}
+	return s.issueSession(correlationID, user, grants, authMethod, false)
+}
+
+// issueSession signs the session token and publishes user.logged_in. Without a verified second factor,
+// roles named in MFAConfig.RequiredRoles are withheld, and so are all scopes, since scopes cannot be
+// traced back to the role that granted them.
+func (s *Service) issueSession(correlationID string, user User, grants Grants, authMethod string, mfaVerified bool) (LoginResponse, error) {
+	var resp LoginResponse
+	if !mfaVerified && s.requiresMFA(grants.Roles) {
+		grants = Grants{Roles: withoutRoles(grants.Roles, s.mfa.RequiredRoles)}
+		resp.MFAEnrollmentRequired = true
+	}
+	token, err := s.auth.GeneratePrincipalToken(principalFor(user, grants))
+	if err != nil {
+		return LoginResponse{}, err
+	}
+	if err := s.publishLoggedInWith(correlationID, user, authMethod); err != nil {
+		return LoginResponse{}, err
+	}
+	resp.Token, resp.User = token, mapUser(user, grants)
+	return resp, nil
+}
+
+func (s *Service) requiresMFA(roles []string) bool {
+	for _, role := range roles {
+		if contains(s.mfa.RequiredRoles, role) {
+			return true
+		}
+	}
+	return false
+}
+
+func withoutRoles(roles, drop []string) []string {
+	var kept []string
+	for _, role := range roles {
+		if !contains(drop, role) {
+			kept = append(kept, role)
+		}
+	}
+	return kept
+}
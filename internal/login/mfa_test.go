@@ -0,0 +1,218 @@
+package login
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/authz"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHOTPReferenceVectors(t *testing.T) {
+	t.Parallel()
+	// RFC 4226 appendix D.
+	key := []byte("12345678901234567890")
+	want := []string{"755224", "287082", "359152", "969429", "338314"}
+	for counter, code := range want {
+		if got := hotp(key, uint64(counter)); got != code {
+			t.Fatalf("counter %d: expected %s got %s", counter, code, got)
+		}
+	}
+}
+
+func TestMatchTOTPWindow(t *testing.T) {
+	t.Parallel()
+	secret := base32NoPadding.EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(59, 0)
+	key := []byte("12345678901234567890")
+	for _, step := range []int64{0, 1, 2} {
+		if got, ok := matchTOTP(secret, hotp(key, uint64(step)), now); !ok || got != step {
+			t.Fatalf("step %d: expected match, got %d %v", step, got, ok)
+		}
+	}
+	if _, ok := matchTOTP(secret, hotp(key, 3), now); ok {
+		t.Fatal("code two steps ahead must not match")
+	}
+}
+
+// mfaFixture enrolls and activates TOTP for alice with a pinned clock.
+func mfaFixture(t *testing.T) (*Service, *fakeRepo, *Authenticator, []string, func(time.Time) string) {
+	t.Helper()
+	ctx := context.Background()
+	auth := NewAuthenticator("test-secret", time.Hour).WithBcryptCost(bcrypt.MinCost)
+	repo := newFakeRepo(t, auth, "alice", "password123")
+	svc := NewService(repo, auth, nil)
+	clock := time.Unix(1_700_000_000, 0)
+	svc.now = func() time.Time { return clock }
+
+	enroll, err := svc.EnrollTOTP(ctx, "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(enroll.ProvisioningURI, "otpauth://totp/") {
+		t.Fatalf("unexpected provisioning uri %s", enroll.ProvisioningURI)
+	}
+	key, err := base32NoPadding.DecodeString(enroll.Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codeAt := func(at time.Time) string { return hotp(key, uint64(at.Unix()/totpPeriod)) }
+
+	// Codes pasted from an authenticator often carry surrounding whitespace.
+	recovery, err := svc.ActivateTOTP(ctx, "u1", MFACodeRequest{Code: " " + codeAt(clock) + "\n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recovery.RecoveryCodes) != recoveryCodeCount {
+		t.Fatalf("expected %d recovery codes, got %d", recoveryCodeCount, len(recovery.RecoveryCodes))
+	}
+	// Later logins happen a few steps after activation so the activation code is not a replay.
+	clock = clock.Add(2 * totpPeriod * time.Second)
+	return svc, repo, auth, recovery.RecoveryCodes, codeAt
+}
+
+func TestMFALogin(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	t.Run("two steps", func(t *testing.T) {
+		t.Parallel()
+		svc, _, auth, _, codeAt := mfaFixture(t)
+		first, err := svc.Login(ctx, LoginRequest{Username: "alice", Password: "password123"}, "corr-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !first.MFARequired || first.Token != "" || first.MFAToken == "" {
+			t.Fatalf("expected an mfa challenge, got %+v", first)
+		}
+		if _, err := auth.ParsePrincipal(first.MFAToken); err == nil {
+			t.Fatal("challenge token must not be accepted as a session token")
+		}
+		resp, err := svc.CompleteMFALogin(ctx, MFALoginRequest{MFAToken: first.MFAToken, Code: codeAt(svc.now()) + " "}, "corr-2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Token == "" || resp.User.ID != "u1" {
+			t.Fatalf("expected a session, got %+v", resp)
+		}
+		_, err = svc.CompleteMFALogin(ctx, MFALoginRequest{MFAToken: first.MFAToken, Code: codeAt(svc.now())}, "corr-3")
+		if !errors.Is(err, ErrInvalidMFACode) {
+			t.Fatalf("expected replayed code to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("recovery codes are single use", func(t *testing.T) {
+		t.Parallel()
+		svc, _, _, codes, _ := mfaFixture(t)
+		first, err := svc.Login(ctx, LoginRequest{Username: "alice", Password: "password123"}, "corr-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := svc.CompleteMFALogin(ctx, MFALoginRequest{MFAToken: first.MFAToken, Code: strings.ToUpper(codes[0])}, "corr-2"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := svc.CompleteMFALogin(ctx, MFALoginRequest{MFAToken: first.MFAToken, Code: codes[0]}, "corr-3"); !errors.Is(err, ErrInvalidMFACode) {
+			t.Fatalf("expected used recovery code to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("wrong codes count towards lockout", func(t *testing.T) {
+		t.Parallel()
+		svc, _, _, _, _ := mfaFixture(t)
+		limiter := &fakeLimiter{mfaLockAfter: 1}
+		svc.WithAttemptLimiter(limiter)
+		first, err := svc.Login(ctx, LoginRequest{Username: "alice", Password: "password123"}, "corr-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = svc.CompleteMFALogin(ctx, MFALoginRequest{MFAToken: first.MFAToken, Code: "000000"}, "corr-2")
+		var locked *LockedError
+		if !errors.As(err, &locked) || limiter.mfaFailures != 1 || limiter.failures != 0 {
+			t.Fatalf("expected lockout after recorded failure, got %v (mfa failures=%d)", err, limiter.mfaFailures)
+		}
+	})
+
+	t.Run("logging in again does not clear code failures", func(t *testing.T) {
+		t.Parallel()
+		svc, _, _, _, codeAt := mfaFixture(t)
+		limiter := &fakeLimiter{mfaLockAfter: 3}
+		svc.WithAttemptLimiter(limiter)
+		challenge := func() string {
+			t.Helper()
+			resp, err := svc.Login(ctx, LoginRequest{Username: "alice", Password: "password123"}, "corr-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			return resp.MFAToken
+		}
+		first := challenge()
+		for i := 0; i < 2; i++ {
+			if _, err := svc.CompleteMFALogin(ctx, MFALoginRequest{MFAToken: first, Code: "000000"}, "corr-2"); !errors.Is(err, ErrInvalidMFACode) {
+				t.Fatalf("attempt %d: expected ErrInvalidMFACode, got %v", i, err)
+			}
+		}
+		second := challenge()
+		var locked *LockedError
+		if _, err := svc.CompleteMFALogin(ctx, MFALoginRequest{MFAToken: second, Code: "000000"}, "corr-3"); !errors.As(err, &locked) {
+			t.Fatalf("expected lockout after the password login, got %v", err)
+		}
+		if _, err := svc.CompleteMFALogin(ctx, MFALoginRequest{MFAToken: second, Code: codeAt(svc.now())}, "corr-4"); !errors.As(err, &locked) {
+			t.Fatalf("expected even a right code refused while locked, got %v", err)
+		}
+	})
+
+	t.Run("disable", func(t *testing.T) {
+		t.Parallel()
+		svc, _, _, _, codeAt := mfaFixture(t)
+		if err := svc.DisableTOTP(ctx, "u1", MFACodeRequest{Code: "000000"}); !errors.Is(err, ErrInvalidMFACode) {
+			t.Fatalf("expected wrong code to be rejected, got %v", err)
+		}
+		if err := svc.DisableTOTP(ctx, "u1", MFACodeRequest{Code: codeAt(svc.now())}); err != nil {
+			t.Fatal(err)
+		}
+		resp, err := svc.Login(ctx, LoginRequest{Username: "alice", Password: "password123"}, "corr-1")
+		if err != nil || resp.MFARequired || resp.Token == "" {
+			t.Fatalf("expected single-step login after disabling, got %+v (%v)", resp, err)
+		}
+	})
+}
+
+func TestEnrollTOTPRestrictions(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	svc, repo, _, _, _ := mfaFixture(t)
+	if _, err := svc.EnrollTOTP(ctx, "u1"); !errors.Is(err, ErrMFAAlreadyEnabled) {
+		t.Fatalf("expected re-enrollment to be refused, got %v", err)
+	}
+	guest, _ := repo.CreateGuest(ctx, "guest-1", "device-hash")
+	if _, err := svc.EnrollTOTP(ctx, guest.ID); !errors.Is(err, ErrMFAUnavailable) {
+		t.Fatalf("expected guests to be refused, got %v", err)
+	}
+}
+
+func TestAdminRoleRequiresMFA(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	auth := NewAuthenticator("test-secret", time.Hour).WithBcryptCost(bcrypt.MinCost)
+	repo := newFakeRepo(t, auth, "alice", "password123")
+	repo.grants["u1"] = Grants{Roles: []string{authz.RoleAdmin, "moderator"}, Scopes: []string{authz.ScopeAdminRolesWrite}}
+	svc := NewService(repo, auth, nil)
+
+	resp, err := svc.Login(ctx, LoginRequest{Username: "alice", Password: "password123"}, "corr-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.MFAEnrollmentRequired {
+		t.Fatal("expected enrollment to be requested")
+	}
+	principal, err := auth.ParsePrincipal(resp.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if principal.HasRole(authz.RoleAdmin) || len(principal.Scopes) != 0 || !principal.HasRole("moderator") {
+		t.Fatalf("expected admin role and scopes withheld, got roles=%v scopes=%v", principal.Roles, principal.Scopes)
+	}
+}
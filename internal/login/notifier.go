@@ -0,0 +1,72 @@
+package login
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Notifier delivers account messages to users. Production deployments plug in email or push delivery;
+// LogNotifier and FileNotifier are stand-ins for local development and tests.
+type Notifier interface {
+	SendPasswordReset(ctx context.Context, user User, token string, expiresAt time.Time) error
+}
+
+// LogNotifier writes reset tokens to the service log. Never use it outside local development.
+type LogNotifier struct {
+	logger zerolog.Logger
+}
+
+func NewLogNotifier(logger zerolog.Logger) *LogNotifier {
+	return &LogNotifier{logger: logger}
+}
+
+func (n *LogNotifier) SendPasswordReset(_ context.Context, user User, token string, expiresAt time.Time) error {
+	n.logger.Info().
+		Str("user_id", user.ID).
+		Str("username", user.Username).
+		Str("reset_token", token).
+		Time("expires_at", expiresAt).
+		Msg("password reset requested")
+	return nil
+}
+
+// FileNotifier appends one JSON line per message to a file, which e2e tests can read back.
+type FileNotifier struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewFileNotifier(path string) *FileNotifier {
+	return &FileNotifier{path: path}
+}
+
+type fileNotification struct {
+	Kind      string    `json:"kind"`
+	UserID    string    `json:"user_id"`
+	Username  string    `json:"username"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (n *FileNotifier) SendPasswordReset(_ context.Context, user User, token string, expiresAt time.Time) error {
+	line, err := json.Marshal(fileNotification{Kind: "password_reset", UserID: user.ID, Username: user.Username, Token: token, ExpiresAt: expiresAt})
+	if err != nil {
+		return err
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	f, err := os.OpenFile(n.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,519 @@
+package login
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrUnknownProvider    = errors.New("unknown identity provider")
+	ErrInvalidOIDCState   = errors.New("invalid or expired oidc state")
+	ErrOIDCVerification   = errors.New("oidc verification failed")
+	errOIDCNotConfigured  = errors.New("oidc login is not configured")
+	errUnsupportedJWTAlgo = errors.New("unsupported id token algorithm")
+)
+
+const oidcStateTTL = 10 * time.Minute
+
+// unusablePasswordHash is stored for accounts created through an identity provider. It never matches a
+// bcrypt comparison, so such accounts cannot be claimed through the legacy empty-hash password path.
+const unusablePasswordHash = "!"
+
+// OIDCProviderConfig configures one OpenID Connect provider, typically loaded from LOGIN_OIDC_PROVIDERS.
+type OIDCProviderConfig struct {
+	Name         string   `json:"name"`
+	Issuer       string   `json:"issuer"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	RedirectURL  string   `json:"redirect_url"`
+	Scopes       []string `json:"scopes"`
+}
+
+// OIDCState is what the login service remembers between redirecting to the provider and the callback.
+type OIDCState struct {
+	Provider     string `json:"provider"`
+	CodeVerifier string `json:"code_verifier"`
+	Nonce        string `json:"nonce"`
+	LinkUserID   string `json:"link_user_id,omitempty"`
+}
+
+type OIDCStateStore interface {
+	Save(ctx context.Context, state string, value OIDCState, ttl time.Duration) error
+	// Take returns and deletes the state so a callback can only be redeemed once.
+	Take(ctx context.Context, state string) (OIDCState, error)
+}
+
+type RedisOIDCStateStore struct {
+	client *redis.Client
+}
+
+func NewRedisOIDCStateStore(client *redis.Client) *RedisOIDCStateStore {
+	return &RedisOIDCStateStore{client: client}
+}
+
+func (s *RedisOIDCStateStore) Save(ctx context.Context, state string, value OIDCState, ttl time.Duration) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, oidcStateKey(state), raw, ttl).Err()
+}
+
+func (s *RedisOIDCStateStore) Take(ctx context.Context, state string) (OIDCState, error) {
+	raw, err := s.client.GetDel(ctx, oidcStateKey(state)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return OIDCState{}, ErrInvalidOIDCState
+	}
+	if err != nil {
+		return OIDCState{}, err
+	}
+	var value OIDCState
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return OIDCState{}, err
+	}
+	return value, nil
+}
+
+func oidcStateKey(state string) string { return "pcgb:login:oidc:state:" + state }
+
+// OIDCProvider talks to a single provider: discovery, authorization URLs, code exchange and ID token checks.
+type OIDCProvider struct {
+	cfg    OIDCProviderConfig
+	client *http.Client
+
+	mu          sync.Mutex
+	discovery   *oidcDiscovery
+	keys        map[string]*rsa.PublicKey
+	keysFetched time.Time
+}
+
+// jwksRefetchInterval bounds how often tokens signed with unknown keys can make a provider's JWKS be
+// fetched again.
+const jwksRefetchInterval = time.Minute
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+func NewOIDCProvider(cfg OIDCProviderConfig, client *http.Client) *OIDCProvider {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "profile", "email"}
+	}
+	return &OIDCProvider{cfg: cfg, client: client}
+}
+
+func (p *OIDCProvider) Name() string { return p.cfg.Name }
+
+// AuthCodeURL builds the authorization request with an S256 PKCE challenge.
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", p.cfg.ClientID)
+	q.Set("redirect_uri", p.cfg.RedirectURL)
+	q.Set("scope", strings.Join(p.cfg.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", codeChallenge)
+	q.Set("code_challenge_method", "S256")
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return d.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Exchange redeems the authorization code and returns the raw ID token.
+func (p *OIDCProvider) Exchange(ctx context.Context, code, codeVerifier string) (string, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.cfg.RedirectURL)
+	form.Set("code_verifier", codeVerifier)
+	form.Set("client_id", p.cfg.ClientID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%w: token endpoint returned %d", ErrOIDCVerification, resp.StatusCode)
+	}
+	var body struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", err
+	}
+	if body.IDToken == "" {
+		return "", fmt.Errorf("%w: token response has no id_token", ErrOIDCVerification)
+	}
+	return body.IDToken, nil
+}
+
+type oidcIDClaims struct {
+	Iss               string   `json:"iss"`
+	Sub               string   `json:"sub"`
+	Aud               audience `json:"aud"`
+	Exp               int64    `json:"exp"`
+	Iat               int64    `json:"iat"`
+	Nonce             string   `json:"nonce"`
+	Email             string   `json:"email"`
+	EmailVerified     bool     `json:"email_verified"`
+	PreferredUsername string   `json:"preferred_username"`
+}
+
+// audience accepts both the string and array forms of the aud claim.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
+
+// VerifyIDToken checks the RS256 signature against the provider JWKS and validates iss, aud, exp and nonce.
+func (p *OIDCProvider) VerifyIDToken(ctx context.Context, raw, nonce string, now time.Time) (oidcIDClaims, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return oidcIDClaims{}, ErrOIDCVerification
+	}
+	headerRaw, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return oidcIDClaims{}, ErrOIDCVerification
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(headerRaw, &header); err != nil {
+		return oidcIDClaims{}, ErrOIDCVerification
+	}
+	if header.Alg != "RS256" {
+		return oidcIDClaims{}, fmt.Errorf("%w: %w", ErrOIDCVerification, errUnsupportedJWTAlgo)
+	}
+	key, err := p.publicKey(ctx, header.Kid)
+	if err != nil {
+		return oidcIDClaims{}, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return oidcIDClaims{}, ErrOIDCVerification
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig); err != nil {
+		return oidcIDClaims{}, fmt.Errorf("%w: bad signature", ErrOIDCVerification)
+	}
+
+	claimsRaw, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return oidcIDClaims{}, ErrOIDCVerification
+	}
+	var claims oidcIDClaims
+	if err := json.Unmarshal(claimsRaw, &claims); err != nil {
+		return oidcIDClaims{}, ErrOIDCVerification
+	}
+	switch {
+	case claims.Iss != p.cfg.Issuer:
+		return oidcIDClaims{}, fmt.Errorf("%w: issuer mismatch", ErrOIDCVerification)
+	case !contains(claims.Aud, p.cfg.ClientID):
+		return oidcIDClaims{}, fmt.Errorf("%w: audience mismatch", ErrOIDCVerification)
+	case claims.Exp < now.Unix():
+		return oidcIDClaims{}, fmt.Errorf("%w: id token expired", ErrOIDCVerification)
+	case claims.Nonce != nonce:
+		return oidcIDClaims{}, fmt.Errorf("%w: nonce mismatch", ErrOIDCVerification)
+	case claims.Sub == "":
+		return oidcIDClaims{}, fmt.Errorf("%w: missing subject", ErrOIDCVerification)
+	}
+	return claims, nil
+}
+
+func (p *OIDCProvider) discover(ctx context.Context) (oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return *p.discovery, nil
+	}
+	var d oidcDiscovery
+	if err := p.getJSON(ctx, strings.TrimSuffix(p.cfg.Issuer, "/")+"/.well-known/openid-configuration", &d); err != nil {
+		return oidcDiscovery{}, err
+	}
+	if d.Issuer != p.cfg.Issuer {
+		return oidcDiscovery{}, fmt.Errorf("%w: discovery issuer %q does not match %q", ErrOIDCVerification, d.Issuer, p.cfg.Issuer)
+	}
+	p.discovery = &d
+	return d, nil
+}
+
+// publicKey returns the signing key for kid. An unknown key refetches the JWKS to pick up a rotation,
+// at most once per jwksRefetchInterval.
+func (p *OIDCProvider) publicKey(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	key, ok := p.keys[kid]
+	recent := p.keys != nil && time.Since(p.keysFetched) < jwksRefetchInterval
+	p.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+	if recent {
+		return nil, fmt.Errorf("%w: unknown signing key %q", ErrOIDCVerification, kid)
+	}
+
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := p.getJSON(ctx, d.JWKSURI, &set); err != nil {
+		return nil, err
+	}
+	keys := map[string]*rsa.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	p.mu.Lock()
+	p.keys, p.keysFetched = keys, time.Now()
+	p.mu.Unlock()
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: unknown signing key %q", ErrOIDCVerification, kid)
+}
+
+func (p *OIDCProvider) getJSON(ctx context.Context, endpoint string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("get %s: status %d", endpoint, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// WithOIDC enables external identity provider login.
+func (s *Service) WithOIDC(providers []*OIDCProvider, store OIDCStateStore) *Service {
+	s.oidcProviders = make(map[string]*OIDCProvider, len(providers))
+	for _, p := range providers {
+		s.oidcProviders[p.Name()] = p
+	}
+	s.oidcStates = store
+	return s
+}
+
+// StartOIDC begins an authorization-code login. When linkUserID is set the resulting identity is
+// attached to that existing user instead of signing in.
+func (s *Service) StartOIDC(ctx context.Context, providerName, linkUserID string) (OIDCStartResponse, error) {
+	provider, err := s.oidcProvider(providerName)
+	if err != nil {
+		return OIDCStartResponse{}, err
+	}
+	state, err := randomToken(24)
+	if err != nil {
+		return OIDCStartResponse{}, err
+	}
+	nonce, err := randomToken(24)
+	if err != nil {
+		return OIDCStartResponse{}, err
+	}
+	verifier, err := randomToken(32)
+	if err != nil {
+		return OIDCStartResponse{}, err
+	}
+	authURL, err := provider.AuthCodeURL(ctx, state, nonce, pkceChallenge(verifier))
+	if err != nil {
+		return OIDCStartResponse{}, err
+	}
+	value := OIDCState{Provider: providerName, CodeVerifier: verifier, Nonce: nonce, LinkUserID: linkUserID}
+	if err := s.oidcStates.Save(ctx, state, value, oidcStateTTL); err != nil {
+		return OIDCStartResponse{}, err
+	}
+	return OIDCStartResponse{AuthorizationURL: authURL, State: state}, nil
+}
+
+// CompleteOIDC handles the provider callback: it redeems the state, exchanges the code with the PKCE
+// verifier, verifies the ID token and signs in (or links) the user behind the external identity.
+func (s *Service) CompleteOIDC(ctx context.Context, providerName, code, state, correlationID string) (LoginResponse, error) {
+	provider, err := s.oidcProvider(providerName)
+	if err != nil {
+		return LoginResponse{}, err
+	}
+	saved, err := s.oidcStates.Take(ctx, state)
+	if err != nil {
+		return LoginResponse{}, err
+	}
+	if saved.Provider != providerName {
+		return LoginResponse{}, ErrInvalidOIDCState
+	}
+	rawIDToken, err := provider.Exchange(ctx, code, saved.CodeVerifier)
+	if err != nil {
+		return LoginResponse{}, err
+	}
+	claims, err := provider.VerifyIDToken(ctx, rawIDToken, saved.Nonce, time.Now().UTC())
+	if err != nil {
+		return LoginResponse{}, err
+	}
+
+	identity := Identity{Provider: providerName, Subject: claims.Sub, Email: claims.Email}
+	user, err := s.userForIdentity(ctx, identity, claims, saved.LinkUserID)
+	if err != nil {
+		return LoginResponse{}, err
+	}
+	if correlationID == "" {
+		correlationID, err = newUUID()
+		if err != nil {
+			return LoginResponse{}, err
+		}
+	}
+	return s.finishLogin(ctx, correlationID, user, "oidc:"+providerName)
+}
+
+func (s *Service) userForIdentity(ctx context.Context, identity Identity, claims oidcIDClaims, linkUserID string) (User, error) {
+	existing, err := s.repo.GetByIdentity(ctx, identity.Provider, identity.Subject)
+	switch {
+	case err == nil:
+		if linkUserID != "" && existing.ID != linkUserID {
+			return User{}, ErrIdentityLinked
+		}
+		return existing, nil
+	case !errors.Is(err, ErrIdentityNotFound):
+		return User{}, err
+	}
+
+	if linkUserID != "" {
+		if err := s.repo.LinkIdentity(ctx, linkUserID, identity); err != nil {
+			return User{}, err
+		}
+		return s.repo.GetByID(ctx, linkUserID)
+	}
+
+	username := oidcUsername(claims)
+	user, err := s.repo.CreateWithIdentity(ctx, username, identity)
+	for attempt := 0; attempt < oidcUsernameRetries && errors.Is(err, ErrUsernameTaken); attempt++ {
+		suffix, suffixErr := randomToken(3)
+		if suffixErr != nil {
+			return User{}, suffixErr
+		}
+		user, err = s.repo.CreateWithIdentity(ctx, username+"-"+strings.ToLower(suffix), identity)
+	}
+	if errors.Is(err, ErrUsernameTaken) {
+		// A suffix derived from the identity is unique unless someone picked that exact name.
+		sum := sha256.Sum256([]byte(identity.Provider + "|" + identity.Subject))
+		user, err = s.repo.CreateWithIdentity(ctx, username+"-"+hex.EncodeToString(sum[:6]), identity)
+	}
+	return user, err
+}
+
+// oidcUsernameRetries is how many random suffixes are tried when a derived username is taken.
+const oidcUsernameRetries = 3
+
+func (s *Service) oidcProvider(name string) (*OIDCProvider, error) {
+	if s.oidcStates == nil {
+		return nil, errOIDCNotConfigured
+	}
+	provider, ok := s.oidcProviders[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return provider, nil
+}
+
+// oidcUsername derives a local username from the provider claims, keeping only safe characters.
+func oidcUsername(claims oidcIDClaims) string {
+	candidate := claims.PreferredUsername
+	if candidate == "" && claims.Email != "" {
+		candidate = strings.SplitN(claims.Email, "@", 2)[0]
+	}
+	var b strings.Builder
+	for _, r := range strings.ToLower(candidate) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' || r == '-' || r == '.' {
+			b.WriteRune(r)
+		}
+	}
+	name := b.String()
+	if len(name) > 48 {
+		name = name[:48]
+	}
+	if len(name) < 3 || reservedUsername(name) {
+		name = "player"
+	}
+	return name
+}
+
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,305 @@
+package login
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/oidcmock"
+)
+
+type memStateStore struct {
+	mu     sync.Mutex
+	states map[string]OIDCState
+}
+
+func (m *memStateStore) Save(_ context.Context, state string, value OIDCState, _ time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.states[state] = value
+	return nil
+}
+
+func (m *memStateStore) Take(_ context.Context, state string) (OIDCState, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	value, ok := m.states[state]
+	if !ok {
+		return OIDCState{}, ErrInvalidOIDCState
+	}
+	delete(m.states, state)
+	return value, nil
+}
+
+func (m *memStateStore) tamper(state string, fn func(*OIDCState)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	value := m.states[state]
+	fn(&value)
+	m.states[state] = value
+}
+
+const testRedirectURL = "http://login.test/v1/login/oidc/mock/callback"
+
+func newOIDCTestService(t *testing.T, repo *fakeRepo) (*Service, *memStateStore) {
+	t.Helper()
+	idp, err := oidcmock.New(oidcmock.Client{ID: "pcgb", Secret: "pcgb-secret", RedirectURIs: []string{testRedirectURL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(idp)
+	t.Cleanup(ts.Close)
+	idp.SetIssuer(ts.URL)
+
+	provider := NewOIDCProvider(OIDCProviderConfig{
+		Name:         "mock",
+		Issuer:       ts.URL,
+		ClientID:     "pcgb",
+		ClientSecret: "pcgb-secret",
+		RedirectURL:  testRedirectURL,
+	}, ts.Client())
+	store := &memStateStore{states: map[string]OIDCState{}}
+	auth := NewAuthenticator("test-secret", time.Hour)
+	return NewService(repo, auth, nil).WithOIDC([]*OIDCProvider{provider}, store), store
+}
+
+// authorize plays the browser: it follows the authorization URL and returns the code and state the
+// provider redirects back with.
+func authorize(t *testing.T, authURL, loginHint string) (string, string) {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	res, err := client.Get(authURL + "&login_hint=" + url.QueryEscape(loginHint))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = res.Body.Close() }()
+	if res.StatusCode != http.StatusFound {
+		t.Fatalf("expected redirect from authorize, got %d", res.StatusCode)
+	}
+	location, err := url.Parse(res.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(location.String(), testRedirectURL) {
+		t.Fatalf("unexpected redirect %s", location)
+	}
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+func TestOIDCLoginFlow(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	auth := NewAuthenticator("test-secret", time.Hour)
+	repo := newFakeRepo(t, auth, "bob", "password123")
+	svc, _ := newOIDCTestService(t, repo)
+
+	login := func(hint string) LoginResponse {
+		t.Helper()
+		start, err := svc.StartOIDC(ctx, "mock", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		code, state := authorize(t, start.AuthorizationURL, hint)
+		if state != start.State {
+			t.Fatalf("state not echoed: %s != %s", state, start.State)
+		}
+		resp, err := svc.CompleteOIDC(ctx, "mock", code, state, "corr-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	first := login("alice")
+	if first.Token == "" || first.User.Username != "alice" {
+		t.Fatalf("unexpected first login %+v", first)
+	}
+	again := login("alice")
+	if again.User.ID != first.User.ID {
+		t.Fatalf("expected the linked user on repeat login, got %s and %s", first.User.ID, again.User.ID)
+	}
+
+	if _, err := svc.Login(ctx, LoginRequest{Username: "alice", Password: "password123"}, "corr-2"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("password login must not claim an oidc-created account, got %v", err)
+	}
+
+	collided := login("bob")
+	if collided.User.ID == "u1" || !strings.HasPrefix(collided.User.Username, "bob-") {
+		t.Fatalf("expected a fresh user with a suffixed username, got %+v", collided.User)
+	}
+}
+
+func TestOIDCRejections(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	auth := NewAuthenticator("test-secret", time.Hour)
+	tests := []struct {
+		name   string
+		tamper func(*OIDCState)
+		replay bool
+		want   error
+	}{
+		{name: "wrong pkce verifier", tamper: func(s *OIDCState) { s.CodeVerifier = "not-the-verifier-used-for-the-challenge" }, want: ErrOIDCVerification},
+		{name: "nonce mismatch", tamper: func(s *OIDCState) { s.Nonce = "other" }, want: ErrOIDCVerification},
+		{name: "provider mismatch", tamper: func(s *OIDCState) { s.Provider = "other" }, want: ErrInvalidOIDCState},
+		{name: "replayed state", replay: true, want: ErrInvalidOIDCState},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			svc, store := newOIDCTestService(t, newFakeRepo(t, auth, "bob", "password123"))
+			start, err := svc.StartOIDC(ctx, "mock", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			code, state := authorize(t, start.AuthorizationURL, "alice")
+			if tc.tamper != nil {
+				store.tamper(state, tc.tamper)
+			}
+			if tc.replay {
+				if _, err := svc.CompleteOIDC(ctx, "mock", code, state, "corr-1"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err := svc.CompleteOIDC(ctx, "mock", code, state, "corr-1"); !errors.Is(err, tc.want) {
+				t.Fatalf("expected %v, got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestOIDCLinkIdentity(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	auth := NewAuthenticator("test-secret", time.Hour)
+	repo := newFakeRepo(t, auth, "bob", "password123")
+	svc, _ := newOIDCTestService(t, repo)
+
+	link := func(userID string) (LoginResponse, error) {
+		start, err := svc.StartOIDC(ctx, "mock", userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		code, state := authorize(t, start.AuthorizationURL, "bobby")
+		return svc.CompleteOIDC(ctx, "mock", code, state, "corr-1")
+	}
+
+	resp, err := link("u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.User.ID != "u1" || repo.identities["mock|mock|bobby"] != "u1" {
+		t.Fatalf("expected identity linked to u1, got %+v", resp.User)
+	}
+	if _, err := link("u-other"); !errors.Is(err, ErrIdentityLinked) {
+		t.Fatalf("expected identity already linked, got %v", err)
+	}
+}
+
+func TestOIDCUnknownKeyRefetchIsRateLimited(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	idp, err := oidcmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	fetches := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/jwks" {
+			mu.Lock()
+			fetches++
+			mu.Unlock()
+		}
+		idp.ServeHTTP(w, r)
+	}))
+	t.Cleanup(ts.Close)
+	idp.SetIssuer(ts.URL)
+	provider := NewOIDCProvider(OIDCProviderConfig{Name: "mock", Issuer: ts.URL, ClientID: "pcgb"}, ts.Client())
+	fetched := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return fetches
+	}
+
+	if _, err := provider.publicKey(ctx, "mock-1"); err != nil || fetched() != 1 {
+		t.Fatalf("expected the first lookup to fetch the JWKS, got %d fetches (%v)", fetched(), err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := provider.publicKey(ctx, "rotated"); !errors.Is(err, ErrOIDCVerification) {
+			t.Fatalf("expected an unknown key error, got %v", err)
+		}
+	}
+	if fetched() != 1 {
+		t.Fatalf("expected unknown keys not to refetch within a minute, got %d fetches", fetched())
+	}
+
+	provider.mu.Lock()
+	provider.keysFetched = time.Now().Add(-jwksRefetchInterval)
+	provider.mu.Unlock()
+	if _, err := provider.publicKey(ctx, "rotated"); !errors.Is(err, ErrOIDCVerification) || fetched() != 2 {
+		t.Fatalf("expected one refetch after the interval, got %d fetches (%v)", fetched(), err)
+	}
+}
+
+// crowdedRepo refuses every username until it has been asked for the first few.
+type crowdedRepo struct {
+	*fakeRepo
+	refusals int
+}
+
+func (r *crowdedRepo) CreateWithIdentity(ctx context.Context, username string, identity Identity) (User, error) {
+	if r.refusals > 0 {
+		r.refusals--
+		return User{}, ErrUsernameTaken
+	}
+	return r.fakeRepo.CreateWithIdentity(ctx, username, identity)
+}
+
+func TestOIDCUsernameCollisions(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	auth := NewAuthenticator("test-secret", time.Hour)
+	identity := Identity{Provider: "mock", Subject: "sub-1"}
+	claims := oidcIDClaims{PreferredUsername: "alice"}
+
+	repo := &crowdedRepo{fakeRepo: newFakeRepo(t, auth, "bob", "password123"), refusals: 2}
+	user, err := NewService(repo, auth, nil).userForIdentity(ctx, identity, claims, "")
+	if err != nil || !strings.HasPrefix(user.Username, "alice-") {
+		t.Fatalf("expected a random suffix after two collisions, got %+v (%v)", user, err)
+	}
+
+	repo = &crowdedRepo{fakeRepo: newFakeRepo(t, auth, "bob", "password123"), refusals: 1 + oidcUsernameRetries}
+	user, err = NewService(repo, auth, nil).userForIdentity(ctx, identity, claims, "")
+	sum := sha256.Sum256([]byte("mock|sub-1"))
+	if want := "alice-" + hex.EncodeToString(sum[:6]); err != nil || user.Username != want {
+		t.Fatalf("expected the subject-derived name %q, got %+v (%v)", want, user, err)
+	}
+}
+
+func TestOIDCUsername(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		claims oidcIDClaims
+		want   string
+	}{
+		{claims: oidcIDClaims{PreferredUsername: "Alice.Smith"}, want: "alice.smith"},
+		{claims: oidcIDClaims{Email: "carol+games@example.com"}, want: "carolgames"},
+		{claims: oidcIDClaims{PreferredUsername: "李"}, want: "player"},
+		{claims: oidcIDClaims{PreferredUsername: "deleted-u1"}, want: "player"},
+	}
+	for _, tc := range tests {
+		if got := oidcUsername(tc.claims); got != tc.want {
+			t.Fatalf("oidcUsername(%+v) = %q, want %q", tc.claims, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package login
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+const passwordResetTTL = 30 * time.Minute
+
+var (
+	ErrInvalidResetToken     = errors.New("invalid or expired reset token")
+	ErrPasswordResetDisabled = errors.New("password reset is not configured")
+)
+
+// ChangePassword replaces the caller's password after checking the current one. Wrong guesses count
+// against the same lockout as password logins so a stolen token cannot be used to brute-force it.
+func (s *Service) ChangePassword(ctx context.Context, userID string, req ChangePasswordRequest) error {
+	if err := req.Validate(); err != nil {
+		return err
+	}
+	user, err := s.repo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if s.limiter != nil {
+		retryAfter, err := s.limiter.Check(ctx, user.Username, "")
+		if err != nil {
+			return err
+		}
+		if retryAfter > 0 {
+			return &LockedError{RetryAfter: retryAfter}
+		}
+	}
+	if err := s.auth.VerifyPassword(user.PasswordHash, req.CurrentPassword); err != nil {
+		if s.limiter != nil {
+			_, lockout, err := s.limiter.RecordFailure(ctx, user.Username, "")
+			if err != nil {
+				return err
+			}
+			if lockout > 0 {
+				return &LockedError{RetryAfter: lockout}
+			}
+		}
+		return ErrInvalidCredentials
+	}
+	hash, err := s.auth.HashPassword(req.NewPassword)
+	if err != nil {
+		return err
+	}
+	return s.repo.UpdatePassword(ctx, user.ID, hash)
+}
+
+// RequestPasswordReset issues a single-use reset token and hands it to the notifier. Unknown users and
+// guests are ignored silently so the endpoint does not reveal which usernames exist; requests for them
+// count towards the per-username and per-IP limits all the same.
+func (s *Service) RequestPasswordReset(ctx context.Context, req PasswordResetRequest) error {
+	if s.notifier == nil {
+		return ErrPasswordResetDisabled
+	}
+	if err := req.Validate(); err != nil {
+		return err
+	}
+	if s.limiter != nil {
+		retryAfter, err := s.limiter.AllowReset(ctx, req.Username, req.ClientIP)
+		if err != nil {
+			return err
+		}
+		if retryAfter > 0 {
+			return &LockedError{RetryAfter: retryAfter}
+		}
+	}
+	user, err := s.repo.GetByUsername(ctx, req.Username)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if user.IsGuest {
+		return nil
+	}
+
+	token, err := randomToken(32)
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Now().UTC().Add(passwordResetTTL)
+	if err := s.repo.CreatePasswordReset(ctx, user.ID, hashResetToken(token), expiresAt); err != nil {
+		return err
+	}
+	return s.notifier.SendPasswordReset(ctx, user, token, expiresAt)
+}
+
+// ConfirmPasswordReset redeems a reset token and sets the new password. Any login lockout on the
+// account is cleared, since the caller has proven control of the account.
+func (s *Service) ConfirmPasswordReset(ctx context.Context, req ConfirmPasswordResetRequest) error {
+	if err := req.Validate(); err != nil {
+		return err
+	}
+	userID, err := s.repo.ConsumePasswordReset(ctx, hashResetToken(req.Token))
+	if err != nil {
+		return err
+	}
+	user, err := s.repo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	hash, err := s.auth.HashPassword(req.NewPassword)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.UpdatePassword(ctx, user.ID, hash); err != nil {
+		return err
+	}
+	if s.limiter != nil {
+		return s.limiter.Reset(ctx, user.Username)
+	}
+	return nil
+}
+
+// hashResetToken is what gets stored; the raw token only ever exists in the notification.
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
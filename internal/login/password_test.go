@@ -0,0 +1,169 @@
+package login
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+type capturingNotifier struct {
+	tokens []string
+}
+
+func (n *capturingNotifier) SendPasswordReset(_ context.Context, _ User, token string, _ time.Time) error {
+	n.tokens = append(n.tokens, token)
+	return nil
+}
+
+func TestChangePassword(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	auth := NewAuthenticator("test-secret", time.Hour).WithBcryptCost(bcrypt.MinCost)
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+		repo := newFakeRepo(t, auth, "alice", "password123")
+		svc := NewService(repo, auth, nil)
+		if err := svc.ChangePassword(ctx, "u1", ChangePasswordRequest{CurrentPassword: "password123", NewPassword: "password456"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := auth.VerifyPassword(repo.users["alice"].PasswordHash, "password456"); err != nil {
+			t.Fatalf("new password not stored: %v", err)
+		}
+	})
+
+	t.Run("wrong current password counts as a failure", func(t *testing.T) {
+		t.Parallel()
+		limiter := &fakeLimiter{lockout: time.Minute}
+		svc := NewService(newFakeRepo(t, auth, "alice", "password123"), auth, nil).WithAttemptLimiter(limiter)
+		err := svc.ChangePassword(ctx, "u1", ChangePasswordRequest{CurrentPassword: "wrong-password", NewPassword: "password456"})
+		var locked *LockedError
+		if !errors.As(err, &locked) || limiter.failures != 1 {
+			t.Fatalf("expected lockout after recorded failure, got %v (failures=%d)", err, limiter.failures)
+		}
+	})
+
+	t.Run("locked out", func(t *testing.T) {
+		t.Parallel()
+		svc := NewService(newFakeRepo(t, auth, "alice", "password123"), auth, nil).WithAttemptLimiter(&fakeLimiter{locked: time.Minute})
+		err := svc.ChangePassword(ctx, "u1", ChangePasswordRequest{CurrentPassword: "password123", NewPassword: "password456"})
+		if !errors.Is(err, ErrTooManyAttempts) {
+			t.Fatalf("expected lockout, got %v", err)
+		}
+	})
+}
+
+func TestPasswordReset(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	auth := NewAuthenticator("test-secret", time.Hour).WithBcryptCost(bcrypt.MinCost)
+
+	t.Run("disabled without notifier", func(t *testing.T) {
+		t.Parallel()
+		svc := NewService(newFakeRepo(t, auth, "alice", "password123"), auth, nil)
+		if err := svc.RequestPasswordReset(ctx, PasswordResetRequest{Username: "alice"}); !errors.Is(err, ErrPasswordResetDisabled) {
+			t.Fatalf("expected reset disabled, got %v", err)
+		}
+	})
+
+	t.Run("unknown user is silent", func(t *testing.T) {
+		t.Parallel()
+		notifier := &capturingNotifier{}
+		svc := NewService(newFakeRepo(t, auth, "alice", "password123"), auth, nil).WithNotifier(notifier)
+		if err := svc.RequestPasswordReset(ctx, PasswordResetRequest{Username: "mallory"}); err != nil {
+			t.Fatal(err)
+		}
+		if len(notifier.tokens) != 0 {
+			t.Fatalf("expected no notification, got %d", len(notifier.tokens))
+		}
+	})
+
+	t.Run("single use and superseded tokens", func(t *testing.T) {
+		t.Parallel()
+		repo := newFakeRepo(t, auth, "alice", "password123")
+		notifier := &capturingNotifier{}
+		limiter := &fakeLimiter{}
+		svc := NewService(repo, auth, nil).WithNotifier(notifier).WithAttemptLimiter(limiter)
+
+		for i := 0; i < 2; i++ {
+			if err := svc.RequestPasswordReset(ctx, PasswordResetRequest{Username: "alice"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for hash := range repo.resets {
+			if hash == notifier.tokens[1] {
+				t.Fatal("raw reset token must not be stored")
+			}
+		}
+		stale, current := notifier.tokens[0], notifier.tokens[1]
+		if err := svc.ConfirmPasswordReset(ctx, ConfirmPasswordResetRequest{Token: stale, NewPassword: "password456"}); !errors.Is(err, ErrInvalidResetToken) {
+			t.Fatalf("expected superseded token to be rejected, got %v", err)
+		}
+		if err := svc.ConfirmPasswordReset(ctx, ConfirmPasswordResetRequest{Token: current, NewPassword: "password456"}); err != nil {
+			t.Fatal(err)
+		}
+		if limiter.resets != 1 {
+			t.Fatalf("expected lockout to be cleared, got %d resets", limiter.resets)
+		}
+		if _, err := svc.Login(ctx, LoginRequest{Username: "alice", Password: "password456"}, "corr-1"); err != nil {
+			t.Fatalf("login with new password: %v", err)
+		}
+		if err := svc.ConfirmPasswordReset(ctx, ConfirmPasswordResetRequest{Token: current, NewPassword: "password789"}); !errors.Is(err, ErrInvalidResetToken) {
+			t.Fatalf("expected reused token to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("requests are throttled", func(t *testing.T) {
+		t.Parallel()
+		notifier := &capturingNotifier{}
+		svc := NewService(newFakeRepo(t, auth, "alice", "password123"), auth, nil).WithNotifier(notifier).WithAttemptLimiter(&fakeLimiter{maxResets: 2})
+		for _, username := range []string{"alice", "nobody"} {
+			if err := svc.RequestPasswordReset(ctx, PasswordResetRequest{Username: username, ClientIP: "10.0.0.1"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var locked *LockedError
+		if err := svc.RequestPasswordReset(ctx, PasswordResetRequest{Username: "alice", ClientIP: "10.0.0.1"}); !errors.As(err, &locked) {
+			t.Fatalf("expected the third request refused, got %v", err)
+		}
+		if len(notifier.tokens) != 1 {
+			t.Fatalf("expected one token sent, got %d", len(notifier.tokens))
+		}
+	})
+
+	t.Run("expired token", func(t *testing.T) {
+		t.Parallel()
+		repo := newFakeRepo(t, auth, "alice", "password123")
+		repo.resets[hashResetToken("old")] = fakeReset{userID: "u1", expiresAt: time.Now().Add(-time.Minute)}
+		svc := NewService(repo, auth, nil)
+		if err := svc.ConfirmPasswordReset(ctx, ConfirmPasswordResetRequest{Token: "old", NewPassword: "password456"}); !errors.Is(err, ErrInvalidResetToken) {
+			t.Fatalf("expected expired token to be rejected, got %v", err)
+		}
+	})
+}
+
+func TestLoginRehashesWhenCostIsRaised(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	oldAuth := NewAuthenticator("test-secret", time.Hour).WithBcryptCost(bcrypt.MinCost)
+	repo := newFakeRepo(t, oldAuth, "alice", "password123")
+
+	newAuth := NewAuthenticator("test-secret", time.Hour).WithBcryptCost(bcrypt.MinCost + 1)
+	if !newAuth.NeedsRehash(repo.users["alice"].PasswordHash) {
+		t.Fatal("expected the old hash to need a rehash")
+	}
+	svc := NewService(repo, newAuth, nil)
+	if _, err := svc.Login(ctx, LoginRequest{Username: "alice", Password: "password123"}, "corr-1"); err != nil {
+		t.Fatal(err)
+	}
+	cost, err := bcrypt.Cost([]byte(repo.users["alice"].PasswordHash))
+	if err != nil || cost != bcrypt.MinCost+1 {
+		t.Fatalf("expected hash upgraded to cost %d, got %d (%v)", bcrypt.MinCost+1, cost, err)
+	}
+	if newAuth.NeedsRehash(repo.users["alice"].PasswordHash) {
+		t.Fatal("upgraded hash should not need another rehash")
+	}
+}
@@ -0,0 +1,127 @@
+package login
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/authz"
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/contracts"
+)
+
+var ErrGuestUsername = errors.New("guests choose a username when upgrading their account")
+
+// UpdateProfile applies a partial profile update and publishes user.updated with the changed fields.
+// A rename reissues the caller's token, which sanctioned users cannot get. The new token never carries
+// more than the caller's, so roles withheld for a missing second factor stay withheld.
+func (s *Service) UpdateProfile(ctx context.Context, caller authz.Principal, req UpdateProfileRequest, correlationID string) (UpdateProfileResponse, error) {
+	if err := req.Validate(); err != nil {
+		return UpdateProfileResponse{}, err
+	}
+	userID := caller.Subject
+	current, err := s.repo.GetByID(ctx, userID)
+	if err != nil {
+		return UpdateProfileResponse{}, err
+	}
+
+	update := ProfileUpdate{DisplayName: req.DisplayName, AvatarURL: req.AvatarURL, Locale: req.Locale, Region: req.Region}
+	if req.Username != nil {
+		username := strings.TrimSpace(*req.Username)
+		if username != current.Username {
+			if current.IsGuest {
+				return UpdateProfileResponse{}, ErrGuestUsername
+			}
+			update.Username = &username
+		}
+	}
+	if update.Username != nil {
+		if err := s.checkSanctions(ctx, userID); err != nil {
+			return UpdateProfileResponse{}, err
+		}
+	}
+	user, err := s.repo.UpdateProfile(ctx, userID, update)
+	if err != nil {
+		return UpdateProfileResponse{}, err
+	}
+	grants, err := s.repo.GetGrants(ctx, user.ID)
+	if err != nil {
+		return UpdateProfileResponse{}, err
+	}
+
+	resp := UpdateProfileResponse{User: mapUser(user, grants)}
+	payload := contracts.UserUpdatedV1{Fields: changedFields(current, user)}
+	if user.Username != current.Username {
+		resp.Token, err = s.auth.GeneratePrincipalToken(principalFor(user, heldGrants(grants, caller)))
+		if err != nil {
+			return UpdateProfileResponse{}, err
+		}
+		payload.Username, payload.PreviousUsername = user.Username, current.Username
+	}
+	if len(payload.Fields) == 0 {
+		return resp, nil
+	}
+	if correlationID == "" {
+		correlationID, err = newUUID()
+		if err != nil {
+			return UpdateProfileResponse{}, err
+		}
+	}
+	if err := publish(s.nc, contracts.SubjectUserUpdated, contracts.EventUserUpdated, correlationID, &user.ID, payload); err != nil {
+		return UpdateProfileResponse{}, err
+	}
+	return resp, nil
+}
+
+// DeleteAccount anonymizes the caller's account and publishes user.deleted, on which the gateway drops
+// the user's connection and matchmaking cancels their tickets. Tokens already issued stay valid until
+// they expire, but /v1/me and logins no longer find the user.
+func (s *Service) DeleteAccount(ctx context.Context, userID, correlationID string) error {
+	if err := s.repo.DeleteUser(ctx, userID); err != nil {
+		return err
+	}
+	var err error
+	if correlationID == "" {
+		correlationID, err = newUUID()
+		if err != nil {
+			return err
+		}
+	}
+	payload := contracts.UserDeletedV1{Reason: "self_service"}
+	return publish(s.nc, contracts.SubjectUserDeleted, contracts.EventUserDeleted, correlationID, &userID, payload)
+}
+
+// heldGrants keeps the grants the caller's token already carries, dropping any revoked since.
+func heldGrants(grants Grants, caller authz.Principal) Grants {
+	var held Grants
+	for _, role := range grants.Roles {
+		if caller.HasRole(role) {
+			held.Roles = append(held.Roles, role)
+		}
+	}
+	for _, scope := range grants.Scopes {
+		if caller.HasScope(scope) {
+			held.Scopes = append(held.Scopes, scope)
+		}
+	}
+	return held
+}
+
+func changedFields(before, after User) []string {
+	var fields []string
+	if before.Username != after.Username {
+		fields = append(fields, "username")
+	}
+	if before.DisplayName != after.DisplayName {
+		fields = append(fields, "display_name")
+	}
+	if before.AvatarURL != after.AvatarURL {
+		fields = append(fields, "avatar_url")
+	}
+	if before.Locale != after.Locale {
+		fields = append(fields, "locale")
+	}
+	if before.Region != after.Region {
+		fields = append(fields, "region")
+	}
+	return fields
+}
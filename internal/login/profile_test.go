@@ -0,0 +1,139 @@
+package login
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/authz"
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/sanctions"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func strPtr(s string) *string { return &s }
+
+func TestUpdateProfile(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	auth := NewAuthenticator("test-secret", time.Hour).WithBcryptCost(bcrypt.MinCost)
+
+	t.Run("fields and rename", func(t *testing.T) {
+		t.Parallel()
+		repo := newFakeRepo(t, auth, "alice", "password123")
+		svc := NewService(repo, auth, nil)
+		resp, err := svc.UpdateProfile(ctx, authz.Principal{Subject: "u1"}, UpdateProfileRequest{Username: strPtr("alice2"), DisplayName: strPtr("Alice"), Region: strPtr("eu-west")}, "corr-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.User.Username != "alice2" || resp.User.DisplayName != "Alice" || resp.User.Region != "eu-west" {
+			t.Fatalf("unexpected profile %+v", resp.User)
+		}
+		_, username, err := auth.ParseToken(resp.Token)
+		if err != nil || username != "alice2" {
+			t.Fatalf("expected a token for the new username, got %q (%v)", username, err)
+		}
+		if !reflect.DeepEqual(repo.history, []string{"alice->alice2"}) {
+			t.Fatalf("expected username history, got %v", repo.history)
+		}
+	})
+
+	t.Run("same username is not a rename", func(t *testing.T) {
+		t.Parallel()
+		repo := newFakeRepo(t, auth, "alice", "password123")
+		resp, err := NewService(repo, auth, nil).UpdateProfile(ctx, authz.Principal{Subject: "u1"}, UpdateProfileRequest{Username: strPtr(" alice ")}, "corr-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Token != "" || len(repo.history) != 0 {
+			t.Fatalf("expected no rename, got token=%q history=%v", resp.Token, repo.history)
+		}
+	})
+
+	t.Run("rename keeps the caller's grants", func(t *testing.T) {
+		t.Parallel()
+		repo := newFakeRepo(t, auth, "alice", "password123")
+		repo.grants["u1"] = Grants{Roles: []string{authz.RoleAdmin, authz.RoleModerator}, Scopes: []string{authz.ScopeAdminRolesWrite}}
+		// The caller signed in without a second factor, so its token lacks the admin role and scopes.
+		caller := authz.Principal{Subject: "u1", Username: "alice", Roles: []string{authz.RoleModerator}}
+		resp, err := NewService(repo, auth, nil).UpdateProfile(ctx, caller, UpdateProfileRequest{Username: strPtr("alice2")}, "corr-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		principal, err := auth.ParsePrincipal(resp.Token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if principal.HasRole(authz.RoleAdmin) || len(principal.Scopes) != 0 || !principal.HasRole(authz.RoleModerator) {
+			t.Fatalf("expected only the caller's grants, got roles=%v scopes=%v", principal.Roles, principal.Scopes)
+		}
+	})
+
+	t.Run("sanctioned users cannot rename", func(t *testing.T) {
+		t.Parallel()
+		repo := newFakeRepo(t, auth, "alice", "password123")
+		svc := NewService(repo, auth, nil)
+		moderator := authz.Principal{Subject: "mod-1", Roles: []string{authz.RoleModerator}}
+		if _, err := svc.ApplySanction(ctx, moderator, "u1", ApplySanctionRequest{Type: sanctions.TypeBan, Reason: "cheating"}, "corr-1"); err != nil {
+			t.Fatal(err)
+		}
+		_, err := svc.UpdateProfile(ctx, authz.Principal{Subject: "u1"}, UpdateProfileRequest{Username: strPtr("alice2")}, "corr-2")
+		var sanctioned *sanctions.Error
+		if !errors.As(err, &sanctioned) || len(repo.history) != 0 {
+			t.Fatalf("expected the rename refused, got %v (history %v)", err, repo.history)
+		}
+	})
+
+	t.Run("guests cannot rename", func(t *testing.T) {
+		t.Parallel()
+		repo := newFakeRepo(t, auth, "alice", "password123")
+		guest, _ := repo.CreateGuest(ctx, "guest-1", "device-hash")
+		_, err := NewService(repo, auth, nil).UpdateProfile(ctx, authz.Principal{Subject: guest.ID, Guest: true}, UpdateProfileRequest{Username: strPtr("bob")}, "corr-1")
+		if !errors.Is(err, ErrGuestUsername) {
+			t.Fatalf("expected guest rename to be refused, got %v", err)
+		}
+	})
+
+	t.Run("reserved prefixes are refused", func(t *testing.T) {
+		t.Parallel()
+		repo := newFakeRepo(t, auth, "alice", "password123")
+		svc := NewService(repo, auth, nil)
+		for _, username := range []string{"deleted-u2", " Guest-bob"} {
+			_, err := svc.UpdateProfile(ctx, authz.Principal{Subject: "u1"}, UpdateProfileRequest{Username: strPtr(username)}, "corr-1")
+			if !errors.Is(err, ErrReservedUsername) {
+				t.Fatalf("%q: expected reserved username, got %v", username, err)
+			}
+		}
+		if len(repo.history) != 0 {
+			t.Fatalf("expected no rename, got %v", repo.history)
+		}
+	})
+}
+
+func TestDeleteAccount(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	auth := NewAuthenticator("test-secret", time.Hour).WithBcryptCost(bcrypt.MinCost)
+	repo := newFakeRepo(t, auth, "alice", "password123")
+	svc := NewService(repo, auth, nil)
+
+	if err := svc.DeleteAccount(ctx, "u1", "corr-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Me(ctx, "u1"); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("expected deleted user to be gone, got %v", err)
+	}
+	if err := svc.DeleteAccount(ctx, "u1", "corr-2"); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("expected second delete to fail, got %v", err)
+	}
+}
+
+func TestChangedFields(t *testing.T) {
+	t.Parallel()
+	before := User{Username: "alice", Locale: "en"}
+	after := User{Username: "alice", Locale: "de", AvatarURL: "https://cdn.example/a.png"}
+	if got := changedFields(before, after); !reflect.DeepEqual(got, []string{"avatar_url", "locale"}) {
+		t.Fatalf("unexpected fields %v", got)
+	}
+}
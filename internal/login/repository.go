@@ -4,23 +4,99 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"strings"
 	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/authz"
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/sanctions"
 )
 
-var ErrUserNotFound = errors.New("user not found")
+var (
+	ErrUserNotFound           = errors.New("user not found")
+	ErrServiceAccountNotFound = errors.New("service account not found")
+	ErrServiceAccountExists   = errors.New("service account already exists")
+	ErrUsernameTaken          = errors.New("username already taken")
+	ErrNotGuest               = errors.New("user is not a guest")
+	ErrIdentityNotFound       = errors.New("identity not found")
+	ErrIdentityLinked         = errors.New("identity is linked to another user")
+	ErrSanctionNotFound       = errors.New("active sanction not found")
+)
 
 type User struct {
 	ID           string
 	Username     string
 	PasswordHash string
+	IsGuest      bool
+	DisplayName  string
+	AvatarURL    string
+	Locale       string
+	Region       string
 	CreatedAt    time.Time
 }
 
+// ProfileUpdate holds the profile fields to change; nil fields are left as they are.
+type ProfileUpdate struct {
+	Username    *string
+	DisplayName *string
+	AvatarURL   *string
+	Locale      *string
+	Region      *string
+}
+
+// ServiceAccount is a machine client allowed to obtain tokens with the client-credentials grant.
+type ServiceAccount struct {
+	ClientID    string
+	SecretHash  string
+	Scopes      []string
+	Description string
+	CreatedAt   time.Time
+	Disabled    bool
+}
+
+// Identity is an external provider account linked to a user.
+type Identity struct {
+	Provider string
+	Subject  string
+	Email    string
+}
+
+// Grants are the roles assigned to a user and the scopes those roles carry.
+type Grants struct {
+	Roles  []string
+	Scopes []string
+}
+
 type Repository interface {
 	GetByUsername(ctx context.Context, username string) (User, error)
 	GetByID(ctx context.Context, id string) (User, error)
 	Create(ctx context.Context, username, passwordHash string) (User, error)
 	UpdatePassword(ctx context.Context, userID, passwordHash string) error
+	UpdateProfile(ctx context.Context, userID string, update ProfileUpdate) (User, error)
+	GetMFA(ctx context.Context, userID string) (MFAEnrollment, error)
+	SaveTOTPSecret(ctx context.Context, userID, secret string) error
+	EnableTOTP(ctx context.Context, userID, secret string, step int64, recoveryCodeHashes []string) error
+	UseTOTPStep(ctx context.Context, userID string, step int64) error
+	UseRecoveryCode(ctx context.Context, userID, codeHash string) error
+	DisableTOTP(ctx context.Context, userID string) error
+	DeleteUser(ctx context.Context, userID string) error
+	CreatePasswordReset(ctx context.Context, userID, tokenHash string, expiresAt time.Time) error
+	ConsumePasswordReset(ctx context.Context, tokenHash string) (string, error)
+	GetByDevice(ctx context.Context, deviceIDHash string) (User, error)
+	CreateGuest(ctx context.Context, username, deviceIDHash string) (User, error)
+	UpgradeGuest(ctx context.Context, userID, username, passwordHash string) (User, error)
+	GetByIdentity(ctx context.Context, provider, subject string) (User, error)
+	CreateWithIdentity(ctx context.Context, username string, identity Identity) (User, error)
+	LinkIdentity(ctx context.Context, userID string, identity Identity) error
+	GetGrants(ctx context.Context, userID string) (Grants, error)
+	GrantRole(ctx context.Context, userID, role, grantedBy string) error
+	RevokeRole(ctx context.Context, userID, role string) error
+	RecordAdminAction(ctx context.Context, entry authz.AuditEntry) error
+	CreateSanction(ctx context.Context, sanction sanctions.Sanction) error
+	LiftSanction(ctx context.Context, userID, sanctionID, liftedBy string) error
+	ListSanctions(ctx context.Context, userID string, activeOnly bool) ([]sanctions.Sanction, error)
+	CreateServiceAccount(ctx context.Context, account ServiceAccount, createdBy string) (ServiceAccount, error)
+	GetServiceAccount(ctx context.Context, clientID string) (ServiceAccount, error)
 }
 
 type PostgresRepository struct {
@@ -31,22 +107,39 @@ func NewPostgresRepository(db *sql.DB) *PostgresRepository {
 	return &PostgresRepository{db: db}
 }
 
+const userColumns = `id::text, username, password_hash, is_guest, display_name, avatar_url, locale, region, created_at`
+
+const userColumnsQualified = `u.id::text, u.username, u.password_hash, u.is_guest, u.display_name, u.avatar_url, u.locale, u.region, u.created_at`
+
 func (r *PostgresRepository) GetByUsername(ctx context.Context, username string) (User, error) {
-	const q = `SELECT id::text, username, password_hash, created_at FROM users WHERE username = $1`
+	const q = `SELECT ` + userColumns + ` FROM users WHERE username = $1 AND deleted_at IS NULL`
 	return r.scanUser(ctx, q, username)
 }
 
 func (r *PostgresRepository) GetByID(ctx context.Context, id string) (User, error) {
-	const q = `SELECT id::text, username, password_hash, created_at FROM users WHERE id = $1`
+	const q = `SELECT ` + userColumns + ` FROM users WHERE id = $1 AND deleted_at IS NULL`
 	return r.scanUser(ctx, q, id)
 }
 
-func (r *PostgresRepository) scanUser(ctx context.Context, q string, arg string) (User, error) {
+func (r *PostgresRepository) GetByDevice(ctx context.Context, deviceIDHash string) (User, error) {
+	const q = `SELECT ` + userColumns + ` FROM users WHERE device_id_hash = $1 AND is_guest`
+	return r.scanUser(ctx, q, deviceIDHash)
+}
+
+func (r *PostgresRepository) scanUser(ctx context.Context, q string, args ...any) (User, error) {
+	return scanUserRow(r.db.QueryRowContext(ctx, q, args...))
+}
+
+// scanUserRow scans a row selected with userColumns.
+func scanUserRow(row *sql.Row) (User, error) {
 	var user User
-	err := r.db.QueryRowContext(ctx, q, arg).Scan(&user.ID, &user.Username, &user.PasswordHash, &user.CreatedAt)
+	err := row.Scan(&user.ID, &user.Username, &user.PasswordHash, &user.IsGuest, &user.DisplayName, &user.AvatarURL, &user.Locale, &user.Region, &user.CreatedAt)
 	if errors.Is(err, sql.ErrNoRows) {
 		return User{}, ErrUserNotFound
 	}
+	if isUniqueViolation(err) {
+		return User{}, ErrUsernameTaken
+	}
 	return user, err
 }
 
@@ -58,13 +151,463 @@ func (r *PostgresRepository) Create(ctx context.Context, username, passwordHash
 	const q = `
 		INSERT INTO users (id, username, password_hash)
 		VALUES ($1, $2, $3)
-		RETURNING id::text, username, password_hash, created_at`
-	var user User
-	err = r.db.QueryRowContext(ctx, q, id, username, passwordHash).Scan(&user.ID, &user.Username, &user.PasswordHash, &user.CreatedAt)
+		RETURNING ` + userColumns
+	return r.scanUser(ctx, q, id, username, passwordHash)
+}
+
+func (r *PostgresRepository) CreateGuest(ctx context.Context, username, deviceIDHash string) (User, error) {
+	id, err := newUUID()
+	if err != nil {
+		return User{}, err
+	}
+	const q = `
+		INSERT INTO users (id, username, is_guest, device_id_hash)
+		VALUES ($1, $2, TRUE, $3)
+		RETURNING ` + userColumns
+	return r.scanUser(ctx, q, id, username, deviceIDHash)
+}
+
+// UpgradeGuest attaches credentials to a guest account in place so its ID, sessions and history are kept.
+// The device binding is dropped: the account is reached with its password from now on.
+func (r *PostgresRepository) UpgradeGuest(ctx context.Context, userID, username, passwordHash string) (User, error) {
+	const q = `
+		UPDATE users
+		SET username = $2, password_hash = $3, is_guest = FALSE, device_id_hash = NULL, upgraded_at = NOW()
+		WHERE id = $1 AND is_guest
+		RETURNING ` + userColumns
+	user, err := r.scanUser(ctx, q, userID, username, passwordHash)
+	if errors.Is(err, ErrUserNotFound) {
+		return User{}, ErrNotGuest
+	}
 	return user, err
 }
 
+func (r *PostgresRepository) GetByIdentity(ctx context.Context, provider, subject string) (User, error) {
+	const q = `
+		SELECT ` + userColumnsQualified + `
+		FROM user_identities i
+		JOIN users u ON u.id = i.user_id
+		WHERE i.provider = $1 AND i.subject = $2`
+	user, err := r.scanUser(ctx, q, provider, subject)
+	if errors.Is(err, ErrUserNotFound) {
+		return User{}, ErrIdentityNotFound
+	}
+	return user, err
+}
+
+// CreateWithIdentity creates a password-less user and links the identity in one transaction.
+func (r *PostgresRepository) CreateWithIdentity(ctx context.Context, username string, identity Identity) (User, error) {
+	id, err := newUUID()
+	if err != nil {
+		return User{}, err
+	}
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return User{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	const insertUser = `
+		INSERT INTO users (id, username, password_hash)
+		VALUES ($1, $2, $3)
+		RETURNING ` + userColumns
+	user, err := scanUserRow(tx.QueryRowContext(ctx, insertUser, id, username, unusablePasswordHash))
+	if err != nil {
+		return User{}, err
+	}
+	if err := insertIdentity(ctx, tx, user.ID, identity); err != nil {
+		return User{}, err
+	}
+	return user, tx.Commit()
+}
+
+func (r *PostgresRepository) LinkIdentity(ctx context.Context, userID string, identity Identity) error {
+	return insertIdentity(ctx, r.db, userID, identity)
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func insertIdentity(ctx context.Context, db execer, userID string, identity Identity) error {
+	const q = `
+		INSERT INTO user_identities (provider, subject, user_id, email)
+		VALUES ($1, $2, $3, $4)`
+	_, err := db.ExecContext(ctx, q, identity.Provider, identity.Subject, userID, identity.Email)
+	if isUniqueViolation(err) {
+		return ErrIdentityLinked
+	}
+	return err
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
 func (r *PostgresRepository) UpdatePassword(ctx context.Context, userID, passwordHash string) error {
 	_, err := r.db.ExecContext(ctx, `UPDATE users SET password_hash = $2 WHERE id = $1`, userID, passwordHash)
 	return err
 }
+
+// UpdateProfile applies the update in one transaction. A username change is recorded in username_history.
+func (r *PostgresRepository) UpdateProfile(ctx context.Context, userID string, update ProfileUpdate) (User, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return User{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var previous string
+	const lock = `SELECT username FROM users WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`
+	if err := tx.QueryRowContext(ctx, lock, userID).Scan(&previous); errors.Is(err, sql.ErrNoRows) {
+		return User{}, ErrUserNotFound
+	} else if err != nil {
+		return User{}, err
+	}
+
+	const q = `
+		UPDATE users
+		SET username = COALESCE($2, username),
+		    display_name = COALESCE($3, display_name),
+		    avatar_url = COALESCE($4, avatar_url),
+		    locale = COALESCE($5, locale),
+		    region = COALESCE($6, region)
+		WHERE id = $1
+		RETURNING ` + userColumns
+	user, err := scanUserRow(tx.QueryRowContext(ctx, q, userID, update.Username, update.DisplayName, update.AvatarURL, update.Locale, update.Region))
+	if err != nil {
+		return User{}, err
+	}
+	if user.Username != previous {
+		const history = `INSERT INTO username_history (user_id, old_username, new_username) VALUES ($1, $2, $3)`
+		if _, err := tx.ExecContext(ctx, history, userID, previous, user.Username); err != nil {
+			return User{}, err
+		}
+	}
+	return user, tx.Commit()
+}
+
+// DeleteUser anonymizes the account and removes everything that ties it to a person: credentials,
+// linked identities, roles, username history and session memberships. The row itself is kept so
+// foreign keys from historical data stay valid.
+func (r *PostgresRepository) DeleteUser(ctx context.Context, userID string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	const anonymize = `
+		UPDATE users
+		SET username = 'deleted-' || id::text, password_hash = $2, display_name = '', avatar_url = '',
+		    locale = '', region = '', device_id_hash = NULL, deleted_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL`
+	res, err := tx.ExecContext(ctx, anonymize, userID, unusablePasswordHash)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrUserNotFound
+	}
+	for _, q := range []string{
+		`DELETE FROM session_members WHERE user_id = $1`,
+		`DELETE FROM user_identities WHERE user_id = $1`,
+		`DELETE FROM user_roles WHERE user_id = $1`,
+		`DELETE FROM username_history WHERE user_id = $1`,
+		`DELETE FROM password_reset_tokens WHERE user_id = $1`,
+		`DELETE FROM user_recovery_codes WHERE user_id = $1`,
+		`DELETE FROM user_mfa WHERE user_id = $1`,
+	} {
+		if _, err := tx.ExecContext(ctx, q, userID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *PostgresRepository) GetMFA(ctx context.Context, userID string) (MFAEnrollment, error) {
+	const q = `SELECT totp_secret, enabled_at IS NOT NULL, last_used_step FROM user_mfa WHERE user_id = $1`
+	var m MFAEnrollment
+	err := r.db.QueryRowContext(ctx, q, userID).Scan(&m.Secret, &m.Enabled, &m.LastUsedStep)
+	if errors.Is(err, sql.ErrNoRows) {
+		return MFAEnrollment{}, ErrMFANotEnrolled
+	}
+	return m, err
+}
+
+// SaveTOTPSecret starts or restarts a pending enrollment. An enabled enrollment is never overwritten.
+func (r *PostgresRepository) SaveTOTPSecret(ctx context.Context, userID, secret string) error {
+	const q = `
+		INSERT INTO user_mfa (user_id, totp_secret)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET totp_secret = EXCLUDED.totp_secret, created_at = NOW()
+		WHERE user_mfa.enabled_at IS NULL`
+	res, err := r.db.ExecContext(ctx, q, userID, secret)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrMFAAlreadyEnabled
+	}
+	return nil
+}
+
+// EnableTOTP activates the pending enrollment for secret and replaces the recovery codes.
+func (r *PostgresRepository) EnableTOTP(ctx context.Context, userID, secret string, step int64, recoveryCodeHashes []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	const enable = `
+		UPDATE user_mfa SET enabled_at = NOW(), last_used_step = $3
+		WHERE user_id = $1 AND totp_secret = $2 AND enabled_at IS NULL`
+	res, err := tx.ExecContext(ctx, enable, userID, secret, step)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		// The enrollment was restarted or activated concurrently; the code no longer applies.
+		return ErrInvalidMFACode
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	for _, hash := range recoveryCodeHashes {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO user_recovery_codes (user_id, code_hash) VALUES ($1, $2)`, userID, hash); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// UseTOTPStep records the step of an accepted code so the same code cannot be replayed.
+func (r *PostgresRepository) UseTOTPStep(ctx context.Context, userID string, step int64) error {
+	const q = `UPDATE user_mfa SET last_used_step = $2 WHERE user_id = $1 AND last_used_step < $2`
+	res, err := r.db.ExecContext(ctx, q, userID, step)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+func (r *PostgresRepository) UseRecoveryCode(ctx context.Context, userID, codeHash string) error {
+	const q = `
+		UPDATE user_recovery_codes SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`
+	res, err := r.db.ExecContext(ctx, q, userID, codeHash)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+func (r *PostgresRepository) DisableTOTP(ctx context.Context, userID string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_mfa WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CreatePasswordReset stores a reset token hash and invalidates the user's earlier unused tokens.
+func (r *PostgresRepository) CreatePasswordReset(ctx context.Context, userID, tokenHash string, expiresAt time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	const invalidate = `UPDATE password_reset_tokens SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL`
+	if _, err := tx.ExecContext(ctx, invalidate, userID); err != nil {
+		return err
+	}
+	const insert = `INSERT INTO password_reset_tokens (token_hash, user_id, expires_at) VALUES ($1, $2, $3)`
+	if _, err := tx.ExecContext(ctx, insert, tokenHash, userID, expiresAt); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ConsumePasswordReset marks an unexpired, unused token as used and returns its user.
+func (r *PostgresRepository) ConsumePasswordReset(ctx context.Context, tokenHash string) (string, error) {
+	const q = `
+		UPDATE password_reset_tokens
+		SET used_at = NOW()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id::text`
+	var userID string
+	err := r.db.QueryRowContext(ctx, q, tokenHash).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrInvalidResetToken
+	}
+	return userID, err
+}
+
+func (r *PostgresRepository) GetGrants(ctx context.Context, userID string) (Grants, error) {
+	const q = `
+		SELECT ur.role, COALESCE(rs.scope, '')
+		FROM user_roles ur
+		LEFT JOIN role_scopes rs ON rs.role = ur.role
+		WHERE ur.user_id = $1
+		ORDER BY ur.role, rs.scope`
+	rows, err := r.db.QueryContext(ctx, q, userID)
+	if err != nil {
+		return Grants{}, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var grants Grants
+	seenRoles := map[string]bool{}
+	seenScopes := map[string]bool{}
+	for rows.Next() {
+		var role, scope string
+		if err := rows.Scan(&role, &scope); err != nil {
+			return Grants{}, err
+		}
+		if !seenRoles[role] {
+			seenRoles[role] = true
+			grants.Roles = append(grants.Roles, role)
+		}
+		if scope != "" && !seenScopes[scope] {
+			seenScopes[scope] = true
+			grants.Scopes = append(grants.Scopes, scope)
+		}
+	}
+	return grants, rows.Err()
+}
+
+func (r *PostgresRepository) GrantRole(ctx context.Context, userID, role, grantedBy string) error {
+	const q = `
+		INSERT INTO user_roles (user_id, role, granted_by)
+		VALUES ($1, $2, NULLIF($3, '')::uuid)
+		ON CONFLICT (user_id, role) DO NOTHING`
+	_, err := r.db.ExecContext(ctx, q, userID, role, grantedBy)
+	return err
+}
+
+func (r *PostgresRepository) RevokeRole(ctx context.Context, userID, role string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM user_roles WHERE user_id = $1 AND role = $2`, userID, role)
+	return err
+}
+
+func (r *PostgresRepository) RecordAdminAction(ctx context.Context, entry authz.AuditEntry) error {
+	id, err := newUUID()
+	if err != nil {
+		return err
+	}
+	const q = `
+		INSERT INTO admin_audit_log (id, actor_user_id, actor_roles, action, target, correlation_id)
+		VALUES ($1, $2, $3, $4, $5, $6)`
+	_, err = r.db.ExecContext(ctx, q, id, entry.ActorUserID, strings.Join(entry.ActorRoles, ","), entry.Action, entry.Target, entry.CorrelationID)
+	return err
+}
+
+func (r *PostgresRepository) CreateSanction(ctx context.Context, s sanctions.Sanction) error {
+	const q = `
+		INSERT INTO user_sanctions (id, user_id, type, reason, issued_by, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, NULLIF($5, '')::uuid, $6, $7)`
+	_, err := r.db.ExecContext(ctx, q, s.ID, s.UserID, s.Type, s.Reason, s.IssuedBy, s.CreatedAt, s.ExpiresAt)
+	return err
+}
+
+func (r *PostgresRepository) LiftSanction(ctx context.Context, userID, sanctionID, liftedBy string) error {
+	const q = `
+		UPDATE user_sanctions SET lifted_at = NOW(), lifted_by = NULLIF($3, '')::uuid
+		WHERE id = $1 AND user_id = $2 AND lifted_at IS NULL`
+	res, err := r.db.ExecContext(ctx, q, sanctionID, userID, liftedBy)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrSanctionNotFound
+	}
+	return nil
+}
+
+// ListSanctions returns the user's sanctions, newest first. With activeOnly, lifted and expired ones are skipped.
+func (r *PostgresRepository) ListSanctions(ctx context.Context, userID string, activeOnly bool) ([]sanctions.Sanction, error) {
+	q := `
+		SELECT id::text, user_id::text, type, reason, COALESCE(issued_by::text, ''), created_at, expires_at, lifted_at
+		FROM user_sanctions WHERE user_id = $1`
+	if activeOnly {
+		q += ` AND lifted_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())`
+	}
+	q += ` ORDER BY created_at DESC`
+	rows, err := r.db.QueryContext(ctx, q, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var out []sanctions.Sanction
+	for rows.Next() {
+		var s sanctions.Sanction
+		var expiresAt, liftedAt sql.NullTime
+		if err := rows.Scan(&s.ID, &s.UserID, &s.Type, &s.Reason, &s.IssuedBy, &s.CreatedAt, &expiresAt, &liftedAt); err != nil {
+			return nil, err
+		}
+		if expiresAt.Valid {
+			s.ExpiresAt = &expiresAt.Time
+		}
+		if liftedAt.Valid {
+			s.LiftedAt = &liftedAt.Time
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+func (r *PostgresRepository) CreateServiceAccount(ctx context.Context, account ServiceAccount, createdBy string) (ServiceAccount, error) {
+	const q = `
+		INSERT INTO service_accounts (client_id, secret_hash, scopes, description, created_by)
+		VALUES ($1, $2, $3, $4, NULLIF($5, '')::uuid)
+		ON CONFLICT (client_id) DO NOTHING
+		RETURNING created_at`
+	err := r.db.QueryRowContext(ctx, q, account.ClientID, account.SecretHash, strings.Join(account.Scopes, " "), account.Description, createdBy).Scan(&account.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ServiceAccount{}, ErrServiceAccountExists
+	}
+	return account, err
+}
+
+func (r *PostgresRepository) GetServiceAccount(ctx context.Context, clientID string) (ServiceAccount, error) {
+	const q = `
+		SELECT client_id, secret_hash, scopes, description, created_at, disabled_at IS NOT NULL
+		FROM service_accounts WHERE client_id = $1`
+	var account ServiceAccount
+	var scopes string
+	err := r.db.QueryRowContext(ctx, q, clientID).Scan(&account.ClientID, &account.SecretHash, &scopes, &account.Description, &account.CreatedAt, &account.Disabled)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ServiceAccount{}, ErrServiceAccountNotFound
+	}
+	account.Scopes = strings.Fields(scopes)
+	return account, err
+}
@@ -0,0 +1,107 @@
+package login
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/authz"
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/contracts"
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/sanctions"
+)
+
+// SanctionMirror copies a user's active sanctions to where the gateway and matchmaking can read them.
+type SanctionMirror interface {
+	Sync(ctx context.Context, userID string, active []sanctions.Sanction) error
+}
+
+// WithSanctionMirror keeps mirror up to date whenever a sanction is applied or lifted.
+func (s *Service) WithSanctionMirror(m SanctionMirror) *Service {
+	s.sanctionMirror = m
+	return s
+}
+
+// ApplySanction records a sanction against userID and publishes user.sanctioned, which makes gateways
+// disconnect banned and suspended users.
+func (s *Service) ApplySanction(ctx context.Context, actor authz.Principal, userID string, req ApplySanctionRequest, correlationID string) (sanctions.Sanction, error) {
+	if err := req.Validate(); err != nil {
+		return sanctions.Sanction{}, err
+	}
+	if _, err := s.repo.GetByID(ctx, userID); err != nil {
+		return sanctions.Sanction{}, err
+	}
+	id, err := newUUID()
+	if err != nil {
+		return sanctions.Sanction{}, err
+	}
+	now := s.now().UTC()
+	sanction := sanctions.Sanction{ID: id, UserID: userID, Type: req.Type, Reason: strings.TrimSpace(req.Reason), IssuedBy: actor.Subject, CreatedAt: now}
+	if req.DurationSeconds > 0 {
+		expiresAt := now.Add(time.Duration(req.DurationSeconds) * time.Second)
+		sanction.ExpiresAt = &expiresAt
+	}
+
+	if err := s.repo.RecordAdminAction(ctx, authz.NewAuditEntry(actor, "sanctions.apply:"+req.Type, userID, correlationID)); err != nil {
+		return sanctions.Sanction{}, err
+	}
+	if err := s.repo.CreateSanction(ctx, sanction); err != nil {
+		return sanctions.Sanction{}, err
+	}
+	if err := s.syncSanctions(ctx, userID); err != nil {
+		return sanctions.Sanction{}, err
+	}
+
+	if correlationID == "" {
+		correlationID, err = newUUID()
+		if err != nil {
+			return sanctions.Sanction{}, err
+		}
+	}
+	payload := contracts.UserSanctionedV1{SanctionID: sanction.ID, Type: sanction.Type, Reason: sanction.Reason, ExpiresAt: sanction.ExpiresAt}
+	if err := publish(s.nc, contracts.SubjectUserSanctioned, contracts.EventUserSanctioned, correlationID, &userID, payload); err != nil {
+		return sanctions.Sanction{}, err
+	}
+	return sanction, nil
+}
+
+func (s *Service) LiftSanction(ctx context.Context, actor authz.Principal, userID, sanctionID, correlationID string) error {
+	if err := s.repo.RecordAdminAction(ctx, authz.NewAuditEntry(actor, "sanctions.lift:"+sanctionID, userID, correlationID)); err != nil {
+		return err
+	}
+	if err := s.repo.LiftSanction(ctx, userID, sanctionID, actor.Subject); err != nil {
+		return err
+	}
+	return s.syncSanctions(ctx, userID)
+}
+
+// ListSanctions returns the full sanction history of userID, including lifted and expired entries.
+func (s *Service) ListSanctions(ctx context.Context, userID string) ([]sanctions.Sanction, error) {
+	if _, err := s.repo.GetByID(ctx, userID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListSanctions(ctx, userID, false)
+}
+
+// checkSanctions refuses a login with a *sanctions.Error while a ban or suspension is active. The
+// database is authoritative here; the mirror only serves services without database access.
+func (s *Service) checkSanctions(ctx context.Context, userID string) error {
+	active, err := s.repo.ListSanctions(ctx, userID, true)
+	if err != nil {
+		return err
+	}
+	if blocking := sanctions.FirstBlocking(active, s.now()); blocking != nil {
+		return &sanctions.Error{Sanction: *blocking}
+	}
+	return nil
+}
+
+func (s *Service) syncSanctions(ctx context.Context, userID string) error {
+	if s.sanctionMirror == nil {
+		return nil
+	}
+	active, err := s.repo.ListSanctions(ctx, userID, true)
+	if err != nil {
+		return err
+	}
+	return s.sanctionMirror.Sync(ctx, userID, active)
+}
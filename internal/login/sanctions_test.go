@@ -0,0 +1,116 @@
+package login
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/authz"
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/sanctions"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type recordingMirror struct {
+	synced map[string][]sanctions.Sanction
+}
+
+func (m *recordingMirror) Sync(_ context.Context, userID string, active []sanctions.Sanction) error {
+	m.synced[userID] = active
+	return nil
+}
+
+func TestSanctionsBlockLogin(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	auth := NewAuthenticator("test-secret", time.Hour).WithBcryptCost(bcrypt.MinCost)
+	repo := newFakeRepo(t, auth, "alice", "password123")
+	mirror := &recordingMirror{synced: map[string][]sanctions.Sanction{}}
+	svc := NewService(repo, auth, nil).WithSanctionMirror(mirror)
+	moderator := authz.Principal{Subject: "mod-1", Roles: []string{authz.RoleModerator}}
+	login := LoginRequest{Username: "alice", Password: "password123"}
+
+	mute, err := svc.ApplySanction(ctx, moderator, "u1", ApplySanctionRequest{Type: sanctions.TypeMute, Reason: "spam", DurationSeconds: 3600}, "corr-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mute.ExpiresAt == nil || mute.IssuedBy != "mod-1" {
+		t.Fatalf("unexpected sanction %+v", mute)
+	}
+	if _, err := svc.Login(ctx, login, "corr-2"); err != nil {
+		t.Fatalf("mutes must not block login: %v", err)
+	}
+
+	ban, err := svc.ApplySanction(ctx, moderator, "u1", ApplySanctionRequest{Type: sanctions.TypeBan, Reason: "cheating"}, "corr-3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mirror.synced["u1"]) != 2 {
+		t.Fatalf("expected both sanctions mirrored, got %+v", mirror.synced["u1"])
+	}
+	_, err = svc.Login(ctx, login, "corr-4")
+	var sanctioned *sanctions.Error
+	if !errors.As(err, &sanctioned) || sanctioned.Sanction.ID != ban.ID {
+		t.Fatalf("expected ban to block login, got %v", err)
+	}
+
+	if err := svc.LiftSanction(ctx, moderator, "u1", ban.ID, "corr-5"); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.LiftSanction(ctx, moderator, "u1", ban.ID, "corr-6"); !errors.Is(err, ErrSanctionNotFound) {
+		t.Fatalf("expected second lift to fail, got %v", err)
+	}
+	if len(mirror.synced["u1"]) != 1 {
+		t.Fatalf("expected only the mute mirrored after lifting, got %+v", mirror.synced["u1"])
+	}
+	if _, err := svc.Login(ctx, login, "corr-7"); err != nil {
+		t.Fatalf("expected login after lift, got %v", err)
+	}
+	history, err := svc.ListSanctions(ctx, "u1")
+	if err != nil || len(history) != 2 {
+		t.Fatalf("expected full history, got %d (%v)", len(history), err)
+	}
+	// Attempts are audited before they run, so the failed second lift is recorded too.
+	if len(repo.audit) != 4 {
+		t.Fatalf("expected an audit entry per admin action, got %d", len(repo.audit))
+	}
+}
+
+func TestExpiredSuspensionAllowsLogin(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	auth := NewAuthenticator("test-secret", time.Hour).WithBcryptCost(bcrypt.MinCost)
+	repo := newFakeRepo(t, auth, "alice", "password123")
+	expired := time.Now().Add(-time.Minute)
+	repo.sanctions = []sanctions.Sanction{{ID: "s1", UserID: "u1", Type: sanctions.TypeSuspension, Reason: "afk", ExpiresAt: &expired}}
+	if _, err := NewService(repo, auth, nil).Login(ctx, LoginRequest{Username: "alice", Password: "password123"}, "corr-1"); err != nil {
+		t.Fatalf("expected expired suspension to be ignored, got %v", err)
+	}
+}
+
+func TestApplySanctionRequestValidate(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		req  ApplySanctionRequest
+		want error
+	}{
+		{name: "ban", req: ApplySanctionRequest{Type: "ban", Reason: "cheating"}},
+		{name: "suspension", req: ApplySanctionRequest{Type: "suspension", Reason: "toxicity", DurationSeconds: 86400}},
+		{name: "permanent mute", req: ApplySanctionRequest{Type: "mute", Reason: "spam"}},
+		{name: "unknown type", req: ApplySanctionRequest{Type: "warn", Reason: "x"}, want: ErrInvalidSanctionType},
+		{name: "blank reason", req: ApplySanctionRequest{Type: "ban", Reason: "  "}, want: ErrInvalidSanctionReason},
+		{name: "timed ban", req: ApplySanctionRequest{Type: "ban", Reason: "x", DurationSeconds: 60}, want: ErrInvalidSanctionDuration},
+		{name: "open suspension", req: ApplySanctionRequest{Type: "suspension", Reason: "x"}, want: ErrInvalidSanctionDuration},
+		{name: "too long", req: ApplySanctionRequest{Type: "mute", Reason: "x", DurationSeconds: 400 * 86400}, want: ErrInvalidSanctionDuration},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			if err := tc.req.Validate(); !errors.Is(err, tc.want) {
+				t.Fatalf("expected %v, got %v", tc.want, err)
+			}
+		})
+	}
+}
@@ -6,17 +6,41 @@ import (
 	"time"
 
 	"github.com/nats-io/nats.go"
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/authz"
 	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/contracts"
 )
 
+var ErrUnknownRole = errors.New("unknown role")
+
 type Service struct {
-	repo Repository
-	auth *Authenticator
-	nc   *nats.Conn
+	repo     Repository
+	auth     *Authenticator
+	nc       *nats.Conn
+	limiter  AttemptLimiter
+	notifier Notifier
+	mfa      MFAConfig
+	now      func() time.Time
+
+	sanctionMirror SanctionMirror
+
+	oidcProviders map[string]*OIDCProvider
+	oidcStates    OIDCStateStore
 }
 
 func NewService(repo Repository, auth *Authenticator, nc *nats.Conn) *Service {
-	return &Service{repo: repo, auth: auth, nc: nc}
+	return &Service{repo: repo, auth: auth, nc: nc, mfa: DefaultMFAConfig(), now: time.Now}
+}
+
+// WithAttemptLimiter enables brute-force protection for password logins.
+func (s *Service) WithAttemptLimiter(limiter AttemptLimiter) *Service {
+	s.limiter = limiter
+	return s
+}
+
+// WithNotifier enables password reset by delivering reset tokens through n.
+func (s *Service) WithNotifier(n Notifier) *Service {
+	s.notifier = n
+	return s
 }
 
 func (s *Service) Login(ctx context.Context, req LoginRequest, correlationID string) (LoginResponse, error) {
@@ -24,16 +48,49 @@ func (s *Service) Login(ctx context.Context, req LoginRequest, correlationID str
 		return LoginResponse{}, err
 	}
 
+	var err error
+	if correlationID == "" {
+		correlationID, err = newUUID()
+		if err != nil {
+			return LoginResponse{}, err
+		}
+	}
+
+	if s.limiter != nil {
+		retryAfter, err := s.limiter.Check(ctx, req.Username, req.ClientIP)
+		if err != nil {
+			return LoginResponse{}, err
+		}
+		if retryAfter > 0 {
+			if err := s.publishLoginFailed(correlationID, nil, req, "locked_out", 0, retryAfter); err != nil {
+				return LoginResponse{}, err
+			}
+			return LoginResponse{}, &LockedError{RetryAfter: retryAfter}
+		}
+	}
+
 	user, err := s.repo.GetByUsername(ctx, req.Username)
+	if err == nil && user.IsGuest {
+		// Guests have no password; they can only sign in from their bound device.
+		return LoginResponse{}, s.loginFailed(ctx, correlationID, user, req)
+	}
 	if err != nil {
 		if !errors.Is(err, ErrUserNotFound) {
 			return LoginResponse{}, err
 		}
+		if reservedUsername(req.Username) {
+			// Guest and deleted accounts are never created by a password login.
+			return LoginResponse{}, ErrInvalidCredentials
+		}
 		hash, err := s.auth.HashPassword(req.Password)
 		if err != nil {
 			return LoginResponse{}, err
 		}
 		user, err = s.repo.Create(ctx, req.Username, hash)
+		if errors.Is(err, ErrUsernameTaken) {
+			// Lost a race with another sign-up, or the name still belongs to a deleted account.
+			return LoginResponse{}, ErrInvalidCredentials
+		}
 		if err != nil {
 			return LoginResponse{}, err
 		}
@@ -46,25 +103,21 @@ func (s *Service) Login(ctx context.Context, req LoginRequest, correlationID str
 			return LoginResponse{}, err
 		}
 	} else if err := s.auth.VerifyPassword(user.PasswordHash, req.Password); err != nil {
-		return LoginResponse{}, ErrInvalidCredentials
-	}
-
-	token, err := s.auth.GenerateToken(user.ID, user.Username)
-	if err != nil {
-		return LoginResponse{}, err
+		return LoginResponse{}, s.loginFailed(ctx, correlationID, user, req)
+	} else if s.auth.NeedsRehash(user.PasswordHash) {
+		// The old hash keeps working, so a failed upgrade is simply retried on the next login.
+		if hash, err := s.auth.HashPassword(req.Password); err == nil {
+			_ = s.repo.UpdatePassword(ctx, user.ID, hash)
+		}
 	}
 
-	if correlationID == "" {
-		correlationID, err = newUUID()
-		if err != nil {
+	if s.limiter != nil {
+		if err := s.limiter.Reset(ctx, req.Username); err != nil {
 			return LoginResponse{}, err
 		}
 	}
-	if err := s.publishLoggedIn(correlationID, user); err != nil {
-		return LoginResponse{}, err
-	}
 
-	return LoginResponse{Token: token, User: mapUser(user)}, nil
+	return s.finishLogin(ctx, correlationID, user, "password")
 }
 
 func (s *Service) Me(ctx context.Context, userID string) (UserProfile, error) {
@@ -72,30 +125,125 @@ func (s *Service) Me(ctx context.Context, userID string) (UserProfile, error) {
 	if err != nil {
 		return UserProfile{}, err
 	}
-	return mapUser(user), nil
+	grants, err := s.repo.GetGrants(ctx, user.ID)
+	if err != nil {
+		return UserProfile{}, err
+	}
+	return mapUser(user, grants), nil
 }
 
 func (s *Service) ParseToken(token string) (string, string, error) {
 	return s.auth.ParseToken(token)
 }
 
-func (s *Service) publishLoggedIn(correlationID string, user User) error {
+func (s *Service) ParsePrincipal(token string) (authz.Principal, error) {
+	return s.auth.ParsePrincipal(token)
+}
+
+// GrantRole assigns a role to a user. The change applies to tokens issued at the user's next login.
+func (s *Service) GrantRole(ctx context.Context, actor authz.Principal, userID, role, correlationID string) error {
+	if !authz.ValidRole(role) {
+		return ErrUnknownRole
+	}
+	if _, err := s.repo.GetByID(ctx, userID); err != nil {
+		return err
+	}
+	if err := s.repo.RecordAdminAction(ctx, authz.NewAuditEntry(actor, "roles.grant:"+role, userID, correlationID)); err != nil {
+		return err
+	}
+	return s.repo.GrantRole(ctx, userID, role, actor.Subject)
+}
+
+// RevokeRole removes a role from a user. Tokens already issued keep it until they expire.
+func (s *Service) RevokeRole(ctx context.Context, actor authz.Principal, userID, role, correlationID string) error {
+	if !authz.ValidRole(role) {
+		return ErrUnknownRole
+	}
+	if _, err := s.repo.GetByID(ctx, userID); err != nil {
+		return err
+	}
+	if err := s.repo.RecordAdminAction(ctx, authz.NewAuditEntry(actor, "roles.revoke:"+role, userID, correlationID)); err != nil {
+		return err
+	}
+	return s.repo.RevokeRole(ctx, userID, role)
+}
+
+// loginFailed records a wrong-password attempt and reports a lockout once the threshold is hit.
+func (s *Service) loginFailed(ctx context.Context, correlationID string, user User, req LoginRequest) error {
+	failures, lockout := 0, time.Duration(0)
+	if s.limiter != nil {
+		var err error
+		failures, lockout, err = s.limiter.RecordFailure(ctx, req.Username, req.ClientIP)
+		if err != nil {
+			return err
+		}
+	}
+	if err := s.publishLoginFailed(correlationID, &user.ID, req, "invalid_credentials", failures, lockout); err != nil {
+		return err
+	}
+	if lockout > 0 {
+		return &LockedError{RetryAfter: lockout}
+	}
+	return ErrInvalidCredentials
+}
+
+func (s *Service) publishLoggedInWith(correlationID string, user User, authMethod string) error {
+	payload := contracts.UserLoggedInV1{AuthMethod: authMethod}
+	return publish(s.nc, contracts.SubjectUserLoggedIn, contracts.EventUserLoggedIn, correlationID, &user.ID, payload)
+}
+
+func (s *Service) publishLoginFailed(correlationID string, userID *string, req LoginRequest, reason string, failures int, retryAfter time.Duration) error {
+	payload := contracts.UserLoginFailedV1{
+		Username:          normalizeUsername(req.Username),
+		ClientIP:          req.ClientIP,
+		Reason:            reason,
+		FailureCount:      failures,
+		RetryAfterSeconds: retryAfterSeconds(retryAfter),
+	}
+	return publish(s.nc, contracts.SubjectUserLoginFailed, contracts.EventUserLoginFailed, correlationID, userID, payload)
+}
+
+func publish[T any](nc *nats.Conn, subject string, eventType contracts.EventType, correlationID string, userID *string, payload T) error {
+	if nc == nil {
+		return nil
+	}
 	eventID, err := newUUID()
 	if err != nil {
 		return err
 	}
-	payload := contracts.UserLoggedInV1{AuthMethod: "password"}
-	raw, err := contracts.MarshalV1(eventID, contracts.EventUserLoggedIn, time.Now().UTC(), correlationID, &user.ID, payload)
+	raw, err := contracts.MarshalV1(eventID, eventType, time.Now().UTC(), correlationID, userID, payload)
 	if err != nil {
 		return err
 	}
-	msg := nats.NewMsg(contracts.SubjectUserLoggedIn)
+	msg := nats.NewMsg(subject)
 	msg.Data = raw
 	msg.Header.Set("correlation_id", correlationID)
 	msg.Header.Set("content-type", "application/json")
-	return s.nc.PublishMsg(msg)
+	return nc.PublishMsg(msg)
 }
 
-func mapUser(user User) UserProfile {
-	return UserProfile{ID: user.ID, Username: user.Username, CreatedAt: user.CreatedAt}
+// retryAfterSeconds rounds up so clients never retry before the lockout expires.
+func retryAfterSeconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int((d + time.Second - 1) / time.Second)
+}
+
+func principalFor(user User, grants Grants) authz.Principal {
+	return authz.Principal{Subject: user.ID, Username: user.Username, Roles: grants.Roles, Scopes: grants.Scopes, Guest: user.IsGuest}
+}
+
+func mapUser(user User, grants Grants) UserProfile {
+	return UserProfile{
+		ID:          user.ID,
+		Username:    user.Username,
+		DisplayName: user.DisplayName,
+		AvatarURL:   user.AvatarURL,
+		Locale:      user.Locale,
+		Region:      user.Region,
+		Roles:       grants.Roles,
+		Guest:       user.IsGuest,
+		CreatedAt:   user.CreatedAt,
+	}
 }
@@ -0,0 +1,607 @@
+package login
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/authz"
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/sanctions"
+)
+
+type fakeLimiter struct {
+	locked   time.Duration
+	lockout  time.Duration
+	failures int
+	resets   int
+	// mfaLockAfter locks second-factor attempts once mfaFailures reaches it.
+	mfaLockAfter int
+	mfaFailures  int
+	// maxResets refuses password reset requests past that many.
+	maxResets     int
+	resetRequests int
+}
+
+func (f *fakeLimiter) Check(context.Context, string, string) (time.Duration, error) {
+	return f.locked, nil
+}
+
+func (f *fakeLimiter) RecordFailure(context.Context, string, string) (int, time.Duration, error) {
+	f.failures++
+	return f.failures, f.lockout, nil
+}
+
+func (f *fakeLimiter) Reset(context.Context, string) error {
+	f.resets++
+	return nil
+}
+
+func (f *fakeLimiter) CheckMFA(context.Context, string) (time.Duration, error) {
+	if f.mfaLockAfter > 0 && f.mfaFailures >= f.mfaLockAfter {
+		return time.Minute, nil
+	}
+	return 0, nil
+}
+
+func (f *fakeLimiter) RecordMFAFailure(context.Context, string) (int, time.Duration, error) {
+	f.mfaFailures++
+	if f.mfaLockAfter > 0 && f.mfaFailures >= f.mfaLockAfter {
+		return f.mfaFailures, time.Minute, nil
+	}
+	return f.mfaFailures, 0, nil
+}
+
+func (f *fakeLimiter) ResetMFA(context.Context, string) error {
+	f.mfaFailures = 0
+	return nil
+}
+
+func (f *fakeLimiter) AllowReset(context.Context, string, string) (time.Duration, error) {
+	f.resetRequests++
+	if f.maxResets > 0 && f.resetRequests > f.maxResets {
+		return time.Minute, nil
+	}
+	return 0, nil
+}
+
+type fakeRepo struct {
+	users    map[string]User
+	grants   map[string]Grants
+	audit    []authz.AuditEntry
+	accounts map[string]ServiceAccount
+	devices  map[string]string
+	// identities maps provider+"|"+subject to a user ID.
+	identities map[string]string
+	resets     map[string]fakeReset
+	history    []string
+	mfa        map[string]MFAEnrollment
+	// recovery maps a recovery code hash to whether it has been used.
+	recovery  map[string]bool
+	sanctions []sanctions.Sanction
+	// createErr, when set, is returned by Create.
+	createErr error
+}
+
+type fakeReset struct {
+	userID    string
+	expiresAt time.Time
+	used      bool
+}
+
+func newFakeRepo(t *testing.T, auth *Authenticator, username, password string) *fakeRepo {
+	t.Helper()
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := User{ID: "u1", Username: username, PasswordHash: hash, CreatedAt: time.Now().UTC()}
+	return &fakeRepo{users: map[string]User{username: user}, grants: map[string]Grants{}, accounts: map[string]ServiceAccount{}, devices: map[string]string{}, identities: map[string]string{}, resets: map[string]fakeReset{}, mfa: map[string]MFAEnrollment{}, recovery: map[string]bool{}}
+}
+
+func (f *fakeRepo) GetByUsername(_ context.Context, username string) (User, error) {
+	user, ok := f.users[username]
+	if !ok {
+		return User{}, ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (f *fakeRepo) GetByID(_ context.Context, id string) (User, error) {
+	for _, user := range f.users {
+		if user.ID == id {
+			return user, nil
+		}
+	}
+	return User{}, ErrUserNotFound
+}
+
+func (f *fakeRepo) Create(_ context.Context, username, passwordHash string) (User, error) {
+	if f.createErr != nil {
+		return User{}, f.createErr
+	}
+	user := User{ID: "u-" + username, Username: username, PasswordHash: passwordHash, CreatedAt: time.Now().UTC()}
+	f.users[username] = user
+	return user, nil
+}
+
+func (f *fakeRepo) UpdatePassword(_ context.Context, userID, passwordHash string) error {
+	for name, user := range f.users {
+		if user.ID == userID {
+			user.PasswordHash = passwordHash
+			f.users[name] = user
+		}
+	}
+	return nil
+}
+
+func (f *fakeRepo) UpdateProfile(_ context.Context, userID string, update ProfileUpdate) (User, error) {
+	for name, user := range f.users {
+		if user.ID != userID {
+			continue
+		}
+		if update.Username != nil && *update.Username != name {
+			if _, taken := f.users[*update.Username]; taken {
+				return User{}, ErrUsernameTaken
+			}
+			f.history = append(f.history, name+"->"+*update.Username)
+			delete(f.users, name)
+			user.Username = *update.Username
+		}
+		for field, value := range map[*string]*string{&user.DisplayName: update.DisplayName, &user.AvatarURL: update.AvatarURL, &user.Locale: update.Locale, &user.Region: update.Region} {
+			if value != nil {
+				*field = *value
+			}
+		}
+		f.users[user.Username] = user
+		return user, nil
+	}
+	return User{}, ErrUserNotFound
+}
+
+func (f *fakeRepo) GetMFA(_ context.Context, userID string) (MFAEnrollment, error) {
+	m, ok := f.mfa[userID]
+	if !ok {
+		return MFAEnrollment{}, ErrMFANotEnrolled
+	}
+	return m, nil
+}
+
+func (f *fakeRepo) SaveTOTPSecret(_ context.Context, userID, secret string) error {
+	if f.mfa[userID].Enabled {
+		return ErrMFAAlreadyEnabled
+	}
+	f.mfa[userID] = MFAEnrollment{Secret: secret}
+	return nil
+}
+
+func (f *fakeRepo) EnableTOTP(_ context.Context, userID, secret string, step int64, recoveryCodeHashes []string) error {
+	m, ok := f.mfa[userID]
+	if !ok || m.Enabled || m.Secret != secret {
+		return ErrInvalidMFACode
+	}
+	f.mfa[userID] = MFAEnrollment{Secret: secret, Enabled: true, LastUsedStep: step}
+	f.recovery = map[string]bool{}
+	for _, hash := range recoveryCodeHashes {
+		f.recovery[hash] = false
+	}
+	return nil
+}
+
+func (f *fakeRepo) UseTOTPStep(_ context.Context, userID string, step int64) error {
+	m := f.mfa[userID]
+	if m.LastUsedStep >= step {
+		return ErrInvalidMFACode
+	}
+	m.LastUsedStep = step
+	f.mfa[userID] = m
+	return nil
+}
+
+func (f *fakeRepo) UseRecoveryCode(_ context.Context, _ string, codeHash string) error {
+	used, ok := f.recovery[codeHash]
+	if !ok || used {
+		return ErrInvalidMFACode
+	}
+	f.recovery[codeHash] = true
+	return nil
+}
+
+func (f *fakeRepo) DisableTOTP(_ context.Context, userID string) error {
+	delete(f.mfa, userID)
+	f.recovery = map[string]bool{}
+	return nil
+}
+
+func (f *fakeRepo) CreateSanction(_ context.Context, s sanctions.Sanction) error {
+	f.sanctions = append(f.sanctions, s)
+	return nil
+}
+
+func (f *fakeRepo) LiftSanction(_ context.Context, userID, sanctionID, _ string) error {
+	for i, s := range f.sanctions {
+		if s.ID == sanctionID && s.UserID == userID && s.LiftedAt == nil {
+			now := time.Now()
+			f.sanctions[i].LiftedAt = &now
+			return nil
+		}
+	}
+	return ErrSanctionNotFound
+}
+
+func (f *fakeRepo) ListSanctions(_ context.Context, userID string, activeOnly bool) ([]sanctions.Sanction, error) {
+	var out []sanctions.Sanction
+	for _, s := range f.sanctions {
+		if s.UserID == userID && (!activeOnly || s.Active(time.Now())) {
+			out = append(out, s)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeRepo) DeleteUser(_ context.Context, userID string) error {
+	for name, user := range f.users {
+		if user.ID == userID {
+			delete(f.users, name)
+			delete(f.grants, userID)
+			for key, id := range f.identities {
+				if id == userID {
+					delete(f.identities, key)
+				}
+			}
+			return nil
+		}
+	}
+	return ErrUserNotFound
+}
+
+func (f *fakeRepo) CreatePasswordReset(_ context.Context, userID, tokenHash string, expiresAt time.Time) error {
+	for hash, reset := range f.resets {
+		if reset.userID == userID {
+			reset.used = true
+			f.resets[hash] = reset
+		}
+	}
+	f.resets[tokenHash] = fakeReset{userID: userID, expiresAt: expiresAt}
+	return nil
+}
+
+func (f *fakeRepo) ConsumePasswordReset(_ context.Context, tokenHash string) (string, error) {
+	reset, ok := f.resets[tokenHash]
+	if !ok || reset.used || !reset.expiresAt.After(time.Now()) {
+		return "", ErrInvalidResetToken
+	}
+	reset.used = true
+	f.resets[tokenHash] = reset
+	return reset.userID, nil
+}
+
+func (f *fakeRepo) GetByDevice(ctx context.Context, deviceIDHash string) (User, error) {
+	userID, ok := f.devices[deviceIDHash]
+	if !ok {
+		return User{}, ErrUserNotFound
+	}
+	return f.GetByID(ctx, userID)
+}
+
+func (f *fakeRepo) CreateGuest(_ context.Context, username, deviceIDHash string) (User, error) {
+	user := User{ID: "g-" + username, Username: username, IsGuest: true, CreatedAt: time.Now().UTC()}
+	f.users[username] = user
+	f.devices[deviceIDHash] = user.ID
+	return user, nil
+}
+
+func (f *fakeRepo) UpgradeGuest(_ context.Context, userID, username, passwordHash string) (User, error) {
+	if _, taken := f.users[username]; taken {
+		return User{}, ErrUsernameTaken
+	}
+	for name, user := range f.users {
+		if user.ID != userID {
+			continue
+		}
+		if !user.IsGuest {
+			return User{}, ErrNotGuest
+		}
+		delete(f.users, name)
+		user.Username, user.PasswordHash, user.IsGuest = username, passwordHash, false
+		f.users[username] = user
+		for device, id := range f.devices {
+			if id == userID {
+				delete(f.devices, device)
+			}
+		}
+		return user, nil
+	}
+	return User{}, ErrNotGuest
+}
+
+func (f *fakeRepo) GetByIdentity(ctx context.Context, provider, subject string) (User, error) {
+	userID, ok := f.identities[provider+"|"+subject]
+	if !ok {
+		return User{}, ErrIdentityNotFound
+	}
+	return f.GetByID(ctx, userID)
+}
+
+func (f *fakeRepo) CreateWithIdentity(ctx context.Context, username string, identity Identity) (User, error) {
+	if _, taken := f.users[username]; taken {
+		return User{}, ErrUsernameTaken
+	}
+	user, err := f.Create(ctx, username, unusablePasswordHash)
+	if err != nil {
+		return User{}, err
+	}
+	return user, f.LinkIdentity(ctx, user.ID, identity)
+}
+
+func (f *fakeRepo) LinkIdentity(_ context.Context, userID string, identity Identity) error {
+	key := identity.Provider + "|" + identity.Subject
+	if _, ok := f.identities[key]; ok {
+		return ErrIdentityLinked
+	}
+	f.identities[key] = userID
+	return nil
+}
+
+func (f *fakeRepo) GetGrants(_ context.Context, userID string) (Grants, error) {
+	return f.grants[userID], nil
+}
+
+func (f *fakeRepo) GrantRole(_ context.Context, userID, role, _ string) error {
+	g := f.grants[userID]
+	g.Roles = append(g.Roles, role)
+	f.grants[userID] = g
+	return nil
+}
+
+func (f *fakeRepo) RevokeRole(_ context.Context, userID, role string) error {
+	g := f.grants[userID]
+	roles := g.Roles[:0]
+	for _, r := range g.Roles {
+		if r != role {
+			roles = append(roles, r)
+		}
+	}
+	g.Roles = roles
+	f.grants[userID] = g
+	return nil
+}
+
+func (f *fakeRepo) RecordAdminAction(_ context.Context, entry authz.AuditEntry) error {
+	f.audit = append(f.audit, entry)
+	return nil
+}
+
+func (f *fakeRepo) CreateServiceAccount(_ context.Context, account ServiceAccount, _ string) (ServiceAccount, error) {
+	if _, ok := f.accounts[account.ClientID]; ok {
+		return ServiceAccount{}, ErrServiceAccountExists
+	}
+	account.CreatedAt = time.Now().UTC()
+	f.accounts[account.ClientID] = account
+	return account, nil
+}
+
+func (f *fakeRepo) GetServiceAccount(_ context.Context, clientID string) (ServiceAccount, error) {
+	account, ok := f.accounts[clientID]
+	if !ok {
+		return ServiceAccount{}, ErrServiceAccountNotFound
+	}
+	return account, nil
+}
+
+func TestLoginThrottling(t *testing.T) {
+	t.Parallel()
+	auth := NewAuthenticator("test-secret", time.Hour)
+	ctx := context.Background()
+
+	t.Run("locked out before password check", func(t *testing.T) {
+		t.Parallel()
+		limiter := &fakeLimiter{locked: 45 * time.Second}
+		svc := NewService(newFakeRepo(t, auth, "alice", "password123"), auth, nil).WithAttemptLimiter(limiter)
+		_, err := svc.Login(ctx, LoginRequest{Username: "alice", Password: "password123"}, "corr-1")
+		var locked *LockedError
+		if !errors.As(err, &locked) || locked.RetryAfter != 45*time.Second {
+			t.Fatalf("expected lockout error, got %v", err)
+		}
+	})
+
+	t.Run("wrong password is recorded", func(t *testing.T) {
+		t.Parallel()
+		limiter := &fakeLimiter{}
+		svc := NewService(newFakeRepo(t, auth, "alice", "password123"), auth, nil).WithAttemptLimiter(limiter)
+		_, err := svc.Login(ctx, LoginRequest{Username: "alice", Password: "wrong-password"}, "corr-1")
+		if !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("expected invalid credentials, got %v", err)
+		}
+		if limiter.failures != 1 {
+			t.Fatalf("expected one recorded failure, got %d", limiter.failures)
+		}
+	})
+
+	t.Run("threshold failure locks", func(t *testing.T) {
+		t.Parallel()
+		limiter := &fakeLimiter{lockout: time.Minute}
+		svc := NewService(newFakeRepo(t, auth, "alice", "password123"), auth, nil).WithAttemptLimiter(limiter)
+		_, err := svc.Login(ctx, LoginRequest{Username: "alice", Password: "wrong-password"}, "corr-1")
+		if !errors.Is(err, ErrTooManyAttempts) {
+			t.Fatalf("expected too many attempts, got %v", err)
+		}
+	})
+
+	t.Run("success resets counters", func(t *testing.T) {
+		t.Parallel()
+		limiter := &fakeLimiter{}
+		svc := NewService(newFakeRepo(t, auth, "alice", "password123"), auth, nil).WithAttemptLimiter(limiter)
+		if _, err := svc.Login(ctx, LoginRequest{Username: "alice", Password: "password123"}, "corr-1"); err != nil {
+			t.Fatalf("login: %v", err)
+		}
+		if limiter.resets != 1 {
+			t.Fatalf("expected one reset, got %d", limiter.resets)
+		}
+	})
+}
+
+func TestLoginDoesNotCreateReservedOrTakenUsernames(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	auth := NewAuthenticator("test-secret", time.Hour)
+
+	for _, username := range []string{"guest-0123456789ab", "Deleted-u9"} {
+		repo := newFakeRepo(t, auth, "alice", "password123")
+		_, err := NewService(repo, auth, nil).Login(ctx, LoginRequest{Username: username, Password: "password123"}, "corr-1")
+		if !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("%s: expected invalid credentials, got %v", username, err)
+		}
+		if _, ok := repo.users[username]; ok {
+			t.Fatalf("%s: expected no account to be created", username)
+		}
+	}
+
+	// A deleted account keeps its name but is invisible to GetByUsername, so Create collides.
+	repo := newFakeRepo(t, auth, "alice", "password123")
+	repo.createErr = ErrUsernameTaken
+	if _, err := NewService(repo, auth, nil).Login(ctx, LoginRequest{Username: "bob", Password: "password123"}, "corr-2"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("expected invalid credentials, got %v", err)
+	}
+}
+
+func TestLoginEmbedsGrantsAndRoleChangesAreAudited(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	auth := NewAuthenticator("test-secret", time.Hour)
+	repo := newFakeRepo(t, auth, "alice", "password123")
+	repo.grants["u1"] = Grants{Roles: []string{authz.RoleModerator}, Scopes: []string{authz.ScopeAdminUsersRead}}
+	svc := NewService(repo, auth, nil)
+
+	resp, err := svc.Login(ctx, LoginRequest{Username: "alice", Password: "password123"}, "corr-1")
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	p, err := auth.ParsePrincipal(resp.Token)
+	if err != nil {
+		t.Fatalf("parse principal: %v", err)
+	}
+	if !p.HasRole(authz.RoleModerator) || !p.HasScope(authz.ScopeAdminUsersRead) {
+		t.Fatalf("expected grants in token, got %+v", p)
+	}
+
+	admin := authz.Principal{Subject: "admin-1", Roles: []string{authz.RoleAdmin}}
+	if err := svc.GrantRole(ctx, admin, "u1", "wizard", "corr-2"); !errors.Is(err, ErrUnknownRole) {
+		t.Fatalf("expected unknown role, got %v", err)
+	}
+	if err := svc.GrantRole(ctx, admin, "u1", authz.RoleAdmin, "corr-3"); err != nil {
+		t.Fatalf("grant: %v", err)
+	}
+	if len(repo.audit) != 1 || repo.audit[0].ActorUserID != "admin-1" || repo.audit[0].Target != "u1" {
+		t.Fatalf("expected attributed audit entry, got %+v", repo.audit)
+	}
+	for name, change := range map[string]func(context.Context, authz.Principal, string, string, string) error{"grant": svc.GrantRole, "revoke": svc.RevokeRole} {
+		if err := change(ctx, admin, "missing", authz.RoleModerator, "corr-4"); !errors.Is(err, ErrUserNotFound) {
+			t.Fatalf("%s: expected unknown user, got %v", name, err)
+		}
+	}
+	if len(repo.audit) != 1 {
+		t.Fatalf("expected no audit entry for unknown users, got %+v", repo.audit)
+	}
+}
+
+func TestServiceAccountClientCredentials(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	auth := NewAuthenticator("test-secret", time.Hour)
+	repo := newFakeRepo(t, auth, "alice", "password123")
+	svc := NewService(repo, auth, nil)
+	admin := authz.Principal{Subject: "admin-1", Roles: []string{authz.RoleAdmin}}
+
+	created, err := svc.CreateServiceAccount(ctx, admin, CreateServiceAccountRequest{ClientID: "matchmaking", Scopes: []string{authz.ScopeGatewaySend}}, "corr-1")
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if len(repo.audit) != 1 || repo.audit[0].Action != "service_accounts.create" {
+		t.Fatalf("expected audited creation, got %+v", repo.audit)
+	}
+
+	if _, err := svc.IssueServiceToken(ctx, "matchmaking", "wrong", nil); !errors.Is(err, ErrInvalidClient) {
+		t.Fatalf("expected invalid client, got %v", err)
+	}
+	if _, err := svc.IssueServiceToken(ctx, "matchmaking", created.ClientSecret, []string{authz.ScopeRouterRoute}); !errors.Is(err, ErrInvalidScope) {
+		t.Fatalf("expected invalid scope, got %v", err)
+	}
+	resp, err := svc.IssueServiceToken(ctx, "matchmaking", created.ClientSecret, nil)
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	p, err := auth.ParseServicePrincipal(resp.AccessToken)
+	if err != nil {
+		t.Fatalf("parse service token: %v", err)
+	}
+	if p.Kind != authz.KindService || p.Subject != "matchmaking" || !p.HasScope(authz.ScopeGatewaySend) {
+		t.Fatalf("unexpected principal %+v", p)
+	}
+	if _, _, err := auth.ParseToken(resp.AccessToken); err == nil {
+		t.Fatal("service token must not be accepted as a user token")
+	}
+}
+
+func TestGuestLoginAndUpgrade(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	auth := NewAuthenticator("test-secret", time.Hour)
+	repo := newFakeRepo(t, auth, "alice", "password123")
+	svc := NewService(repo, auth, nil)
+	device := GuestLoginRequest{DeviceID: "device-0123456789abcdef"}
+
+	first, err := svc.GuestLogin(ctx, device, "corr-1")
+	if err != nil {
+		t.Fatalf("guest login: %v", err)
+	}
+	again, err := svc.GuestLogin(ctx, device, "corr-2")
+	if err != nil {
+		t.Fatalf("second guest login: %v", err)
+	}
+	if first.User.ID != again.User.ID || !again.User.Guest {
+		t.Fatalf("expected the device-bound guest, got %+v and %+v", first.User, again.User)
+	}
+	p, err := auth.ParsePrincipal(first.Token)
+	if err != nil || !p.Guest {
+		t.Fatalf("expected guest token, got %+v %v", p, err)
+	}
+
+	if _, err := svc.Login(ctx, LoginRequest{Username: first.User.Username, Password: "password123"}, "corr-3"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("expected guest password login to fail, got %v", err)
+	}
+	if _, err := svc.UpgradeGuest(ctx, first.User.ID, UpgradeGuestRequest{Username: "alice", Password: "password123"}, "corr-4"); !errors.Is(err, ErrUsernameTaken) {
+		t.Fatalf("expected username taken, got %v", err)
+	}
+
+	if _, err := svc.UpgradeGuest(ctx, first.User.ID, UpgradeGuestRequest{Username: "guest-bob", Password: "password123"}, "corr-4"); !errors.Is(err, ErrReservedUsername) {
+		t.Fatalf("expected reserved username, got %v", err)
+	}
+
+	upgraded, err := svc.UpgradeGuest(ctx, first.User.ID, UpgradeGuestRequest{Username: "bob", Password: "password123"}, "corr-5")
+	if err != nil {
+		t.Fatalf("upgrade: %v", err)
+	}
+	if upgraded.User.ID != first.User.ID || upgraded.User.Guest {
+		t.Fatalf("expected upgraded account to keep its id, got %+v", upgraded.User)
+	}
+	if _, err := svc.Login(ctx, LoginRequest{Username: "bob", Password: "password123"}, "corr-6"); err != nil {
+		t.Fatalf("password login after upgrade: %v", err)
+	}
+	if _, err := svc.UpgradeGuest(ctx, first.User.ID, UpgradeGuestRequest{Username: "carol", Password: "password123"}, "corr-7"); !errors.Is(err, ErrNotGuest) {
+		t.Fatalf("expected not guest, got %v", err)
+	}
+
+	banned, err := svc.GuestLogin(ctx, GuestLoginRequest{DeviceID: "device-banned-0001"}, "corr-8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	moderator := authz.Principal{Subject: "mod-1", Roles: []string{authz.RoleModerator}}
+	if _, err := svc.ApplySanction(ctx, moderator, banned.User.ID, ApplySanctionRequest{Type: sanctions.TypeBan, Reason: "cheating"}, "corr-9"); err != nil {
+		t.Fatal(err)
+	}
+	var sanctioned *sanctions.Error
+	if _, err := svc.UpgradeGuest(ctx, banned.User.ID, UpgradeGuestRequest{Username: "dave", Password: "password123"}, "corr-10"); !errors.As(err, &sanctioned) {
+		t.Fatalf("expected a banned guest to be refused, got %v", err)
+	}
+}
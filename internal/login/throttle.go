@@ -0,0 +1,243 @@
+package login
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var ErrTooManyAttempts = errors.New("too many failed login attempts")
+
+// LockedError reports a temporary lockout and how long the caller must wait.
+type LockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("%s: retry after %s", ErrTooManyAttempts, e.RetryAfter.Round(time.Second))
+}
+
+func (e *LockedError) Unwrap() error { return ErrTooManyAttempts }
+
+// AttemptLimiter tracks failed login attempts per username and per client IP, and wrong second-factor
+// codes per user. The two are counted apart so that a correct password never clears code failures.
+type AttemptLimiter interface {
+	// Check returns the remaining lockout for the username or IP, or zero when login may proceed.
+	Check(ctx context.Context, username, clientIP string) (time.Duration, error)
+	// RecordFailure counts a failed attempt and returns the failure count and any lockout it triggered.
+	RecordFailure(ctx context.Context, username, clientIP string) (int, time.Duration, error)
+	// Reset clears the username counters after a successful login.
+	Reset(ctx context.Context, username string) error
+	// CheckMFA returns the remaining second-factor lockout for the user, or zero when a code may be tried.
+	CheckMFA(ctx context.Context, userID string) (time.Duration, error)
+	// RecordMFAFailure counts a wrong code and returns the failure count and any lockout it triggered.
+	RecordMFAFailure(ctx context.Context, userID string) (int, time.Duration, error)
+	// ResetMFA clears the user's second-factor counters once a code was accepted.
+	ResetMFA(ctx context.Context, userID string) error
+	// AllowReset counts a password reset request and returns how long the caller must wait if the
+	// username or IP has made too many, or zero when the request may proceed.
+	AllowReset(ctx context.Context, username, clientIP string) (time.Duration, error)
+}
+
+type ThrottleConfig struct {
+	MaxUserFailures int
+	MaxIPFailures   int
+	Window          time.Duration
+	BaseLockout     time.Duration
+	MaxLockout      time.Duration
+	// MaxUserResets and MaxIPResets bound password reset requests per Window.
+	MaxUserResets int
+	MaxIPResets   int
+}
+
+func DefaultThrottleConfig() ThrottleConfig {
+	return ThrottleConfig{
+		MaxUserFailures: 5,
+		MaxIPFailures:   20,
+		Window:          15 * time.Minute,
+		BaseLockout:     30 * time.Second,
+		MaxLockout:      15 * time.Minute,
+		MaxUserResets:   3,
+		MaxIPResets:     20,
+	}
+}
+
+type RedisAttemptLimiter struct {
+	client *redis.Client
+	cfg    ThrottleConfig
+}
+
+func NewRedisAttemptLimiter(client *redis.Client, cfg ThrottleConfig) *RedisAttemptLimiter {
+	return &RedisAttemptLimiter{client: client, cfg: cfg}
+}
+
+func (l *RedisAttemptLimiter) Check(ctx context.Context, username, clientIP string) (time.Duration, error) {
+	var longest time.Duration
+	for _, key := range l.lockKeys(username, clientIP) {
+		ttl, err := l.client.PTTL(ctx, key).Result()
+		if err != nil {
+			return 0, err
+		}
+		if ttl > longest {
+			longest = ttl
+		}
+	}
+	return longest, nil
+}
+
+func (l *RedisAttemptLimiter) RecordFailure(ctx context.Context, username, clientIP string) (int, time.Duration, error) {
+	userFailures, err := l.incr(ctx, userFailKey(username))
+	if err != nil {
+		return 0, 0, err
+	}
+	lockout := lockoutDuration(userFailures, l.cfg.MaxUserFailures, l.cfg.BaseLockout, l.cfg.MaxLockout)
+	if lockout > 0 {
+		if err := l.client.Set(ctx, userLockKey(username), userFailures, lockout).Err(); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	if clientIP != "" {
+		ipFailures, err := l.incr(ctx, ipFailKey(clientIP))
+		if err != nil {
+			return 0, 0, err
+		}
+		ipLockout := lockoutDuration(ipFailures, l.cfg.MaxIPFailures, l.cfg.BaseLockout, l.cfg.MaxLockout)
+		if ipLockout > 0 {
+			if err := l.client.Set(ctx, ipLockKey(clientIP), ipFailures, ipLockout).Err(); err != nil {
+				return 0, 0, err
+			}
+		}
+		if ipLockout > lockout {
+			lockout = ipLockout
+		}
+	}
+	return userFailures, lockout, nil
+}
+
+func (l *RedisAttemptLimiter) Reset(ctx context.Context, username string) error {
+	return l.client.Del(ctx, userFailKey(username), userLockKey(username)).Err()
+}
+
+func (l *RedisAttemptLimiter) CheckMFA(ctx context.Context, userID string) (time.Duration, error) {
+	ttl, err := l.client.PTTL(ctx, mfaLockKey(userID)).Result()
+	if err != nil {
+		return 0, err
+	}
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+func (l *RedisAttemptLimiter) RecordMFAFailure(ctx context.Context, userID string) (int, time.Duration, error) {
+	failures, err := l.incr(ctx, mfaFailKey(userID))
+	if err != nil {
+		return 0, 0, err
+	}
+	lockout := lockoutDuration(failures, l.cfg.MaxUserFailures, l.cfg.BaseLockout, l.cfg.MaxLockout)
+	if lockout > 0 {
+		if err := l.client.Set(ctx, mfaLockKey(userID), failures, lockout).Err(); err != nil {
+			return 0, 0, err
+		}
+	}
+	return failures, lockout, nil
+}
+
+func (l *RedisAttemptLimiter) ResetMFA(ctx context.Context, userID string) error {
+	return l.client.Del(ctx, mfaFailKey(userID), mfaLockKey(userID)).Err()
+}
+
+func (l *RedisAttemptLimiter) AllowReset(ctx context.Context, username, clientIP string) (time.Duration, error) {
+	limits := map[string]int{userResetKey(username): l.cfg.MaxUserResets}
+	if clientIP != "" {
+		limits[ipResetKey(clientIP)] = l.cfg.MaxIPResets
+	}
+	var longest time.Duration
+	for key, limit := range limits {
+		n, err := l.incr(ctx, key)
+		if err != nil {
+			return 0, err
+		}
+		if limit <= 0 || n <= limit {
+			continue
+		}
+		ttl, err := l.client.PTTL(ctx, key).Result()
+		if err != nil {
+			return 0, err
+		}
+		if ttl > longest {
+			longest = ttl
+		}
+	}
+	return longest, nil
+}
+
+func (l *RedisAttemptLimiter) incr(ctx context.Context, key string) (int, error) {
+	n, err := l.client.Incr(ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+	if n == 1 {
+		if err := l.client.Expire(ctx, key, l.cfg.Window).Err(); err != nil {
+			return 0, err
+		}
+	}
+	return int(n), nil
+}
+
+func (l *RedisAttemptLimiter) lockKeys(username, clientIP string) []string {
+	keys := []string{userLockKey(username)}
+	if clientIP != "" {
+		keys = append(keys, ipLockKey(clientIP))
+	}
+	return keys
+}
+
+// lockoutDuration doubles the lockout for every failure past the threshold, capped at max.
+func lockoutDuration(failures, threshold int, base, max time.Duration) time.Duration {
+	if threshold <= 0 || failures < threshold {
+		return 0
+	}
+	lockout := base
+	for i := threshold; i < failures; i++ {
+		lockout *= 2
+		if lockout >= max {
+			return max
+		}
+	}
+	if lockout > max {
+		return max
+	}
+	return lockout
+}
+
+func normalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+func userFailKey(username string) string {
+	return "pcgb:login:fail:user:" + normalizeUsername(username)
+}
+
+func userLockKey(username string) string {
+	return "pcgb:login:lock:user:" + normalizeUsername(username)
+}
+
+func ipFailKey(clientIP string) string { return "pcgb:login:fail:ip:" + clientIP }
+
+func userResetKey(username string) string {
+	return "pcgb:login:reset:user:" + normalizeUsername(username)
+}
+
+func ipResetKey(clientIP string) string { return "pcgb:login:reset:ip:" + clientIP }
+
+func mfaFailKey(userID string) string { return "pcgb:login:fail:mfa:" + userID }
+
+func mfaLockKey(userID string) string { return "pcgb:login:lock:mfa:" + userID }
+
+func ipLockKey(clientIP string) string { return "pcgb:login:lock:ip:" + clientIP }
@@ -0,0 +1,30 @@
+package login
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockoutDuration(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		failures int
+		want     time.Duration
+	}{
+		{name: "below threshold", failures: 4, want: 0},
+		{name: "at threshold", failures: 5, want: 30 * time.Second},
+		{name: "doubles", failures: 7, want: 2 * time.Minute},
+		{name: "capped", failures: 20, want: 15 * time.Minute},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			got := lockoutDuration(tc.failures, 5, 30*time.Second, 15*time.Minute)
+			if got != tc.want {
+				t.Fatalf("expected %s got %s", tc.want, got)
+			}
+		})
+	}
+}
@@ -2,18 +2,41 @@ package login
 
 import (
 	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/authz"
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/sanctions"
 )
 
 var (
 	ErrInvalidUsername = errors.New("username must be between 3 and 64 characters")
 	ErrInvalidPassword = errors.New("password must be between 8 and 128 characters")
+	ErrInvalidClientID = errors.New("client_id must be between 3 and 64 characters")
+	ErrNoScopes        = errors.New("at least one scope is required")
+	ErrInvalidDeviceID = errors.New("device_id must be between 16 and 128 characters")
+	ErrMissingToken    = errors.New("token is required")
+	// ErrReservedUsername keeps players off the prefixes the service assigns itself:
+	// guest- for new guests and deleted-<id> for deleted accounts.
+	ErrReservedUsername = errors.New("usernames starting with guest- or deleted- are reserved")
 )
 
+// reservedUsername reports whether name uses a prefix the service hands out itself.
+func reservedUsername(name string) bool {
+	name = normalizeUsername(name)
+	return strings.HasPrefix(name, "guest-") || strings.HasPrefix(name, "deleted-")
+}
+
 type LoginRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+	// ClientIP is filled in by the HTTP handler for attempt throttling.
+	ClientIP string `json:"-"`
 }
 
 func (r LoginRequest) Validate() error {
@@ -21,23 +44,281 @@ func (r LoginRequest) Validate() error {
 	if len(r.Username) < 3 || len(r.Username) > 64 {
 		return ErrInvalidUsername
 	}
-	if len(r.Password) < 8 || len(r.Password) > 128 {
+	return validatePassword(r.Password)
+}
+
+type GuestLoginRequest struct {
+	DeviceID string `json:"device_id"`
+}
+
+func (r GuestLoginRequest) Validate() error {
+	if len(r.DeviceID) < 16 || len(r.DeviceID) > 128 {
+		return ErrInvalidDeviceID
+	}
+	return nil
+}
+
+// UpgradeGuestRequest carries the credentials attached to a guest account.
+type UpgradeGuestRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+func (r UpgradeGuestRequest) Validate() error {
+	if err := (LoginRequest{Username: r.Username, Password: r.Password}).Validate(); err != nil {
+		return err
+	}
+	if reservedUsername(r.Username) {
+		return ErrReservedUsername
+	}
+	return nil
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+func (r ChangePasswordRequest) Validate() error {
+	return validatePassword(r.NewPassword)
+}
+
+type PasswordResetRequest struct {
+	Username string `json:"username"`
+	// ClientIP is filled in by the HTTP handler for request throttling.
+	ClientIP string `json:"-"`
+}
+
+func (r PasswordResetRequest) Validate() error {
+	username := strings.TrimSpace(r.Username)
+	if len(username) < 3 || len(username) > 64 {
+		return ErrInvalidUsername
+	}
+	return nil
+}
+
+type ConfirmPasswordResetRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+func (r ConfirmPasswordResetRequest) Validate() error {
+	if r.Token == "" {
+		return ErrMissingToken
+	}
+	return validatePassword(r.NewPassword)
+}
+
+func validatePassword(password string) error {
+	if len(password) < 8 || len(password) > 128 {
 		return ErrInvalidPassword
 	}
 	return nil
 }
 
+// UpdateProfileRequest is a partial update: omitted fields are unchanged and "" clears a field.
+type UpdateProfileRequest struct {
+	Username    *string `json:"username,omitempty"`
+	DisplayName *string `json:"display_name,omitempty"`
+	AvatarURL   *string `json:"avatar_url,omitempty"`
+	Locale      *string `json:"locale,omitempty"`
+	Region      *string `json:"region,omitempty"`
+}
+
+var (
+	ErrNoProfileChanges   = errors.New("at least one field is required")
+	ErrInvalidDisplayName = errors.New("display_name must be at most 32 printable characters")
+	ErrInvalidAvatarURL   = errors.New("avatar_url must be an https URL of at most 512 characters")
+	ErrInvalidLocale      = errors.New("locale must look like en or en-US")
+	ErrInvalidRegion      = errors.New("region must be a lowercase code such as eu-west")
+
+	localePattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Z]{2})?$`)
+	regionPattern = regexp.MustCompile(`^[a-z]{2,}(-[a-z0-9]+)*$`)
+)
+
+func (r UpdateProfileRequest) Validate() error {
+	if r.Username == nil && r.DisplayName == nil && r.AvatarURL == nil && r.Locale == nil && r.Region == nil {
+		return ErrNoProfileChanges
+	}
+	if r.Username != nil {
+		username := strings.TrimSpace(*r.Username)
+		if len(username) < 3 || len(username) > 64 {
+			return ErrInvalidUsername
+		}
+		if reservedUsername(username) {
+			return ErrReservedUsername
+		}
+	}
+	if r.DisplayName != nil {
+		name := *r.DisplayName
+		if utf8.RuneCountInString(name) > 32 || strings.IndexFunc(name, func(c rune) bool { return !unicode.IsPrint(c) }) >= 0 {
+			return ErrInvalidDisplayName
+		}
+	}
+	if r.AvatarURL != nil && *r.AvatarURL != "" {
+		u, err := url.Parse(*r.AvatarURL)
+		if err != nil || len(*r.AvatarURL) > 512 || u.Scheme != "https" || u.Host == "" {
+			return ErrInvalidAvatarURL
+		}
+	}
+	if r.Locale != nil && *r.Locale != "" && !localePattern.MatchString(*r.Locale) {
+		return ErrInvalidLocale
+	}
+	if r.Region != nil && *r.Region != "" && (len(*r.Region) > 32 || !regionPattern.MatchString(*r.Region)) {
+		return ErrInvalidRegion
+	}
+	return nil
+}
+
 type UserProfile struct {
-	ID        string    `json:"id"`
-	Username  string    `json:"username"`
-	CreatedAt time.Time `json:"created_at"`
+	ID          string    `json:"id"`
+	Username    string    `json:"username"`
+	DisplayName string    `json:"display_name,omitempty"`
+	AvatarURL   string    `json:"avatar_url,omitempty"`
+	Locale      string    `json:"locale,omitempty"`
+	Region      string    `json:"region,omitempty"`
+	Roles       []string  `json:"roles,omitempty"`
+	Guest       bool      `json:"guest,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
 }
 
-type LoginResponse struct {
-	Token string      `json:"token"`
+// UpdateProfileResponse carries a fresh token when the username changed, since tokens embed it.
+type UpdateProfileResponse struct {
 	User  UserProfile `json:"user"`
+	Token string      `json:"token,omitempty"`
+}
+
+// LoginResponse carries either a session token and profile, or, for accounts with two-factor
+// authentication, only an MFA challenge token to redeem at /v1/login/mfa.
+type LoginResponse struct {
+	Token       string      `json:"token,omitempty"`
+	User        UserProfile `json:"user"`
+	MFARequired bool        `json:"mfa_required,omitempty"`
+	MFAToken    string      `json:"mfa_token,omitempty"`
+	// MFAEnrollmentRequired means privileged roles were withheld until the user enrolls TOTP.
+	MFAEnrollmentRequired bool `json:"mfa_enrollment_required,omitempty"`
+}
+
+// MFAChallengeResponse is what clients see instead of LoginResponse while a second factor is pending.
+type MFAChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+}
+
+type MFALoginRequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+func (r MFALoginRequest) Validate() error {
+	if r.MFAToken == "" {
+		return ErrMissingToken
+	}
+	return MFACodeRequest{Code: r.Code}.Validate()
+}
+
+// MFACodeRequest carries a TOTP code or a recovery code.
+type MFACodeRequest struct {
+	Code string `json:"code"`
+}
+
+func (r MFACodeRequest) Validate() error {
+	if code := strings.TrimSpace(r.Code); len(code) < totpDigits || len(code) > 16 {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+type TOTPEnrollResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// maxSanctionDuration caps timed sanctions; anything longer should be a ban.
+const maxSanctionDuration = 365 * 24 * time.Hour
+
+var (
+	ErrInvalidSanctionType     = errors.New("type must be ban, suspension or mute")
+	ErrInvalidSanctionReason   = errors.New("reason must be between 1 and 500 characters")
+	ErrInvalidSanctionDuration = errors.New("suspensions need a duration of at most a year, bans take none")
+)
+
+// ApplySanctionRequest is the body of POST /admin/v1/users/{id}/sanctions. DurationSeconds is required
+// for suspensions, optional for mutes and not allowed for bans, which last until lifted.
+type ApplySanctionRequest struct {
+	Type            string `json:"type"`
+	Reason          string `json:"reason"`
+	DurationSeconds int64  `json:"duration_seconds,omitempty"`
+}
+
+func (r ApplySanctionRequest) Validate() error {
+	if !sanctions.ValidType(r.Type) {
+		return ErrInvalidSanctionType
+	}
+	if reason := strings.TrimSpace(r.Reason); reason == "" || utf8.RuneCountInString(reason) > 500 {
+		return ErrInvalidSanctionReason
+	}
+	duration := time.Duration(r.DurationSeconds) * time.Second
+	switch {
+	case r.DurationSeconds < 0, duration > maxSanctionDuration:
+		return ErrInvalidSanctionDuration
+	case r.Type == sanctions.TypeBan && r.DurationSeconds != 0:
+		return ErrInvalidSanctionDuration
+	case r.Type == sanctions.TypeSuspension && r.DurationSeconds == 0:
+		return ErrInvalidSanctionDuration
+	}
+	return nil
+}
+
+type SanctionsResponse struct {
+	Sanctions []sanctions.Sanction `json:"sanctions"`
+}
+
+// OIDCStartResponse tells the client where to send the browser to sign in with an identity provider.
+type OIDCStartResponse struct {
+	AuthorizationURL string `json:"authorization_url"`
+	State            string `json:"state"`
 }
 
 type MeResponse struct {
 	User UserProfile `json:"user"`
 }
+
+type ServiceTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	Scope       string `json:"scope"`
+}
+
+type CreateServiceAccountRequest struct {
+	ClientID    string   `json:"client_id"`
+	Scopes      []string `json:"scopes"`
+	Description string   `json:"description"`
+}
+
+func (r CreateServiceAccountRequest) Validate() error {
+	if len(r.ClientID) < 3 || len(r.ClientID) > 64 || strings.TrimSpace(r.ClientID) != r.ClientID {
+		return ErrInvalidClientID
+	}
+	if len(r.Scopes) == 0 {
+		return ErrNoScopes
+	}
+	for _, scope := range r.Scopes {
+		if !authz.ValidServiceScope(scope) {
+			return fmt.Errorf("%w: %s", ErrInvalidScope, scope)
+		}
+	}
+	return nil
+}
+
+type CreateServiceAccountResponse struct {
+	ClientID     string    `json:"client_id"`
+	ClientSecret string    `json:"client_secret"`
+	Scopes       []string  `json:"scopes"`
+	CreatedAt    time.Time `json:"created_at"`
+}
@@ -0,0 +1,325 @@
+package matchmaking
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/contracts"
+)
+
+// Session statuses that end a session, as carried by session.status_changed.
+const (
+	sessionCompleted = "completed"
+	sessionAbandoned = "abandoned"
+)
+
+var ErrInvalidBackfill = errors.New("backfill needs one open slot count per team, each within the team size, and at least one open slot")
+
+// Backfill is a running session looking for players: OpenSlots[i] more players are wanted on team i.
+// Members are the players already in the session and Rating is their mean rating in the queue.
+type Backfill struct {
+	ID         string            `json:"id"`
+	SessionID  string            `json:"session_id"`
+	MatchID    string            `json:"match_id,omitempty"`
+	Queue      string            `json:"queue"`
+	Region     string            `json:"region,omitempty"`
+	OpenSlots  []int             `json:"open_slots"`
+	Members    []string          `json:"members"`
+	Rating     float64           `json:"rating"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	CreatedAt  time.Time         `json:"created_at"`
+}
+
+// Open is how many players the backfill still wants.
+func (b Backfill) Open() int {
+	open := 0
+	for _, n := range b.OpenSlots {
+		open += n
+	}
+	return open
+}
+
+// backfillFoundMessage tells a player over the gateway that their ticket joined a running session.
+type backfillFoundMessage struct {
+	Type      string `json:"type"`
+	TicketID  string `json:"ticket_id"`
+	SessionID string `json:"session_id"`
+	MatchID   string `json:"match_id,omitempty"`
+	Queue     string `json:"queue"`
+	Region    string `json:"region,omitempty"`
+	Team      int    `json:"team"`
+}
+
+// WithBackfills lets running sessions ask for players. Open backfills are filled before new matches
+// are formed.
+func (s *Service) WithBackfills(store BackfillStore) *Service {
+	s.backfills = store
+	return s
+}
+
+// HandleBackfillRequest opens a backfill from a session.backfill_requested event.
+func (s *Service) HandleBackfillRequest(ctx context.Context, data []byte) error {
+	env, err := contracts.UnmarshalEnvelope(data)
+	if err != nil {
+		return err
+	}
+	if env.Type != contracts.EventSessionBackfill {
+		return nil
+	}
+	var req contracts.SessionBackfillRequestedV1
+	if err := json.Unmarshal(env.Payload, &req); err != nil {
+		return err
+	}
+	cfg, ok := s.queues[req.Queue]
+	if !ok {
+		return ErrUnknownQueue
+	}
+	if req.BackfillID == "" || req.SessionID == "" || len(req.OpenSlots) != cfg.TeamCount {
+		return ErrInvalidBackfill
+	}
+	open := 0
+	for _, n := range req.OpenSlots {
+		if n < 0 || n > cfg.TeamSize {
+			return ErrInvalidBackfill
+		}
+		open += n
+	}
+	if open == 0 {
+		return ErrInvalidBackfill
+	}
+	if err := ValidateAttributes(req.Attributes, nil); err != nil {
+		return err
+	}
+	rating := DefaultRating
+	if s.ratings != nil && len(req.Members) > 0 {
+		total := 0.0
+		for _, userID := range req.Members {
+			r, err := s.ratings.Rating(ctx, userID, req.Queue)
+			if err != nil {
+				return err
+			}
+			total += r
+		}
+		rating = total / float64(len(req.Members))
+	}
+	return s.backfills.Open(ctx, Backfill{
+		ID: req.BackfillID, SessionID: req.SessionID, MatchID: req.MatchID, Queue: req.Queue, Region: req.Region,
+		OpenSlots: req.OpenSlots, Members: req.Members, Rating: rating, Attributes: req.Attributes, CreatedAt: s.now(),
+	})
+}
+
+// fillBackfills offers waiting tickets to the queue's open backfills, oldest backfill and longest-waiting
+// ticket first, and returns the tickets left for new matches. Backfills open longer than the queue's
+// ticket timeout are closed unfilled.
+func (s *Service) fillBackfills(ctx context.Context, cfg QueueConfig, waiting []Ticket, now time.Time) ([]Ticket, error) {
+	if s.backfills == nil || len(waiting) == 0 {
+		return waiting, nil
+	}
+	backfills, err := s.backfills.List(ctx, cfg.Name)
+	if err != nil {
+		return waiting, err
+	}
+	byWait := append([]Ticket(nil), waiting...)
+	sort.SliceStable(byWait, func(i, j int) bool { return waitsLonger(byWait[i], byWait[j]) })
+
+	used := map[string]bool{}
+	var errs []error
+	for _, b := range backfills {
+		if now.Sub(b.CreatedAt) >= cfg.TicketTimeout() {
+			if err := s.backfills.Close(ctx, cfg.Name, b.ID); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		for _, t := range byWait {
+			if used[t.ID] || b.Open() == 0 {
+				continue
+			}
+			team, ok := backfillFits(cfg, b, t, now)
+			if !ok {
+				continue
+			}
+			updated, filled, err := s.fillSlot(ctx, cfg, b, t, team)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if filled {
+				used[t.ID] = true
+				b = updated
+			}
+		}
+	}
+
+	left := make([]Ticket, 0, len(waiting))
+	for _, t := range waiting {
+		if !used[t.ID] {
+			left = append(left, t)
+		}
+	}
+	return left, errors.Join(errs...)
+}
+
+// backfillFits reports whether t may join b now, and on which team: the one with the most open slots
+// that fits the whole ticket. The ticket's rating window, latency threshold and the queue's rules apply
+// as they would to a new match; team balance is left out, since the teams are already playing.
+func backfillFits(cfg QueueConfig, b Backfill, t Ticket, now time.Time) (int, bool) {
+	team := -1
+	for i, open := range b.OpenSlots {
+		if open >= t.Size() && (team == -1 || open > b.OpenSlots[team]) {
+			team = i
+		}
+	}
+	if team == -1 {
+		return 0, false
+	}
+	if math.Abs(t.Rating-b.Rating) > cfg.RatingWindow(now.Sub(t.EnqueuedAt)) {
+		return 0, false
+	}
+	if regions := regionsWithin(cfg, t, now); b.Region != "" && regions != nil && !regions[b.Region] {
+		return 0, false
+	}
+	session := Ticket{ID: "backfill:" + b.ID, Members: b.Members, Rating: b.Rating, Attributes: b.Attributes, EnqueuedAt: b.CreatedAt}
+	if len(b.Members) > 0 {
+		session.UserID = b.Members[0]
+	}
+	if ruleConflict(cfg, []Ticket{session, t}, now, false) != "" {
+		return 0, false
+	}
+	return team, true
+}
+
+// fillSlot claims t and takes its places on team of b, adding its players to that team of the recorded
+// match. The ticket is committed as matched only once matchmaking.backfilled is published; if that fails
+// the places are given back, the players leave the match again and the ticket's lease runs out,
+// returning it to the queue.
+func (s *Service) fillSlot(ctx context.Context, cfg QueueConfig, b Backfill, t Ticket, team int) (Backfill, bool, error) {
+	claimed, err := s.queue.Claim(ctx, cfg.Name, []Ticket{t}, s.now().Add(claimLease))
+	if err != nil || !claimed {
+		return b, false, err
+	}
+	take := func(delta int) func(*Backfill) error {
+		return func(p *Backfill) error {
+			if p.OpenSlots[team] < delta {
+				return ErrBackfillFull
+			}
+			p.OpenSlots[team] -= delta
+			if delta > 0 {
+				p.Members = append(p.Members, t.Players()...)
+			} else {
+				for _, userID := range t.Players() {
+					p.Members = without(p.Members, userID)
+				}
+			}
+			return nil
+		}
+	}
+	updated, err := s.backfills.Update(ctx, b.ID, take(t.Size()))
+	if errors.Is(err, ErrBackfillFull) || errors.Is(err, ErrBackfillNotFound) {
+		// Another replica filled or closed it first.
+		return b, false, s.queue.Requeue(ctx, []Ticket{t})
+	}
+	if err != nil {
+		return b, false, err
+	}
+
+	corrID, err := s.newID()
+	if err != nil {
+		return b, false, err
+	}
+	if err := s.joinMatch(ctx, b, t, team); err != nil {
+		_, undoErr := s.backfills.Update(ctx, b.ID, take(-t.Size()))
+		return b, false, errors.Join(err, undoErr)
+	}
+	if err := s.publishBackfilled(corrID, updated, t, team); err != nil {
+		_, undoErr := s.backfills.Update(ctx, b.ID, take(-t.Size()))
+		return b, false, errors.Join(err, undoErr, s.leaveMatch(ctx, b, t))
+	}
+	if err := s.queue.Finish(ctx, []Ticket{t}, TicketMatched, b.MatchID); err != nil {
+		return updated, true, err
+	}
+	s.stats.recordMatched(cfg.Name, []Ticket{t}, s.now(), false)
+	if updated.Open() == 0 {
+		if err := s.backfills.Close(ctx, cfg.Name, b.ID); err != nil {
+			return updated, true, err
+		}
+	}
+	for _, userID := range t.Players() {
+		message := backfillFoundMessage{Type: "backfill_found", TicketID: t.ID, SessionID: b.SessionID, MatchID: b.MatchID, Queue: b.Queue, Region: b.Region, Team: team}
+		if err := s.sendToUser(corrID, userID, message); err != nil {
+			return updated, true, err
+		}
+	}
+	return updated, true, nil
+}
+
+// joinMatch records t's players on team of the match b belongs to, if matches are recorded.
+func (s *Service) joinMatch(ctx context.Context, b Backfill, t Ticket, team int) error {
+	if s.recorder == nil || b.MatchID == "" {
+		return nil
+	}
+	return s.recorder.JoinMatch(ctx, b.MatchID, team, t.Players())
+}
+
+func (s *Service) leaveMatch(ctx context.Context, b Backfill, t Ticket) error {
+	if s.recorder == nil || b.MatchID == "" {
+		return nil
+	}
+	return s.recorder.LeaveMatch(ctx, b.MatchID, t.Players())
+}
+
+// HandleSessionStatus closes the open backfills of a session that completed or was abandoned, from a
+// session.status_changed event.
+func (s *Service) HandleSessionStatus(ctx context.Context, data []byte) error {
+	if s.backfills == nil {
+		return nil
+	}
+	env, err := contracts.UnmarshalEnvelope(data)
+	if err != nil {
+		return err
+	}
+	if env.Type != contracts.EventSessionStatus {
+		return nil
+	}
+	var change contracts.SessionStatusChangedV1
+	if err := json.Unmarshal(env.Payload, &change); err != nil {
+		return err
+	}
+	if change.To != sessionCompleted && change.To != sessionAbandoned {
+		return nil
+	}
+	var errs []error
+	for name := range s.queues {
+		backfills, err := s.backfills.List(ctx, name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, b := range backfills {
+			if b.SessionID != change.SessionID {
+				continue
+			}
+			if err := s.backfills.Close(ctx, name, b.ID); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Service) publishBackfilled(correlationID string, b Backfill, t Ticket, team int) error {
+	eventID, err := s.newID()
+	if err != nil {
+		return err
+	}
+	payload := contracts.MatchmakingBackfilledV1{BackfillID: b.ID, SessionID: b.SessionID, MatchID: b.MatchID, Queue: b.Queue, TicketID: t.ID, Team: team, UserIDs: t.Players()}
+	raw, err := contracts.MarshalV1(eventID, contracts.EventMatchmakingBackfill, s.now(), correlationID, nil, payload)
+	if err != nil {
+		return err
+	}
+	return s.publisher.Publish(contracts.SubjectMatchmakingBackfill, raw)
+}
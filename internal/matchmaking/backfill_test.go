@@ -0,0 +1,211 @@
+package matchmaking
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/contracts"
+)
+
+func newBackfillService(now *time.Time) (*Service, *fakeRedisQueue, *fakePublisher, *fakeBackfills) {
+	queue := &fakeRedisQueue{}
+	publisher := &fakePublisher{}
+	store := newFakeBackfills()
+	svc := NewService(queue, publisher).
+		WithQueues([]QueueConfig{{Name: "duel", Mode: "duel", TeamSize: 1, TeamCount: 2, Rules: []MatchRule{{Type: RuleAvoidBlocked}}}}).
+		WithBackfills(store)
+	svc.now = func() time.Time { return *now }
+	return svc, queue, publisher, store
+}
+
+func backfillRequest(t *testing.T, payload contracts.SessionBackfillRequestedV1) []byte {
+	t.Helper()
+	raw, err := contracts.MarshalV1("evt-1", contracts.EventSessionBackfill, time.Now().UTC(), "corr-1", nil, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestBackfillIsFilledBeforeNewMatches(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	svc, queue, publisher, store := newBackfillService(&now)
+	recorder := &recordingRecorder{}
+	svc.WithMatchRecorder(recorder)
+
+	request := contracts.SessionBackfillRequestedV1{BackfillID: "bf-1", SessionID: "sess-1", MatchID: "m-0", Queue: "duel", OpenSlots: []int{0, 1}, Members: []string{"x"}}
+	if err := svc.HandleBackfillRequest(ctx, backfillRequest(t, request)); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(time.Second)
+	a, _ := svc.EnqueueWithOptions(ctx, "a", "duel", EnqueueOptions{Blocked: []string{"x"}}, "corr")
+	now = now.Add(time.Second)
+	b, _ := svc.Enqueue(ctx, "b", "duel", "corr")
+	now = now.Add(time.Second)
+	c, _ := svc.Enqueue(ctx, "c", "duel", "corr")
+
+	publisher.events = nil
+	if err := svc.ProcessOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var backfilled []contracts.MatchmakingBackfilledV1
+	for _, evt := range publisher.events {
+		if evt.subject != contracts.SubjectMatchmakingBackfill {
+			continue
+		}
+		env, err := contracts.UnmarshalEnvelope(evt.data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var payload contracts.MatchmakingBackfilledV1
+		if err := json.Unmarshal(env.Payload, &payload); err != nil {
+			t.Fatal(err)
+		}
+		backfilled = append(backfilled, payload)
+	}
+	want := []contracts.MatchmakingBackfilledV1{{BackfillID: "bf-1", SessionID: "sess-1", MatchID: "m-0", Queue: "duel", TicketID: b.ID, Team: 1, UserIDs: []string{"b"}}}
+	if !reflect.DeepEqual(backfilled, want) {
+		t.Fatalf("expected b, the longest waiter nobody blocked, to fill the slot, got %+v", backfilled)
+	}
+	if got := pushedTypes(t, publisher)["b"]; !reflect.DeepEqual(got, []string{"backfill_found"}) {
+		t.Fatalf("expected b to be told about the backfill, got %v", got)
+	}
+	if got, _ := queue.Ticket(ctx, b.ID); got.Status != TicketMatched || got.MatchID != "m-0" {
+		t.Fatalf("expected b's ticket to be matched into m-0, got %+v", got)
+	}
+	if got := recorder.joined["m-0"]; !reflect.DeepEqual(got, []string{"1:b"}) {
+		t.Fatalf("expected b to join team 1 of the recorded match, got %v", got)
+	}
+	for _, id := range []string{a.ID, c.ID} {
+		if got, _ := queue.Ticket(ctx, id); got.Status != TicketMatched || got.MatchID == "m-0" {
+			t.Fatalf("expected %s to be matched into a new match, got %+v", id, got)
+		}
+	}
+	if len(store.backfills) != 0 {
+		t.Fatalf("expected the full backfill to be closed, got %+v", store.backfills)
+	}
+}
+
+func TestBackfillExpiresAndValidates(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	svc, _, _, store := newBackfillService(&now)
+
+	for _, tc := range []struct {
+		payload contracts.SessionBackfillRequestedV1
+		want    error
+	}{
+		{contracts.SessionBackfillRequestedV1{BackfillID: "bf-1", SessionID: "sess-1", Queue: "ranked", OpenSlots: []int{0, 1}}, ErrUnknownQueue},
+		{contracts.SessionBackfillRequestedV1{BackfillID: "bf-1", SessionID: "sess-1", Queue: "duel", OpenSlots: []int{1}}, ErrInvalidBackfill},
+		{contracts.SessionBackfillRequestedV1{BackfillID: "bf-1", SessionID: "sess-1", Queue: "duel", OpenSlots: []int{0, 2}}, ErrInvalidBackfill},
+		{contracts.SessionBackfillRequestedV1{BackfillID: "bf-1", SessionID: "sess-1", Queue: "duel", OpenSlots: []int{0, 0}}, ErrInvalidBackfill},
+	} {
+		if err := svc.HandleBackfillRequest(ctx, backfillRequest(t, tc.payload)); !errors.Is(err, tc.want) {
+			t.Fatalf("%+v: expected %v, got %v", tc.payload, tc.want, err)
+		}
+	}
+
+	request := contracts.SessionBackfillRequestedV1{BackfillID: "bf-1", SessionID: "sess-1", Queue: "duel", OpenSlots: []int{1, 0}, Members: []string{"x"}}
+	if err := svc.HandleBackfillRequest(ctx, backfillRequest(t, request)); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(DefaultTicketTimeout)
+	_, _ = svc.Enqueue(ctx, "a", "duel", "corr")
+	if err := svc.ProcessOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.backfills) != 0 {
+		t.Fatalf("expected the backfill to be closed after the ticket timeout, got %+v", store.backfills)
+	}
+}
+
+func TestBackfillClosedWhenSessionEnds(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	svc, _, _, store := newBackfillService(&now)
+
+	for _, request := range []contracts.SessionBackfillRequestedV1{
+		{BackfillID: "bf-1", SessionID: "sess-1", Queue: "duel", OpenSlots: []int{0, 1}, Members: []string{"x"}},
+		{BackfillID: "bf-2", SessionID: "sess-2", Queue: "duel", OpenSlots: []int{1, 0}, Members: []string{"y"}},
+	} {
+		if err := svc.HandleBackfillRequest(ctx, backfillRequest(t, request)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	statusChanged := func(sessionID, to string) []byte {
+		raw, err := contracts.MarshalV1("evt-2", contracts.EventSessionStatus, now, "corr-2", nil, contracts.SessionStatusChangedV1{SessionID: sessionID, From: "in_progress", To: to, Actor: "server:gs-1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return raw
+	}
+
+	if err := svc.HandleSessionStatus(ctx, statusChanged("sess-1", "allocating")); err != nil || len(store.backfills) != 2 {
+		t.Fatalf("a session still in play keeps its backfills, got %+v (%v)", store.backfills, err)
+	}
+	if err := svc.HandleSessionStatus(ctx, statusChanged("sess-1", "completed")); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.backfills["bf-2"]; len(store.backfills) != 1 || !ok {
+		t.Fatalf("expected only the ended session's backfill to be closed, got %+v", store.backfills)
+	}
+}
+
+type fakeBackfills struct {
+	backfills map[string]Backfill
+}
+
+func newFakeBackfills() *fakeBackfills {
+	return &fakeBackfills{backfills: map[string]Backfill{}}
+}
+
+func copyBackfill(b Backfill) Backfill {
+	b.OpenSlots = append([]int(nil), b.OpenSlots...)
+	b.Members = append([]string(nil), b.Members...)
+	return b
+}
+
+func (f *fakeBackfills) Open(_ context.Context, backfill Backfill) error {
+	if _, ok := f.backfills[backfill.ID]; !ok {
+		f.backfills[backfill.ID] = copyBackfill(backfill)
+	}
+	return nil
+}
+
+func (f *fakeBackfills) List(_ context.Context, queue string) ([]Backfill, error) {
+	var out []Backfill
+	for _, b := range f.backfills {
+		if b.Queue == queue {
+			out = append(out, copyBackfill(b))
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out, nil
+}
+
+func (f *fakeBackfills) Update(_ context.Context, id string, fn func(*Backfill) error) (Backfill, error) {
+	b, ok := f.backfills[id]
+	if !ok {
+		return Backfill{}, ErrBackfillNotFound
+	}
+	b = copyBackfill(b)
+	if err := fn(&b); err != nil {
+		return Backfill{}, err
+	}
+	f.backfills[id] = b
+	return copyBackfill(b), nil
+}
+
+func (f *fakeBackfills) Close(_ context.Context, _, id string) error {
+	delete(f.backfills, id)
+	return nil
+}
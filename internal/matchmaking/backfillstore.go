@@ -0,0 +1,144 @@
+package matchmaking
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	backfillKeyPrefix  = "pcgb:mm:backfill:"
+	backfillsKeyPrefix = "pcgb:mm:backfills:"
+	// backfillTTL outlives any ticket timeout, so a backfill nobody closes still goes away.
+	backfillTTL = time.Hour
+)
+
+var (
+	ErrBackfillNotFound = errors.New("backfill not found")
+	ErrBackfillFull     = errors.New("backfill has no room left")
+)
+
+type BackfillStore interface {
+	// Open stores a new backfill. Opening an ID that is already open changes nothing, so a request
+	// delivered twice opens one backfill.
+	Open(ctx context.Context, backfill Backfill) error
+	// List returns the queue's open backfills, oldest first.
+	List(ctx context.Context, queue string) ([]Backfill, error)
+	// Update applies fn to an open backfill and saves the result atomically. An error from fn is
+	// returned as is and nothing is saved.
+	Update(ctx context.Context, id string, fn func(*Backfill) error) (Backfill, error)
+	Close(ctx context.Context, queue, id string) error
+}
+
+// RedisBackfills keeps each open backfill as JSON under its own key, indexed per queue in a sorted set
+// scored by when it was opened.
+type RedisBackfills struct {
+	client *redis.Client
+}
+
+func NewRedisBackfills(client *redis.Client) *RedisBackfills {
+	return &RedisBackfills{client: client}
+}
+
+func backfillKey(id string) string     { return backfillKeyPrefix + id }
+func backfillsKey(queue string) string { return backfillsKeyPrefix + queue }
+
+func (s *RedisBackfills) Open(ctx context.Context, backfill Backfill) error {
+	raw, err := json.Marshal(backfill)
+	if err != nil {
+		return err
+	}
+	created, err := s.client.SetNX(ctx, backfillKey(backfill.ID), raw, backfillTTL).Result()
+	if err != nil || !created {
+		return err
+	}
+	return s.client.ZAdd(ctx, backfillsKey(backfill.Queue), redis.Z{Score: float64(backfill.CreatedAt.UnixMilli()), Member: backfill.ID}).Err()
+}
+
+func (s *RedisBackfills) List(ctx context.Context, queue string) ([]Backfill, error) {
+	ids, err := s.client.ZRange(ctx, backfillsKey(queue), 0, -1).Result()
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = backfillKey(id)
+	}
+	values, err := s.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	backfills := make([]Backfill, 0, len(values))
+	var gone []any
+	for i, v := range values {
+		raw, ok := v.(string)
+		if !ok {
+			gone = append(gone, ids[i])
+			continue
+		}
+		var b Backfill
+		if err := json.Unmarshal([]byte(raw), &b); err != nil {
+			return nil, err
+		}
+		backfills = append(backfills, b)
+	}
+	if len(gone) > 0 {
+		// Drop index entries whose backfill expired.
+		if err := s.client.ZRem(ctx, backfillsKey(queue), gone...).Err(); err != nil {
+			return nil, err
+		}
+	}
+	return backfills, nil
+}
+
+func (s *RedisBackfills) Update(ctx context.Context, id string, fn func(*Backfill) error) (Backfill, error) {
+	var updated Backfill
+	txn := func(tx *redis.Tx) error {
+		raw, err := tx.Get(ctx, backfillKey(id)).Bytes()
+		if errors.Is(err, redis.Nil) {
+			return ErrBackfillNotFound
+		}
+		if err != nil {
+			return err
+		}
+		var b Backfill
+		if err := json.Unmarshal(raw, &b); err != nil {
+			return err
+		}
+		if err := fn(&b); err != nil {
+			return err
+		}
+		if raw, err = json.Marshal(b); err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, backfillKey(id), raw, redis.KeepTTL)
+			return nil
+		})
+		updated = b
+		return err
+	}
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		err := s.client.Watch(ctx, txn, backfillKey(id))
+		if errors.Is(err, redis.TxFailedErr) {
+			continue
+		}
+		if err != nil {
+			return Backfill{}, err
+		}
+		return updated, nil
+	}
+	return Backfill{}, ErrConcurrentUpdate
+}
+
+func (s *RedisBackfills) Close(ctx context.Context, queue, id string) error {
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, backfillKey(id))
+		pipe.ZRem(ctx, backfillsKey(queue), id)
+		return nil
+	})
+	return err
+}
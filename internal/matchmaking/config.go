@@ -0,0 +1,172 @@
+package matchmaking
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"time"
+)
+
+// DefaultQueueName is used when an enqueue request does not name a queue.
+const DefaultQueueName = "default"
+
+var ErrUnknownQueue = errors.New("unknown queue")
+
+// Rating window defaults, used when a queue leaves the corresponding field unset.
+const (
+	DefaultInitialRatingWindow = 100.0
+	DefaultRatingWindowGrowth  = 5.0
+	DefaultMaxRatingWindow     = 400.0
+	DefaultTicketTimeout       = 5 * time.Minute
+	DefaultDeclineCooldown     = time.Minute
+	DefaultInitialLatencyMs    = 60
+	DefaultLatencyGrowthMs     = 2.0
+	DefaultMaxLatencyMs        = 200
+)
+
+var queueNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// QueueConfig describes one named queue: the game mode it feeds, the shape of the matches it forms and
+// how far apart in rating its players may be. The rating window starts at InitialRatingWindow and grows
+// by RatingWindowGrowth for every second a player waits, up to MaxRatingWindow. Tickets that wait longer
+// than TicketTimeoutSeconds are dropped. Players who report pings are only matched in a region they
+// reach within InitialLatencyMs, a threshold that grows by LatencyGrowthMs for every second they wait, up
+// to MaxLatencyMs. Rules is the queue's match profile (see MatchRule). With ReadyCheckSeconds set, every
+// player must accept a formed match within that time; those who do not are kept out of the queues for
+// DeclineCooldownSeconds.
+type QueueConfig struct {
+	Name                   string      `json:"name"`
+	Mode                   string      `json:"mode"`
+	TeamSize               int         `json:"team_size"`
+	TeamCount              int         `json:"team_count"`
+	InitialRatingWindow    float64     `json:"initial_rating_window,omitempty"`
+	RatingWindowGrowth     float64     `json:"rating_window_growth,omitempty"`
+	MaxRatingWindow        float64     `json:"max_rating_window,omitempty"`
+	TicketTimeoutSeconds   int         `json:"ticket_timeout_seconds,omitempty"`
+	ReadyCheckSeconds      int         `json:"ready_check_seconds,omitempty"`
+	DeclineCooldownSeconds int         `json:"decline_cooldown_seconds,omitempty"`
+	InitialLatencyMs       int         `json:"initial_latency_ms,omitempty"`
+	LatencyGrowthMs        float64     `json:"latency_growth_ms,omitempty"`
+	MaxLatencyMs           int         `json:"max_latency_ms,omitempty"`
+	Rules                  []MatchRule `json:"rules,omitempty"`
+}
+
+// MatchSize is the number of players needed to form one match.
+func (c QueueConfig) MatchSize() int { return c.TeamSize * c.TeamCount }
+
+// RatingWindow is the largest rating gap a player accepts after waiting for wait.
+func (c QueueConfig) RatingWindow(wait time.Duration) float64 {
+	initial, growth, max := c.InitialRatingWindow, c.RatingWindowGrowth, c.MaxRatingWindow
+	if initial == 0 {
+		initial = DefaultInitialRatingWindow
+	}
+	if growth == 0 {
+		growth = DefaultRatingWindowGrowth
+	}
+	if max == 0 {
+		max = DefaultMaxRatingWindow
+	}
+	if wait < 0 {
+		wait = 0
+	}
+	return math.Min(initial+growth*wait.Seconds(), math.Max(initial, max))
+}
+
+// LatencyThreshold is the highest ping, in milliseconds, a player accepts for the match's region after
+// waiting for wait.
+func (c QueueConfig) LatencyThreshold(wait time.Duration) int {
+	initial, growth, max := c.InitialLatencyMs, c.LatencyGrowthMs, c.MaxLatencyMs
+	if initial == 0 {
+		initial = DefaultInitialLatencyMs
+	}
+	if growth == 0 {
+		growth = DefaultLatencyGrowthMs
+	}
+	if max == 0 {
+		max = DefaultMaxLatencyMs
+	}
+	if wait < 0 {
+		wait = 0
+	}
+	return int(math.Min(float64(initial)+growth*wait.Seconds(), math.Max(float64(initial), float64(max))))
+}
+
+// TicketTimeout is how long a ticket may wait before it times out.
+func (c QueueConfig) TicketTimeout() time.Duration {
+	if c.TicketTimeoutSeconds == 0 {
+		return DefaultTicketTimeout
+	}
+	return time.Duration(c.TicketTimeoutSeconds) * time.Second
+}
+
+// ReadyCheck is how long players have to accept a formed match. Zero means matches are announced
+// without a ready-check.
+func (c QueueConfig) ReadyCheck() time.Duration {
+	return time.Duration(c.ReadyCheckSeconds) * time.Second
+}
+
+// DeclineCooldown is how long a player who fails a ready-check must wait before queueing again.
+func (c QueueConfig) DeclineCooldown() time.Duration {
+	if c.DeclineCooldownSeconds == 0 {
+		return DefaultDeclineCooldown
+	}
+	return time.Duration(c.DeclineCooldownSeconds) * time.Second
+}
+
+func (c QueueConfig) Validate() error {
+	switch {
+	case !queueNamePattern.MatchString(c.Name):
+		return fmt.Errorf("queue %q: name must be 1-32 lowercase letters, digits, '-' or '_'", c.Name)
+	case c.Mode == "":
+		return fmt.Errorf("queue %q: mode is required", c.Name)
+	case c.TeamSize < 1 || c.TeamCount < 1 || c.MatchSize() < 2 || c.MatchSize() > 100:
+		return fmt.Errorf("queue %q: team_size and team_count must form a match of 2 to 100 players", c.Name)
+	case c.InitialRatingWindow < 0 || c.RatingWindowGrowth < 0 || c.MaxRatingWindow < 0:
+		return fmt.Errorf("queue %q: rating window settings must not be negative", c.Name)
+	case c.TicketTimeoutSeconds < 0:
+		return fmt.Errorf("queue %q: ticket_timeout_seconds must not be negative", c.Name)
+	case c.ReadyCheckSeconds < 0 || c.DeclineCooldownSeconds < 0:
+		return fmt.Errorf("queue %q: ready_check_seconds and decline_cooldown_seconds must not be negative", c.Name)
+	case c.MaxRatingWindow > 0 && c.MaxRatingWindow < c.InitialRatingWindow:
+		return fmt.Errorf("queue %q: max_rating_window must not be below initial_rating_window", c.Name)
+	case c.InitialLatencyMs < 0 || c.LatencyGrowthMs < 0 || c.MaxLatencyMs < 0:
+		return fmt.Errorf("queue %q: latency settings must not be negative", c.Name)
+	case c.MaxLatencyMs > 0 && c.MaxLatencyMs < c.InitialLatencyMs:
+		return fmt.Errorf("queue %q: max_latency_ms must not be below initial_latency_ms", c.Name)
+	}
+	for _, rule := range c.Rules {
+		if err := rule.validate(); err != nil {
+			return fmt.Errorf("queue %q: %w", c.Name, err)
+		}
+	}
+	return nil
+}
+
+// DefaultQueues is the single 1v1 queue used when no configuration is given.
+func DefaultQueues() []QueueConfig {
+	return []QueueConfig{{Name: DefaultQueueName, Mode: "duel", TeamSize: 1, TeamCount: 2}}
+}
+
+// ParseQueues reads a JSON array of QueueConfig objects and validates it.
+func ParseQueues(raw []byte) ([]QueueConfig, error) {
+	var queues []QueueConfig
+	if err := json.Unmarshal(raw, &queues); err != nil {
+		return nil, err
+	}
+	if len(queues) == 0 {
+		return nil, errors.New("at least one queue is required")
+	}
+	seen := map[string]bool{}
+	for _, q := range queues {
+		if err := q.Validate(); err != nil {
+			return nil, err
+		}
+		if seen[q.Name] {
+			return nil, fmt.Errorf("queue %q is defined twice", q.Name)
+		}
+		seen[q.Name] = true
+	}
+	return queues, nil
+}
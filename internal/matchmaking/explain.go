@@ -0,0 +1,144 @@
+package matchmaking
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// MaxExplainTickets bounds the tickets one dry-run may match.
+const MaxExplainTickets = 200
+
+var ErrInvalidExplain = errors.New("explain needs 1-200 tickets, each with a unique id and a user_id")
+
+// Explanation is a dry-run of the matcher: the matches it would form and, for every ticket, why it was
+// or was not matched.
+type Explanation struct {
+	Matches []ExplainedMatch    `json:"matches"`
+	Tickets []TicketExplanation `json:"tickets"`
+}
+
+// ExplainedMatch is a match the dry-run would form.
+type ExplainedMatch struct {
+	TicketIDs []string   `json:"ticket_ids"`
+	Teams     [][]string `json:"teams"`
+	Region    string     `json:"region,omitempty"`
+}
+
+// TicketExplanation says whether a ticket was matched. An unmatched ticket gets a Reason, and Conflicts
+// lists every other ticket it cannot be grouped with, and why.
+type TicketExplanation struct {
+	TicketID  string           `json:"ticket_id"`
+	Matched   bool             `json:"matched"`
+	Reason    string           `json:"reason,omitempty"`
+	Conflicts []TicketConflict `json:"conflicts,omitempty"`
+}
+
+// TicketConflict is why a ticket cannot share a match with the ticket With.
+type TicketConflict struct {
+	With   string `json:"with"`
+	Reason string `json:"reason"`
+}
+
+// Explain runs FindMatches over tickets as the matcher would at now, and explains the outcome.
+func Explain(cfg QueueConfig, tickets []Ticket, now time.Time) Explanation {
+	out := Explanation{Matches: []ExplainedMatch{}, Tickets: make([]TicketExplanation, 0, len(tickets))}
+	matched := map[string]bool{}
+	for _, group := range FindMatches(cfg, tickets, now) {
+		m, ok := BuildMatch(cfg, group, "")
+		if !ok {
+			continue
+		}
+		explained := ExplainedMatch{Teams: m.Teams, Region: matchRegion(cfg, group, now)}
+		for _, t := range group {
+			explained.TicketIDs = append(explained.TicketIDs, t.ID)
+			matched[t.ID] = true
+		}
+		out.Matches = append(out.Matches, explained)
+	}
+
+	for _, t := range tickets {
+		e := TicketExplanation{TicketID: t.ID, Matched: matched[t.ID]}
+		if e.Matched {
+			out.Tickets = append(out.Tickets, e)
+			continue
+		}
+		if t.Size() > cfg.TeamSize {
+			e.Reason = fmt.Sprintf("party of %d does not fit a team of %d", t.Size(), cfg.TeamSize)
+			out.Tickets = append(out.Tickets, e)
+			continue
+		}
+		compatible := t.Size()
+		for _, other := range tickets {
+			if other.ID == t.ID {
+				continue
+			}
+			if reason := pairConflict(cfg, t, other, now); reason != "" {
+				e.Conflicts = append(e.Conflicts, TicketConflict{With: other.ID, Reason: reason})
+			} else if !matched[other.ID] {
+				compatible += other.Size()
+			}
+		}
+		if compatible < cfg.MatchSize() {
+			e.Reason = fmt.Sprintf("only %d of the %d players needed can play together", compatible, cfg.MatchSize())
+		} else {
+			e.Reason = "compatible players do not form balanced teams that satisfy every rule"
+		}
+		out.Tickets = append(out.Tickets, e)
+	}
+	return out
+}
+
+// pairConflict explains why a and b cannot share a match at now, or returns "".
+func pairConflict(cfg QueueConfig, a, b Ticket, now time.Time) string {
+	if b.Size() > cfg.TeamSize {
+		return fmt.Sprintf("party of %d does not fit a team of %d", b.Size(), cfg.TeamSize)
+	}
+	if a.Size()+b.Size() > cfg.MatchSize() {
+		return "together they exceed the match size"
+	}
+	window := math.Min(cfg.RatingWindow(now.Sub(a.EnqueuedAt)), cfg.RatingWindow(now.Sub(b.EnqueuedAt)))
+	if gap := math.Abs(a.Rating - b.Rating); gap > window {
+		return fmt.Sprintf("rating gap %.0f exceeds the window of %.0f", gap, window)
+	}
+	if _, ok := narrowRegions(regionsWithin(cfg, a, now), regionsWithin(cfg, b, now)); !ok {
+		return "no region within both tickets' latency threshold"
+	}
+	return ruleConflict(cfg, []Ticket{a, b}, now, false)
+}
+
+// Explain dry-runs the matcher over tickets in the named queue at the current time. Tickets without an
+// enqueue time count as just queued. Nothing is read from or written to the real queue.
+func (s *Service) Explain(queueName string, tickets []Ticket) (Explanation, error) {
+	cfg, ok := s.queues[queueName]
+	if !ok {
+		return Explanation{}, ErrUnknownQueue
+	}
+	if len(tickets) == 0 || len(tickets) > MaxExplainTickets {
+		return Explanation{}, ErrInvalidExplain
+	}
+	now := s.now()
+	seen := map[string]bool{}
+	for i := range tickets {
+		t := &tickets[i]
+		if t.ID == "" || t.UserID == "" || seen[t.ID] {
+			return Explanation{}, ErrInvalidExplain
+		}
+		seen[t.ID] = true
+		if err := ValidatePings(t.Pings); err != nil {
+			return Explanation{}, err
+		}
+		if err := ValidateAttributes(t.Attributes, t.Blocked); err != nil {
+			return Explanation{}, err
+		}
+		t.Queue, t.Status = queueName, TicketQueued
+		if t.EnqueuedAt.IsZero() {
+			t.EnqueuedAt = now
+		}
+		if t.Rating == 0 {
+			t.Rating = DefaultRating
+		}
+	}
+	return Explain(cfg, tickets, now), nil
+}
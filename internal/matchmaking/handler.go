@@ -1,14 +1,85 @@
 package matchmaking
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"io"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/authz"
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/sanctions"
 	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/pkg/apierror"
 )
 
+type EnqueueRequest struct {
+	Queue      string            `json:"queue"`
+	Pings      map[string]int    `json:"pings,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Blocked    []string          `json:"blocked,omitempty"`
+}
+
+// ExplainRequest is a dry-run of the matcher over Tickets in Queue.
+type ExplainRequest struct {
+	Queue   string   `json:"queue"`
+	Tickets []Ticket `json:"tickets"`
+}
+
+type InviteRequest struct {
+	UserID string `json:"user_id"`
+}
+
+// TicketResponse is returned by the enqueue and ticket endpoints.
+type TicketResponse struct {
+	Status     string    `json:"status"`
+	TicketID   string    `json:"ticket_id"`
+	Queue      string    `json:"queue"`
+	Members    []string  `json:"members,omitempty"`
+	EnqueuedAt time.Time `json:"enqueued_at"`
+	MatchID    string    `json:"match_id,omitempty"`
+	// EstimatedWaitSeconds is how much longer a queued ticket is likely to wait, when the queue's recent
+	// matches give an estimate.
+	EstimatedWaitSeconds *int `json:"estimated_wait_seconds,omitempty"`
+}
+
+// QueuesResponse lists the stats of every queue.
+type QueuesResponse struct {
+	Queues []QueueStats `json:"queues"`
+}
+
+// ReadyCheckResponse is returned when a player answers a ready-check.
+type ReadyCheckResponse struct {
+	MatchID   string    `json:"match_id"`
+	Accepted  []string  `json:"accepted"`
+	Declined  []string  `json:"declined"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func ticketResponse(t Ticket) TicketResponse {
+	return TicketResponse{Status: t.Status, TicketID: t.ID, Queue: t.Queue, Members: t.Members, EnqueuedAt: t.EnqueuedAt, MatchID: t.MatchID}
+}
+
+// queuedTicketResponse is ticketResponse with the wait estimate of a queued ticket. The estimate is a
+// courtesy: without stats the ticket is returned without one.
+func (h *Handler) queuedTicketResponse(ctx context.Context, t Ticket) TicketResponse {
+	resp := ticketResponse(t)
+	if t.Status != TicketQueued {
+		return resp
+	}
+	if wait, ok, err := h.svc.EstimatedWait(ctx, t); err == nil && ok {
+		seconds := int(math.Ceil(wait.Seconds()))
+		resp.EstimatedWaitSeconds = &seconds
+	}
+	return resp
+}
+
+// TokenParser reads player tokens, and the principal of operators on the admin-only endpoints.
 type TokenParser interface {
+	authz.Verifier
 	ParseToken(token string) (string, string, error)
 }
 
@@ -24,6 +95,17 @@ func NewHandler(svc *Service, auth TokenParser) *Handler {
 
 func (h *Handler) Register(mux *http.ServeMux) {
 	mux.HandleFunc("/v1/matchmaking/enqueue", h.handleEnqueue)
+	mux.HandleFunc("/v1/matchmaking/tickets/", h.handleTicket)
+	mux.HandleFunc("/v1/matchmaking/workers", h.handleWorkers)
+	mux.HandleFunc("/v1/matchmaking/queues", h.handleQueues)
+	mux.HandleFunc("/v1/matchmaking/explain", authz.Require(h.auth, authz.ScopeAdminMatchmakingRead)(h.handleExplain))
+	if h.svc.ReadyChecksEnabled() {
+		mux.HandleFunc("/v1/matchmaking/matches/", h.handleReadyCheck)
+	}
+	if h.svc.PartiesEnabled() {
+		mux.HandleFunc("/v1/parties", h.handleCreateParty)
+		mux.HandleFunc("/v1/parties/", h.handleParty)
+	}
 }
 
 func (h *Handler) handleEnqueue(w http.ResponseWriter, r *http.Request) {
@@ -37,20 +119,326 @@ func (h *Handler) handleEnqueue(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	correlationID := r.Header.Get("X-Correlation-Id")
-	if correlationID == "" {
-		id, err := h.newID()
+	correlationID, ok := h.correlationID(w, r)
+	if !ok {
+		return
+	}
+	var req EnqueueRequest
+	// The body is optional; an empty one joins the default queue.
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		apierror.Write(w, http.StatusBadRequest, "invalid_json", "invalid json")
+		return
+	}
+	if req.Queue == "" {
+		req.Queue = DefaultQueueName
+	}
+	ticket, err := h.svc.EnqueueWithOptions(r.Context(), userID, req.Queue, EnqueueOptions{Pings: req.Pings, Attributes: req.Attributes, Blocked: req.Blocked}, correlationID)
+	if err != nil {
+		var sanctioned *sanctions.Error
+		var cooldown *CooldownError
+		switch {
+		case errors.As(err, &sanctioned):
+			apierror.Write(w, http.StatusForbidden, sanctioned.Code(), sanctioned.Error())
+		case errors.Is(err, sanctions.ErrUnavailable):
+			apierror.Write(w, http.StatusServiceUnavailable, "sanctions_unavailable", sanctions.ErrUnavailable.Error())
+		case errors.As(err, &cooldown):
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(cooldown.Until.Sub(time.Now()).Seconds()))))
+			apierror.Write(w, http.StatusTooManyRequests, "queue_cooldown", cooldown.Error())
+		case errors.Is(err, ErrInvalidPings):
+			apierror.Write(w, http.StatusBadRequest, "invalid_pings", err.Error())
+		case errors.Is(err, ErrInvalidAttributes):
+			apierror.Write(w, http.StatusBadRequest, "invalid_attributes", err.Error())
+		case errors.Is(err, ErrUnknownQueue):
+			apierror.Write(w, http.StatusBadRequest, "unknown_queue", "unknown queue "+req.Queue)
+		case errors.Is(err, ErrAlreadyQueued) && ticket.HasPlayer(userID):
+			apierror.Write(w, http.StatusConflict, "already_queued", "already queued in "+ticket.Queue+" with ticket "+ticket.ID)
+		case errors.Is(err, ErrAlreadyQueued):
+			// The ticket in the way belongs to a party member; it is theirs to see.
+			apierror.Write(w, http.StatusConflict, "already_queued", "a party member is already queued")
+		case errors.Is(err, ErrNotPartyLeader):
+			apierror.Write(w, http.StatusForbidden, "not_party_leader", "only the party leader can queue the party")
+		case errors.Is(err, ErrPartyTooLarge):
+			apierror.Write(w, http.StatusBadRequest, "party_too_large", "party does not fit on one team in "+req.Queue)
+		default:
+			apierror.Write(w, http.StatusInternalServerError, "internal_error", "enqueue failed")
+		}
+		return
+	}
+	writeJSON(w, http.StatusAccepted, h.queuedTicketResponse(r.Context(), ticket))
+}
+
+// handleTicket serves GET and DELETE /v1/matchmaking/tickets/{id} for the ticket's owner.
+func (h *Handler) handleTicket(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodDelete {
+		apierror.Write(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+	userID, ok := h.userIDFromAuth(r)
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, "unauthorized", "unauthorized")
+		return
+	}
+	ticketID := strings.TrimPrefix(r.URL.Path, "/v1/matchmaking/tickets/")
+	if ticketID == "" || strings.Contains(ticketID, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	var ticket Ticket
+	var err error
+	if r.Method == http.MethodGet {
+		ticket, err = h.svc.GetTicket(r.Context(), userID, ticketID)
+	} else {
+		correlationID, ok := h.correlationID(w, r)
+		if !ok {
+			return
+		}
+		ticket, err = h.svc.CancelTicket(r.Context(), userID, ticketID, correlationID)
+	}
+	switch {
+	case errors.Is(err, ErrTicketNotFound):
+		apierror.Write(w, http.StatusNotFound, "ticket_not_found", "ticket not found")
+	case errors.Is(err, ErrTicketNotActive):
+		apierror.Write(w, http.StatusConflict, "ticket_not_active", "ticket is already "+ticket.Status)
+	case err != nil:
+		apierror.Write(w, http.StatusInternalServerError, "internal_error", "ticket lookup failed")
+	default:
+		writeJSON(w, http.StatusOK, h.queuedTicketResponse(r.Context(), ticket))
+	}
+}
+
+// handleExplain serves POST /v1/matchmaking/explain: it shows which of the posted tickets the queue's
+// matcher and rules would group, and why the others would not be matched. It is for operators tuning
+// the queues.
+func (h *Handler) handleExplain(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.Write(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+	var req ExplainRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, "invalid_json", "invalid json")
+		return
+	}
+	if req.Queue == "" {
+		req.Queue = DefaultQueueName
+	}
+	explanation, err := h.svc.Explain(req.Queue, req.Tickets)
+	switch {
+	case errors.Is(err, ErrUnknownQueue):
+		apierror.Write(w, http.StatusBadRequest, "unknown_queue", "unknown queue "+req.Queue)
+	case errors.Is(err, ErrInvalidExplain):
+		apierror.Write(w, http.StatusBadRequest, "invalid_tickets", err.Error())
+	case errors.Is(err, ErrInvalidPings):
+		apierror.Write(w, http.StatusBadRequest, "invalid_pings", err.Error())
+	case errors.Is(err, ErrInvalidAttributes):
+		apierror.Write(w, http.StatusBadRequest, "invalid_attributes", err.Error())
+	case err != nil:
+		apierror.Write(w, http.StatusInternalServerError, "internal_error", "explain failed")
+	default:
+		writeJSON(w, http.StatusOK, explanation)
+	}
+}
+
+// handleQueues serves GET /v1/matchmaking/queues: how many players wait in each queue, how often it
+// matches and how long its matched players waited.
+func (h *Handler) handleQueues(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.Write(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+	if _, ok := h.userIDFromAuth(r); !ok {
+		apierror.Write(w, http.StatusUnauthorized, "unauthorized", "unauthorized")
+		return
+	}
+	queues, err := h.svc.QueueStats(r.Context())
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, "internal_error", "could not read queue stats")
+		return
+	}
+	writeJSON(w, http.StatusOK, QueuesResponse{Queues: queues})
+}
+
+// WorkersResponse shows which matchmaking instance works each queue.
+type WorkersResponse struct {
+	InstanceID string           `json:"instance_id,omitempty"`
+	Queues     []QueueOwnership `json:"queues"`
+}
+
+// handleWorkers serves GET /v1/matchmaking/workers. Like /metrics, it is a diagnostic and needs no token.
+func (h *Handler) handleWorkers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.Write(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+	queues, err := h.svc.Ownership(r.Context())
+	if err != nil {
+		apierror.Write(w, http.StatusServiceUnavailable, "leases_unavailable", "could not read queue leases")
+		return
+	}
+	writeJSON(w, http.StatusOK, WorkersResponse{InstanceID: h.svc.InstanceID(), Queues: queues})
+}
+
+// handleReadyCheck serves POST /v1/matchmaking/matches/{id}/accept and /decline for the proposed
+// match's players.
+func (h *Handler) handleReadyCheck(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.Write(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+	userID, ok := h.userIDFromAuth(r)
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, "unauthorized", "unauthorized")
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/v1/matchmaking/matches/"), "/")
+	if len(parts) != 2 || parts[0] == "" || (parts[1] != "accept" && parts[1] != "decline") {
+		http.NotFound(w, r)
+		return
+	}
+	correlationID, ok := h.correlationID(w, r)
+	if !ok {
+		return
+	}
+	answer := h.svc.AcceptMatch
+	if parts[1] == "decline" {
+		answer = h.svc.DeclineMatch
+	}
+	proposal, err := answer(r.Context(), userID, parts[0], correlationID)
+	switch {
+	case errors.Is(err, ErrProposalNotFound):
+		apierror.Write(w, http.StatusNotFound, "ready_check_not_found", "no pending ready-check for this match")
+	case errors.Is(err, ErrConcurrentUpdate):
+		apierror.Write(w, http.StatusConflict, "concurrent_update", err.Error())
+	case err != nil:
+		apierror.Write(w, http.StatusInternalServerError, "internal_error", "ready-check failed")
+	default:
+		writeJSON(w, http.StatusOK, ReadyCheckResponse{MatchID: proposal.MatchID, Accepted: nonNil(proposal.Accepted), Declined: nonNil(proposal.Declined), ExpiresAt: proposal.ExpiresAt})
+	}
+}
+
+// handleCreateParty serves POST /v1/parties, which makes the caller the leader of a new party.
+func (h *Handler) handleCreateParty(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.Write(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+	userID, ok := h.userIDFromAuth(r)
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, "unauthorized", "unauthorized")
+		return
+	}
+	correlationID, ok := h.correlationID(w, r)
+	if !ok {
+		return
+	}
+	party, err := h.svc.CreateParty(r.Context(), userID, correlationID)
+	if err != nil {
+		writePartyError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, party)
+}
+
+// handleParty serves GET /v1/parties/me and POST /v1/parties/{id}/{invites|accept|decline|leave}.
+func (h *Handler) handleParty(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.userIDFromAuth(r)
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, "unauthorized", "unauthorized")
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/v1/parties/"), "/")
+	if len(parts) == 1 && parts[0] == "me" {
+		if r.Method != http.MethodGet {
+			apierror.Write(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+			return
+		}
+		party, err := h.svc.Party(r.Context(), userID)
 		if err != nil {
-			apierror.Write(w, http.StatusInternalServerError, "internal_error", "could not create correlation id")
+			writePartyError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, party)
+		return
+	}
+	if len(parts) != 2 || parts[0] == "" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		apierror.Write(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+	partyID := parts[0]
+
+	var req InviteRequest
+	if parts[1] == "invites" {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, "invalid_json", "invalid json")
 			return
 		}
-		correlationID = id
 	}
-	if err := h.svc.Enqueue(r.Context(), userID, correlationID); err != nil {
-		apierror.Write(w, http.StatusInternalServerError, "internal_error", "enqueue failed")
+	correlationID, ok := h.correlationID(w, r)
+	if !ok {
+		return
+	}
+	var party Party
+	var err error
+	switch parts[1] {
+	case "invites":
+		party, err = h.svc.Invite(r.Context(), userID, partyID, req.UserID, correlationID)
+	case "accept":
+		party, err = h.svc.AcceptInvite(r.Context(), userID, partyID, correlationID)
+	case "decline":
+		party, err = h.svc.DeclineInvite(r.Context(), userID, partyID, correlationID)
+	case "leave":
+		party, err = h.svc.LeaveParty(r.Context(), userID, partyID, correlationID)
+	default:
+		http.NotFound(w, r)
 		return
 	}
-	writeJSON(w, http.StatusAccepted, map[string]string{"status": "queued"})
+	if err != nil {
+		writePartyError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, party)
+}
+
+func writePartyError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrPartyNotFound):
+		apierror.Write(w, http.StatusNotFound, "party_not_found", "party not found")
+	case errors.Is(err, ErrNotInParty):
+		apierror.Write(w, http.StatusNotFound, "not_in_party", "not in a party")
+	case errors.Is(err, ErrNoInvite):
+		apierror.Write(w, http.StatusNotFound, "invite_not_found", "no pending invite to this party")
+	case errors.Is(err, ErrNotPartyLeader):
+		apierror.Write(w, http.StatusForbidden, "not_party_leader", "only the party leader can do that")
+	case errors.Is(err, ErrAlreadyInParty):
+		apierror.Write(w, http.StatusConflict, "already_in_party", "already in a party")
+	case errors.Is(err, ErrPartyFull):
+		apierror.Write(w, http.StatusConflict, "party_full", "party is full")
+	case errors.Is(err, ErrAlreadyQueued):
+		apierror.Write(w, http.StatusConflict, "already_queued", "a match is being proposed to you; answer it before joining a party")
+	case errors.Is(err, ErrConcurrentUpdate):
+		apierror.Write(w, http.StatusConflict, "concurrent_update", err.Error())
+	case errors.Is(err, ErrInvalidInvite):
+		apierror.Write(w, http.StatusBadRequest, "invalid_invite", "user_id must name a player outside the party")
+	default:
+		apierror.Write(w, http.StatusInternalServerError, "internal_error", "party request failed")
+	}
+}
+
+func (h *Handler) correlationID(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if id := r.Header.Get("X-Correlation-Id"); id != "" {
+		return id, true
+	}
+	id, err := h.newID()
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, "internal_error", "could not create correlation id")
+		return "", false
+	}
+	return id, true
 }
 
 func (h *Handler) userIDFromAuth(r *http.Request) (string, bool) {
@@ -66,6 +454,13 @@ func (h *Handler) userIDFromAuth(r *http.Request) (string, bool) {
 	return userID, true
 }
 
+func nonNil(ids []string) []string {
+	if ids == nil {
+		return []string{}
+	}
+	return ids
+}
+
 func writeJSON(w http.ResponseWriter, status int, value any) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -0,0 +1,131 @@
+//go:build integration
+
+package matchmaking
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/itest"
+)
+
+func TestRedisQueueClaimsOnceAndReclaimsExpiredLeases(t *testing.T) {
+	h := itest.Start(t)
+	ctx := context.Background()
+	q := NewRedisQueue(itest.Redis(t, h.RedisAddr))
+	now := time.Now().UTC()
+
+	var tickets []Ticket
+	for _, id := range []string{"u1", "u2", "u3"} {
+		ticket, err := q.Enqueue(ctx, Ticket{ID: "t-" + id, UserID: id, Queue: "itest", Rating: DefaultRating, EnqueuedAt: now, Status: TicketQueued})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tickets = append(tickets, ticket)
+	}
+
+	// Two replicas race for overlapping groups; exactly one may win.
+	var wg sync.WaitGroup
+	results := make([]bool, 2)
+	for i, group := range [][]Ticket{tickets[:2], tickets[1:]} {
+		wg.Add(1)
+		go func(i int, group []Ticket) {
+			defer wg.Done()
+			claimed, err := q.Claim(ctx, "itest", group, now.Add(time.Minute))
+			if err != nil {
+				t.Error(err)
+			}
+			results[i] = claimed
+		}(i, group)
+	}
+	wg.Wait()
+	if results[0] == results[1] {
+		t.Fatalf("expected exactly one claim to win, got %v", results)
+	}
+	waiting, err := q.Tickets(ctx, "itest")
+	if err != nil || len(waiting) != 1 {
+		t.Fatalf("expected one ticket left waiting, got %+v (%v)", waiting, err)
+	}
+
+	if returned, err := q.Reclaim(ctx, "itest", now.Add(30*time.Second)); err != nil || len(returned) != 0 {
+		t.Fatalf("leases must hold until they end, got %v (%v)", returned, err)
+	}
+	returned, err := q.Reclaim(ctx, "itest", now.Add(2*time.Minute))
+	if err != nil || len(returned) != 2 {
+		t.Fatalf("expected both claimed tickets back, got %v (%v)", returned, err)
+	}
+	waiting, _ = q.Tickets(ctx, "itest")
+	if len(waiting) != 3 {
+		t.Fatalf("expected every ticket waiting again, got %+v", waiting)
+	}
+
+	if claimed, err := q.Claim(ctx, "itest", tickets[:2], now.Add(time.Minute)); err != nil || !claimed {
+		t.Fatalf("expected the claim to succeed, got %v (%v)", claimed, err)
+	}
+	if err := q.Finish(ctx, tickets[:2], TicketMatched, "m-1"); err != nil {
+		t.Fatal(err)
+	}
+	if returned, err := q.Reclaim(ctx, "itest", now.Add(time.Hour)); err != nil || len(returned) != 0 {
+		t.Fatalf("committed tickets must not be reclaimed, got %v (%v)", returned, err)
+	}
+}
+
+func TestRedisQueueKeepsProposedTicketsActive(t *testing.T) {
+	h := itest.Start(t)
+	ctx := context.Background()
+	q := NewRedisQueue(itest.Redis(t, h.RedisAddr))
+	now := time.Now().UTC()
+
+	ticket, err := q.Enqueue(ctx, Ticket{ID: "t-proposed", UserID: "u-proposed", Queue: "itest-rc", Rating: DefaultRating, EnqueuedAt: now, Status: TicketQueued})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claimed, err := q.Claim(ctx, "itest-rc", []Ticket{ticket}, now.Add(time.Minute)); err != nil || !claimed {
+		t.Fatalf("expected the claim to succeed, got %v (%v)", claimed, err)
+	}
+	if err := q.Hold(ctx, []Ticket{ticket}, "m-rc"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Queueing again while the ready-check is open must not drop the held ticket.
+	again := Ticket{ID: "t-again", UserID: "u-proposed", Queue: "itest-rc", Rating: DefaultRating, EnqueuedAt: now, Status: TicketQueued}
+	existing, err := q.Enqueue(ctx, again)
+	if !errors.Is(err, ErrAlreadyQueued) || existing.ID != ticket.ID || existing.Status != TicketProposed {
+		t.Fatalf("expected the proposed ticket back with ErrAlreadyQueued, got %+v (%v)", existing, err)
+	}
+	if _, err := q.Ticket(ctx, "t-again"); !errors.Is(err, ErrTicketNotFound) {
+		t.Fatalf("the second ticket must not be stored, got %v", err)
+	}
+	if active, err := q.ActiveTicket(ctx, "u-proposed"); err != nil || active.ID != ticket.ID {
+		t.Fatalf("expected the proposed ticket to be active, got %+v (%v)", active, err)
+	}
+	if err := q.Finish(ctx, []Ticket{ticket}, TicketDeclined, "m-rc"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.ActiveTicket(ctx, "u-proposed"); !errors.Is(err, ErrTicketNotFound) {
+		t.Fatalf("expected no active ticket once finished, got %v", err)
+	}
+}
+
+func TestRedisQueueFinishReleasesEveryPartyMember(t *testing.T) {
+	h := itest.Start(t)
+	ctx := context.Background()
+	q := NewRedisQueue(itest.Redis(t, h.RedisAddr))
+	now := time.Now().UTC()
+
+	party := Ticket{ID: "t-party", UserID: "p1", Members: []string{"p1", "p2"}, PartyID: "party-1", Queue: "itest-party", Rating: DefaultRating, EnqueuedAt: now, Status: TicketQueued}
+	if _, err := q.Enqueue(ctx, party); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Finish(ctx, []Ticket{party}, TicketCancelled, ""); err != nil {
+		t.Fatal(err)
+	}
+	for _, userID := range party.Players() {
+		if n, err := q.client.Exists(ctx, activeKey(userID)).Result(); err != nil || n != 0 {
+			t.Fatalf("expected %s's active ticket to be released, got %d (%v)", userID, n, err)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package matchmaking
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	leaseKeyPrefix = "pcgb:mm:lease:"
+	instancesKey   = "pcgb:mm:instances"
+)
+
+// QueueLeases lets matchmaking replicas share the queues: each queue is worked by the one replica that
+// holds its lease.
+type QueueLeases interface {
+	// Heartbeat records that instanceID is alive until now+ttl and returns how many instances are alive.
+	Heartbeat(ctx context.Context, instanceID string, now time.Time, ttl time.Duration) (int, error)
+	// Acquire takes the lease on queue for instanceID, or renews it if instanceID already holds it, and
+	// reports whether instanceID holds it now.
+	Acquire(ctx context.Context, queue, instanceID string, ttl time.Duration) (bool, error)
+	// Release gives up the lease on queue if instanceID holds it.
+	Release(ctx context.Context, queue, instanceID string) error
+	// Owners returns the instance holding the lease of each of queues. Unleased queues are left out.
+	Owners(ctx context.Context, queues []string) (map[string]string, error)
+}
+
+// RedisQueueLeases keeps each queue's lease in a key holding the owner's instance ID, and live instances
+// in a sorted set scored by the unix millisecond their heartbeat runs out.
+type RedisQueueLeases struct {
+	client *redis.Client
+}
+
+func NewRedisQueueLeases(client *redis.Client) *RedisQueueLeases {
+	return &RedisQueueLeases{client: client}
+}
+
+func leaseKey(queue string) string { return leaseKeyPrefix + queue }
+
+func (l *RedisQueueLeases) Heartbeat(ctx context.Context, instanceID string, now time.Time, ttl time.Duration) (int, error) {
+	var count *redis.IntCmd
+	_, err := l.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRemRangeByScore(ctx, instancesKey, "-inf", strconv.FormatInt(now.UnixMilli(), 10))
+		pipe.ZAdd(ctx, instancesKey, redis.Z{Score: float64(now.Add(ttl).UnixMilli()), Member: instanceID})
+		count = pipe.ZCard(ctx, instancesKey)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int(count.Val()), nil
+}
+
+func (l *RedisQueueLeases) Acquire(ctx context.Context, queue, instanceID string, ttl time.Duration) (bool, error) {
+	held, err := l.client.Eval(ctx, acquireLeaseScript, []string{leaseKey(queue)}, instanceID, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+	return held == 1, nil
+}
+
+func (l *RedisQueueLeases) Release(ctx context.Context, queue, instanceID string) error {
+	return l.client.Eval(ctx, releaseActiveScript, []string{leaseKey(queue)}, instanceID).Err()
+}
+
+func (l *RedisQueueLeases) Owners(ctx context.Context, queues []string) (map[string]string, error) {
+	owners := make(map[string]string, len(queues))
+	if len(queues) == 0 {
+		return owners, nil
+	}
+	keys := make([]string, len(queues))
+	for i, q := range queues {
+		keys[i] = leaseKey(q)
+	}
+	values, err := l.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i, v := range values {
+		if owner, ok := v.(string); ok {
+			owners[queues[i]] = owner
+		}
+	}
+	return owners, nil
+}
+
+// acquireLeaseScript renews lease KEYS[1] for ARGV[2] milliseconds if ARGV[1] holds it, takes it if
+// nobody does, and returns 1 in both cases; it returns 0 if another instance holds it.
+const acquireLeaseScript = `
+local owner = redis.call("GET", KEYS[1])
+if owner == ARGV[1] then
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+	return 1
+end
+if owner then
+	return 0
+end
+redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+return 1`
@@ -0,0 +1,249 @@
+package matchmaking
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Ticket statuses. A ticket is queued until it is matched, cancelled by its player or timed out. In
+// queues with a ready-check, a ticket is proposed while its players are asked to accept the match, and
+// declined if one of them does not.
+const (
+	TicketQueued    = "queued"
+	TicketProposed  = "proposed"
+	TicketMatched   = "matched"
+	TicketCancelled = "cancelled"
+	TicketTimedOut  = "timed_out"
+	TicketDeclined  = "declined"
+)
+
+// Ticket is a request to be matched in a queue. A solo ticket belongs to UserID; a party ticket is
+// owned by the party leader in UserID and lists every member, leader included, in Members. Rating is
+// the mean rating of the players. Pings holds the round trip in milliseconds to each region the client
+// measured; a ticket without pings can play in any region. Attributes and Blocked are what the queue's
+// match rules look at, such as the players' platform and the user IDs they refuse to play with.
+type Ticket struct {
+	ID         string            `json:"id"`
+	UserID     string            `json:"user_id"`
+	Members    []string          `json:"members,omitempty"`
+	PartyID    string            `json:"party_id,omitempty"`
+	Queue      string            `json:"queue"`
+	Rating     float64           `json:"rating"`
+	Pings      map[string]int    `json:"pings,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Blocked    []string          `json:"blocked,omitempty"`
+	EnqueuedAt time.Time         `json:"enqueued_at"`
+	Status     string            `json:"status"`
+	MatchID    string            `json:"match_id,omitempty"`
+}
+
+// Players returns the user IDs the ticket queues for.
+func (t Ticket) Players() []string {
+	if len(t.Members) == 0 {
+		return []string{t.UserID}
+	}
+	return t.Members
+}
+
+// Size is the number of players on the ticket.
+func (t Ticket) Size() int { return len(t.Players()) }
+
+// HasPlayer reports whether userID is queued on the ticket.
+func (t Ticket) HasPlayer(userID string) bool { return contains(t.Players(), userID) }
+
+// FindMatches groups waiting tickets into matches of cfg.MatchSize() players. The longest-waiting ticket
+// is served first: it is grouped with the closest-rated tickets such that the rating spread of the group
+// fits the window of every ticket at its current wait, every ticket reaches some common region within its
+// latency threshold, the queue's match rules hold, and every party still fits on one team. Tickets
+// that fit in no group are left out, to be tried again on the next pass with wider windows. Each group is
+// ordered strongest first.
+func FindMatches(cfg QueueConfig, tickets []Ticket, now time.Time) [][]Ticket {
+	size := cfg.MatchSize()
+	waitingPlayers := 0
+	for _, t := range tickets {
+		waitingPlayers += t.Size()
+	}
+	if size < 2 || waitingPlayers < size {
+		return nil
+	}
+	byWait := append([]Ticket(nil), tickets...)
+	sort.SliceStable(byWait, func(i, j int) bool { return waitsLonger(byWait[i], byWait[j]) })
+
+	// byRating orders the tickets, by their index in byWait, from lowest to highest rating; each anchor's
+	// candidates are found by scanning outwards from its place in it.
+	byRating := make([]int, len(byWait))
+	for i := range byRating {
+		byRating[i] = i
+	}
+	sort.SliceStable(byRating, func(i, j int) bool { return byWait[byRating[i]].Rating < byWait[byRating[j]].Rating })
+	position := make([]int, len(byWait))
+	for p, i := range byRating {
+		position[i] = p
+	}
+
+	used := make([]bool, len(byWait))
+	var groups [][]Ticket
+	for a, anchor := range byWait {
+		if used[a] || anchor.Size() > cfg.TeamSize {
+			continue
+		}
+		group := []Ticket{anchor}
+		members := []int{a}
+		players := anchor.Size()
+		low, high := anchor.Rating, anchor.Rating
+		window := cfg.RatingWindow(now.Sub(anchor.EnqueuedAt))
+		regions := regionsWithin(cfg, anchor, now)
+		scan := ratingScan{tickets: byWait, byRating: byRating, used: used, rating: anchor.Rating, lo: position[a] - 1, hi: position[a] + 1}
+		for players < size {
+			c, ok := scan.next(window)
+			if !ok {
+				// Candidates come by distance from the anchor, so nobody further out fits either.
+				break
+			}
+			t := byWait[c]
+			if players+t.Size() > size {
+				continue
+			}
+			l, h := math.Min(low, t.Rating), math.Max(high, t.Rating)
+			w := math.Min(window, cfg.RatingWindow(now.Sub(t.EnqueuedAt)))
+			if h-l > w {
+				continue
+			}
+			r, ok := narrowRegions(regions, regionsWithin(cfg, t, now))
+			if !ok {
+				continue
+			}
+			next := append(group[:len(group):len(group)], t)
+			if ruleConflict(cfg, next, now, players+t.Size() == size) != "" {
+				continue
+			}
+			if _, ok := assignTeams(cfg, next); !ok {
+				continue
+			}
+			group = append(group, t)
+			members = append(members, c)
+			players += t.Size()
+			low, high, window, regions = l, h, w, r
+		}
+		if players < size {
+			continue
+		}
+		for _, m := range members {
+			used[m] = true
+		}
+		sort.SliceStable(group, func(i, j int) bool {
+			if group[i].Rating != group[j].Rating {
+				return group[i].Rating > group[j].Rating
+			}
+			return waitsLonger(group[i], group[j])
+		})
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// ratingScan walks outwards from an anchor's place in the rating order, yielding the unused tickets
+// closest in rating first. Tickets as far from the anchor as each other come in wait order.
+type ratingScan struct {
+	tickets  []Ticket // in wait order
+	byRating []int    // indexes into tickets, lowest rating first
+	used     []bool
+	rating   float64
+	lo, hi   int     // next places in byRating below and above the anchor
+	batch    []int   // tickets at distance from the anchor not yet yielded
+	distance float64 // of the tickets in batch
+}
+
+// next returns the index of the next closest ticket, or false once none is left within limit of the
+// anchor's rating.
+func (s *ratingScan) next(limit float64) (int, bool) {
+	if len(s.batch) == 0 {
+		s.fill(limit)
+	}
+	if len(s.batch) == 0 || s.distance > limit {
+		return 0, false
+	}
+	c := s.batch[0]
+	s.batch = s.batch[1:]
+	return c, true
+}
+
+// fill collects every unused ticket at the smallest remaining distance from the anchor, if it is within
+// limit, from both sides.
+func (s *ratingScan) fill(limit float64) {
+	for s.lo >= 0 && s.used[s.byRating[s.lo]] {
+		s.lo--
+	}
+	for s.hi < len(s.byRating) && s.used[s.byRating[s.hi]] {
+		s.hi++
+	}
+	distance := math.Inf(1)
+	if s.lo >= 0 {
+		distance = s.rating - s.tickets[s.byRating[s.lo]].Rating
+	}
+	if s.hi < len(s.byRating) {
+		distance = math.Min(distance, s.tickets[s.byRating[s.hi]].Rating-s.rating)
+	}
+	if math.IsInf(distance, 1) || distance > limit {
+		return
+	}
+	s.distance = distance
+	for ; s.lo >= 0 && s.rating-s.tickets[s.byRating[s.lo]].Rating == distance; s.lo-- {
+		if !s.used[s.byRating[s.lo]] {
+			s.batch = append(s.batch, s.byRating[s.lo])
+		}
+	}
+	for ; s.hi < len(s.byRating) && s.tickets[s.byRating[s.hi]].Rating-s.rating == distance; s.hi++ {
+		if !s.used[s.byRating[s.hi]] {
+			s.batch = append(s.batch, s.byRating[s.hi])
+		}
+	}
+	// Indexes follow the wait order.
+	sort.Ints(s.batch)
+}
+
+func waitsLonger(a, b Ticket) bool {
+	if !a.EnqueuedAt.Equal(b.EnqueuedAt) {
+		return a.EnqueuedAt.Before(b.EnqueuedAt)
+	}
+	return a.UserID < b.UserID
+}
+
+// assignTeams places tickets on cfg.TeamCount teams of at most cfg.TeamSize players, keeping each ticket
+// on a single team. Larger tickets are placed first; within a size, stronger tickets go first, and each
+// goes to the team with room whose rating total is lowest, which balances the teams. It reports false if
+// the tickets cannot be placed.
+func assignTeams(cfg QueueConfig, tickets []Ticket) ([][]Ticket, bool) {
+	order := append([]Ticket(nil), tickets...)
+	sort.SliceStable(order, func(i, j int) bool {
+		if order[i].Size() != order[j].Size() {
+			return order[i].Size() > order[j].Size()
+		}
+		if order[i].Rating != order[j].Rating {
+			return order[i].Rating > order[j].Rating
+		}
+		return waitsLonger(order[i], order[j])
+	})
+	teams := make([][]Ticket, cfg.TeamCount)
+	filled := make([]int, cfg.TeamCount)
+	total := make([]float64, cfg.TeamCount)
+	for _, t := range order {
+		best := -1
+		for i := range teams {
+			if filled[i]+t.Size() > cfg.TeamSize {
+				continue
+			}
+			if best == -1 || total[i] < total[best] {
+				best = i
+			}
+		}
+		if best == -1 {
+			return nil, false
+		}
+		teams[best] = append(teams[best], t)
+		filled[best] += t.Size()
+		total[best] += t.Rating * float64(t.Size())
+	}
+	return teams, true
+}
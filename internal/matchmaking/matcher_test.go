@@ -0,0 +1,195 @@
+package matchmaking
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRatingWindowWidensWithWait(t *testing.T) {
+	t.Parallel()
+	cfg := QueueConfig{InitialRatingWindow: 50, RatingWindowGrowth: 10, MaxRatingWindow: 200}
+	tests := []struct {
+		wait time.Duration
+		want float64
+	}{
+		{0, 50},
+		{-time.Second, 50},
+		{5 * time.Second, 100},
+		{time.Minute, 200},
+	}
+	for _, tc := range tests {
+		if got := cfg.RatingWindow(tc.wait); got != tc.want {
+			t.Fatalf("wait %s: expected %v, got %v", tc.wait, tc.want, got)
+		}
+	}
+	if got := (QueueConfig{}).RatingWindow(time.Hour); got != DefaultMaxRatingWindow {
+		t.Fatalf("expected default max window, got %v", got)
+	}
+}
+
+func TestFindMatches(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	duel := QueueConfig{Name: "duel", Mode: "duel", TeamSize: 1, TeamCount: 2, InitialRatingWindow: 100, RatingWindowGrowth: 10, MaxRatingWindow: 400}
+	squads := QueueConfig{Name: "squads", Mode: "battle", TeamSize: 2, TeamCount: 2, InitialRatingWindow: 100, RatingWindowGrowth: 10, MaxRatingWindow: 400}
+	ago := func(d time.Duration) time.Time { return now.Add(-d) }
+	tk := func(userID string, rating float64, enqueuedAt time.Time) Ticket {
+		return Ticket{ID: "t-" + userID, UserID: userID, Rating: rating, EnqueuedAt: enqueuedAt, Status: TicketQueued}
+	}
+	party := func(leaderID string, rating float64, enqueuedAt time.Time, members ...string) Ticket {
+		t := tk(leaderID, rating, enqueuedAt)
+		t.Members = members
+		return t
+	}
+
+	tests := []struct {
+		name    string
+		cfg     QueueConfig
+		tickets []Ticket
+		want    [][]string
+	}{
+		{
+			name:    "new player is not matched against a veteran",
+			cfg:     duel,
+			tickets: []Ticket{tk("rookie", 1500, ago(0)), tk("veteran", 2100, ago(0))},
+			want:    nil,
+		},
+		{
+			name:    "never beyond the max window",
+			cfg:     duel,
+			tickets: []Ticket{tk("rookie", 1500, ago(time.Hour)), tk("veteran", 2100, ago(time.Hour))},
+			want:    nil,
+		},
+		{
+			name:    "close ratings match at once",
+			cfg:     duel,
+			tickets: []Ticket{tk("a", 1500, ago(0)), tk("b", 1580, ago(0))},
+			want:    [][]string{{"b", "a"}},
+		},
+		{
+			name:    "gap accepted once both have waited",
+			cfg:     duel,
+			tickets: []Ticket{tk("a", 1500, ago(20*time.Second)), tk("b", 1750, ago(20*time.Second))},
+			want:    [][]string{{"b", "a"}},
+		},
+		{
+			name:    "gap refused while one side is fresh",
+			cfg:     duel,
+			tickets: []Ticket{tk("a", 1500, ago(time.Minute)), tk("b", 1750, ago(0))},
+			want:    nil,
+		},
+		{
+			name: "longest waiter picks the closest opponent",
+			cfg:  duel,
+			tickets: []Ticket{
+				tk("late", 1530, ago(0)),
+				tk("first", 1500, ago(time.Minute)),
+				tk("close", 1510, ago(time.Second)),
+			},
+			want: [][]string{{"close", "first"}},
+		},
+		{
+			name: "several matches in one pass",
+			cfg:  duel,
+			tickets: []Ticket{
+				tk("a", 1000, ago(0)), tk("b", 2000, ago(0)), tk("c", 1020, ago(0)), tk("d", 1990, ago(0)),
+			},
+			want: [][]string{{"c", "a"}, {"b", "d"}},
+		},
+		{
+			name: "spread of the whole group must fit",
+			cfg:  squads,
+			tickets: []Ticket{
+				tk("a", 1500, ago(0)), tk("b", 1580, ago(0)), tk("c", 1420, ago(0)), tk("d", 1560, ago(0)), tk("e", 1510, ago(0)),
+			},
+			want: [][]string{{"b", "d", "e", "a"}},
+		},
+		{
+			name: "party fills a team against two solos",
+			cfg:  squads,
+			tickets: []Ticket{
+				party("p1", 1500, ago(0), "p1", "p2"), tk("a", 1520, ago(0)), tk("b", 1480, ago(0)),
+			},
+			want: [][]string{{"a", "p1", "b"}},
+		},
+		{
+			name: "two parties of two cannot share a team with a third",
+			cfg:  QueueConfig{Name: "trios", Mode: "battle", TeamSize: 3, TeamCount: 2, InitialRatingWindow: 100},
+			tickets: []Ticket{
+				party("p", 1500, ago(0), "p", "q"), party("r", 1500, ago(0), "r", "s"), party("x", 1500, ago(0), "x", "y"),
+			},
+			want: nil,
+		},
+		{
+			name:    "party larger than a team never matches",
+			cfg:     duel,
+			tickets: []Ticket{party("p1", 1500, ago(0), "p1", "p2"), tk("a", 1500, ago(0)), tk("b", 1500, ago(0))},
+			want:    [][]string{{"a", "b"}},
+		},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			var got [][]string
+			for _, group := range FindMatches(tc.cfg, tc.tickets, now) {
+				ids := make([]string, len(group))
+				for i, t := range group {
+					ids[i] = t.UserID
+				}
+				got = append(got, ids)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+type fakeRatings map[string]float64
+
+func (f fakeRatings) Rating(_ context.Context, userID, _ string) (float64, error) {
+	if r, ok := f[userID]; ok {
+		return r, nil
+	}
+	return DefaultRating, nil
+}
+
+func TestProcessOnceWaitsForCloseRatings(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	queue := &fakeRedisQueue{}
+	publisher := &fakePublisher{}
+	svc := NewService(queue, publisher).WithRatings(fakeRatings{"veteran": 2000, "rookie": 1200, "peer": 1250})
+	svc.now = func() time.Time { return now }
+	for _, id := range []string{"veteran", "rookie"} {
+		if _, err := svc.Enqueue(ctx, id, DefaultQueueName, "corr"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := queue.waiting(DefaultQueueName)[0].Rating; got != 2000 {
+		t.Fatalf("expected the ticket to carry the stored rating, got %v", got)
+	}
+	publisher.events = nil
+	now = now.Add(2 * time.Minute)
+	if err := svc.ProcessOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(publisher.events) != 0 {
+		t.Fatalf("expected no match across an 800 point gap, got %d events", len(publisher.events))
+	}
+
+	if _, err := svc.Enqueue(ctx, "peer", DefaultQueueName, "corr"); err != nil {
+		t.Fatal(err)
+	}
+	publisher.events = nil
+	if err := svc.ProcessOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(publisher.events) != 3 || len(queue.waiting(DefaultQueueName)) != 1 || queue.waiting(DefaultQueueName)[0].UserID != "veteran" {
+		t.Fatalf("expected rookie and peer to be matched, got %d events and %+v", len(publisher.events), queue.all)
+	}
+}
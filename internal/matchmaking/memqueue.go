@@ -0,0 +1,160 @@
+package matchmaking
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryQueue is a Queue held in process memory, for simulations that replay traffic through the
+// matcher without Redis. Like RedisQueue it hands out each queue's waiting tickets by rating. Finished
+// tickets are never dropped.
+type MemoryQueue struct {
+	mu       sync.Mutex
+	tickets  map[string]Ticket
+	pools    map[string]map[string]bool
+	active   map[string]string
+	inflight map[string]time.Time
+}
+
+func NewMemoryQueue() *MemoryQueue {
+	return &MemoryQueue{tickets: map[string]Ticket{}, pools: map[string]map[string]bool{}, active: map[string]string{}, inflight: map[string]time.Time{}}
+}
+
+func (q *MemoryQueue) Enqueue(_ context.Context, ticket Ticket) (Ticket, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, userID := range ticket.Players() {
+		if id, ok := q.active[userID]; ok {
+			return q.tickets[id], ErrAlreadyQueued
+		}
+	}
+	q.tickets[ticket.ID] = ticket
+	for _, userID := range ticket.Players() {
+		q.active[userID] = ticket.ID
+	}
+	q.pool(ticket.Queue)[ticket.ID] = true
+	return ticket, nil
+}
+
+// pool returns the waiting ticket IDs of queue; callers hold mu.
+func (q *MemoryQueue) pool(queue string) map[string]bool {
+	pool, ok := q.pools[queue]
+	if !ok {
+		pool = map[string]bool{}
+		q.pools[queue] = pool
+	}
+	return pool
+}
+
+func (q *MemoryQueue) Ticket(_ context.Context, ticketID string) (Ticket, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	t, ok := q.tickets[ticketID]
+	if !ok {
+		return Ticket{}, ErrTicketNotFound
+	}
+	return t, nil
+}
+
+func (q *MemoryQueue) ActiveTicket(_ context.Context, userID string) (Ticket, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	id, ok := q.active[userID]
+	if !ok {
+		return Ticket{}, ErrTicketNotFound
+	}
+	return q.tickets[id], nil
+}
+
+func (q *MemoryQueue) Tickets(_ context.Context, queue string) ([]Ticket, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	out := make([]Ticket, 0, len(q.pools[queue]))
+	for id := range q.pools[queue] {
+		out = append(out, q.tickets[id])
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Rating != out[j].Rating {
+			return out[i].Rating < out[j].Rating
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out, nil
+}
+
+func (q *MemoryQueue) Claim(_ context.Context, queue string, tickets []Ticket, leaseUntil time.Time) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	pool := q.pool(queue)
+	for _, t := range tickets {
+		if !pool[t.ID] {
+			return false, nil
+		}
+	}
+	for _, t := range tickets {
+		delete(pool, t.ID)
+		q.inflight[t.ID] = leaseUntil
+	}
+	return true, nil
+}
+
+func (q *MemoryQueue) Reclaim(_ context.Context, queue string, now time.Time) ([]string, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var returned []string
+	for id, until := range q.inflight {
+		t := q.tickets[id]
+		if t.Queue != queue || !until.Before(now) {
+			continue
+		}
+		delete(q.inflight, id)
+		if t.Status == TicketQueued {
+			q.pool(queue)[id] = true
+			returned = append(returned, id)
+		}
+	}
+	sort.Strings(returned)
+	return returned, nil
+}
+
+func (q *MemoryQueue) Hold(_ context.Context, tickets []Ticket, matchID string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, t := range tickets {
+		t.Status, t.MatchID = TicketProposed, matchID
+		q.tickets[t.ID] = t
+		delete(q.inflight, t.ID)
+	}
+	return nil
+}
+
+func (q *MemoryQueue) Requeue(_ context.Context, tickets []Ticket) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, t := range tickets {
+		t.Status, t.MatchID = TicketQueued, ""
+		q.tickets[t.ID] = t
+		delete(q.inflight, t.ID)
+		q.pool(t.Queue)[t.ID] = true
+	}
+	return nil
+}
+
+func (q *MemoryQueue) Finish(_ context.Context, tickets []Ticket, status, matchID string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, t := range tickets {
+		t.Status, t.MatchID = status, matchID
+		q.tickets[t.ID] = t
+		delete(q.inflight, t.ID)
+		delete(q.pool(t.Queue), t.ID)
+		for _, userID := range t.Players() {
+			if q.active[userID] == t.ID {
+				delete(q.active, userID)
+			}
+		}
+	}
+	return nil
+}
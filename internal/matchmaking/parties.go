@@ -0,0 +1,261 @@
+package matchmaking
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// MaxPartySize caps a party's members. A party can only queue where it fits on one team.
+const MaxPartySize = 8
+
+var (
+	ErrNotPartyLeader = errors.New("only the party leader can do that")
+	ErrPartyFull      = errors.New("party is full")
+	ErrNoInvite       = errors.New("no pending invite")
+	ErrInvalidInvite  = errors.New("invalid invite")
+	ErrPartyTooLarge  = errors.New("party does not fit on one team")
+)
+
+// Party is a group of players who queue together. Members lists the leader first; Invited holds
+// players who have been invited and not yet answered. TicketID is the party's latest ticket.
+type Party struct {
+	ID        string    `json:"id"`
+	LeaderID  string    `json:"leader_id"`
+	Members   []string  `json:"members"`
+	Invited   []string  `json:"invited,omitempty"`
+	TicketID  string    `json:"ticket_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// partyMessage is pushed over the gateway: party_update to members whenever the party changes, and
+// party_invite to an invited player.
+type partyMessage struct {
+	Type  string `json:"type"`
+	Party Party  `json:"party"`
+}
+
+// WithParties lets players form parties and queue together. Without it every ticket is solo.
+func (s *Service) WithParties(store PartyStore) *Service {
+	s.parties = store
+	return s
+}
+
+// PartiesEnabled reports whether the service was configured with a party store.
+func (s *Service) PartiesEnabled() bool { return s.parties != nil }
+
+// CreateParty makes userID the leader of a new party of one.
+func (s *Service) CreateParty(ctx context.Context, userID, correlationID string) (Party, error) {
+	partyID, err := s.newID()
+	if err != nil {
+		return Party{}, err
+	}
+	party := Party{ID: partyID, LeaderID: userID, Members: []string{userID}, CreatedAt: s.now()}
+	if err := s.parties.Create(ctx, party); err != nil {
+		return Party{}, err
+	}
+	return party, s.pushPartyUpdate(correlationID, party)
+}
+
+// Party returns the party userID belongs to.
+func (s *Service) Party(ctx context.Context, userID string) (Party, error) {
+	return s.parties.PartyOf(ctx, userID)
+}
+
+// Invite lets the leader invite inviteeID into the party.
+func (s *Service) Invite(ctx context.Context, userID, partyID, inviteeID, correlationID string) (Party, error) {
+	party, err := s.parties.Update(ctx, partyID, func(p *Party) error {
+		switch {
+		case !contains(p.Members, userID):
+			return ErrPartyNotFound
+		case p.LeaderID != userID:
+			return ErrNotPartyLeader
+		case inviteeID == "" || contains(p.Members, inviteeID):
+			return ErrInvalidInvite
+		case len(p.Members) >= MaxPartySize:
+			return ErrPartyFull
+		}
+		if !contains(p.Invited, inviteeID) {
+			p.Invited = append(p.Invited, inviteeID)
+		}
+		return nil
+	})
+	if err != nil {
+		return Party{}, err
+	}
+	if err := s.sendToUser(correlationID, inviteeID, partyMessage{Type: "party_invite", Party: party}); err != nil {
+		return Party{}, err
+	}
+	return party, s.pushPartyUpdate(correlationID, party)
+}
+
+// AcceptInvite moves userID from the party's invites to its members. A queued party ticket is
+// cancelled, since it no longer holds the whole party, and so is the invitee's own queued ticket, which
+// would keep the party from queueing. An invitee waiting on a ready-check gets ErrAlreadyQueued.
+func (s *Service) AcceptInvite(ctx context.Context, userID, partyID, correlationID string) (Party, error) {
+	party, err := s.parties.Get(ctx, partyID)
+	if errors.Is(err, ErrPartyNotFound) {
+		return Party{}, ErrNoInvite
+	}
+	if err != nil {
+		return Party{}, err
+	}
+	if !contains(party.Invited, userID) {
+		return Party{}, ErrNoInvite
+	}
+	if err := s.cancelActiveTicket(ctx, userID, correlationID); err != nil {
+		return Party{}, err
+	}
+	party, err = s.parties.Update(ctx, partyID, func(p *Party) error {
+		if !contains(p.Invited, userID) {
+			return ErrNoInvite
+		}
+		if len(p.Members) >= MaxPartySize {
+			return ErrPartyFull
+		}
+		p.Invited = without(p.Invited, userID)
+		p.Members = append(p.Members, userID)
+		return nil
+	})
+	if errors.Is(err, ErrPartyNotFound) {
+		// An invite to a party that no longer exists is gone too.
+		err = ErrNoInvite
+	}
+	if err != nil {
+		return Party{}, err
+	}
+	if err := s.cancelPartyTicket(ctx, party.TicketID, correlationID); err != nil {
+		return Party{}, err
+	}
+	return party, s.pushPartyUpdate(correlationID, party)
+}
+
+// DeclineInvite drops userID's invite to the party.
+func (s *Service) DeclineInvite(ctx context.Context, userID, partyID, correlationID string) (Party, error) {
+	party, err := s.parties.Update(ctx, partyID, func(p *Party) error {
+		if !contains(p.Invited, userID) {
+			return ErrNoInvite
+		}
+		p.Invited = without(p.Invited, userID)
+		return nil
+	})
+	if errors.Is(err, ErrPartyNotFound) {
+		err = ErrNoInvite
+	}
+	if err != nil {
+		return Party{}, err
+	}
+	return party, s.pushPartyUpdate(correlationID, party)
+}
+
+// LeaveParty removes userID from the party. If the leader leaves, the longest-standing member takes
+// over; the last member to leave disbands the party. A queued party ticket is cancelled.
+func (s *Service) LeaveParty(ctx context.Context, userID, partyID, correlationID string) (Party, error) {
+	var ticketID string
+	party, err := s.parties.Update(ctx, partyID, func(p *Party) error {
+		if !contains(p.Members, userID) {
+			return ErrNotInParty
+		}
+		ticketID = p.TicketID
+		p.Members = without(p.Members, userID)
+		if p.LeaderID == userID && len(p.Members) > 0 {
+			p.LeaderID = p.Members[0]
+		}
+		return nil
+	})
+	if errors.Is(err, ErrPartyNotFound) {
+		err = ErrNotInParty
+	}
+	if err != nil {
+		return Party{}, err
+	}
+	// The party may be gone, so cancel by the ticket ID read before the update.
+	if err := s.cancelPartyTicket(ctx, ticketID, correlationID); err != nil {
+		return Party{}, err
+	}
+	return party, s.pushPartyUpdate(correlationID, party)
+}
+
+// partyFor returns the party userID queues with into cfg's queue, and false if they queue solo. Only
+// the leader can queue a party, and only where it fits on one team.
+func (s *Service) partyFor(ctx context.Context, userID string, cfg QueueConfig) (Party, bool, error) {
+	if s.parties == nil {
+		return Party{}, false, nil
+	}
+	party, err := s.parties.PartyOf(ctx, userID)
+	if errors.Is(err, ErrNotInParty) {
+		return Party{}, false, nil
+	}
+	if err != nil {
+		return Party{}, false, err
+	}
+	if party.LeaderID != userID {
+		return Party{}, false, ErrNotPartyLeader
+	}
+	if len(party.Members) > cfg.TeamSize {
+		return Party{}, false, ErrPartyTooLarge
+	}
+	return party, true, nil
+}
+
+func (s *Service) cancelPartyTicket(ctx context.Context, ticketID, correlationID string) error {
+	if ticketID == "" {
+		return nil
+	}
+	ticket, err := s.queue.Ticket(ctx, ticketID)
+	if errors.Is(err, ErrTicketNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := s.cancel(ctx, ticket, correlationID); err != nil && !errors.Is(err, ErrTicketNotActive) {
+		return err
+	}
+	return nil
+}
+
+// cancelActiveTicket cancels userID's queued ticket, if any. A ticket that is past the queue, on a
+// ready-check, cannot be cancelled and fails with ErrAlreadyQueued.
+func (s *Service) cancelActiveTicket(ctx context.Context, userID, correlationID string) error {
+	ticket, err := s.queue.ActiveTicket(ctx, userID)
+	if errors.Is(err, ErrTicketNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, err = s.cancel(ctx, ticket, correlationID)
+	if errors.Is(err, ErrTicketNotActive) {
+		return ErrAlreadyQueued
+	}
+	return err
+}
+
+func (s *Service) pushPartyUpdate(correlationID string, party Party) error {
+	for _, userID := range party.Members {
+		if err := s.sendToUser(correlationID, userID, partyMessage{Type: "party_update", Party: party}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func contains(ids []string, id string) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+func without(ids []string, id string) []string {
+	out := make([]string, 0, len(ids))
+	for _, v := range ids {
+		if v != id {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,333 @@
+package matchmaking
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/contracts"
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/login"
+)
+
+func TestPartyQueuesAsOneTeam(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	queue := &fakeRedisQueue{}
+	publisher := &fakePublisher{}
+	svc := NewService(queue, publisher).
+		WithQueues([]QueueConfig{{Name: "squads", Mode: "battle", TeamSize: 2, TeamCount: 2}, {Name: "duel", Mode: "duel", TeamSize: 1, TeamCount: 2}}).
+		WithRatings(fakeRatings{"lead": 1600, "mate": 1400}).
+		WithParties(newFakePartyStore())
+
+	party, err := svc.CreateParty(ctx, "lead", "corr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Invite(ctx, "mate", party.ID, "lead", "corr"); !errors.Is(err, ErrPartyNotFound) {
+		t.Fatalf("outsiders must not see the party, got %v", err)
+	}
+	if _, err := svc.AcceptInvite(ctx, "mate", party.ID, "corr"); !errors.Is(err, ErrNoInvite) {
+		t.Fatalf("expected ErrNoInvite before being invited, got %v", err)
+	}
+	publisher.events = nil
+	if _, err := svc.Invite(ctx, "lead", party.ID, "mate", "corr"); err != nil {
+		t.Fatal(err)
+	}
+	if got := pushedTypes(t, publisher); !reflect.DeepEqual(got, map[string][]string{"mate": {"party_invite"}, "lead": {"party_update"}}) {
+		t.Fatalf("unexpected pushes %v", got)
+	}
+	party, err = svc.AcceptInvite(ctx, "mate", party.ID, "corr")
+	if err != nil || !reflect.DeepEqual(party.Members, []string{"lead", "mate"}) || len(party.Invited) != 0 {
+		t.Fatalf("unexpected party %+v (%v)", party, err)
+	}
+
+	if _, err := svc.Enqueue(ctx, "mate", "squads", "corr"); !errors.Is(err, ErrNotPartyLeader) {
+		t.Fatalf("only the leader may queue the party, got %v", err)
+	}
+	if _, err := svc.Enqueue(ctx, "lead", "duel", "corr"); !errors.Is(err, ErrPartyTooLarge) {
+		t.Fatalf("a duo does not fit a duel team, got %v", err)
+	}
+	ticket, err := svc.Enqueue(ctx, "lead", "squads", "corr")
+	if err != nil || !reflect.DeepEqual(ticket.Members, []string{"lead", "mate"}) || ticket.Rating != 1500 {
+		t.Fatalf("unexpected party ticket %+v (%v)", ticket, err)
+	}
+	if got, err := svc.GetTicket(ctx, "mate", ticket.ID); err != nil || got.ID != ticket.ID {
+		t.Fatalf("members should see the party ticket, got %+v (%v)", got, err)
+	}
+
+	for _, id := range []string{"solo-1", "solo-2"} {
+		if _, err := svc.Enqueue(ctx, id, "squads", "corr"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	publisher.events = nil
+	if err := svc.ProcessOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	env, err := contracts.UnmarshalEnvelope(publisher.events[0].data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var matched contracts.MatchmakingMatchedV1
+	if err := json.Unmarshal(env.Payload, &matched); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(matched.Teams, [][]string{{"lead", "mate"}, {"solo-1", "solo-2"}}) {
+		t.Fatalf("expected the party on one team, got %v", matched.Teams)
+	}
+	if got := pushedTypes(t, publisher); len(got["mate"]) != 1 || got["mate"][0] != "match_found" {
+		t.Fatalf("expected every party member to get match_found, got %v", got)
+	}
+}
+
+func TestLeavingCancelsPartyTicket(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	queue := &fakeRedisQueue{}
+	publisher := &fakePublisher{}
+	svc := NewService(queue, publisher).
+		WithQueues([]QueueConfig{{Name: "squads", Mode: "battle", TeamSize: 2, TeamCount: 2}}).
+		WithParties(newFakePartyStore())
+	party, _ := svc.CreateParty(ctx, "lead", "corr")
+	_, _ = svc.Invite(ctx, "lead", party.ID, "mate", "corr")
+	_, _ = svc.AcceptInvite(ctx, "mate", party.ID, "corr")
+	ticket, err := svc.Enqueue(ctx, "lead", "squads", "corr")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publisher.events = nil
+	party, err = svc.LeaveParty(ctx, "lead", party.ID, "corr")
+	if err != nil || party.LeaderID != "mate" || !reflect.DeepEqual(party.Members, []string{"mate"}) {
+		t.Fatalf("expected mate to lead the party, got %+v (%v)", party, err)
+	}
+	if got, _ := queue.Ticket(ctx, ticket.ID); got.Status != TicketCancelled {
+		t.Fatalf("expected the party ticket to be cancelled, got %+v", got)
+	}
+	if got := pushedTypes(t, publisher); !reflect.DeepEqual(got, map[string][]string{"lead": {"ticket_status"}, "mate": {"ticket_status", "party_update"}}) {
+		t.Fatalf("unexpected pushes %v", got)
+	}
+	if _, err := svc.Enqueue(ctx, "lead", "squads", "corr"); err != nil {
+		t.Fatalf("the former leader should queue solo again, got %v", err)
+	}
+	if _, err := svc.LeaveParty(ctx, "lead", party.ID, "corr"); !errors.Is(err, ErrNotInParty) {
+		t.Fatalf("expected ErrNotInParty, got %v", err)
+	}
+	if _, err := svc.LeaveParty(ctx, "mate", party.ID, "corr"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Party(ctx, "mate"); !errors.Is(err, ErrNotInParty) {
+		t.Fatalf("expected the party to be disbanded, got %v", err)
+	}
+}
+
+func TestAcceptingCancelsInviteeTicket(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	queue := &fakeRedisQueue{}
+	svc := NewService(queue, &fakePublisher{}).
+		WithQueues([]QueueConfig{{Name: "squads", Mode: "battle", TeamSize: 2, TeamCount: 2}}).
+		WithParties(newFakePartyStore())
+	party, _ := svc.CreateParty(ctx, "lead", "corr")
+	_, _ = svc.Invite(ctx, "lead", party.ID, "mate", "corr")
+	_, _ = svc.Invite(ctx, "lead", party.ID, "held", "corr")
+
+	solo, err := svc.Enqueue(ctx, "mate", "squads", "corr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.AcceptInvite(ctx, "mate", party.ID, "corr"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := queue.Ticket(ctx, solo.ID); got.Status != TicketCancelled {
+		t.Fatalf("expected the invitee's solo ticket to be cancelled, got %+v", got)
+	}
+
+	// A player whose match is being proposed cannot join until the ready-check is over.
+	held, err := svc.Enqueue(ctx, "held", "squads", "corr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := queue.Claim(ctx, "squads", []Ticket{held}, time.Now().Add(claimLease)); err != nil {
+		t.Fatal(err)
+	}
+	if err := queue.Hold(ctx, []Ticket{held}, "m-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.AcceptInvite(ctx, "held", party.ID, "corr"); !errors.Is(err, ErrAlreadyQueued) {
+		t.Fatalf("expected ErrAlreadyQueued while a ready-check is pending, got %v", err)
+	}
+	if party, _ := svc.Party(ctx, "lead"); !reflect.DeepEqual(party.Invited, []string{"held"}) {
+		t.Fatalf("expected the invite kept, got %+v", party)
+	}
+
+	// A member who queued alone in the meantime holds the party up, without the leader seeing the ticket.
+	if _, err := queue.Enqueue(ctx, Ticket{ID: "t-mate", UserID: "mate", Queue: "squads", Status: TicketQueued}); err != nil {
+		t.Fatal(err)
+	}
+	auth := login.NewAuthenticator("test-secret", time.Hour)
+	mux := http.NewServeMux()
+	NewHandler(svc, auth).Register(mux)
+	token, _ := auth.GenerateToken("lead", "leader")
+	req := httptest.NewRequest(http.MethodPost, "/v1/matchmaking/enqueue", strings.NewReader(`{"queue":"squads"}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusConflict || !strings.Contains(rr.Body.String(), "already_queued") || strings.Contains(rr.Body.String(), "t-mate") {
+		t.Fatalf("expected a 409 without the member's ticket, got %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestHTTPPartyEndpoints(t *testing.T) {
+	t.Parallel()
+	svc := NewService(&fakeRedisQueue{}, &fakePublisher{}).
+		WithQueues([]QueueConfig{{Name: "duel", Mode: "duel", TeamSize: 1, TeamCount: 2}}).
+		WithParties(newFakePartyStore())
+	auth := login.NewAuthenticator("test-secret", time.Hour)
+	mux := http.NewServeMux()
+	NewHandler(svc, auth).Register(mux)
+	lead, _ := auth.GenerateToken("u-1", "player1")
+	mate, _ := auth.GenerateToken("u-2", "player2")
+
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := do(http.MethodPost, "/v1/parties", lead, "")
+	var party Party
+	if err := json.Unmarshal(rr.Body.Bytes(), &party); err != nil || rr.Code != http.StatusCreated || party.LeaderID != "u-1" {
+		t.Fatalf("unexpected create response %d %s", rr.Code, rr.Body.String())
+	}
+	base := "/v1/parties/" + party.ID
+	steps := []struct {
+		method string
+		path   string
+		token  string
+		body   string
+		code   int
+		want   string
+	}{
+		{http.MethodPost, "/v1/parties", lead, "", http.StatusConflict, "already_in_party"},
+		{http.MethodGet, "/v1/parties/me", mate, "", http.StatusNotFound, "not_in_party"},
+		{http.MethodPost, base + "/invites", mate, `{"user_id":"u-3"}`, http.StatusNotFound, "party_not_found"},
+		{http.MethodPost, base + "/invites", lead, `{"user_id":"u-1"}`, http.StatusBadRequest, "invalid_invite"},
+		{http.MethodPost, base + "/invites", lead, `{"user_id":`, http.StatusBadRequest, "invalid_json"},
+		{http.MethodPost, base + "/invites", lead, `{"user_id":"u-2"}`, http.StatusOK, `"invited":["u-2"]`},
+		{http.MethodPost, base + "/accept", mate, "", http.StatusOK, `"members":["u-1","u-2"]`},
+		{http.MethodPost, base + "/invites", mate, `{"user_id":"u-3"}`, http.StatusForbidden, "not_party_leader"},
+		{http.MethodGet, "/v1/parties/me", mate, "", http.StatusOK, `"leader_id":"u-1"`},
+		{http.MethodPost, "/v1/matchmaking/enqueue", mate, `{"queue":"duel"}`, http.StatusForbidden, "not_party_leader"},
+		{http.MethodPost, "/v1/matchmaking/enqueue", lead, `{"queue":"duel"}`, http.StatusBadRequest, "party_too_large"},
+		{http.MethodPost, base + "/decline", mate, "", http.StatusNotFound, "invite_not_found"},
+		{http.MethodGet, base + "/leave", mate, "", http.StatusMethodNotAllowed, "method_not_allowed"},
+		{http.MethodPost, base + "/leave", mate, "", http.StatusOK, `"members":["u-1"]`},
+	}
+	for _, step := range steps {
+		rr := do(step.method, step.path, step.token, step.body)
+		if rr.Code != step.code || !strings.Contains(rr.Body.String(), step.want) {
+			t.Fatalf("%s %s: expected %d %s, got %d %s", step.method, step.path, step.code, step.want, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+// pushedTypes returns the gateway message types published to each user, in order.
+func pushedTypes(t *testing.T, publisher *fakePublisher) map[string][]string {
+	t.Helper()
+	got := map[string][]string{}
+	for _, evt := range publisher.events {
+		if evt.subject != contracts.SubjectGatewaySendToUser {
+			continue
+		}
+		env, err := contracts.UnmarshalEnvelope(evt.data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var send contracts.GatewaySendToUserV1
+		if err := json.Unmarshal(env.Payload, &send); err != nil {
+			t.Fatal(err)
+		}
+		var message struct {
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal(send.Message, &message); err != nil {
+			t.Fatal(err)
+		}
+		got[send.TargetUserID] = append(got[send.TargetUserID], message.Type)
+	}
+	return got
+}
+
+type fakePartyStore struct {
+	parties map[string]Party
+	members map[string]string // user ID -> party ID
+}
+
+func newFakePartyStore() *fakePartyStore {
+	return &fakePartyStore{parties: map[string]Party{}, members: map[string]string{}}
+}
+
+func (f *fakePartyStore) Create(_ context.Context, party Party) error {
+	if _, ok := f.members[party.LeaderID]; ok {
+		return ErrAlreadyInParty
+	}
+	f.parties[party.ID] = party
+	f.members[party.LeaderID] = party.ID
+	return nil
+}
+
+func (f *fakePartyStore) Get(_ context.Context, partyID string) (Party, error) {
+	p, ok := f.parties[partyID]
+	if !ok {
+		return Party{}, ErrPartyNotFound
+	}
+	return p, nil
+}
+
+func (f *fakePartyStore) PartyOf(ctx context.Context, userID string) (Party, error) {
+	partyID, ok := f.members[userID]
+	if !ok {
+		return Party{}, ErrNotInParty
+	}
+	return f.Get(ctx, partyID)
+}
+
+func (f *fakePartyStore) Update(ctx context.Context, partyID string, fn func(*Party) error) (Party, error) {
+	party, err := f.Get(ctx, partyID)
+	if err != nil {
+		return Party{}, err
+	}
+	party.Members = append([]string(nil), party.Members...)
+	party.Invited = append([]string(nil), party.Invited...)
+	before := party.Members
+	if err := fn(&party); err != nil {
+		return Party{}, err
+	}
+	joined, left := diffMembers(before, party.Members)
+	for _, userID := range joined {
+		if id, ok := f.members[userID]; ok && id != partyID {
+			return Party{}, ErrAlreadyInParty
+		}
+	}
+	for _, userID := range left {
+		delete(f.members, userID)
+	}
+	if len(party.Members) == 0 {
+		delete(f.parties, partyID)
+		return party, nil
+	}
+	for _, userID := range party.Members {
+		f.members[userID] = partyID
+	}
+	f.parties[partyID] = party
+	return party, nil
+}
@@ -0,0 +1,194 @@
+package matchmaking
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	partyKeyPrefix  = "pcgb:mm:party:"
+	memberKeyPrefix = "pcgb:mm:member:"
+	// partyTTL lets abandoned parties expire; every change to a party starts it again.
+	partyTTL = 24 * time.Hour
+	// maxUpdateAttempts bounds the retries of an optimistic update that keeps racing other writers.
+	maxUpdateAttempts = 10
+)
+
+var (
+	ErrPartyNotFound    = errors.New("party not found")
+	ErrNotInParty       = errors.New("not in a party")
+	ErrAlreadyInParty   = errors.New("already in a party")
+	ErrConcurrentUpdate = errors.New("changed concurrently, try again")
+)
+
+type PartyStore interface {
+	// Create stores a new party and makes its leader a member. It fails with ErrAlreadyInParty if the
+	// leader already belongs to one.
+	Create(ctx context.Context, party Party) error
+	Get(ctx context.Context, partyID string) (Party, error)
+	// PartyOf returns the party userID belongs to, or ErrNotInParty.
+	PartyOf(ctx context.Context, userID string) (Party, error)
+	// Update applies fn to the stored party and saves the result atomically. Players fn adds to Members
+	// must not belong to another party (ErrAlreadyInParty); players it removes are free to join another.
+	// A party left without members is deleted. An error from fn is returned as is and nothing is saved.
+	Update(ctx context.Context, partyID string, fn func(*Party) error) (Party, error)
+}
+
+// RedisPartyStore keeps each party as JSON under its own key, and each member has a pointer to their
+// party so that a player belongs to at most one.
+type RedisPartyStore struct {
+	client *redis.Client
+}
+
+func NewRedisPartyStore(client *redis.Client) *RedisPartyStore {
+	return &RedisPartyStore{client: client}
+}
+
+func partyKey(partyID string) string { return partyKeyPrefix + partyID }
+func memberKey(userID string) string { return memberKeyPrefix + userID }
+
+func (s *RedisPartyStore) Create(ctx context.Context, party Party) error {
+	raw, err := json.Marshal(party)
+	if err != nil {
+		return err
+	}
+	set, err := s.client.SetNX(ctx, memberKey(party.LeaderID), party.ID, partyTTL).Result()
+	if err != nil {
+		return err
+	}
+	if !set {
+		if _, err := s.PartyOf(ctx, party.LeaderID); !errors.Is(err, ErrNotInParty) {
+			if err == nil {
+				err = ErrAlreadyInParty
+			}
+			return err
+		}
+		// The pointer outlived its party: take it over.
+		if err := s.client.Set(ctx, memberKey(party.LeaderID), party.ID, partyTTL).Err(); err != nil {
+			return err
+		}
+	}
+	return s.client.Set(ctx, partyKey(party.ID), raw, partyTTL).Err()
+}
+
+func (s *RedisPartyStore) Get(ctx context.Context, partyID string) (Party, error) {
+	return getParty(ctx, s.client, partyID)
+}
+
+func (s *RedisPartyStore) PartyOf(ctx context.Context, userID string) (Party, error) {
+	partyID, err := s.client.Get(ctx, memberKey(userID)).Result()
+	if errors.Is(err, redis.Nil) {
+		return Party{}, ErrNotInParty
+	}
+	if err != nil {
+		return Party{}, err
+	}
+	party, err := s.Get(ctx, partyID)
+	if errors.Is(err, ErrPartyNotFound) {
+		return Party{}, ErrNotInParty
+	}
+	return party, err
+}
+
+func (s *RedisPartyStore) Update(ctx context.Context, partyID string, fn func(*Party) error) (Party, error) {
+	var updated Party
+	txn := func(tx *redis.Tx) error {
+		party, err := getParty(ctx, tx, partyID)
+		if err != nil {
+			return err
+		}
+		before := append([]string(nil), party.Members...)
+		if err := fn(&party); err != nil {
+			return err
+		}
+		joined, left := diffMembers(before, party.Members)
+		if len(joined) > 0 {
+			keys := make([]string, len(joined))
+			for i, userID := range joined {
+				keys[i] = memberKey(userID)
+			}
+			if err := tx.Watch(ctx, keys...).Err(); err != nil {
+				return err
+			}
+			current, err := tx.MGet(ctx, keys...).Result()
+			if err != nil {
+				return err
+			}
+			for _, v := range current {
+				if id, ok := v.(string); ok && id != partyID {
+					return ErrAlreadyInParty
+				}
+			}
+		}
+		raw, err := json.Marshal(party)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, userID := range left {
+				pipe.Del(ctx, memberKey(userID))
+			}
+			if len(party.Members) == 0 {
+				pipe.Del(ctx, partyKey(partyID))
+				return nil
+			}
+			pipe.Set(ctx, partyKey(partyID), raw, partyTTL)
+			for _, userID := range party.Members {
+				pipe.Set(ctx, memberKey(userID), partyID, partyTTL)
+			}
+			return nil
+		})
+		updated = party
+		return err
+	}
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		err := s.client.Watch(ctx, txn, partyKey(partyID))
+		if errors.Is(err, redis.TxFailedErr) {
+			continue
+		}
+		if err != nil {
+			return Party{}, err
+		}
+		return updated, nil
+	}
+	return Party{}, ErrConcurrentUpdate
+}
+
+func getParty(ctx context.Context, client redis.Cmdable, partyID string) (Party, error) {
+	raw, err := client.Get(ctx, partyKey(partyID)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return Party{}, ErrPartyNotFound
+	}
+	if err != nil {
+		return Party{}, err
+	}
+	var p Party
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return Party{}, err
+	}
+	return p, nil
+}
+
+// diffMembers returns the players in after but not before, and those in before but not after.
+func diffMembers(before, after []string) (joined, left []string) {
+	was := make(map[string]bool, len(before))
+	for _, userID := range before {
+		was[userID] = true
+	}
+	for _, userID := range after {
+		if !was[userID] {
+			joined = append(joined, userID)
+		}
+		delete(was, userID)
+	}
+	for _, userID := range before {
+		if was[userID] {
+			left = append(left, userID)
+		}
+	}
+	return joined, left
+}
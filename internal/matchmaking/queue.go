@@ -2,46 +2,308 @@ package matchmaking
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
-const defaultQueueKey = "pcgb:mm:queue"
+const (
+	poolKeyPrefix   = "pcgb:mm:pool:"
+	ticketKeyPrefix = "pcgb:mm:ticket:"
+	activeKeyPrefix = "pcgb:mm:active:"
+	// inflightKeyPrefix names a queue's claimed tickets, scored by the unix millisecond their lease ends.
+	inflightKeyPrefix = "pcgb:mm:inflight:"
+	// finishedTicketTTL keeps finished tickets readable long enough for clients to poll their outcome.
+	finishedTicketTTL = time.Hour
+)
+
+var (
+	ErrTicketNotFound = errors.New("ticket not found")
+	ErrAlreadyQueued  = errors.New("already queued")
+)
 
 type Queue interface {
-	Enqueue(ctx context.Context, userID string) error
-	DequeuePair(ctx context.Context) ([]string, error)
+	// Enqueue stores ticket and makes it the active ticket of each of its players. If any of them already
+	// holds an active ticket, that ticket is returned with ErrAlreadyQueued and nothing is stored.
+	Enqueue(ctx context.Context, ticket Ticket) (Ticket, error)
+	// Ticket returns a ticket by ID, including finished ones for a while.
+	Ticket(ctx context.Context, ticketID string) (Ticket, error)
+	// ActiveTicket returns the ticket userID is queued or waiting on a ready-check with, or
+	// ErrTicketNotFound.
+	ActiveTicket(ctx context.Context, userID string) (Ticket, error)
+	// Tickets returns every ticket waiting in queue.
+	Tickets(ctx context.Context, queue string) ([]Ticket, error)
+	// Claim takes tickets out of queue on a lease that ends at leaseUntil. It reports false and leaves
+	// the queue as it was if any of them is no longer waiting. A claim is committed by Hold or Finish;
+	// until then the tickets are in flight.
+	Claim(ctx context.Context, queue string, tickets []Ticket, leaseUntil time.Time) (bool, error)
+	// Reclaim returns the tickets of queue whose lease ended before now to the queue, and their IDs.
+	Reclaim(ctx context.Context, queue string, now time.Time) ([]string, error)
+	// Hold records that claimed tickets wait on a ready-check for matchID. Their players keep them as
+	// their active tickets.
+	Hold(ctx context.Context, tickets []Ticket, matchID string) error
+	// Requeue puts claimed tickets back in their queue, unchanged apart from their status.
+	Requeue(ctx context.Context, tickets []Ticket) error
+	// Finish records the final status of claimed tickets and lets their players queue again.
+	Finish(ctx context.Context, tickets []Ticket, status, matchID string) error
 }
 
+// RedisQueue stores each ticket as JSON under its own key. A queue is a sorted set of ticket IDs scored
+// by rating, and each player with an active ticket has a pointer to it. Claimed tickets move to the
+// queue's in-flight set in one script, so replicas never claim the same ticket, and a claim that is never
+// committed, e.g. because the replica crashed or could not publish, returns to the queue when its lease
+// ends.
 type RedisQueue struct {
 	client *redis.Client
-	key    string
 }
 
 func NewRedisQueue(client *redis.Client) *RedisQueue {
-	return &RedisQueue{client: client, key: defaultQueueKey}
+	return &RedisQueue{client: client}
 }
 
-func (q *RedisQueue) Enqueue(ctx context.Context, userID string) error {
-	return q.client.RPush(ctx, q.key, userID).Err()
+func poolKey(queue string) string      { return poolKeyPrefix + queue }
+func inflightKey(queue string) string  { return inflightKeyPrefix + queue }
+func ticketKey(ticketID string) string { return ticketKeyPrefix + ticketID }
+func activeKey(userID string) string   { return activeKeyPrefix + userID }
+
+func (q *RedisQueue) Enqueue(ctx context.Context, ticket Ticket) (Ticket, error) {
+	players := ticket.Players()
+	keys := make([]string, len(players))
+	for i, userID := range players {
+		keys[i] = activeKey(userID)
+	}
+	// Each attempt either points every player at the ticket or finds one pointer in the way. A pointer
+	// that outlived its ticket, e.g. after a crash between claim and finish, is dropped before retrying.
+	// A ticket held for a ready-check is still active: its players are waiting to accept.
+	for attempt := 0; attempt <= len(keys); attempt++ {
+		existingID, err := q.client.Eval(ctx, claimActiveScript, keys, ticket.ID).Text()
+		if err != nil {
+			return Ticket{}, err
+		}
+		if existingID == "" {
+			return ticket, q.store(ctx, ticket)
+		}
+		existing, err := q.Ticket(ctx, existingID)
+		if err == nil && (existing.Status == TicketQueued || existing.Status == TicketProposed) {
+			return existing, ErrAlreadyQueued
+		}
+		if err != nil && !errors.Is(err, ErrTicketNotFound) {
+			return Ticket{}, err
+		}
+		stale := make([]string, 0, len(keys))
+		for _, userID := range existing.Players() {
+			stale = append(stale, activeKey(userID))
+		}
+		if err != nil {
+			// Without the ticket the holders are unknown, so check every player's pointer.
+			stale = keys
+		}
+		for _, key := range stale {
+			if err := q.client.Eval(ctx, releaseActiveScript, []string{key}, existingID).Err(); err != nil {
+				return Ticket{}, err
+			}
+		}
+	}
+	return Ticket{}, ErrAlreadyQueued
 }
 
-func (q *RedisQueue) DequeuePair(ctx context.Context) ([]string, error) {
-	ids, err := q.client.LPopCount(ctx, q.key, 2).Result()
-	if err == redis.Nil {
-		return nil, nil
+func (q *RedisQueue) store(ctx context.Context, ticket Ticket) error {
+	raw, err := json.Marshal(ticket)
+	if err != nil {
+		return err
+	}
+	_, err = q.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, ticketKey(ticket.ID), raw, 0)
+		pipe.ZAdd(ctx, poolKey(ticket.Queue), redis.Z{Score: ticket.Rating, Member: ticket.ID})
+		return nil
+	})
+	return err
+}
+
+func (q *RedisQueue) Ticket(ctx context.Context, ticketID string) (Ticket, error) {
+	raw, err := q.client.Get(ctx, ticketKey(ticketID)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return Ticket{}, ErrTicketNotFound
 	}
 	if err != nil {
+		return Ticket{}, err
+	}
+	var t Ticket
+	if err := json.Unmarshal(raw, &t); err != nil {
+		return Ticket{}, err
+	}
+	return t, nil
+}
+
+func (q *RedisQueue) ActiveTicket(ctx context.Context, userID string) (Ticket, error) {
+	ticketID, err := q.client.Get(ctx, activeKey(userID)).Result()
+	if errors.Is(err, redis.Nil) {
+		return Ticket{}, ErrTicketNotFound
+	}
+	if err != nil {
+		return Ticket{}, err
+	}
+	t, err := q.Ticket(ctx, ticketID)
+	if err != nil {
+		return Ticket{}, err
+	}
+	// A pointer can outlive its ticket's activity until the player next enqueues.
+	if t.Status != TicketQueued && t.Status != TicketProposed {
+		return Ticket{}, ErrTicketNotFound
+	}
+	return t, nil
+}
+
+func (q *RedisQueue) Tickets(ctx context.Context, queue string) ([]Ticket, error) {
+	ids, err := q.client.ZRange(ctx, poolKey(queue), 0, -1).Result()
+	if err != nil || len(ids) == 0 {
 		return nil, err
 	}
-	if len(ids) == 1 {
-		if pushErr := q.client.LPush(ctx, q.key, ids[0]).Err(); pushErr != nil {
-			return nil, pushErr
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = ticketKey(id)
+	}
+	values, err := q.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	tickets := make([]Ticket, 0, len(values))
+	for _, v := range values {
+		raw, ok := v.(string)
+		if !ok {
+			continue
+		}
+		var t Ticket
+		if err := json.Unmarshal([]byte(raw), &t); err != nil {
+			return nil, err
 		}
-		return nil, nil
+		tickets = append(tickets, t)
 	}
-	if len(ids) < 2 {
-		return nil, nil
+	return tickets, nil
+}
+
+func (q *RedisQueue) Claim(ctx context.Context, queue string, tickets []Ticket, leaseUntil time.Time) (bool, error) {
+	args := make([]any, 0, len(tickets)+1)
+	args = append(args, leaseUntil.UnixMilli())
+	for _, t := range tickets {
+		args = append(args, t.ID)
+	}
+	claimed, err := q.client.Eval(ctx, claimScript, []string{poolKey(queue), inflightKey(queue)}, args...).Int()
+	if err != nil {
+		return false, err
 	}
-	return ids, nil
+	return claimed == 1, nil
+}
+
+func (q *RedisQueue) Reclaim(ctx context.Context, queue string, now time.Time) ([]string, error) {
+	return q.client.Eval(ctx, reclaimScript, []string{poolKey(queue), inflightKey(queue)}, now.UnixMilli(), ticketKeyPrefix).StringSlice()
 }
+
+func (q *RedisQueue) Hold(ctx context.Context, tickets []Ticket, matchID string) error {
+	_, err := q.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, t := range tickets {
+			t.Status, t.MatchID = TicketProposed, matchID
+			raw, err := json.Marshal(t)
+			if err != nil {
+				return err
+			}
+			pipe.Set(ctx, ticketKey(t.ID), raw, 0)
+			pipe.ZRem(ctx, inflightKey(t.Queue), t.ID)
+		}
+		return nil
+	})
+	return err
+}
+
+func (q *RedisQueue) Requeue(ctx context.Context, tickets []Ticket) error {
+	_, err := q.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, t := range tickets {
+			t.Status, t.MatchID = TicketQueued, ""
+			raw, err := json.Marshal(t)
+			if err != nil {
+				return err
+			}
+			pipe.Set(ctx, ticketKey(t.ID), raw, 0)
+			pipe.ZRem(ctx, inflightKey(t.Queue), t.ID)
+			pipe.ZAdd(ctx, poolKey(t.Queue), redis.Z{Score: t.Rating, Member: t.ID})
+		}
+		return nil
+	})
+	return err
+}
+
+func (q *RedisQueue) Finish(ctx context.Context, tickets []Ticket, status, matchID string) error {
+	_, err := q.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, t := range tickets {
+			t.Status, t.MatchID = status, matchID
+			raw, err := json.Marshal(t)
+			if err != nil {
+				return err
+			}
+			pipe.Set(ctx, ticketKey(t.ID), raw, finishedTicketTTL)
+			pipe.ZRem(ctx, inflightKey(t.Queue), t.ID)
+			// Only release each player's pointer if it still points at this ticket.
+			for _, userID := range t.Players() {
+				pipe.Eval(ctx, releaseActiveScript, []string{activeKey(userID)}, t.ID)
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+// claimScript moves ticket IDs ARGV[2..] from pool KEYS[1] to in-flight set KEYS[2], leased until
+// ARGV[1], and returns 1; if any of them is not in the pool it changes nothing and returns 0.
+const claimScript = `
+for i = 2, #ARGV do
+	if not redis.call("ZSCORE", KEYS[1], ARGV[i]) then
+		return 0
+	end
+end
+for i = 2, #ARGV do
+	redis.call("ZREM", KEYS[1], ARGV[i])
+	redis.call("ZADD", KEYS[2], ARGV[1], ARGV[i])
+end
+return 1`
+
+// reclaimScript moves tickets whose lease in KEYS[2] ended by ARGV[1] back to pool KEYS[1], scored by
+// their rating, and returns their IDs. Tickets that are no longer queued are only dropped from the
+// in-flight set. The ticket keys are built from prefix ARGV[2], so this script assumes a single Redis
+// node rather than a cluster.
+const reclaimScript = `
+local expired = redis.call("ZRANGEBYSCORE", KEYS[2], "-inf", ARGV[1])
+local returned = {}
+for _, id in ipairs(expired) do
+	redis.call("ZREM", KEYS[2], id)
+	local raw = redis.call("GET", ARGV[2] .. id)
+	if raw then
+		local ticket = cjson.decode(raw)
+		if ticket.status == "queued" then
+			redis.call("ZADD", KEYS[1], ticket.rating, id)
+			table.insert(returned, id)
+		end
+	end
+end
+return returned`
+
+// claimActiveScript points every player in KEYS at ticket ARGV[1], or returns the ticket ID held by the
+// first player who already has one and changes nothing.
+const claimActiveScript = `
+for _, key in ipairs(KEYS) do
+	local current = redis.call("GET", key)
+	if current then
+		return current
+	end
+end
+for _, key in ipairs(KEYS) do
+	redis.call("SET", key, ARGV[1])
+end
+return ""`
+
+const releaseActiveScript = `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`
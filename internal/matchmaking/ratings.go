@@ -0,0 +1,12 @@
+package matchmaking
+
+import "context"
+
+// DefaultRating is the rating of a player who has not played in a queue yet.
+const DefaultRating = 1500.0
+
+// RatingStore looks up a player's rating in one queue; ratings.PostgresRepository is the production
+// implementation.
+type RatingStore interface {
+	Rating(ctx context.Context, userID, queue string) (float64, error)
+}
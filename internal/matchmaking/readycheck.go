@@ -0,0 +1,257 @@
+package matchmaking
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Proposal is a formed match waiting on its ready-check. Accepted and Declined record the players'
+// answers; players in neither have not answered yet.
+type Proposal struct {
+	MatchID   string     `json:"match_id"`
+	Queue     string     `json:"queue"`
+	Mode      string     `json:"mode"`
+	Region    string     `json:"region,omitempty"`
+	Teams     [][]string `json:"teams"`
+	Tickets   []Ticket   `json:"tickets"`
+	Accepted  []string   `json:"accepted,omitempty"`
+	Declined  []string   `json:"declined,omitempty"`
+	ExpiresAt time.Time  `json:"expires_at"`
+}
+
+// Match returns the match the proposal would start.
+func (p Proposal) Match() Match {
+	return Match{ID: p.MatchID, Queue: p.Queue, Mode: p.Mode, Region: p.Region, Teams: p.Teams}
+}
+
+// HasPlayer reports whether userID is one of the proposed match's players.
+func (p Proposal) HasPlayer(userID string) bool {
+	return contains(p.Match().UserIDs(), userID)
+}
+
+// Ready reports whether every player has accepted.
+func (p Proposal) Ready() bool {
+	return len(p.Accepted) == len(p.Match().UserIDs())
+}
+
+// CooldownError is returned by Enqueue while a player is kept out of the queues for failing a
+// ready-check.
+type CooldownError struct {
+	UserID string
+	Until  time.Time
+}
+
+func (e *CooldownError) Error() string {
+	return "queue cooldown for " + e.UserID + " until " + e.Until.UTC().Format(time.RFC3339)
+}
+
+// matchProposedMessage asks a player over the gateway to accept their match before ExpiresAt.
+type matchProposedMessage struct {
+	Type      string     `json:"type"`
+	TicketID  string     `json:"ticket_id"`
+	MatchID   string     `json:"match_id"`
+	Queue     string     `json:"queue"`
+	Mode      string     `json:"mode"`
+	Region    string     `json:"region,omitempty"`
+	Team      int        `json:"team"`
+	Teams     [][]string `json:"teams"`
+	ExpiresAt time.Time  `json:"expires_at"`
+}
+
+// WithReadyChecks enables the ready-check of queues that configure ready_check_seconds. Without it
+// every match is announced as soon as it is formed.
+func (s *Service) WithReadyChecks(store ReadyCheckStore) *Service {
+	s.readyChecks = store
+	return s
+}
+
+// ReadyChecksEnabled reports whether the service was configured with a ready-check store.
+func (s *Service) ReadyChecksEnabled() bool { return s.readyChecks != nil }
+
+// AcceptMatch records that userID is ready for the proposed match. The match is announced once every
+// player has accepted.
+func (s *Service) AcceptMatch(ctx context.Context, userID, matchID, correlationID string) (Proposal, error) {
+	return s.answer(ctx, userID, matchID, true, correlationID)
+}
+
+// DeclineMatch calls the proposed match off. The decliner is put on cooldown and the tickets of players
+// who accepted go back to their queue.
+func (s *Service) DeclineMatch(ctx context.Context, userID, matchID, correlationID string) (Proposal, error) {
+	return s.answer(ctx, userID, matchID, false, correlationID)
+}
+
+func (s *Service) answer(ctx context.Context, userID, matchID string, accept bool, correlationID string) (Proposal, error) {
+	proposal, err := s.readyChecks.Update(ctx, matchID, func(p *Proposal) error {
+		if !p.HasPlayer(userID) {
+			return ErrProposalNotFound
+		}
+		p.Accepted, p.Declined = without(p.Accepted, userID), without(p.Declined, userID)
+		if accept {
+			p.Accepted = append(p.Accepted, userID)
+		} else {
+			p.Declined = append(p.Declined, userID)
+		}
+		return nil
+	})
+	if err != nil {
+		return Proposal{}, err
+	}
+	if len(proposal.Declined) > 0 || proposal.Ready() {
+		return proposal, s.resolveProposal(ctx, matchID, correlationID)
+	}
+	return proposal, nil
+}
+
+// propose stores the ready-check, holds the match's tickets for it and asks every player to accept.
+func (s *Service) propose(ctx context.Context, cfg QueueConfig, match Match, group []Ticket) error {
+	proposal := Proposal{MatchID: match.ID, Queue: match.Queue, Mode: match.Mode, Region: match.Region, Teams: match.Teams, Tickets: group, ExpiresAt: s.now().Add(cfg.ReadyCheck())}
+	if err := s.readyChecks.Create(ctx, proposal); err != nil {
+		return err
+	}
+	if err := s.queue.Hold(ctx, group, match.ID); err != nil {
+		return err
+	}
+	corrID, err := s.newID()
+	if err != nil {
+		return err
+	}
+	ticketOf := ticketsByPlayer(group)
+	for team, members := range match.Teams {
+		for _, userID := range members {
+			message := matchProposedMessage{Type: "match_proposed", TicketID: ticketOf[userID], MatchID: match.ID, Queue: match.Queue, Mode: match.Mode, Region: match.Region, Team: team, Teams: match.Teams, ExpiresAt: proposal.ExpiresAt}
+			if err := s.sendToUser(corrID, userID, message); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// expireProposals resolves every ready-check whose deadline has passed.
+func (s *Service) expireProposals(ctx context.Context) error {
+	if s.readyChecks == nil {
+		return nil
+	}
+	due, err := s.readyChecks.Due(ctx, s.now())
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, matchID := range due {
+		if err := s.resolveProposal(ctx, matchID, matchID); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// resolveProposal ends a ready-check. If everyone accepted, the match is announced. Otherwise tickets
+// whose players all accepted are requeued with their original enqueue time, so they keep their place,
+// and the other tickets are declined, with their players who did not accept put on cooldown. The
+// proposal is only removed once its outcome is committed; if resolving fails part way, the proposal
+// comes due again when its claim lapses and is resolved from the start.
+func (s *Service) resolveProposal(ctx context.Context, matchID, correlationID string) error {
+	proposal, ok, err := s.readyChecks.Resolve(ctx, matchID, s.now().Add(claimLease))
+	if err != nil || !ok {
+		return err
+	}
+	held, err := s.heldTickets(ctx, proposal)
+	if err != nil {
+		return err
+	}
+	if proposal.Ready() {
+		if len(held) > 0 {
+			if err := s.announce(ctx, correlationID, proposal.Match(), held); err != nil {
+				return err
+			}
+		}
+		return s.readyChecks.Complete(ctx, matchID)
+	}
+
+	var requeued, declined []Ticket
+	for _, t := range held {
+		ready := true
+		for _, userID := range t.Players() {
+			ready = ready && contains(proposal.Accepted, userID)
+		}
+		if ready {
+			requeued = append(requeued, t)
+		} else {
+			declined = append(declined, t)
+		}
+	}
+	// Cooldowns go first: a ticket that is no longer held is left out when resolving again.
+	until := s.now().Add(s.queues[proposal.Queue].DeclineCooldown())
+	for _, t := range declined {
+		for _, userID := range t.Players() {
+			if contains(proposal.Accepted, userID) {
+				continue
+			}
+			if err := s.readyChecks.SetCooldown(ctx, userID, until); err != nil {
+				return err
+			}
+		}
+	}
+	if len(requeued) > 0 {
+		if err := s.queue.Requeue(ctx, requeued); err != nil {
+			return err
+		}
+	}
+	if err := s.queue.Finish(ctx, declined, TicketDeclined, proposal.MatchID); err != nil {
+		return err
+	}
+	if err := s.readyChecks.Complete(ctx, matchID); err != nil {
+		return err
+	}
+
+	for _, t := range requeued {
+		t.Status, t.MatchID = TicketQueued, ""
+		if err := s.pushTicketStatus(correlationID, t); err != nil {
+			return err
+		}
+	}
+	for _, t := range declined {
+		t.Status, t.MatchID = TicketDeclined, proposal.MatchID
+		if err := s.pushTicketStatus(correlationID, t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// heldTickets returns the proposal's tickets that are still held for it, leaving out those an earlier
+// attempt at resolving it already requeued or finished.
+func (s *Service) heldTickets(ctx context.Context, proposal Proposal) ([]Ticket, error) {
+	held := make([]Ticket, 0, len(proposal.Tickets))
+	for _, t := range proposal.Tickets {
+		current, err := s.queue.Ticket(ctx, t.ID)
+		if errors.Is(err, ErrTicketNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if current.Status == TicketProposed && current.MatchID == proposal.MatchID {
+			held = append(held, t)
+		}
+	}
+	return held, nil
+}
+
+// checkCooldowns fails with a CooldownError if any of players is on cooldown.
+func (s *Service) checkCooldowns(ctx context.Context, players []string) error {
+	if s.readyChecks == nil {
+		return nil
+	}
+	for _, userID := range players {
+		until, err := s.readyChecks.Cooldown(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if until.After(s.now()) {
+			return &CooldownError{UserID: userID, Until: until}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,342 @@
+package matchmaking
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/contracts"
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/login"
+)
+
+func newReadyCheckService(t *testing.T, now *time.Time) (*Service, *fakeRedisQueue, *fakePublisher, *fakeReadyChecks) {
+	t.Helper()
+	queue := &fakeRedisQueue{}
+	publisher := &fakePublisher{}
+	store := newFakeReadyChecks(now)
+	svc := NewService(queue, publisher).
+		WithQueues([]QueueConfig{{Name: "duel", Mode: "duel", TeamSize: 1, TeamCount: 2, ReadyCheckSeconds: 20, DeclineCooldownSeconds: 120}}).
+		WithReadyChecks(store)
+	svc.now = func() time.Time { return *now }
+	return svc, queue, publisher, store
+}
+
+func TestReadyCheckAllAccept(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	svc, queue, publisher, _ := newReadyCheckService(t, &now)
+	a, _ := svc.Enqueue(ctx, "a", "duel", "corr")
+	_, _ = svc.Enqueue(ctx, "b", "duel", "corr")
+
+	publisher.events = nil
+	if err := svc.ProcessOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := pushedTypes(t, publisher); !reflect.DeepEqual(got, map[string][]string{"a": {"match_proposed"}, "b": {"match_proposed"}}) {
+		t.Fatalf("expected only match_proposed pushes, got %v", got)
+	}
+	held, _ := queue.Ticket(ctx, a.ID)
+	if held.Status != TicketProposed || held.MatchID == "" {
+		t.Fatalf("expected the ticket to be held for the ready-check, got %+v", held)
+	}
+	if again, err := svc.Enqueue(ctx, "a", "duel", "corr"); err != nil || again.ID != a.ID || again.Status != TicketProposed {
+		t.Fatalf("queueing during the ready-check must return the held ticket, got %+v (%v)", again, err)
+	}
+	if _, err := svc.AcceptMatch(ctx, "stranger", held.MatchID, "corr"); !errors.Is(err, ErrProposalNotFound) {
+		t.Fatalf("expected ErrProposalNotFound for a stranger, got %v", err)
+	}
+
+	publisher.events = nil
+	proposal, err := svc.AcceptMatch(ctx, "a", held.MatchID, "corr")
+	if err != nil || !reflect.DeepEqual(proposal.Accepted, []string{"a"}) || len(publisher.events) != 0 {
+		t.Fatalf("unexpected first accept %+v (%v), %d events", proposal, err, len(publisher.events))
+	}
+	if _, err := svc.AcceptMatch(ctx, "b", held.MatchID, "corr"); err != nil {
+		t.Fatal(err)
+	}
+	if len(publisher.events) != 3 || publisher.events[0].subject != contracts.SubjectMatchmakingMatch {
+		t.Fatalf("expected the match to be announced once both accepted, got %+v", publisher.events)
+	}
+	if got, _ := queue.Ticket(ctx, a.ID); got.Status != TicketMatched || got.MatchID != held.MatchID {
+		t.Fatalf("expected the ticket to be matched, got %+v", got)
+	}
+	if _, err := svc.AcceptMatch(ctx, "a", held.MatchID, "corr"); !errors.Is(err, ErrProposalNotFound) {
+		t.Fatalf("a resolved ready-check must not be answered again, got %v", err)
+	}
+}
+
+func TestReadyCheckDeclineRequeuesAccepters(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	svc, queue, publisher, _ := newReadyCheckService(t, &now)
+	a, _ := svc.Enqueue(ctx, "a", "duel", "corr")
+	now = now.Add(10 * time.Second)
+	b, _ := svc.Enqueue(ctx, "b", "duel", "corr")
+	if err := svc.ProcessOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	held, _ := queue.Ticket(ctx, a.ID)
+
+	if _, err := svc.AcceptMatch(ctx, "a", held.MatchID, "corr"); err != nil {
+		t.Fatal(err)
+	}
+	publisher.events = nil
+	if _, err := svc.DeclineMatch(ctx, "b", held.MatchID, "corr"); err != nil {
+		t.Fatal(err)
+	}
+	waiting := queue.waiting("duel")
+	if len(waiting) != 1 || waiting[0].ID != a.ID || !waiting[0].EnqueuedAt.Equal(a.EnqueuedAt) || waiting[0].Status != TicketQueued {
+		t.Fatalf("expected a's ticket back in the queue with its original time, got %+v", waiting)
+	}
+	if got, _ := queue.Ticket(ctx, b.ID); got.Status != TicketDeclined {
+		t.Fatalf("expected b's ticket to be declined, got %+v", got)
+	}
+	if got := pushedTypes(t, publisher); !reflect.DeepEqual(got, map[string][]string{"a": {"ticket_status"}, "b": {"ticket_status"}}) {
+		t.Fatalf("unexpected pushes %v", got)
+	}
+
+	var cooldown *CooldownError
+	if _, err := svc.Enqueue(ctx, "b", "duel", "corr"); !errors.As(err, &cooldown) || !cooldown.Until.Equal(now.Add(2*time.Minute)) {
+		t.Fatalf("expected b to be on cooldown, got %v", err)
+	}
+	now = now.Add(2 * time.Minute)
+	if _, err := svc.Enqueue(ctx, "b", "duel", "corr"); err != nil {
+		t.Fatalf("expected b to queue again after the cooldown, got %v", err)
+	}
+}
+
+func TestReadyCheckDeclinedForDeletedUser(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	svc, queue, _, _ := newReadyCheckService(t, &now)
+	a, _ := svc.Enqueue(ctx, "a", "duel", "corr")
+	b, _ := svc.Enqueue(ctx, "b", "duel", "corr")
+	if err := svc.ProcessOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	held, _ := queue.Ticket(ctx, a.ID)
+	if _, err := svc.AcceptMatch(ctx, "a", held.MatchID, "corr"); err != nil {
+		t.Fatal(err)
+	}
+
+	userID := "b"
+	raw, err := contracts.MarshalV1("evt-1", contracts.EventUserDeleted, now, "corr", &userID, contracts.UserDeletedV1{Reason: "user_request"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.HandleUserDeleted(ctx, raw); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := queue.Ticket(ctx, b.ID); got.Status != TicketDeclined {
+		t.Fatalf("expected the deleted user's ticket to be declined, got %+v", got)
+	}
+	if waiting := queue.waiting("duel"); len(waiting) != 1 || waiting[0].ID != a.ID {
+		t.Fatalf("expected a's ticket back in the queue, got %+v", waiting)
+	}
+}
+
+func TestReadyCheckExpires(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	svc, queue, _, store := newReadyCheckService(t, &now)
+	a, _ := svc.Enqueue(ctx, "a", "duel", "corr")
+	b, _ := svc.Enqueue(ctx, "b", "duel", "corr")
+	if err := svc.ProcessOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	held, _ := queue.Ticket(ctx, a.ID)
+	if _, err := svc.AcceptMatch(ctx, "a", held.MatchID, "corr"); err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(19 * time.Second)
+	if err := svc.ProcessOnce(ctx); err != nil || len(store.proposals) != 1 {
+		t.Fatalf("the ready-check should still be pending: %v (%v)", store.proposals, err)
+	}
+	now = now.Add(time.Second)
+	if err := svc.ProcessOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.proposals) != 0 {
+		t.Fatalf("expected the ready-check to be resolved, got %v", store.proposals)
+	}
+	if got, _ := queue.Ticket(ctx, b.ID); got.Status != TicketDeclined {
+		t.Fatalf("expected the silent player's ticket to be declined, got %+v", got)
+	}
+	if until := store.cooldowns["b"]; !until.After(now) {
+		t.Fatalf("expected the silent player to be on cooldown, got %v", until)
+	}
+	if _, ok := store.cooldowns["a"]; ok {
+		t.Fatalf("the accepting player must not be on cooldown")
+	}
+	if waiting := queue.waiting("duel"); len(waiting) != 1 || waiting[0].ID != a.ID {
+		t.Fatalf("expected a to be requeued, got %+v", waiting)
+	}
+}
+
+func TestReadyCheckResolvedAgainAfterFailure(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	svc, queue, _, store := newReadyCheckService(t, &now)
+	a, _ := svc.Enqueue(ctx, "a", "duel", "corr")
+	b, _ := svc.Enqueue(ctx, "b", "duel", "corr")
+	if err := svc.ProcessOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	held, _ := queue.Ticket(ctx, a.ID)
+	if _, err := svc.AcceptMatch(ctx, "a", held.MatchID, "corr"); err != nil {
+		t.Fatal(err)
+	}
+
+	queue.finishErr = errors.New("redis unavailable")
+	if _, err := svc.DeclineMatch(ctx, "b", held.MatchID, "corr"); err == nil {
+		t.Fatal("expected the decline to fail while tickets cannot be finished")
+	}
+	queue.finishErr = nil
+	if len(store.proposals) != 1 {
+		t.Fatalf("a ready-check must be kept until its outcome is committed, got %v", store.proposals)
+	}
+	if _, err := svc.AcceptMatch(ctx, "b", held.MatchID, "corr"); !errors.Is(err, ErrProposalNotFound) {
+		t.Fatalf("a ready-check being resolved must not be answered, got %v", err)
+	}
+
+	// Past the deadline but within the failed resolver's claim, nobody else resolves it.
+	now = now.Add(21 * time.Second)
+	if err := svc.ProcessOnce(ctx); err != nil || len(store.proposals) != 1 {
+		t.Fatalf("the claim should still hold: %v (%v)", store.proposals, err)
+	}
+	now = now.Add(claimLease)
+	if err := svc.ProcessOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.proposals) != 0 {
+		t.Fatalf("expected the ready-check to be resolved, got %v", store.proposals)
+	}
+	if got, _ := queue.Ticket(ctx, b.ID); got.Status != TicketDeclined {
+		t.Fatalf("expected the decliner's ticket to be declined, got %+v", got)
+	}
+	if until := store.cooldowns["b"]; !until.After(now) {
+		t.Fatalf("expected the decliner to be on cooldown, got %v", until)
+	}
+	if waiting := queue.waiting("duel"); len(waiting) != 1 || waiting[0].ID != a.ID {
+		t.Fatalf("expected a to be requeued once, got %+v", waiting)
+	}
+}
+
+func TestHTTPReadyCheckEndpoints(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	svc, queue, _, _ := newReadyCheckService(t, &now)
+	auth := login.NewAuthenticator("test-secret", time.Hour)
+	mux := http.NewServeMux()
+	NewHandler(svc, auth).Register(mux)
+	a, _ := svc.Enqueue(ctx, "u-1", "duel", "corr")
+	_, _ = svc.Enqueue(ctx, "u-2", "duel", "corr")
+	if err := svc.ProcessOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	held, _ := queue.Ticket(ctx, a.ID)
+	first, _ := auth.GenerateToken("u-1", "player1")
+	second, _ := auth.GenerateToken("u-2", "player2")
+	stranger, _ := auth.GenerateToken("u-3", "player3")
+	base := "/v1/matchmaking/matches/" + held.MatchID
+
+	steps := []struct {
+		method string
+		path   string
+		token  string
+		code   int
+		want   string
+	}{
+		{http.MethodGet, base + "/accept", first, http.StatusMethodNotAllowed, "method_not_allowed"},
+		{http.MethodPost, base + "/accept", stranger, http.StatusNotFound, "ready_check_not_found"},
+		{http.MethodPost, base + "/accept", first, http.StatusOK, `"accepted":["u-1"]`},
+		{http.MethodPost, base + "/decline", second, http.StatusOK, `"declined":["u-2"]`},
+		{http.MethodPost, base + "/accept", first, http.StatusNotFound, "ready_check_not_found"},
+		{http.MethodPost, "/v1/matchmaking/enqueue", second, http.StatusTooManyRequests, "queue_cooldown"},
+	}
+	for _, step := range steps {
+		req := httptest.NewRequest(step.method, step.path, strings.NewReader(`{"queue":"duel"}`))
+		req.Header.Set("Authorization", "Bearer "+step.token)
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		if rr.Code != step.code || !strings.Contains(rr.Body.String(), step.want) {
+			t.Fatalf("%s %s: expected %d %s, got %d %s", step.method, step.path, step.code, step.want, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+type fakeReadyChecks struct {
+	now       *time.Time
+	proposals map[string]Proposal
+	resolving map[string]time.Time // match ID -> end of the resolver's claim
+	cooldowns map[string]time.Time
+}
+
+func newFakeReadyChecks(now *time.Time) *fakeReadyChecks {
+	return &fakeReadyChecks{now: now, proposals: map[string]Proposal{}, resolving: map[string]time.Time{}, cooldowns: map[string]time.Time{}}
+}
+
+func (f *fakeReadyChecks) Create(_ context.Context, proposal Proposal) error {
+	f.proposals[proposal.MatchID] = proposal
+	return nil
+}
+
+func (f *fakeReadyChecks) Update(_ context.Context, matchID string, fn func(*Proposal) error) (Proposal, error) {
+	p, ok := f.proposals[matchID]
+	if !ok || f.resolving[matchID].After(*f.now) {
+		return Proposal{}, ErrProposalNotFound
+	}
+	p.Accepted = append([]string(nil), p.Accepted...)
+	p.Declined = append([]string(nil), p.Declined...)
+	if err := fn(&p); err != nil {
+		return Proposal{}, err
+	}
+	f.proposals[matchID] = p
+	return p, nil
+}
+
+func (f *fakeReadyChecks) Resolve(_ context.Context, matchID string, leaseUntil time.Time) (Proposal, bool, error) {
+	p, ok := f.proposals[matchID]
+	if !ok || f.resolving[matchID].After(*f.now) {
+		return Proposal{}, false, nil
+	}
+	f.resolving[matchID] = leaseUntil
+	return p, true, nil
+}
+
+func (f *fakeReadyChecks) Complete(_ context.Context, matchID string) error {
+	delete(f.proposals, matchID)
+	delete(f.resolving, matchID)
+	return nil
+}
+
+func (f *fakeReadyChecks) Due(_ context.Context, now time.Time) ([]string, error) {
+	var due []string
+	for id, p := range f.proposals {
+		if !p.ExpiresAt.After(now) {
+			due = append(due, id)
+		}
+	}
+	return due, nil
+}
+
+func (f *fakeReadyChecks) SetCooldown(_ context.Context, userID string, until time.Time) error {
+	f.cooldowns[userID] = until
+	return nil
+}
+
+func (f *fakeReadyChecks) Cooldown(_ context.Context, userID string) (time.Time, error) {
+	return f.cooldowns[userID], nil
+}
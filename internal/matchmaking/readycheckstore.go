@@ -0,0 +1,184 @@
+package matchmaking
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	proposalKeyPrefix = "pcgb:mm:proposal:"
+	proposalsKey      = "pcgb:mm:proposals"
+	resolvingPrefix   = "pcgb:mm:resolving:"
+	cooldownKeyPrefix = "pcgb:mm:cooldown:"
+	// proposalTTL outlives any ready-check deadline, so a proposal nobody resolves still goes away.
+	proposalTTL = time.Hour
+)
+
+var ErrProposalNotFound = errors.New("ready-check not found")
+
+type ReadyCheckStore interface {
+	Create(ctx context.Context, proposal Proposal) error
+	// Update applies fn to a pending proposal and saves the result atomically. An error from fn is
+	// returned as is and nothing is saved.
+	Update(ctx context.Context, matchID string, fn func(*Proposal) error) (Proposal, error)
+	// Resolve claims a pending proposal until leaseUntil and returns it. While the claim holds, other
+	// callers get false and the proposal can no longer be updated. A claim that lapses before Complete
+	// lets the proposal be resolved again.
+	Resolve(ctx context.Context, matchID string, leaseUntil time.Time) (Proposal, bool, error)
+	// Complete removes a proposal whose outcome has been committed.
+	Complete(ctx context.Context, matchID string) error
+	// Due returns the IDs of proposals whose deadline is not after now.
+	Due(ctx context.Context, now time.Time) ([]string, error)
+	SetCooldown(ctx context.Context, userID string, until time.Time) error
+	// Cooldown returns when userID may queue again, or the zero time if they may now.
+	Cooldown(ctx context.Context, userID string) (time.Time, error)
+}
+
+// RedisReadyChecks keeps each pending proposal as JSON under its own key and indexes them by deadline
+// in a sorted set. A proposal being resolved has a key of its own that expires with the claim. Cooldowns
+// are keys that expire when the cooldown ends.
+type RedisReadyChecks struct {
+	client *redis.Client
+}
+
+func NewRedisReadyChecks(client *redis.Client) *RedisReadyChecks {
+	return &RedisReadyChecks{client: client}
+}
+
+func proposalKey(matchID string) string  { return proposalKeyPrefix + matchID }
+func resolvingKey(matchID string) string { return resolvingPrefix + matchID }
+func cooldownKey(userID string) string   { return cooldownKeyPrefix + userID }
+
+func (s *RedisReadyChecks) Create(ctx context.Context, proposal Proposal) error {
+	raw, err := json.Marshal(proposal)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, proposalKey(proposal.MatchID), raw, proposalTTL)
+		pipe.ZAdd(ctx, proposalsKey, redis.Z{Score: float64(proposal.ExpiresAt.Unix()), Member: proposal.MatchID})
+		return nil
+	})
+	return err
+}
+
+func (s *RedisReadyChecks) Update(ctx context.Context, matchID string, fn func(*Proposal) error) (Proposal, error) {
+	var updated Proposal
+	txn := func(tx *redis.Tx) error {
+		resolving, err := tx.Exists(ctx, resolvingKey(matchID)).Result()
+		if err != nil {
+			return err
+		}
+		if resolving > 0 {
+			return ErrProposalNotFound
+		}
+		proposal, err := getProposal(ctx, tx, matchID)
+		if err != nil {
+			return err
+		}
+		if err := fn(&proposal); err != nil {
+			return err
+		}
+		raw, err := json.Marshal(proposal)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, proposalKey(matchID), raw, redis.KeepTTL)
+			return nil
+		})
+		updated = proposal
+		return err
+	}
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		err := s.client.Watch(ctx, txn, proposalKey(matchID), resolvingKey(matchID))
+		if errors.Is(err, redis.TxFailedErr) {
+			continue
+		}
+		if err != nil {
+			return Proposal{}, err
+		}
+		return updated, nil
+	}
+	return Proposal{}, ErrConcurrentUpdate
+}
+
+func (s *RedisReadyChecks) Resolve(ctx context.Context, matchID string, leaseUntil time.Time) (Proposal, bool, error) {
+	raw, err := s.client.Eval(ctx, resolveScript, []string{proposalKey(matchID), resolvingKey(matchID)}, leaseUntil.UnixMilli()).Text()
+	if errors.Is(err, redis.Nil) {
+		return Proposal{}, false, nil
+	}
+	if err != nil {
+		return Proposal{}, false, err
+	}
+	var p Proposal
+	if err := json.Unmarshal([]byte(raw), &p); err != nil {
+		return Proposal{}, false, err
+	}
+	return p, true, nil
+}
+
+func (s *RedisReadyChecks) Complete(ctx context.Context, matchID string) error {
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, proposalsKey, matchID)
+		pipe.Del(ctx, proposalKey(matchID), resolvingKey(matchID))
+		return nil
+	})
+	return err
+}
+
+func (s *RedisReadyChecks) Due(ctx context.Context, now time.Time) ([]string, error) {
+	return s.client.ZRangeByScore(ctx, proposalsKey, &redis.ZRangeBy{Min: "-inf", Max: strconv.FormatInt(now.Unix(), 10)}).Result()
+}
+
+func (s *RedisReadyChecks) SetCooldown(ctx context.Context, userID string, until time.Time) error {
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, cooldownKey(userID), until.UTC().Format(time.RFC3339), 0)
+		pipe.ExpireAt(ctx, cooldownKey(userID), until)
+		return nil
+	})
+	return err
+}
+
+func (s *RedisReadyChecks) Cooldown(ctx context.Context, userID string) (time.Time, error) {
+	raw, err := s.client.Get(ctx, cooldownKey(userID)).Result()
+	if errors.Is(err, redis.Nil) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Parse(time.RFC3339, raw)
+}
+
+func getProposal(ctx context.Context, client redis.Cmdable, matchID string) (Proposal, error) {
+	raw, err := client.Get(ctx, proposalKey(matchID)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return Proposal{}, ErrProposalNotFound
+	}
+	if err != nil {
+		return Proposal{}, err
+	}
+	var p Proposal
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return Proposal{}, err
+	}
+	return p, nil
+}
+
+// resolveScript returns proposal KEYS[1] and claims it by setting KEYS[2] to expire at ARGV[1], in
+// milliseconds since the epoch. It returns nil if the proposal is gone or already claimed.
+const resolveScript = `
+local raw = redis.call("GET", KEYS[1])
+if not raw then
+	return false
+end
+if not redis.call("SET", KEYS[2], "1", "NX", "PXAT", ARGV[1]) then
+	return false
+end
+return raw`
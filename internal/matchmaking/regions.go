@@ -0,0 +1,108 @@
+package matchmaking
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// Ping limits: a ticket reports at most MaxPingRegions regions, each at no more than MaxPingMs.
+const (
+	MaxPingRegions = 16
+	MaxPingMs      = 5000
+)
+
+var ErrInvalidPings = errors.New("pings must map up to 16 region codes such as eu-west to round trips of 0-5000 ms")
+
+var regionPattern = regexp.MustCompile(`^[a-z]{2,}(-[a-z0-9]+)*$`)
+
+// ValidatePings checks a client's per-region round trips, in milliseconds. No pings at all is valid and
+// means the ticket can be matched in any region.
+func ValidatePings(pings map[string]int) error {
+	if len(pings) > MaxPingRegions {
+		return ErrInvalidPings
+	}
+	for region, ms := range pings {
+		if len(region) > 32 || !regionPattern.MatchString(region) || ms < 0 || ms > MaxPingMs {
+			return ErrInvalidPings
+		}
+	}
+	return nil
+}
+
+// regionsWithin returns the regions t's players accept after their current wait: those pinged within the
+// queue's latency threshold, and always the ticket's best region, so that players far from every region
+// can still play. It returns nil for a ticket without pings, which accepts any region.
+func regionsWithin(cfg QueueConfig, t Ticket, now time.Time) map[string]bool {
+	if len(t.Pings) == 0 {
+		return nil
+	}
+	threshold := cfg.LatencyThreshold(now.Sub(t.EnqueuedAt))
+	best := MaxPingMs
+	for _, ms := range t.Pings {
+		if ms < best {
+			best = ms
+		}
+	}
+	if best > threshold {
+		threshold = best
+	}
+	accepted := make(map[string]bool, len(t.Pings))
+	for region, ms := range t.Pings {
+		if ms <= threshold {
+			accepted[region] = true
+		}
+	}
+	return accepted
+}
+
+// narrowRegions intersects the regions a group accepts with those of a ticket joining it, where nil
+// stands for any region. It reports false if no region is left.
+func narrowRegions(have, accept map[string]bool) (map[string]bool, bool) {
+	if accept == nil {
+		return have, true
+	}
+	if have == nil {
+		return accept, true
+	}
+	both := make(map[string]bool, len(have))
+	for region := range have {
+		if accept[region] {
+			both[region] = true
+		}
+	}
+	return both, len(both) > 0
+}
+
+// matchRegion picks where tickets should play: of the regions every ticket accepts, the one whose worst
+// ping is lowest, ties going to the lowest total. It returns "" when no ticket reported pings.
+func matchRegion(cfg QueueConfig, tickets []Ticket, now time.Time) string {
+	var regions map[string]bool
+	for _, t := range tickets {
+		regions, _ = narrowRegions(regions, regionsWithin(cfg, t, now))
+	}
+	names := make([]string, 0, len(regions))
+	for region := range regions {
+		names = append(names, region)
+	}
+	sort.Strings(names)
+	best, bestWorst, bestTotal := "", 0, 0
+	for _, region := range names {
+		worst, total := 0, 0
+		for _, t := range tickets {
+			ms, ok := t.Pings[region]
+			if !ok {
+				continue
+			}
+			total += ms
+			if ms > worst {
+				worst = ms
+			}
+		}
+		if best == "" || worst < bestWorst || (worst == bestWorst && total < bestTotal) {
+			best, bestWorst, bestTotal = region, worst, total
+		}
+	}
+	return best
+}
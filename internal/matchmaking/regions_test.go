@@ -0,0 +1,175 @@
+package matchmaking
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/contracts"
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/login"
+)
+
+func TestLatencyThresholdRelaxesWithWait(t *testing.T) {
+	t.Parallel()
+	cfg := QueueConfig{InitialLatencyMs: 50, LatencyGrowthMs: 5, MaxLatencyMs: 150}
+	tests := []struct {
+		wait time.Duration
+		want int
+	}{
+		{0, 50},
+		{-time.Second, 50},
+		{10 * time.Second, 100},
+		{time.Minute, 150},
+	}
+	for _, tc := range tests {
+		if got := cfg.LatencyThreshold(tc.wait); got != tc.want {
+			t.Fatalf("wait %s: expected %d, got %d", tc.wait, tc.want, got)
+		}
+	}
+	if got := (QueueConfig{}).LatencyThreshold(time.Hour); got != DefaultMaxLatencyMs {
+		t.Fatalf("expected the default max threshold, got %d", got)
+	}
+}
+
+func TestFindMatchesByRegion(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	duel := QueueConfig{Name: "duel", Mode: "duel", TeamSize: 1, TeamCount: 2, InitialLatencyMs: 50, LatencyGrowthMs: 5, MaxLatencyMs: 150}
+	ago := func(d time.Duration) time.Time { return now.Add(-d) }
+	tk := func(userID string, enqueuedAt time.Time, pings map[string]int) Ticket {
+		return Ticket{ID: "t-" + userID, UserID: userID, Rating: 1500, Pings: pings, EnqueuedAt: enqueuedAt, Status: TicketQueued}
+	}
+	eu := map[string]int{"eu-west": 20, "us-east": 110}
+	us := map[string]int{"eu-west": 110, "us-east": 20}
+
+	tests := []struct {
+		name    string
+		tickets []Ticket
+		want    [][]string
+		region  []string
+	}{
+		{
+			name:    "players on different continents wait",
+			tickets: []Ticket{tk("paris", ago(0), eu), tk("boston", ago(0), us)},
+			want:    nil,
+		},
+		{
+			name:    "same continent matches at once",
+			tickets: []Ticket{tk("paris", ago(0), eu), tk("boston", ago(0), us), tk("london", ago(time.Second), eu)},
+			want:    [][]string{{"london", "paris"}},
+			region:  []string{"eu-west"},
+		},
+		{
+			name:    "threshold relaxes once both have waited",
+			tickets: []Ticket{tk("paris", ago(15*time.Second), eu), tk("boston", ago(15*time.Second), us)},
+			want:    [][]string{{"boston", "paris"}},
+			region:  []string{"eu-west"},
+		},
+		{
+			name:    "players without pings fit anywhere",
+			tickets: []Ticket{tk("paris", ago(0), eu), tk("anyone", ago(0), nil)},
+			want:    [][]string{{"anyone", "paris"}},
+			region:  []string{"eu-west"},
+		},
+		{
+			name:    "a far-away player still plays at their best region",
+			tickets: []Ticket{tk("sydney", ago(0), map[string]int{"eu-west": 300, "us-east": 220}), tk("boston", ago(time.Hour), us)},
+			want:    [][]string{{"boston", "sydney"}},
+			region:  []string{"us-east"},
+		},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			var got [][]string
+			var regions []string
+			for _, group := range FindMatches(duel, tc.tickets, now) {
+				ids := make([]string, len(group))
+				for i, t := range group {
+					ids[i] = t.UserID
+				}
+				got = append(got, ids)
+				regions = append(regions, matchRegion(duel, group, now))
+			}
+			if !reflect.DeepEqual(got, tc.want) || !reflect.DeepEqual(regions, tc.region) {
+				t.Fatalf("expected %v in %v, got %v in %v", tc.want, tc.region, got, regions)
+			}
+		})
+	}
+}
+
+func TestMatchedEventCarriesRegion(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	publisher := &fakePublisher{}
+	svc := NewService(&fakeRedisQueue{}, publisher)
+	for userID, pings := range map[string]map[string]int{
+		"u-1": {"eu-west": 30, "eu-central": 45},
+		"u-2": {"eu-west": 60, "eu-central": 35},
+	} {
+		if _, err := svc.EnqueueWithOptions(ctx, userID, DefaultQueueName, EnqueueOptions{Pings: pings}, "corr"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := svc.ProcessOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var matched contracts.MatchmakingMatchedV1
+	for _, e := range publisher.events {
+		if e.subject != contracts.SubjectMatchmakingMatch {
+			continue
+		}
+		env, err := contracts.UnmarshalEnvelope(e.data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(env.Payload, &matched); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// eu-central keeps the worse of the two pings lowest.
+	if matched.Region != "eu-central" {
+		t.Fatalf("expected the match in eu-central, got %+v", matched)
+	}
+
+	if _, err := svc.EnqueueWithOptions(ctx, "u-3", DefaultQueueName, EnqueueOptions{Pings: map[string]int{"eu-west": -1}}, "corr"); !errors.Is(err, ErrInvalidPings) {
+		t.Fatalf("expected ErrInvalidPings, got %v", err)
+	}
+}
+
+func TestHTTPEnqueueValidatesPings(t *testing.T) {
+	t.Parallel()
+	queue := &fakeRedisQueue{}
+	svc := NewService(queue, &fakePublisher{})
+	auth := login.NewAuthenticator("test-secret", time.Hour)
+	mux := http.NewServeMux()
+	NewHandler(svc, auth).Register(mux)
+	token, _ := auth.GenerateToken("u-1", "player1")
+	for _, tc := range []struct {
+		body string
+		code int
+		want string
+	}{
+		{`{"pings":{"EU West":20}}`, http.StatusBadRequest, "invalid_pings"},
+		{`{"pings":{"eu-west":99999}}`, http.StatusBadRequest, "invalid_pings"},
+		{`{"pings":{"eu-west":20,"us-east":95}}`, http.StatusAccepted, `"status":"queued"`},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/v1/matchmaking/enqueue", strings.NewReader(tc.body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		if rr.Code != tc.code || !strings.Contains(rr.Body.String(), tc.want) {
+			t.Fatalf("%s: expected %d %s, got %d %s", tc.body, tc.code, tc.want, rr.Code, rr.Body.String())
+		}
+	}
+	if waiting := queue.waiting(DefaultQueueName); len(waiting) != 1 || waiting[0].Pings["us-east"] != 95 {
+		t.Fatalf("expected the ticket to keep its pings, got %+v", waiting)
+	}
+}
@@ -0,0 +1,212 @@
+package matchmaking
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Match rule types. A queue's rules are its match profile: every rule must hold for a group of tickets
+// to be matched.
+const (
+	// RuleSame requires every ticket to carry the same value of Attribute. A missing attribute counts as
+	// the empty value.
+	RuleSame = "same"
+	// RuleShared requires the tickets to share at least one of the comma-separated values of Attribute,
+	// such as a spoken language.
+	RuleShared = "shared"
+	// RuleAvoidBlocked keeps players out of matches with anyone on their ticket's block list, and with
+	// anyone who blocked them.
+	RuleAvoidBlocked = "avoid_blocked"
+	// RuleTeamBalance requires the teams' mean ratings to differ by at most MaxGap.
+	RuleTeamBalance = "team_balance"
+	// RulePartyBalance requires the largest parties on each team to differ in size by at most MaxGap
+	// players, so a premade team does not face a team of solo players.
+	RulePartyBalance = "party_balance"
+)
+
+// Ticket attribute limits.
+const (
+	MaxTicketAttributes = 16
+	MaxBlockedPlayers   = 100
+)
+
+var ErrInvalidAttributes = errors.New("attributes must map up to 16 lowercase names to values of at most 64 characters, and blocked must list at most 100 user ids")
+
+var attributeNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,31}$`)
+
+// MatchRule is one declarative constraint on the tickets grouped into a match. With RelaxAfterSeconds
+// set, the rule no longer applies once every ticket in the group has waited that long.
+type MatchRule struct {
+	Type              string  `json:"type"`
+	Attribute         string  `json:"attribute,omitempty"`
+	MaxGap            float64 `json:"max_gap,omitempty"`
+	RelaxAfterSeconds int     `json:"relax_after_seconds,omitempty"`
+}
+
+// Name identifies the rule in explanations, e.g. "same(platform)".
+func (r MatchRule) Name() string {
+	if r.Attribute == "" {
+		return r.Type
+	}
+	return r.Type + "(" + r.Attribute + ")"
+}
+
+func (r MatchRule) validate() error {
+	switch r.Type {
+	case RuleSame, RuleShared:
+		if !attributeNamePattern.MatchString(r.Attribute) {
+			return fmt.Errorf("rule %s: attribute must be 1-32 lowercase letters, digits or '_'", r.Name())
+		}
+	case RuleAvoidBlocked:
+	case RuleTeamBalance, RulePartyBalance:
+		if r.MaxGap <= 0 {
+			return fmt.Errorf("rule %s: max_gap must be positive", r.Name())
+		}
+	default:
+		return fmt.Errorf("unknown rule type %q", r.Type)
+	}
+	if r.RelaxAfterSeconds < 0 {
+		return fmt.Errorf("rule %s: relax_after_seconds must not be negative", r.Name())
+	}
+	return nil
+}
+
+// relaxed reports whether every ticket in group has waited past the rule's relax time.
+func (r MatchRule) relaxed(group []Ticket, now time.Time) bool {
+	if r.RelaxAfterSeconds == 0 {
+		return false
+	}
+	for _, t := range group {
+		if now.Sub(t.EnqueuedAt) < time.Duration(r.RelaxAfterSeconds)*time.Second {
+			return false
+		}
+	}
+	return true
+}
+
+// conflict explains why group breaks the rule, or returns "". Team and party balance can only be judged
+// once the group is complete.
+func (r MatchRule) conflict(cfg QueueConfig, group []Ticket, complete bool) string {
+	switch r.Type {
+	case RuleSame:
+		first := group[0].Attributes[r.Attribute]
+		for _, t := range group[1:] {
+			if v := t.Attributes[r.Attribute]; v != first {
+				return fmt.Sprintf("%s is %q for %s but %q for %s", r.Attribute, first, group[0].ID, v, t.ID)
+			}
+		}
+	case RuleShared:
+		common := splitValues(group[0].Attributes[r.Attribute])
+		for _, t := range group[1:] {
+			var both []string
+			for _, v := range splitValues(t.Attributes[r.Attribute]) {
+				if contains(common, v) {
+					both = append(both, v)
+				}
+			}
+			common = both
+		}
+		if len(common) == 0 {
+			return "no " + r.Attribute + " shared by every ticket"
+		}
+	case RuleAvoidBlocked:
+		for _, t := range group {
+			for _, other := range group {
+				if t.ID == other.ID {
+					continue
+				}
+				for _, userID := range other.Players() {
+					if contains(t.Blocked, userID) {
+						return fmt.Sprintf("%s blocked %s", t.UserID, userID)
+					}
+				}
+			}
+		}
+	case RuleTeamBalance:
+		if !complete {
+			return ""
+		}
+		teams, ok := assignTeams(cfg, group)
+		if !ok {
+			return ""
+		}
+		low, high := math.Inf(1), math.Inf(-1)
+		for _, team := range teams {
+			total, players := 0.0, 0
+			for _, t := range team {
+				total += t.Rating * float64(t.Size())
+				players += t.Size()
+			}
+			mean := total / float64(players)
+			low, high = math.Min(low, mean), math.Max(high, mean)
+		}
+		if high-low > r.MaxGap {
+			return fmt.Sprintf("team ratings differ by %.0f, more than %.0f", high-low, r.MaxGap)
+		}
+	case RulePartyBalance:
+		if !complete {
+			return ""
+		}
+		teams, ok := assignTeams(cfg, group)
+		if !ok {
+			return ""
+		}
+		smallest, largest := cfg.TeamSize, 0
+		for _, team := range teams {
+			party := 0
+			for _, t := range team {
+				party = max(party, t.Size())
+			}
+			smallest, largest = min(smallest, party), max(largest, party)
+		}
+		if float64(largest-smallest) > r.MaxGap {
+			return fmt.Sprintf("largest parties differ by %d players, more than %.0f", largest-smallest, r.MaxGap)
+		}
+	}
+	return ""
+}
+
+// ruleConflict explains which of cfg's rules group breaks at now, or returns "".
+func ruleConflict(cfg QueueConfig, group []Ticket, now time.Time, complete bool) string {
+	for _, rule := range cfg.Rules {
+		if rule.relaxed(group, now) {
+			continue
+		}
+		if reason := rule.conflict(cfg, group, complete); reason != "" {
+			return rule.Name() + ": " + reason
+		}
+	}
+	return ""
+}
+
+func splitValues(raw string) []string {
+	var values []string
+	for _, v := range strings.Split(raw, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// ValidateAttributes checks the attributes and block list a client queues with.
+func ValidateAttributes(attributes map[string]string, blocked []string) error {
+	if len(attributes) > MaxTicketAttributes || len(blocked) > MaxBlockedPlayers {
+		return ErrInvalidAttributes
+	}
+	for name, value := range attributes {
+		if !attributeNamePattern.MatchString(name) || len(value) > 64 {
+			return ErrInvalidAttributes
+		}
+	}
+	for _, userID := range blocked {
+		if userID == "" || len(userID) > 64 {
+			return ErrInvalidAttributes
+		}
+	}
+	return nil
+}
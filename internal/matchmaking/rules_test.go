@@ -0,0 +1,226 @@
+package matchmaking
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/authz"
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/login"
+)
+
+func TestFindMatchesWithRules(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	ago := func(d time.Duration) time.Time { return now.Add(-d) }
+	tk := func(userID string, rating float64, enqueuedAt time.Time, attributes map[string]string, blocked ...string) Ticket {
+		return Ticket{ID: "t-" + userID, UserID: userID, Rating: rating, Attributes: attributes, Blocked: blocked, EnqueuedAt: enqueuedAt, Status: TicketQueued}
+	}
+	duel := func(rules ...MatchRule) QueueConfig {
+		return QueueConfig{Name: "duel", Mode: "duel", TeamSize: 1, TeamCount: 2, MaxRatingWindow: 1000, RatingWindowGrowth: 100, Rules: rules}
+	}
+	pc, xbox := map[string]string{"platform": "pc"}, map[string]string{"platform": "xbox"}
+
+	tests := []struct {
+		name    string
+		cfg     QueueConfig
+		tickets []Ticket
+		want    [][]string
+	}{
+		{
+			name:    "same platform keeps consoles apart",
+			cfg:     duel(MatchRule{Type: RuleSame, Attribute: "platform"}),
+			tickets: []Ticket{tk("a", 1500, ago(0), pc), tk("b", 1500, ago(0), xbox), tk("c", 1520, ago(0), pc)},
+			want:    [][]string{{"c", "a"}},
+		},
+		{
+			name:    "relaxed rule lets long waiters cross play",
+			cfg:     duel(MatchRule{Type: RuleSame, Attribute: "platform", RelaxAfterSeconds: 30}),
+			tickets: []Ticket{tk("a", 1500, ago(time.Minute), pc), tk("b", 1500, ago(time.Minute), xbox)},
+			want:    [][]string{{"a", "b"}},
+		},
+		{
+			name: "shared language",
+			cfg:  duel(MatchRule{Type: RuleShared, Attribute: "languages"}),
+			tickets: []Ticket{
+				tk("a", 1500, ago(time.Second), map[string]string{"languages": "en,de"}),
+				tk("b", 1500, ago(0), map[string]string{"languages": "fr"}),
+				tk("c", 1500, ago(0), map[string]string{"languages": "de, fr"}),
+			},
+			want: [][]string{{"a", "c"}},
+		},
+		{
+			name:    "blocked players never meet, whoever blocked whom",
+			cfg:     duel(MatchRule{Type: RuleAvoidBlocked}),
+			tickets: []Ticket{tk("a", 1500, ago(time.Second), nil), tk("b", 1500, ago(0), nil, "a"), tk("c", 1600, ago(0), nil)},
+			want:    [][]string{{"c", "a"}},
+		},
+		{
+			name:    "team balance is tighter than the rating window",
+			cfg:     duel(MatchRule{Type: RuleTeamBalance, MaxGap: 50}),
+			tickets: []Ticket{tk("a", 1500, ago(time.Second), nil), tk("b", 1580, ago(0), nil), tk("c", 1460, ago(0), nil)},
+			want:    [][]string{{"a", "c"}},
+		},
+		{
+			name: "a strong party is not put against two weaker solos",
+			cfg: QueueConfig{Name: "duos", Mode: "battle", TeamSize: 2, TeamCount: 2, InitialRatingWindow: 400, Rules: []MatchRule{
+				{Type: RuleTeamBalance, MaxGap: 50},
+			}},
+			tickets: []Ticket{
+				{ID: "t-p", UserID: "p", Members: []string{"p", "q"}, Rating: 1700, EnqueuedAt: ago(time.Second)},
+				tk("a", 1500, ago(0), nil), tk("b", 1500, ago(0), nil),
+			},
+			want: nil,
+		},
+		{
+			name: "a premade trio only faces another trio",
+			cfg: QueueConfig{Name: "trios", Mode: "battle", TeamSize: 3, TeamCount: 2, InitialRatingWindow: 400, Rules: []MatchRule{
+				{Type: RulePartyBalance, MaxGap: 1},
+			}},
+			tickets: []Ticket{
+				{ID: "t-p", UserID: "p", Members: []string{"p", "q", "r"}, Rating: 1500, EnqueuedAt: ago(2 * time.Second)},
+				tk("a", 1500, ago(time.Second), nil), tk("b", 1500, ago(time.Second), nil), tk("c", 1500, ago(time.Second), nil),
+				{ID: "t-x", UserID: "x", Members: []string{"x", "y", "z"}, Rating: 1500, EnqueuedAt: ago(0)},
+			},
+			want: [][]string{{"p", "x"}},
+		},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			var got [][]string
+			for _, group := range FindMatches(tc.cfg, tc.tickets, now) {
+				ids := make([]string, len(group))
+				for i, t := range group {
+					ids[i] = t.UserID
+				}
+				got = append(got, ids)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestParseQueuesValidatesRules(t *testing.T) {
+	t.Parallel()
+	queues, err := ParseQueues([]byte(`[{"name":"ranked","mode":"duel","team_size":1,"team_count":2,"rules":[{"type":"same","attribute":"platform","relax_after_seconds":60},{"type":"avoid_blocked"}]}]`))
+	if err != nil || len(queues[0].Rules) != 2 || queues[0].Rules[0].Name() != "same(platform)" {
+		t.Fatalf("unexpected queues %+v (%v)", queues, err)
+	}
+	for _, rule := range []string{
+		`{"type":"closest"}`,
+		`{"type":"same"}`,
+		`{"type":"shared","attribute":"Languages"}`,
+		`{"type":"team_balance"}`,
+		`{"type":"party_balance","max_gap":-1}`,
+		`{"type":"avoid_blocked","relax_after_seconds":-1}`,
+	} {
+		raw := `[{"name":"ranked","mode":"duel","team_size":1,"team_count":2,"rules":[` + rule + `]}]`
+		if _, err := ParseQueues([]byte(raw)); err == nil {
+			t.Fatalf("expected rule %s to be rejected", rule)
+		}
+	}
+}
+
+func TestExplain(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	svc := NewService(&fakeRedisQueue{}, &fakePublisher{}).WithQueues([]QueueConfig{{
+		Name: "duel", Mode: "duel", TeamSize: 1, TeamCount: 2,
+		Rules: []MatchRule{{Type: RuleSame, Attribute: "platform"}, {Type: RuleAvoidBlocked}},
+	}})
+	svc.now = func() time.Time { return now }
+
+	explanation, err := svc.Explain("duel", []Ticket{
+		{ID: "t-a", UserID: "a", Rating: 1500, Attributes: map[string]string{"platform": "pc"}},
+		{ID: "t-b", UserID: "b", Rating: 1510, Attributes: map[string]string{"platform": "pc"}},
+		{ID: "t-c", UserID: "c", Rating: 1500, Attributes: map[string]string{"platform": "xbox"}},
+		{ID: "t-d", UserID: "d", Rating: 2400, Attributes: map[string]string{"platform": "pc"}},
+		{ID: "t-e", UserID: "e", Rating: 1500, Attributes: map[string]string{"platform": "pc"}, Blocked: []string{"a", "b"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(explanation.Matches) != 1 || !reflect.DeepEqual(explanation.Matches[0].TicketIDs, []string{"t-b", "t-a"}) {
+		t.Fatalf("unexpected matches %+v", explanation.Matches)
+	}
+	byTicket := map[string]TicketExplanation{}
+	for _, e := range explanation.Tickets {
+		byTicket[e.TicketID] = e
+	}
+	if !byTicket["t-a"].Matched || byTicket["t-c"].Matched {
+		t.Fatalf("unexpected explanations %+v", explanation.Tickets)
+	}
+	conflicts := map[string]string{}
+	for _, c := range byTicket["t-e"].Conflicts {
+		conflicts[c.With] = c.Reason
+	}
+	for with, want := range map[string]string{
+		"t-a": "avoid_blocked: e blocked a",
+		"t-c": `same(platform): platform is "pc" for t-e but "xbox" for t-c`,
+		"t-d": "rating gap 900 exceeds the window of 100",
+	} {
+		if conflicts[with] != want {
+			t.Fatalf("expected t-e's conflict with %s to be %q, got %q", with, want, conflicts[with])
+		}
+	}
+	if want := "only 1 of the 2 players needed can play together"; byTicket["t-e"].Reason != want {
+		t.Fatalf("expected %q, got %q", want, byTicket["t-e"].Reason)
+	}
+
+	if _, err := svc.Explain("duel", []Ticket{{ID: "t-a", UserID: "a"}, {ID: "t-a", UserID: "b"}}); !errors.Is(err, ErrInvalidExplain) {
+		t.Fatalf("expected duplicate ids to be rejected, got %v", err)
+	}
+}
+
+func TestHTTPExplainAndAttributes(t *testing.T) {
+	t.Parallel()
+	queue := &fakeRedisQueue{}
+	svc := NewService(queue, &fakePublisher{}).WithQueues([]QueueConfig{{
+		Name: "duel", Mode: "duel", TeamSize: 1, TeamCount: 2, Rules: []MatchRule{{Type: RuleSame, Attribute: "platform"}},
+	}})
+	auth := login.NewAuthenticator("test-secret", time.Hour)
+	mux := http.NewServeMux()
+	NewHandler(svc, auth).Register(mux)
+	token, _ := auth.GenerateToken("u-1", "player1")
+	operator, _ := auth.GeneratePrincipalToken(authz.Principal{Kind: authz.KindUser, Subject: "ops-1", Username: "ops", Roles: []string{authz.RoleAdmin}, Scopes: []string{authz.ScopeAdminMatchmakingRead}})
+
+	steps := []struct {
+		path  string
+		token string
+		body  string
+		code  int
+		want  string
+	}{
+		{"/v1/matchmaking/explain", "", `{"queue":"duel","tickets":[]}`, http.StatusUnauthorized, "unauthorized"},
+		{"/v1/matchmaking/explain", token, `{"queue":"duel","tickets":[]}`, http.StatusForbidden, "forbidden"},
+		{"/v1/matchmaking/explain", operator, `{"queue":"duel","tickets":[]}`, http.StatusBadRequest, "invalid_tickets"},
+		{"/v1/matchmaking/explain", operator, `{"queue":"ranked","tickets":[{"id":"t-a","user_id":"a"}]}`, http.StatusBadRequest, "unknown_queue"},
+		{"/v1/matchmaking/explain", operator, `{"queue":"duel","tickets":[{"id":"t-a","user_id":"a","attributes":{"platform":"pc"}},{"id":"t-b","user_id":"b","attributes":{"platform":"pc"}}]}`, http.StatusOK, `"ticket_ids":["t-a","t-b"]`},
+		{"/v1/matchmaking/enqueue", token, `{"queue":"duel","attributes":{"Platform":"pc"}}`, http.StatusBadRequest, "invalid_attributes"},
+		{"/v1/matchmaking/enqueue", token, `{"queue":"duel","attributes":{"platform":"pc"},"blocked":["u-9"]}`, http.StatusAccepted, `"status":"queued"`},
+	}
+	for _, step := range steps {
+		req := httptest.NewRequest(http.MethodPost, step.path, strings.NewReader(step.body))
+		if step.token != "" {
+			req.Header.Set("Authorization", "Bearer "+step.token)
+		}
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		if rr.Code != step.code || !strings.Contains(rr.Body.String(), step.want) {
+			t.Fatalf("%s %s: expected %d %s, got %d %s", step.path, step.body, step.code, step.want, rr.Code, rr.Body.String())
+		}
+	}
+	waiting, _ := queue.Tickets(context.Background(), "duel")
+	if len(waiting) != 1 || waiting[0].Attributes["platform"] != "pc" || !reflect.DeepEqual(waiting[0].Blocked, []string{"u-9"}) {
+		t.Fatalf("expected the ticket to keep its attributes, got %+v", waiting)
+	}
+}
@@ -3,58 +3,323 @@ package matchmaking
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/contracts"
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/sanctions"
 )
 
+// claimLease is how long a replica may hold claimed tickets before committing them. A claim that is not
+// committed in time, because the replica crashed or could not publish, goes back to the queue.
+const claimLease = 30 * time.Second
+
 type Publisher interface {
 	Publish(subject string, data []byte) error
 }
 
+// MatchRecorder keeps formed matches so that game servers can later report their results. Recording the
+// same match again must succeed without changing it, as a ready-check may be resolved more than once.
+type MatchRecorder interface {
+	RecordMatch(ctx context.Context, matchID, queue, mode string, teams [][]string) error
+	// JoinMatch adds players found by a backfill to a team of the match, so that its result counts them.
+	JoinMatch(ctx context.Context, matchID string, team int, userIDs []string) error
+	// LeaveMatch takes players back out of the match when their backfill is undone.
+	LeaveMatch(ctx context.Context, matchID string, userIDs []string) error
+}
+
 type Service struct {
 	queue     Queue
 	publisher Publisher
-	now       func() time.Time
-	newID     func() (string, error)
+	sanctions sanctions.Checker
+	ratings   RatingStore
+	recorder  MatchRecorder
+	parties   PartyStore
+	// readyChecks is only set when queues may run a ready-check.
+	readyChecks ReadyCheckStore
+	// backfills is only set when running sessions may ask for players.
+	backfills BackfillStore
+	sharding  *sharding
+	stats     *statsTracker
+	// statsStore is only set when replicas share queue stats.
+	statsStore StatsStore
+	queues     map[string]QueueConfig
+	// order keeps ProcessOnce deterministic across queues.
+	order []string
+	now   func() time.Time
+	newID func() (string, error)
 }
 
-type MatchResult struct {
-	UserA   string
-	UserB   string
-	MatchID string
+// Match is a formed match: Teams holds the players of each team in team order. Region is where the
+// players should play, or "" if none of them reported pings.
+type Match struct {
+	ID     string
+	Queue  string
+	Mode   string
+	Region string
+	Teams  [][]string
+}
+
+// UserIDs returns every player in the match, team by team.
+func (m Match) UserIDs() []string {
+	var ids []string
+	for _, team := range m.Teams {
+		ids = append(ids, team...)
+	}
+	return ids
 }
 
-func BuildMatch(ids []string, matchID string) (MatchResult, bool) {
-	if len(ids) < 2 {
-		return MatchResult{}, false
+// ErrUnbuildableMatch reports a group of tickets that could not be split into teams after it was claimed.
+var ErrUnbuildableMatch = errors.New("matched tickets could not be split into teams")
+
+// BuildMatch splits tickets, which must hold exactly cfg.MatchSize() players, into cfg.TeamCount teams
+// of cfg.TeamSize. Parties stay together and the teams' rating totals are kept close.
+func BuildMatch(cfg QueueConfig, tickets []Ticket, matchID string) (Match, bool) {
+	players := 0
+	for _, t := range tickets {
+		players += t.Size()
+	}
+	if players != cfg.MatchSize() || players == 0 {
+		return Match{}, false
+	}
+	assigned, ok := assignTeams(cfg, tickets)
+	if !ok {
+		return Match{}, false
+	}
+	teams := make([][]string, len(assigned))
+	for i, team := range assigned {
+		for _, t := range team {
+			teams[i] = append(teams[i], t.Players()...)
+		}
 	}
-	return MatchResult{UserA: ids[0], UserB: ids[1], MatchID: matchID}, true
+	return Match{ID: matchID, Queue: cfg.Name, Mode: cfg.Mode, Teams: teams}, true
 }
 
 func NewService(queue Queue, publisher Publisher) *Service {
-	return &Service{queue: queue, publisher: publisher, now: func() time.Time { return time.Now().UTC() }, newID: newUUID}
+	s := &Service{queue: queue, publisher: publisher, stats: newStatsTracker(), now: func() time.Time { return time.Now().UTC() }, newID: newUUID}
+	return s.WithQueues(DefaultQueues())
 }
 
-func (s *Service) Enqueue(ctx context.Context, userID, correlationID string) error {
-	if err := s.queue.Enqueue(ctx, userID); err != nil {
-		return err
+// WithClock replaces the service's clock, so that a simulation can replay traffic faster than real time.
+func (s *Service) WithClock(now func() time.Time) *Service {
+	s.now = now
+	return s
+}
+
+// WithQueues replaces the configured queues. The configs are expected to be validated already.
+func (s *Service) WithQueues(queues []QueueConfig) *Service {
+	s.queues = make(map[string]QueueConfig, len(queues))
+	s.order = s.order[:0]
+	for _, q := range queues {
+		s.queues[q.Name] = q
+		s.order = append(s.order, q.Name)
+	}
+	return s
+}
+
+// Queues returns the configured queues in configuration order.
+func (s *Service) Queues() []QueueConfig {
+	out := make([]QueueConfig, 0, len(s.order))
+	for _, name := range s.order {
+		out = append(out, s.queues[name])
+	}
+	return out
+}
+
+// WithSanctionChecker keeps banned and suspended users out of the queue.
+func (s *Service) WithSanctionChecker(c sanctions.Checker) *Service {
+	s.sanctions = c
+	return s
+}
+
+// WithRatings makes tickets carry the player's rating in the queue. Without it every player is queued
+// at DefaultRating.
+func (s *Service) WithRatings(r RatingStore) *Service {
+	s.ratings = r
+	return s
+}
+
+// WithMatchRecorder records every match before it is announced.
+func (s *Service) WithMatchRecorder(r MatchRecorder) *Service {
+	s.recorder = r
+	return s
+}
+
+// EnqueueOptions carries what a client reports about itself when queueing.
+type EnqueueOptions struct {
+	// Pings is the round trip in milliseconds to each region the client measured. A party ticket uses
+	// the leader's pings.
+	Pings map[string]int
+	// Attributes and Blocked feed the queue's match rules. A party ticket uses the leader's.
+	Attributes map[string]string
+	Blocked    []string
+}
+
+// Enqueue gives userID a ticket in the named queue; an empty name means DefaultQueueName. A party
+// leader queues the whole party on one ticket, rated at the members' mean; other members cannot queue
+// while in a party. A player holds at most one active ticket: asking again for the same queue returns
+// the existing ticket, and asking for another queue returns it with ErrAlreadyQueued.
+func (s *Service) Enqueue(ctx context.Context, userID, queueName, correlationID string) (Ticket, error) {
+	return s.EnqueueWithOptions(ctx, userID, queueName, EnqueueOptions{}, correlationID)
+}
+
+// EnqueueWithOptions is Enqueue for a client that reports pings or match attributes.
+func (s *Service) EnqueueWithOptions(ctx context.Context, userID, queueName string, opts EnqueueOptions, correlationID string) (Ticket, error) {
+	if err := ValidatePings(opts.Pings); err != nil {
+		return Ticket{}, err
+	}
+	if err := ValidateAttributes(opts.Attributes, opts.Blocked); err != nil {
+		return Ticket{}, err
+	}
+	if queueName == "" {
+		queueName = DefaultQueueName
+	}
+	cfg, ok := s.queues[queueName]
+	if !ok {
+		return Ticket{}, ErrUnknownQueue
+	}
+	party, inParty, err := s.partyFor(ctx, userID, cfg)
+	if err != nil {
+		return Ticket{}, err
+	}
+	players := []string{userID}
+	if inParty {
+		players = party.Members
+	}
+	if err := s.checkCooldowns(ctx, players); err != nil {
+		return Ticket{}, err
+	}
+	if s.sanctions != nil {
+		for _, playerID := range players {
+			sanction, err := s.sanctions.Blocking(ctx, playerID)
+			if err != nil {
+				return Ticket{}, fmt.Errorf("%w: %v", sanctions.ErrUnavailable, err)
+			}
+			if sanction != nil {
+				return Ticket{}, &sanctions.Error{Sanction: *sanction}
+			}
+		}
+	}
+	rating := DefaultRating
+	if s.ratings != nil {
+		total := 0.0
+		for _, playerID := range players {
+			r, err := s.ratings.Rating(ctx, playerID, queueName)
+			if err != nil {
+				return Ticket{}, err
+			}
+			total += r
+		}
+		rating = total / float64(len(players))
+	}
+	ticketID, err := s.newID()
+	if err != nil {
+		return Ticket{}, err
 	}
+	ticket := Ticket{ID: ticketID, UserID: userID, Queue: queueName, Rating: rating, Pings: opts.Pings, Attributes: opts.Attributes, Blocked: opts.Blocked, EnqueuedAt: s.now(), Status: TicketQueued}
+	if inParty {
+		ticket.Members, ticket.PartyID = party.Members, party.ID
+	}
+	ticket, err = s.queue.Enqueue(ctx, ticket)
+	if errors.Is(err, ErrAlreadyQueued) && ticket.Queue == queueName && ticket.UserID == userID && ticket.PartyID == party.ID {
+		return ticket, nil
+	}
+	if err != nil {
+		return ticket, err
+	}
+	if inParty {
+		if _, err := s.parties.Update(ctx, party.ID, func(p *Party) error {
+			p.TicketID = ticket.ID
+			return nil
+		}); err != nil {
+			return Ticket{}, err
+		}
+	}
+
 	eventID, err := s.newID()
 	if err != nil {
-		return err
+		return Ticket{}, err
 	}
-	payload := contracts.MatchmakingEnqueuedV1{TicketID: eventID, Queue: "default"}
+	payload := contracts.MatchmakingEnqueuedV1{TicketID: ticket.ID, Queue: queueName}
 	raw, err := contracts.MarshalV1(eventID, contracts.EventMatchmakingEnqueued, s.now(), correlationID, &userID, payload)
 	if err != nil {
-		return err
+		return Ticket{}, err
 	}
-	return s.publisher.Publish(contracts.SubjectMatchmakingQueued, raw)
+	if err := s.publisher.Publish(contracts.SubjectMatchmakingQueued, raw); err != nil {
+		return Ticket{}, err
+	}
+	return ticket, s.pushTicketStatus(correlationID, ticket)
 }
 
+// ProcessOnce resolves expired ready-checks, then forms as many matches in each queue this replica
+// works as the waiting players' rating windows allow.
 func (s *Service) ProcessOnce(ctx context.Context) error {
-	ids, err := s.queue.DequeuePair(ctx)
-	if err != nil || len(ids) < 2 {
+	var errs []error
+	if err := s.expireProposals(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	queues, err := s.queuesToWork(ctx)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	for _, name := range queues {
+		if err := s.processQueue(ctx, s.queues[name]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Service) processQueue(ctx context.Context, cfg QueueConfig) error {
+	now := s.now()
+	var errs []error
+	if _, err := s.queue.Reclaim(ctx, cfg.Name, now); err != nil {
+		errs = append(errs, err)
+	}
+	tickets, err := s.queue.Tickets(ctx, cfg.Name)
+	if err != nil {
+		return errors.Join(append(errs, err)...)
+	}
+	waiting := make([]Ticket, 0, len(tickets))
+	for _, t := range tickets {
+		if now.Sub(t.EnqueuedAt) >= cfg.TicketTimeout() {
+			if err := s.timeOut(ctx, t); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		waiting = append(waiting, t)
+	}
+	waiting, err = s.fillBackfills(ctx, cfg, waiting, now)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	formed := map[string]bool{}
+	for _, group := range FindMatches(cfg, waiting, now) {
+		if err := s.formMatch(ctx, cfg, group); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, t := range group {
+			formed[t.ID] = true
+		}
+	}
+	left := make([]Ticket, 0, len(waiting))
+	for _, t := range waiting {
+		if !formed[t.ID] {
+			left = append(left, t)
+		}
+	}
+	if err := s.updateStats(ctx, cfg, left, now); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Service) formMatch(ctx context.Context, cfg QueueConfig, group []Ticket) error {
+	claimed, err := s.queue.Claim(ctx, cfg.Name, group, s.now().Add(claimLease))
+	if err != nil || !claimed {
 		return err
 	}
 
@@ -62,22 +327,62 @@ func (s *Service) ProcessOnce(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
-	res, ok := BuildMatch(ids, matchID)
+	match, ok := BuildMatch(cfg, group, matchID)
 	if !ok {
-		return nil
+		// FindMatches only returns groups that build; put the tickets back rather than strand them.
+		if err := s.queue.Requeue(ctx, group); err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: queue %s", ErrUnbuildableMatch, cfg.Name)
+	}
+	match.Region = matchRegion(cfg, group, s.now())
+	if cfg.ReadyCheck() > 0 && s.readyChecks != nil {
+		return s.propose(ctx, cfg, match, group)
 	}
 	corrID, err := s.newID()
 	if err != nil {
 		return err
 	}
+	return s.announce(ctx, corrID, match, group)
+}
 
-	if err := s.publishMatched(corrID, res); err != nil {
+// announce records the match, tells the sessions service and marks its tickets matched, then tells every
+// player. The tickets are only committed once matchmaking.matched is published; if that fails, their
+// lease runs out and they are matched again.
+func (s *Service) announce(ctx context.Context, correlationID string, match Match, group []Ticket) error {
+	if s.recorder != nil {
+		if err := s.recorder.RecordMatch(ctx, match.ID, match.Queue, match.Mode, match.Teams); err != nil {
+			return err
+		}
+	}
+	if err := s.publishMatched(correlationID, match); err != nil {
 		return err
 	}
-	if err := s.publishUserMessage(corrID, res.UserA, res.UserB, res.MatchID); err != nil {
+	if err := s.queue.Finish(ctx, group, TicketMatched, match.ID); err != nil {
 		return err
 	}
-	return s.publishUserMessage(corrID, res.UserB, res.UserA, res.MatchID)
+	s.stats.recordMatched(match.Queue, group, s.now(), true)
+	ticketOf := ticketsByPlayer(group)
+	for team, members := range match.Teams {
+		for _, userID := range members {
+			message := matchFoundMessage{Type: "match_found", TicketID: ticketOf[userID], MatchID: match.ID, Queue: match.Queue, Mode: match.Mode, Region: match.Region, Team: team, Teams: match.Teams}
+			if err := s.sendToUser(correlationID, userID, message); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ticketsByPlayer maps each player in tickets to their ticket's ID.
+func ticketsByPlayer(tickets []Ticket) map[string]string {
+	ticketOf := make(map[string]string, len(tickets))
+	for _, t := range tickets {
+		for _, userID := range t.Players() {
+			ticketOf[userID] = t.ID
+		}
+	}
+	return ticketOf
 }
 
 func (s *Service) Run(ctx context.Context, interval time.Duration) {
@@ -86,6 +391,7 @@ func (s *Service) Run(ctx context.Context, interval time.Duration) {
 	for {
 		select {
 		case <-ctx.Done():
+			s.releaseQueues(context.Background())
 			return
 		case <-ticker.C:
 			_ = s.ProcessOnce(ctx)
@@ -93,12 +399,12 @@ func (s *Service) Run(ctx context.Context, interval time.Duration) {
 	}
 }
 
-func (s *Service) publishMatched(correlationID string, result MatchResult) error {
+func (s *Service) publishMatched(correlationID string, match Match) error {
 	eventID, err := s.newID()
 	if err != nil {
 		return err
 	}
-	payload := contracts.MatchmakingMatchedV1{MatchID: result.MatchID, UserIDs: []string{result.UserA, result.UserB}}
+	payload := contracts.MatchmakingMatchedV1{MatchID: match.ID, Queue: match.Queue, Mode: match.Mode, Region: match.Region, UserIDs: match.UserIDs(), Teams: match.Teams}
 	raw, err := contracts.MarshalV1(eventID, contracts.EventMatchmakingMatched, s.now(), correlationID, nil, payload)
 	if err != nil {
 		return err
@@ -106,17 +412,30 @@ func (s *Service) publishMatched(correlationID string, result MatchResult) error
 	return s.publisher.Publish(contracts.SubjectMatchmakingMatch, raw)
 }
 
-func (s *Service) publishUserMessage(correlationID, targetUserID, otherUserID, matchID string) error {
+// matchFoundMessage is what each player receives over the gateway when their match is formed.
+type matchFoundMessage struct {
+	Type     string     `json:"type"`
+	TicketID string     `json:"ticket_id"`
+	MatchID  string     `json:"match_id"`
+	Queue    string     `json:"queue"`
+	Mode     string     `json:"mode"`
+	Region   string     `json:"region,omitempty"`
+	Team     int        `json:"team"`
+	Teams    [][]string `json:"teams"`
+}
+
+// sendToUser asks the gateway to deliver message, marshalled as JSON, to targetUserID.
+func (s *Service) sendToUser(correlationID, targetUserID string, message any) error {
 	eventID, err := s.newID()
 	if err != nil {
 		return err
 	}
-	message, err := json.Marshal(map[string]string{"type": "match_found", "match_id": matchID, "other_user_id": otherUserID})
+	raw, err := json.Marshal(message)
 	if err != nil {
 		return err
 	}
-	payload := contracts.GatewaySendToUserV1{TargetUserID: targetUserID, Message: message}
-	raw, err := contracts.MarshalV1(eventID, contracts.EventGatewaySendToUser, s.now(), correlationID, &targetUserID, payload)
+	payload := contracts.GatewaySendToUserV1{TargetUserID: targetUserID, Message: raw}
+	raw, err = contracts.MarshalV1(eventID, contracts.EventGatewaySendToUser, s.now(), correlationID, &targetUserID, payload)
 	if err != nil {
 		return err
 	}
@@ -2,25 +2,149 @@ package matchmaking
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/contracts"
 	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/login"
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/sanctions"
 )
 
 func TestBuildMatch(t *testing.T) {
 	t.Parallel()
-	_, ok := BuildMatch([]string{"only-one"}, "m-1")
-	if ok {
+	solo := func(userID string, rating float64) Ticket {
+		return Ticket{ID: "t-" + userID, UserID: userID, Rating: rating}
+	}
+	duel := DefaultQueues()[0]
+	if _, ok := BuildMatch(duel, []Ticket{solo("only-one", 1500)}, "m-1"); ok {
 		t.Fatalf("expected no match for single user")
 	}
-	result, ok := BuildMatch([]string{"u-1", "u-2", "u-3"}, "m-2")
-	if !ok || result.UserA != "u-1" || result.UserB != "u-2" || result.MatchID != "m-2" {
+	if _, ok := BuildMatch(duel, []Ticket{solo("u-1", 1500), solo("u-2", 1500), solo("u-3", 1500)}, "m-2"); ok {
+		t.Fatalf("expected no match for too many users")
+	}
+	result, ok := BuildMatch(duel, []Ticket{solo("u-1", 1500), solo("u-2", 1500)}, "m-2")
+	if !ok || !reflect.DeepEqual(result.Teams, [][]string{{"u-1"}, {"u-2"}}) || result.ID != "m-2" {
 		t.Fatalf("unexpected result: %+v", result)
 	}
+
+	squads := QueueConfig{Name: "squads", Mode: "battle", TeamSize: 2, TeamCount: 3}
+	result, ok = BuildMatch(squads, []Ticket{solo("a", 1600), solo("b", 1550), solo("c", 1520), solo("d", 1500), solo("e", 1450), solo("f", 1400)}, "m-3")
+	if !ok || !reflect.DeepEqual(result.Teams, [][]string{{"a", "f"}, {"b", "e"}, {"c", "d"}}) {
+		t.Fatalf("unexpected teams: %+v", result.Teams)
+	}
+	if !reflect.DeepEqual(result.UserIDs(), []string{"a", "f", "b", "e", "c", "d"}) {
+		t.Fatalf("unexpected user ids: %v", result.UserIDs())
+	}
+
+	duo := Ticket{ID: "t-p", UserID: "p1", Members: []string{"p1", "p2"}, Rating: 1500}
+	result, ok = BuildMatch(QueueConfig{Name: "squads", Mode: "battle", TeamSize: 2, TeamCount: 2}, []Ticket{solo("a", 1700), duo, solo("b", 1300)}, "m-4")
+	if !ok || !reflect.DeepEqual(result.Teams, [][]string{{"p1", "p2"}, {"a", "b"}}) {
+		t.Fatalf("expected the party to stay together, got %+v", result.Teams)
+	}
+}
+
+func TestParseQueues(t *testing.T) {
+	t.Parallel()
+	queues, err := ParseQueues([]byte(`[{"name":"duel","mode":"duel","team_size":1,"team_count":2},{"name":"squads","mode":"battle","team_size":4,"team_count":2}]`))
+	if err != nil || len(queues) != 2 || queues[1].MatchSize() != 8 {
+		t.Fatalf("unexpected queues %+v (%v)", queues, err)
+	}
+	for _, raw := range []string{
+		`[]`,
+		`[{"name":"Bad Name","mode":"duel","team_size":1,"team_count":2}]`,
+		`[{"name":"solo","mode":"duel","team_size":1,"team_count":1}]`,
+		`[{"name":"duel","mode":"duel","team_size":1,"team_count":2},{"name":"duel","mode":"duel","team_size":1,"team_count":2}]`,
+	} {
+		if _, err := ParseQueues([]byte(raw)); err == nil {
+			t.Fatalf("expected %s to be rejected", raw)
+		}
+	}
+}
+
+func TestProcessOnceFormsNvNMatchesPerQueue(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	queue := &fakeRedisQueue{}
+	publisher := &fakePublisher{}
+	recorder := &recordingRecorder{}
+	svc := NewService(queue, publisher).WithQueues([]QueueConfig{
+		{Name: "duel", Mode: "duel", TeamSize: 1, TeamCount: 2},
+		{Name: "squads", Mode: "battle", TeamSize: 2, TeamCount: 2},
+	}).WithMatchRecorder(recorder)
+	for _, id := range []string{"a", "b", "c", "d"} {
+		if _, err := svc.Enqueue(ctx, id, "squads", "corr"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := svc.Enqueue(ctx, "e", "duel", "corr"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Enqueue(ctx, "f", "ranked", "corr"); !errors.Is(err, ErrUnknownQueue) {
+		t.Fatalf("expected unknown queue, got %v", err)
+	}
+	publisher.events = nil
+	if err := svc.ProcessOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(publisher.events) != 5 {
+		t.Fatalf("expected one matched event and four player messages, got %d", len(publisher.events))
+	}
+	env, err := contracts.UnmarshalEnvelope(publisher.events[0].data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var matched contracts.MatchmakingMatchedV1
+	if err := json.Unmarshal(env.Payload, &matched); err != nil {
+		t.Fatal(err)
+	}
+	if matched.Queue != "squads" || matched.Mode != "battle" || !reflect.DeepEqual(matched.Teams, [][]string{{"a", "c"}, {"b", "d"}}) || len(matched.UserIDs) != 4 {
+		t.Fatalf("unexpected matched payload %+v", matched)
+	}
+	if len(queue.waiting("duel")) != 1 {
+		t.Fatalf("expected the lone duel player to keep waiting, got %v", queue.waiting("duel"))
+	}
+	if len(recorder.matches) != 1 || recorder.matches[0] != matched.MatchID {
+		t.Fatalf("expected the match to be recorded, got %v", recorder.matches)
+	}
+}
+
+type recordingRecorder struct {
+	matches []string
+	joined  map[string][]string // match ID -> "team:user" for each player added by a backfill
+}
+
+func (r *recordingRecorder) RecordMatch(_ context.Context, matchID, _, _ string, _ [][]string) error {
+	r.matches = append(r.matches, matchID)
+	return nil
+}
+
+func (r *recordingRecorder) JoinMatch(_ context.Context, matchID string, team int, userIDs []string) error {
+	if r.joined == nil {
+		r.joined = map[string][]string{}
+	}
+	for _, userID := range userIDs {
+		r.joined[matchID] = append(r.joined[matchID], strconv.Itoa(team)+":"+userID)
+	}
+	return nil
+}
+
+func (r *recordingRecorder) LeaveMatch(_ context.Context, matchID string, userIDs []string) error {
+	for _, userID := range userIDs {
+		for i, joined := range r.joined[matchID] {
+			if strings.HasSuffix(joined, ":"+userID) {
+				r.joined[matchID] = append(r.joined[matchID][:i], r.joined[matchID][i+1:]...)
+				break
+			}
+		}
+	}
+	return nil
 }
 
 func TestEnqueueAndProcessOnce_WithFakeRedisQueue(t *testing.T) {
@@ -29,27 +153,35 @@ func TestEnqueueAndProcessOnce_WithFakeRedisQueue(t *testing.T) {
 	queue := &fakeRedisQueue{}
 	publisher := &fakePublisher{}
 	svc := NewService(queue, publisher)
-	svc.newID = fixedIDs("evt-1", "evt-2", "match-1", "corr-1", "evt-3", "evt-4")
+	svc.newID = fixedIDs("t-1", "evt-1", "evt-2", "t-2", "evt-3", "evt-4", "match-1", "corr-1", "evt-5", "evt-6", "evt-7")
 	svc.now = func() time.Time { return time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC) }
-	_ = svc.Enqueue(ctx, "u-1", "corr-enq-1")
-	_ = svc.Enqueue(ctx, "u-2", "corr-enq-2")
+	_, _ = svc.Enqueue(ctx, "u-1", DefaultQueueName, "corr-enq-1")
+	_, _ = svc.Enqueue(ctx, "u-2", DefaultQueueName, "corr-enq-2")
 	if err := svc.ProcessOnce(ctx); err != nil {
 		t.Fatalf("process once: %v", err)
 	}
-	if len(publisher.events) != 5 {
-		t.Fatalf("expected 5 published messages, got %d", len(publisher.events))
+	if len(publisher.events) != 7 {
+		t.Fatalf("expected 7 published messages, got %d", len(publisher.events))
 	}
-	if publisher.events[2].subject != contracts.SubjectMatchmakingMatch {
-		t.Fatalf("unexpected subject at #3: %s", publisher.events[2].subject)
+	if publisher.events[4].subject != contracts.SubjectMatchmakingMatch {
+		t.Fatalf("unexpected subject at #5: %s", publisher.events[4].subject)
+	}
+	if ticket, _ := queue.Ticket(ctx, "t-1"); ticket.Status != TicketMatched || ticket.MatchID != "match-1" {
+		t.Fatalf("expected the ticket to be marked matched, got %+v", ticket)
 	}
 }
 
 func TestNoDuplicateMatchesAcrossProcessCalls(t *testing.T) {
 	t.Parallel()
 	ctx := context.Background()
-	q := &fakeRedisQueue{users: []string{"u1", "u2", "u3", "u4"}}
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	q := &fakeRedisQueue{}
+	for _, id := range []string{"u1", "u2", "u3", "u4"} {
+		_, _ = q.Enqueue(ctx, Ticket{ID: "t-" + id, UserID: id, Queue: DefaultQueueName, Rating: DefaultRating, EnqueuedAt: now, Status: TicketQueued})
+	}
 	p := &fakePublisher{}
 	svc := NewService(q, p)
+	svc.now = func() time.Time { return now }
 	svc.newID = fixedIDs("a", "b", "m1", "c", "d", "e", "f", "m2", "g", "h")
 	if err := svc.ProcessOnce(ctx); err != nil {
 		t.Fatal(err)
@@ -71,6 +203,78 @@ func TestNoDuplicateMatchesAcrossProcessCalls(t *testing.T) {
 	}
 }
 
+type flakyPublisher struct {
+	fakePublisher
+	failing string
+}
+
+func (f *flakyPublisher) Publish(subject string, data []byte) error {
+	if subject == f.failing {
+		return errors.New("nats unavailable")
+	}
+	return f.fakePublisher.Publish(subject, data)
+}
+
+func TestUnpublishedMatchReturnsToQueueAfterLease(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	queue := &fakeRedisQueue{}
+	publisher := &flakyPublisher{failing: contracts.SubjectMatchmakingMatch}
+	svc := NewService(queue, publisher)
+	svc.now = func() time.Time { return now }
+	for _, id := range []string{"u-1", "u-2"} {
+		if _, err := svc.Enqueue(ctx, id, DefaultQueueName, "corr"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := svc.ProcessOnce(ctx); err == nil {
+		t.Fatal("expected the failed publish to be reported")
+	}
+	if len(queue.waiting(DefaultQueueName)) != 0 || len(queue.inflight) != 2 {
+		t.Fatalf("expected both tickets in flight, got %v waiting and %v in flight", queue.waiting(DefaultQueueName), queue.inflight)
+	}
+	for _, ticket := range queue.all {
+		if ticket.Status != TicketQueued {
+			t.Fatalf("an unpublished match must not be committed, got %+v", ticket)
+		}
+	}
+
+	publisher.failing = ""
+	now = now.Add(claimLease)
+	if err := svc.ProcessOnce(ctx); err != nil || len(queue.waiting(DefaultQueueName)) != 0 {
+		t.Fatalf("tickets must stay in flight until the lease has ended: %v", err)
+	}
+	now = now.Add(time.Second)
+	if err := svc.ProcessOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(queue.inflight) != 0 || publisher.events[len(publisher.events)-3].subject != contracts.SubjectMatchmakingMatch {
+		t.Fatalf("expected the reclaimed tickets to be matched, got %v in flight", queue.inflight)
+	}
+}
+
+func TestUnbuildableMatchIsRequeued(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	queue := &fakeRedisQueue{}
+	svc := NewService(queue, &fakePublisher{})
+	cfg := svc.queues[DefaultQueueName]
+	ticket, err := svc.Enqueue(ctx, "u-1", DefaultQueueName, "corr")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// One player cannot fill a 1v1, so the claimed group cannot be built.
+	if err := svc.formMatch(ctx, cfg, []Ticket{ticket}); !errors.Is(err, ErrUnbuildableMatch) {
+		t.Fatalf("expected ErrUnbuildableMatch, got %v", err)
+	}
+	if waiting := queue.waiting(DefaultQueueName); len(waiting) != 1 || waiting[0].ID != ticket.ID || len(queue.inflight) != 0 {
+		t.Fatalf("expected the ticket back in the queue, got %v waiting and %v in flight", waiting, queue.inflight)
+	}
+}
+
 func TestHTTPEnqueueRequiresJWT(t *testing.T) {
 	t.Parallel()
 	queue := &fakeRedisQueue{}
@@ -96,19 +300,202 @@ func TestHTTPEnqueueRequiresJWT(t *testing.T) {
 	}
 }
 
-type fakeRedisQueue struct{ users []string }
+func TestHTTPEnqueueQueueSelection(t *testing.T) {
+	t.Parallel()
+	queue := &fakeRedisQueue{}
+	svc := NewService(queue, &fakePublisher{}).WithQueues([]QueueConfig{{Name: "squads", Mode: "battle", TeamSize: 2, TeamCount: 2}})
+	auth := login.NewAuthenticator("test-secret", time.Hour)
+	mux := http.NewServeMux()
+	NewHandler(svc, auth).Register(mux)
+	token, _ := auth.GenerateToken("u-1", "player1")
+	for _, tc := range []struct {
+		body string
+		code int
+	}{
+		{`{"queue":"squads"}`, http.StatusAccepted},
+		{`{"queue":"ranked"}`, http.StatusBadRequest},
+		{`{"queue":`, http.StatusBadRequest},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/v1/matchmaking/enqueue", strings.NewReader(tc.body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		if rr.Code != tc.code {
+			t.Fatalf("%s: expected %d, got %d %s", tc.body, tc.code, rr.Code, rr.Body.String())
+		}
+	}
+	if len(queue.waiting("squads")) != 1 {
+		t.Fatalf("expected one queued player, got %v", queue.all)
+	}
+}
+
+type fakeChecker struct {
+	sanction *sanctions.Sanction
+	err      error
+}
+
+func (f fakeChecker) Blocking(context.Context, string) (*sanctions.Sanction, error) {
+	return f.sanction, f.err
+}
+
+func TestEnqueueRefusesSanctionedUsers(t *testing.T) {
+	t.Parallel()
+	queue := &fakeRedisQueue{}
+	svc := NewService(queue, &fakePublisher{}).WithSanctionChecker(fakeChecker{sanction: &sanctions.Sanction{Type: sanctions.TypeSuspension, Reason: "afk"}})
+	auth := login.NewAuthenticator("test-secret", time.Hour)
+	mux := http.NewServeMux()
+	NewHandler(svc, auth).Register(mux)
+	token, _ := auth.GenerateToken("u-1", "player1")
+	req := httptest.NewRequest(http.MethodPost, "/v1/matchmaking/enqueue", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), "account_suspended") {
+		t.Fatalf("expected 403 account_suspended, got %d %s", rr.Code, rr.Body.String())
+	}
+	if len(queue.waiting(DefaultQueueName)) != 0 {
+		t.Fatalf("sanctioned user must not be queued, got %v", queue.all)
+	}
+
+	unchecked := NewService(queue, &fakePublisher{}).WithSanctionChecker(fakeChecker{err: errors.New("redis down")})
+	mux = http.NewServeMux()
+	NewHandler(unchecked, auth).Register(mux)
+	req = httptest.NewRequest(http.MethodPost, "/v1/matchmaking/enqueue", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusServiceUnavailable || !strings.Contains(rr.Body.String(), "sanctions_unavailable") {
+		t.Fatalf("expected 503 sanctions_unavailable, got %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+type fakeRedisQueue struct {
+	all      map[string]Ticket    // by ticket ID
+	pools    map[string][]string  // queue -> waiting ticket IDs in enqueue order
+	active   map[string]string    // user ID -> active ticket ID
+	inflight map[string]time.Time // claimed ticket ID -> lease end
+	// finishErr, when set, fails Finish before it changes anything.
+	finishErr error
+}
 
-func (f *fakeRedisQueue) Enqueue(_ context.Context, userID string) error {
-	f.users = append(f.users, userID)
+func (f *fakeRedisQueue) Enqueue(_ context.Context, ticket Ticket) (Ticket, error) {
+	if f.all == nil {
+		f.all, f.pools, f.active, f.inflight = map[string]Ticket{}, map[string][]string{}, map[string]string{}, map[string]time.Time{}
+	}
+	for _, userID := range ticket.Players() {
+		if id, ok := f.active[userID]; ok {
+			return f.all[id], ErrAlreadyQueued
+		}
+	}
+	f.all[ticket.ID] = ticket
+	for _, userID := range ticket.Players() {
+		f.active[userID] = ticket.ID
+	}
+	f.pools[ticket.Queue] = append(f.pools[ticket.Queue], ticket.ID)
+	return ticket, nil
+}
+
+func (f *fakeRedisQueue) Ticket(_ context.Context, ticketID string) (Ticket, error) {
+	t, ok := f.all[ticketID]
+	if !ok {
+		return Ticket{}, ErrTicketNotFound
+	}
+	return t, nil
+}
+
+func (f *fakeRedisQueue) ActiveTicket(_ context.Context, userID string) (Ticket, error) {
+	id, ok := f.active[userID]
+	if !ok {
+		return Ticket{}, ErrTicketNotFound
+	}
+	return f.all[id], nil
+}
+
+func (f *fakeRedisQueue) Tickets(_ context.Context, queue string) ([]Ticket, error) {
+	return f.waiting(queue), nil
+}
+
+func (f *fakeRedisQueue) waiting(queue string) []Ticket {
+	var out []Ticket
+	for _, id := range f.pools[queue] {
+		out = append(out, f.all[id])
+	}
+	return out
+}
+
+func (f *fakeRedisQueue) Claim(_ context.Context, queue string, tickets []Ticket, leaseUntil time.Time) (bool, error) {
+	claim := map[string]bool{}
+	for _, t := range tickets {
+		claim[t.ID] = true
+	}
+	var rest []string
+	for _, id := range f.pools[queue] {
+		if claim[id] {
+			delete(claim, id)
+			continue
+		}
+		rest = append(rest, id)
+	}
+	if len(claim) > 0 {
+		return false, nil
+	}
+	f.pools[queue] = rest
+	for _, t := range tickets {
+		f.inflight[t.ID] = leaseUntil
+	}
+	return true, nil
+}
+
+func (f *fakeRedisQueue) Reclaim(_ context.Context, queue string, now time.Time) ([]string, error) {
+	var returned []string
+	for id, until := range f.inflight {
+		t := f.all[id]
+		if t.Queue != queue || !until.Before(now) {
+			continue
+		}
+		delete(f.inflight, id)
+		if t.Status == TicketQueued {
+			f.pools[queue] = append(f.pools[queue], id)
+			returned = append(returned, id)
+		}
+	}
+	return returned, nil
+}
+
+func (f *fakeRedisQueue) Hold(_ context.Context, tickets []Ticket, matchID string) error {
+	for _, t := range tickets {
+		t.Status, t.MatchID = TicketProposed, matchID
+		f.all[t.ID] = t
+		delete(f.inflight, t.ID)
+	}
 	return nil
 }
-func (f *fakeRedisQueue) DequeuePair(_ context.Context) ([]string, error) {
-	if len(f.users) < 2 {
-		return nil, nil
+
+func (f *fakeRedisQueue) Requeue(_ context.Context, tickets []Ticket) error {
+	for _, t := range tickets {
+		t.Status, t.MatchID = TicketQueued, ""
+		f.all[t.ID] = t
+		delete(f.inflight, t.ID)
+		f.pools[t.Queue] = append(f.pools[t.Queue], t.ID)
 	}
-	pair := []string{f.users[0], f.users[1]}
-	f.users = f.users[2:]
-	return pair, nil
+	return nil
+}
+
+func (f *fakeRedisQueue) Finish(_ context.Context, tickets []Ticket, status, matchID string) error {
+	if f.finishErr != nil {
+		return f.finishErr
+	}
+	for _, t := range tickets {
+		t.Status, t.MatchID = status, matchID
+		f.all[t.ID] = t
+		delete(f.inflight, t.ID)
+		for _, userID := range t.Players() {
+			if f.active[userID] == t.ID {
+				delete(f.active, userID)
+			}
+		}
+	}
+	return nil
 }
 
 type fakePublisher struct{ events []published }
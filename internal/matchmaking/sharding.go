@@ -0,0 +1,190 @@
+package matchmaking
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"sync"
+	"time"
+)
+
+// ShardLeaseTTL is how long a replica owns a queue, or counts as alive, without renewing. Run renews
+// far more often, so a queue only changes hands when its owner stops or is rebalanced.
+const ShardLeaseTTL = 10 * time.Second
+
+// sharding splits the queues between matchmaking replicas. Each replica works only the queues it
+// holds a lease on, and takes at most its fair share of them, so that work spreads as replicas join.
+type sharding struct {
+	leases     QueueLeases
+	instanceID string
+
+	mu    sync.Mutex
+	owned map[string]bool
+}
+
+// QueueOwnership reports which instance works a queue.
+type QueueOwnership struct {
+	Queue string `json:"queue"`
+	Owner string `json:"owner,omitempty"`
+	Owned bool   `json:"owned"`
+}
+
+// WithSharding makes the service one of several replicas sharing the queues through leases, known to
+// the others as instanceID. Without it the service works every queue.
+func (s *Service) WithSharding(leases QueueLeases, instanceID string) *Service {
+	s.sharding = &sharding{leases: leases, instanceID: instanceID, owned: map[string]bool{}}
+	return s
+}
+
+// InstanceID is the name this replica holds queue leases under, or "" without sharding.
+func (s *Service) InstanceID() string {
+	if s.sharding == nil {
+		return ""
+	}
+	return s.sharding.instanceID
+}
+
+// OwnedQueues returns the queues this replica worked on its last pass, in configuration order.
+func (s *Service) OwnedQueues() []string {
+	if s.sharding == nil {
+		return append([]string(nil), s.order...)
+	}
+	s.sharding.mu.Lock()
+	defer s.sharding.mu.Unlock()
+	var owned []string
+	for _, name := range s.order {
+		if s.sharding.owned[name] {
+			owned = append(owned, name)
+		}
+	}
+	return owned
+}
+
+// Ownership returns the current owner of every queue.
+func (s *Service) Ownership(ctx context.Context) ([]QueueOwnership, error) {
+	out := make([]QueueOwnership, 0, len(s.order))
+	if s.sharding == nil {
+		for _, name := range s.order {
+			out = append(out, QueueOwnership{Queue: name, Owned: true})
+		}
+		return out, nil
+	}
+	owners, err := s.sharding.leases.Owners(ctx, s.order)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range s.order {
+		out = append(out, QueueOwnership{Queue: name, Owner: owners[name], Owned: owners[name] == s.sharding.instanceID})
+	}
+	return out, nil
+}
+
+// WriteMetrics writes, in Prometheus text format, whether this replica owns each queue and the stats of
+// the queues it owns.
+func (s *Service) WriteMetrics(w io.Writer, serviceName string) {
+	owned := map[string]bool{}
+	for _, name := range s.OwnedQueues() {
+		owned[name] = true
+	}
+	_, _ = fmt.Fprintf(w, "# HELP pcgb_matchmaking_queue_owned Whether this instance works the queue.\n")
+	_, _ = fmt.Fprintf(w, "# TYPE pcgb_matchmaking_queue_owned gauge\n")
+	for _, name := range s.order {
+		value := 0
+		if owned[name] {
+			value = 1
+		}
+		_, _ = fmt.Fprintf(w, "pcgb_matchmaking_queue_owned{service=%q,instance=%q,queue=%q} %d\n", serviceName, s.InstanceID(), name, value)
+	}
+	s.writeQueueStats(w, serviceName)
+}
+
+// queuesToWork returns the queues this pass should process. With sharding it first heartbeats, then
+// renews or takes leases up to the fair share of queues per live replica and releases any beyond it.
+// Each replica starts from a different queue, so that replicas reach for different queues first.
+func (s *Service) queuesToWork(ctx context.Context) ([]string, error) {
+	if s.sharding == nil {
+		return s.order, nil
+	}
+	sh := s.sharding
+	live, err := sh.leases.Heartbeat(ctx, sh.instanceID, s.now(), ShardLeaseTTL)
+	if err != nil {
+		// Without a heartbeat the leases cannot be trusted either; sit this pass out.
+		sh.mu.Lock()
+		sh.owned = map[string]bool{}
+		sh.mu.Unlock()
+		return nil, err
+	}
+	if live < 1 {
+		live = 1
+	}
+	share := (len(s.order) + live - 1) / live
+
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(sh.instanceID))
+	start := 0
+	if len(s.order) > 0 {
+		start = int(h.Sum32() % uint32(len(s.order)))
+	}
+	// Renew held leases before taking new ones, so that a replica keeps its queues across passes.
+	var renew, take []string
+	for i := range s.order {
+		name := s.order[(start+i)%len(s.order)]
+		if sh.owned[name] {
+			renew = append(renew, name)
+		} else {
+			take = append(take, name)
+		}
+	}
+	candidates := append(renew, take...)
+	held := 0
+	var errs []error
+	for _, name := range candidates {
+		if held >= share {
+			if sh.owned[name] {
+				if err := sh.leases.Release(ctx, name, sh.instanceID); err != nil {
+					errs = append(errs, err)
+				}
+				delete(sh.owned, name)
+			}
+			continue
+		}
+		ok, err := sh.leases.Acquire(ctx, name, sh.instanceID, ShardLeaseTTL)
+		if err != nil {
+			errs = append(errs, err)
+			delete(sh.owned, name)
+			continue
+		}
+		if ok {
+			sh.owned[name] = true
+			held++
+		} else {
+			delete(sh.owned, name)
+		}
+	}
+
+	var work []string
+	for _, name := range s.order {
+		if sh.owned[name] {
+			work = append(work, name)
+		}
+	}
+	return work, errors.Join(errs...)
+}
+
+// releaseQueues gives up every lease this replica holds, so that others can take its queues at once.
+func (s *Service) releaseQueues(ctx context.Context) {
+	if s.sharding == nil {
+		return
+	}
+	sh := s.sharding
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	for name := range sh.owned {
+		_ = sh.leases.Release(ctx, name, sh.instanceID)
+	}
+	sh.owned = map[string]bool{}
+}
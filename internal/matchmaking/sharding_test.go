@@ -0,0 +1,202 @@
+package matchmaking
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var shardedQueues = []QueueConfig{
+	{Name: "duel", Mode: "duel", TeamSize: 1, TeamCount: 2},
+	{Name: "duos", Mode: "battle", TeamSize: 2, TeamCount: 2},
+	{Name: "squads", Mode: "battle", TeamSize: 4, TeamCount: 2},
+	{Name: "ranked", Mode: "duel", TeamSize: 1, TeamCount: 2},
+}
+
+func newShardedService(leases *fakeQueueLeases, instanceID string) *Service {
+	svc := NewService(&fakeRedisQueue{}, &fakePublisher{}).
+		WithQueues(shardedQueues).
+		WithSharding(leases, instanceID)
+	svc.now = func() time.Time { return *leases.now }
+	return svc
+}
+
+func TestShardingSplitsQueuesBetweenReplicas(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	leases := newFakeQueueLeases(&now)
+	first := newShardedService(leases, "mm-1")
+	second := newShardedService(leases, "mm-2")
+
+	// Alone, the first replica works every queue.
+	if err := first.ProcessOnce(ctx); err != nil || len(first.OwnedQueues()) != 4 {
+		t.Fatalf("expected the only replica to own every queue, got %v (%v)", first.OwnedQueues(), err)
+	}
+	// Once the second replica shows up, the first gives up its surplus and the second takes it.
+	for i := 0; i < 2; i++ {
+		now = now.Add(time.Second)
+		if err := second.ProcessOnce(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if err := first.ProcessOnce(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(first.OwnedQueues()) != 2 || len(second.OwnedQueues()) != 2 {
+		t.Fatalf("expected a 2/2 split, got %v and %v", first.OwnedQueues(), second.OwnedQueues())
+	}
+	for _, name := range first.OwnedQueues() {
+		if contains(second.OwnedQueues(), name) {
+			t.Fatalf("queue %s is worked by both replicas", name)
+		}
+	}
+
+	// When the first replica stops, the second takes its queues at once.
+	first.releaseQueues(ctx)
+	now = now.Add(time.Second)
+	if err := second.ProcessOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(second.OwnedQueues()) != 2 {
+		t.Fatalf("the stopped replica still counts as alive until its heartbeat runs out, got %v", second.OwnedQueues())
+	}
+	now = now.Add(ShardLeaseTTL)
+	if err := second.ProcessOnce(ctx); err != nil || len(second.OwnedQueues()) != 4 {
+		t.Fatalf("expected the remaining replica to own every queue, got %v (%v)", second.OwnedQueues(), err)
+	}
+}
+
+func TestShardingTakesOverAfterLeaseExpires(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	leases := newFakeQueueLeases(&now)
+	crashed := newShardedService(leases, "mm-1")
+	survivor := newShardedService(leases, "mm-2")
+	if err := crashed.ProcessOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := survivor.ProcessOnce(ctx); err != nil || len(survivor.OwnedQueues()) != 0 {
+		t.Fatalf("expected no free queues while the first replica holds them, got %v (%v)", survivor.OwnedQueues(), err)
+	}
+
+	// The first replica dies without releasing; its leases run out on their own.
+	now = now.Add(ShardLeaseTTL - time.Second)
+	_ = survivor.ProcessOnce(ctx)
+	if len(survivor.OwnedQueues()) != 0 {
+		t.Fatalf("leases must hold until they end, got %v", survivor.OwnedQueues())
+	}
+	now = now.Add(time.Second)
+	if err := survivor.ProcessOnce(ctx); err != nil || len(survivor.OwnedQueues()) != 4 {
+		t.Fatalf("expected the survivor to take over every queue, got %v (%v)", survivor.OwnedQueues(), err)
+	}
+
+	// A replica that cannot heartbeat stops working queues rather than risk working them twice.
+	leases.err = errors.New("redis down")
+	if err := survivor.ProcessOnce(ctx); err == nil || len(survivor.OwnedQueues()) != 0 {
+		t.Fatalf("expected no queues without a heartbeat, got %v (%v)", survivor.OwnedQueues(), err)
+	}
+}
+
+func TestHTTPWorkersAndMetrics(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	leases := newFakeQueueLeases(&now)
+	svc := newShardedService(leases, "mm-1")
+	if err := svc.ProcessOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	leases.owners["squads"] = "mm-2"
+	svc.sharding.owned["squads"] = false
+	mux := http.NewServeMux()
+	NewHandler(svc, nil).Register(mux)
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/matchmaking/workers", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"instance_id":"mm-1"`) || !strings.Contains(rr.Body.String(), `{"queue":"squads","owner":"mm-2","owned":false}`) {
+		t.Fatalf("unexpected workers response %d %s", rr.Code, rr.Body.String())
+	}
+
+	var metrics bytes.Buffer
+	svc.WriteMetrics(&metrics, "matchmaking")
+	for _, want := range []string{
+		`pcgb_matchmaking_queue_owned{service="matchmaking",instance="mm-1",queue="duel"} 1`,
+		`pcgb_matchmaking_queue_owned{service="matchmaking",instance="mm-1",queue="squads"} 0`,
+	} {
+		if !strings.Contains(metrics.String(), want) {
+			t.Fatalf("expected %s in metrics:\n%s", want, metrics.String())
+		}
+	}
+
+	leases.err = errors.New("redis down")
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/matchmaking/workers", nil))
+	if rr.Code != http.StatusServiceUnavailable || !strings.Contains(rr.Body.String(), "leases_unavailable") {
+		t.Fatalf("unexpected workers response %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+// fakeQueueLeases is shared by the services of a test, the way replicas share Redis.
+type fakeQueueLeases struct {
+	now       *time.Time
+	err       error
+	instances map[string]time.Time
+	owners    map[string]string
+	expires   map[string]time.Time
+}
+
+func newFakeQueueLeases(now *time.Time) *fakeQueueLeases {
+	return &fakeQueueLeases{now: now, instances: map[string]time.Time{}, owners: map[string]string{}, expires: map[string]time.Time{}}
+}
+
+func (f *fakeQueueLeases) Heartbeat(_ context.Context, instanceID string, now time.Time, ttl time.Duration) (int, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+	for id, until := range f.instances {
+		if !until.After(now) {
+			delete(f.instances, id)
+		}
+	}
+	f.instances[instanceID] = now.Add(ttl)
+	return len(f.instances), nil
+}
+
+func (f *fakeQueueLeases) Acquire(_ context.Context, queue, instanceID string, ttl time.Duration) (bool, error) {
+	if f.err != nil {
+		return false, f.err
+	}
+	if owner, ok := f.owners[queue]; ok && owner != instanceID && f.expires[queue].After(*f.now) {
+		return false, nil
+	}
+	f.owners[queue], f.expires[queue] = instanceID, f.now.Add(ttl)
+	return true, nil
+}
+
+func (f *fakeQueueLeases) Release(_ context.Context, queue, instanceID string) error {
+	if f.owners[queue] == instanceID {
+		delete(f.owners, queue)
+		delete(f.expires, queue)
+	}
+	return nil
+}
+
+func (f *fakeQueueLeases) Owners(_ context.Context, queues []string) (map[string]string, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	owners := map[string]string{}
+	for _, q := range queues {
+		if owner, ok := f.owners[q]; ok {
+			owners[q] = owner
+		}
+	}
+	return owners, nil
+}
@@ -0,0 +1,295 @@
+package matchmaking
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// StatsWindow is how far back match rates and wait percentiles look.
+	StatsWindow = 10 * time.Minute
+	// QueueStatusInterval is how often waiting players are told how long they have waited and may still
+	// wait.
+	QueueStatusInterval = 15 * time.Second
+	// maxWaitSamples bounds the waits kept per queue; the oldest are dropped first.
+	maxWaitSamples = 10000
+)
+
+// QueueStats describes a queue as of the matcher's last pass over it. Players and Tickets count who
+// was left waiting; the rate and wait percentiles cover tickets matched within StatsWindow.
+type QueueStats struct {
+	Queue            string          `json:"queue"`
+	Mode             string          `json:"mode"`
+	Players          int             `json:"players"`
+	Tickets          int             `json:"tickets"`
+	MatchesPerMinute float64         `json:"matches_per_minute"`
+	WaitSeconds      WaitPercentiles `json:"wait_seconds"`
+	// Samples is how many matched tickets the percentiles are drawn from.
+	Samples   int       `json:"samples"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// WaitPercentiles are how long matched tickets waited, in seconds.
+type WaitPercentiles struct {
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P99 float64 `json:"p99"`
+}
+
+// EstimatedWait is how much longer a ticket that has waited for waited is likely to wait: the time to
+// the first wait percentile it has not reached yet. It reports false when there is no recent match to
+// go by, or the ticket has already waited longer than nearly everyone matched.
+func (q QueueStats) EstimatedWait(waited time.Duration) (time.Duration, bool) {
+	if q.Samples == 0 {
+		return 0, false
+	}
+	for _, p := range []float64{q.WaitSeconds.P50, q.WaitSeconds.P90, q.WaitSeconds.P99} {
+		if d := time.Duration(p * float64(time.Second)); d > waited {
+			return d - waited, true
+		}
+	}
+	return 0, false
+}
+
+// queueStatusMessage periodically tells each waiting player about their ticket.
+type queueStatusMessage struct {
+	Type                 string `json:"type"`
+	TicketID             string `json:"ticket_id"`
+	Queue                string `json:"queue"`
+	WaitedSeconds        int    `json:"waited_seconds"`
+	EstimatedWaitSeconds *int   `json:"estimated_wait_seconds,omitempty"`
+	Players              int    `json:"players"`
+}
+
+// statsTracker keeps the recent matches of the queues this replica works.
+type statsTracker struct {
+	mu     sync.Mutex
+	queues map[string]*queueTracker
+}
+
+type queueTracker struct {
+	since    time.Time
+	matches  []time.Time
+	waits    []waitSample
+	last     QueueStats
+	lastPush time.Time
+}
+
+type waitSample struct {
+	at   time.Time
+	wait time.Duration
+}
+
+func newStatsTracker() *statsTracker {
+	return &statsTracker{queues: map[string]*queueTracker{}}
+}
+
+// queue returns the tracker for name; callers hold mu.
+func (st *statsTracker) queue(name string, now time.Time) *queueTracker {
+	q, ok := st.queues[name]
+	if !ok {
+		// The first pushes go out one interval after the replica starts working the queue.
+		q = &queueTracker{since: now, lastPush: now}
+		st.queues[name] = q
+	}
+	return q
+}
+
+// recordMatched records how long tickets waited before being matched at now. newMatch is false for
+// tickets that joined a running session.
+func (st *statsTracker) recordMatched(queue string, tickets []Ticket, now time.Time, newMatch bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	q := st.queue(queue, now)
+	if newMatch {
+		q.matches = append(q.matches, now)
+	}
+	for _, t := range tickets {
+		q.waits = append(q.waits, waitSample{at: now, wait: now.Sub(t.EnqueuedAt)})
+	}
+	if over := len(q.waits) - maxWaitSamples; over > 0 {
+		q.waits = append(q.waits[:0:0], q.waits[over:]...)
+	}
+}
+
+// update computes cfg's stats at now with waiting left in the queue, and reports whether waiting
+// players are due a queue_status push.
+func (st *statsTracker) update(cfg QueueConfig, waiting []Ticket, now time.Time) (QueueStats, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	q := st.queue(cfg.Name, now)
+	cutoff := now.Add(-StatsWindow)
+	for len(q.matches) > 0 && q.matches[0].Before(cutoff) {
+		q.matches = q.matches[1:]
+	}
+	for len(q.waits) > 0 && q.waits[0].at.Before(cutoff) {
+		q.waits = q.waits[1:]
+	}
+
+	stats := QueueStats{Queue: cfg.Name, Mode: cfg.Mode, Tickets: len(waiting), Samples: len(q.waits), UpdatedAt: now}
+	for _, t := range waiting {
+		stats.Players += t.Size()
+	}
+	// A replica that only just took the queue over has seen less than a full window.
+	span := math.Max(math.Min(now.Sub(q.since).Minutes(), StatsWindow.Minutes()), 1)
+	stats.MatchesPerMinute = float64(len(q.matches)) / span
+	if len(q.waits) > 0 {
+		waits := make([]float64, len(q.waits))
+		for i, sample := range q.waits {
+			waits[i] = sample.wait.Seconds()
+		}
+		sort.Float64s(waits)
+		stats.WaitSeconds = WaitPercentiles{P50: percentile(waits, 0.5), P90: percentile(waits, 0.9), P99: percentile(waits, 0.99)}
+	}
+	q.last = stats
+
+	due := now.Sub(q.lastPush) >= QueueStatusInterval
+	if due {
+		q.lastPush = now
+	}
+	return stats, due
+}
+
+// snapshots returns the last stats computed per queue.
+func (st *statsTracker) snapshots() map[string]QueueStats {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	out := make(map[string]QueueStats, len(st.queues))
+	for name, q := range st.queues {
+		if !q.last.UpdatedAt.IsZero() {
+			out[name] = q.last
+		}
+	}
+	return out
+}
+
+// percentile returns the nearest-rank p-th percentile of sorted.
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+// WithStatsStore shares queue stats between replicas, so that any of them can report on queues worked
+// by another. Without it each replica reports what it has seen itself.
+func (s *Service) WithStatsStore(store StatsStore) *Service {
+	s.statsStore = store
+	return s
+}
+
+// QueueStats returns the stats of every queue in configuration order. A queue nobody has worked yet
+// has only its name and mode set.
+func (s *Service) QueueStats(ctx context.Context) ([]QueueStats, error) {
+	latest := s.stats.snapshots()
+	if s.statsStore != nil {
+		shared, err := s.statsStore.Load(ctx, s.order)
+		if err != nil {
+			return nil, err
+		}
+		for name, stats := range shared {
+			if stats.UpdatedAt.After(latest[name].UpdatedAt) {
+				latest[name] = stats
+			}
+		}
+	}
+	out := make([]QueueStats, 0, len(s.order))
+	for _, name := range s.order {
+		stats, ok := latest[name]
+		if !ok {
+			stats = QueueStats{Queue: name, Mode: s.queues[name].Mode}
+		}
+		out = append(out, stats)
+	}
+	return out, nil
+}
+
+// EstimatedWait is how much longer t is likely to wait in its queue; see QueueStats.EstimatedWait.
+func (s *Service) EstimatedWait(ctx context.Context, t Ticket) (time.Duration, bool, error) {
+	all, err := s.QueueStats(ctx)
+	if err != nil {
+		return 0, false, err
+	}
+	for _, stats := range all {
+		if stats.Queue == t.Queue {
+			wait, ok := stats.EstimatedWait(s.now().Sub(t.EnqueuedAt))
+			return wait, ok, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// updateStats refreshes cfg's stats after a pass, shares them, and every QueueStatusInterval tells each
+// waiting player where their ticket stands.
+func (s *Service) updateStats(ctx context.Context, cfg QueueConfig, waiting []Ticket, now time.Time) error {
+	stats, due := s.stats.update(cfg, waiting, now)
+	if s.statsStore != nil {
+		if err := s.statsStore.Save(ctx, stats); err != nil {
+			return err
+		}
+	}
+	if !due || len(waiting) == 0 {
+		return nil
+	}
+	corrID, err := s.newID()
+	if err != nil {
+		return err
+	}
+	for _, t := range waiting {
+		waited := now.Sub(t.EnqueuedAt)
+		message := queueStatusMessage{Type: "queue_status", TicketID: t.ID, Queue: cfg.Name, WaitedSeconds: int(waited.Seconds()), Players: stats.Players}
+		if estimate, ok := stats.EstimatedWait(waited); ok {
+			seconds := int(math.Ceil(estimate.Seconds()))
+			message.EstimatedWaitSeconds = &seconds
+		}
+		for _, userID := range t.Players() {
+			if err := s.sendToUser(corrID, userID, message); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeQueueStats writes, in Prometheus text format, the stats of the queues this replica works.
+// Queues worked elsewhere are left to their owner, so that summing over replicas counts each once.
+func (s *Service) writeQueueStats(w io.Writer, serviceName string) {
+	latest := s.stats.snapshots()
+	var owned []QueueStats
+	for _, name := range s.OwnedQueues() {
+		if stats, ok := latest[name]; ok {
+			owned = append(owned, stats)
+		}
+	}
+	gauges := []struct {
+		name, help string
+		value      func(QueueStats) float64
+	}{
+		{"pcgb_matchmaking_queue_players", "Players waiting in the queue.", func(q QueueStats) float64 { return float64(q.Players) }},
+		{"pcgb_matchmaking_queue_tickets", "Tickets waiting in the queue.", func(q QueueStats) float64 { return float64(q.Tickets) }},
+		{"pcgb_matchmaking_matches_per_minute", "Matches formed per minute over the stats window.", func(q QueueStats) float64 { return q.MatchesPerMinute }},
+	}
+	for _, g := range gauges {
+		_, _ = fmt.Fprintf(w, "# HELP %s %s\n", g.name, g.help)
+		_, _ = fmt.Fprintf(w, "# TYPE %s gauge\n", g.name)
+		for _, q := range owned {
+			_, _ = fmt.Fprintf(w, "%s{service=%q,queue=%q} %g\n", g.name, serviceName, q.Queue, g.value(q))
+		}
+	}
+	_, _ = fmt.Fprintf(w, "# HELP pcgb_matchmaking_wait_seconds How long tickets matched over the stats window waited.\n")
+	_, _ = fmt.Fprintf(w, "# TYPE pcgb_matchmaking_wait_seconds gauge\n")
+	for _, q := range owned {
+		for _, p := range []struct {
+			quantile string
+			value    float64
+		}{{"0.5", q.WaitSeconds.P50}, {"0.9", q.WaitSeconds.P90}, {"0.99", q.WaitSeconds.P99}} {
+			_, _ = fmt.Fprintf(w, "pcgb_matchmaking_wait_seconds{service=%q,queue=%q,quantile=%q} %g\n", serviceName, q.Queue, p.quantile, p.value)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package matchmaking
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/login"
+)
+
+func TestEstimatedWait(t *testing.T) {
+	t.Parallel()
+	stats := QueueStats{Samples: 40, WaitSeconds: WaitPercentiles{P50: 10, P90: 30, P99: 60}}
+	tests := []struct {
+		name   string
+		stats  QueueStats
+		waited time.Duration
+		want   time.Duration
+		ok     bool
+	}{
+		{"no recent matches", QueueStats{}, 0, 0, false},
+		{"new ticket expects the median", stats, 0, 10 * time.Second, true},
+		{"past the median expects the 90th percentile", stats, 20 * time.Second, 10 * time.Second, true},
+		{"past the 90th percentile expects the 99th", stats, 45 * time.Second, 15 * time.Second, true},
+		{"past nearly everyone has no estimate", stats, 90 * time.Second, 0, false},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			got, ok := tc.stats.EstimatedWait(tc.waited)
+			if got != tc.want || ok != tc.ok {
+				t.Fatalf("expected %v %v, got %v %v", tc.want, tc.ok, got, ok)
+			}
+		})
+	}
+}
+
+func TestQueueStatsEndpointsAndPushes(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	publisher := &fakePublisher{}
+	svc := NewService(&fakeRedisQueue{}, publisher).WithQueues([]QueueConfig{{Name: "duel", Mode: "duel", TeamSize: 1, TeamCount: 2}})
+	svc.now = func() time.Time { return now }
+	auth := login.NewAuthenticator("test-secret", time.Hour)
+	mux := http.NewServeMux()
+	NewHandler(svc, auth).Register(mux)
+	token, _ := auth.GenerateToken("c", "player3")
+
+	_, _ = svc.Enqueue(ctx, "a", "duel", "corr")
+	_, _ = svc.Enqueue(ctx, "b", "duel", "corr")
+	now = now.Add(10 * time.Second)
+	if err := svc.ProcessOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/matchmaking/enqueue", strings.NewReader(`{"queue":"duel"}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	var ticket TicketResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &ticket); err != nil || ticket.EstimatedWaitSeconds == nil || *ticket.EstimatedWaitSeconds != 10 {
+		t.Fatalf("expected a 10s estimate, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	publisher.events = nil
+	now = now.Add(QueueStatusInterval)
+	if err := svc.ProcessOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := pushedTypes(t, publisher); !reflect.DeepEqual(got, map[string][]string{"c": {"queue_status"}}) {
+		t.Fatalf("expected c alone to get a queue_status push, got %v", got)
+	}
+
+	for _, step := range []struct {
+		token string
+		code  int
+	}{{"", http.StatusUnauthorized}, {token, http.StatusOK}} {
+		req := httptest.NewRequest(http.MethodGet, "/v1/matchmaking/queues", nil)
+		if step.token != "" {
+			req.Header.Set("Authorization", "Bearer "+step.token)
+		}
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		if rr.Code != step.code {
+			t.Fatalf("expected %d, got %d %s", step.code, rr.Code, rr.Body.String())
+		}
+	}
+	queues, err := svc.QueueStats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := QueueStats{Queue: "duel", Mode: "duel", Players: 1, Tickets: 1, MatchesPerMinute: 1, WaitSeconds: WaitPercentiles{P50: 10, P90: 10, P99: 10}, Samples: 2, UpdatedAt: now}
+	if len(queues) != 1 || !reflect.DeepEqual(queues[0], want) {
+		t.Fatalf("expected %+v, got %+v", want, queues)
+	}
+
+	var metrics bytes.Buffer
+	svc.WriteMetrics(&metrics, "matchmaking")
+	for _, line := range []string{
+		`pcgb_matchmaking_queue_players{service="matchmaking",queue="duel"} 1`,
+		`pcgb_matchmaking_matches_per_minute{service="matchmaking",queue="duel"} 1`,
+		`pcgb_matchmaking_wait_seconds{service="matchmaking",queue="duel",quantile="0.9"} 10`,
+	} {
+		if !strings.Contains(metrics.String(), line) {
+			t.Fatalf("expected %s in metrics:\n%s", line, metrics.String())
+		}
+	}
+}
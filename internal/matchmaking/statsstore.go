@@ -0,0 +1,67 @@
+package matchmaking
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	statsKeyPrefix = "pcgb:mm:stats:"
+	// statsTTL drops the stats of a queue nobody works any more.
+	statsTTL = time.Minute
+)
+
+type StatsStore interface {
+	Save(ctx context.Context, stats QueueStats) error
+	// Load returns the saved stats of each of queues that has any.
+	Load(ctx context.Context, queues []string) (map[string]QueueStats, error)
+}
+
+// RedisStatsStore keeps each queue's latest stats as JSON under its own key.
+type RedisStatsStore struct {
+	client *redis.Client
+}
+
+func NewRedisStatsStore(client *redis.Client) *RedisStatsStore {
+	return &RedisStatsStore{client: client}
+}
+
+func statsKey(queue string) string { return statsKeyPrefix + queue }
+
+func (s *RedisStatsStore) Save(ctx context.Context, stats QueueStats) error {
+	raw, err := json.Marshal(stats)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, statsKey(stats.Queue), raw, statsTTL).Err()
+}
+
+func (s *RedisStatsStore) Load(ctx context.Context, queues []string) (map[string]QueueStats, error) {
+	out := map[string]QueueStats{}
+	if len(queues) == 0 {
+		return out, nil
+	}
+	keys := make([]string, len(queues))
+	for i, queue := range queues {
+		keys[i] = statsKey(queue)
+	}
+	values, err := s.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i, v := range values {
+		raw, ok := v.(string)
+		if !ok {
+			continue
+		}
+		var stats QueueStats
+		if err := json.Unmarshal([]byte(raw), &stats); err != nil {
+			return nil, err
+		}
+		out[queues[i]] = stats
+	}
+	return out, nil
+}
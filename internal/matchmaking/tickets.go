@@ -0,0 +1,144 @@
+package matchmaking
+
+import (
+	"context"
+	"errors"
+
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/contracts"
+)
+
+var (
+	ErrTicketNotActive     = errors.New("ticket is no longer queued")
+	ErrInvalidDeletedEvent = errors.New("invalid user.deleted event")
+)
+
+// ticketStatusMessage tells a player over the gateway that one of their tickets changed status.
+// Matched tickets are announced with match_found instead.
+type ticketStatusMessage struct {
+	Type     string `json:"type"`
+	TicketID string `json:"ticket_id"`
+	Queue    string `json:"queue"`
+	Status   string `json:"status"`
+}
+
+// GetTicket returns a ticket userID is queued on, solo or with a party. Other tickets are reported as
+// not found.
+func (s *Service) GetTicket(ctx context.Context, userID, ticketID string) (Ticket, error) {
+	ticket, err := s.queue.Ticket(ctx, ticketID)
+	if err != nil {
+		return Ticket{}, err
+	}
+	if !ticket.HasPlayer(userID) {
+		return Ticket{}, ErrTicketNotFound
+	}
+	return ticket, nil
+}
+
+// CancelTicket takes userID's ticket out of its queue. Any member of a party may cancel the party's
+// ticket. It fails with ErrTicketNotActive once the ticket has been matched, cancelled or timed out.
+func (s *Service) CancelTicket(ctx context.Context, userID, ticketID, correlationID string) (Ticket, error) {
+	ticket, err := s.GetTicket(ctx, userID, ticketID)
+	if err != nil {
+		return Ticket{}, err
+	}
+	return s.cancel(ctx, ticket, correlationID)
+}
+
+func (s *Service) cancel(ctx context.Context, ticket Ticket, correlationID string) (Ticket, error) {
+	if ticket.Status != TicketQueued {
+		return ticket, ErrTicketNotActive
+	}
+	claimed, err := s.queue.Claim(ctx, ticket.Queue, []Ticket{ticket}, s.now().Add(claimLease))
+	if err != nil {
+		return Ticket{}, err
+	}
+	if !claimed {
+		return ticket, ErrTicketNotActive
+	}
+	if err := s.queue.Finish(ctx, []Ticket{ticket}, TicketCancelled, ""); err != nil {
+		return Ticket{}, err
+	}
+	ticket.Status = TicketCancelled
+	return ticket, s.pushTicketStatus(correlationID, ticket)
+}
+
+// HandleUserDeleted takes a deleted account out of matchmaking: the user leaves their party, a
+// pending ready-check is declined for them and a queued ticket is cancelled.
+func (s *Service) HandleUserDeleted(ctx context.Context, data []byte) error {
+	env, err := contracts.UnmarshalEnvelope(data)
+	if err != nil {
+		return err
+	}
+	if env.Type != contracts.EventUserDeleted {
+		return nil
+	}
+	if env.UserID == nil || *env.UserID == "" {
+		return ErrInvalidDeletedEvent
+	}
+	userID, correlationID := *env.UserID, env.CorrelationID
+	if s.parties != nil {
+		party, err := s.parties.PartyOf(ctx, userID)
+		if err == nil {
+			_, err = s.LeaveParty(ctx, userID, party.ID, correlationID)
+		}
+		if err != nil && !errors.Is(err, ErrNotInParty) {
+			return err
+		}
+	}
+	ticket, err := s.queue.ActiveTicket(ctx, userID)
+	if errors.Is(err, ErrTicketNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if ticket.Status == TicketProposed && s.readyChecks != nil {
+		_, err := s.DeclineMatch(ctx, userID, ticket.MatchID, correlationID)
+		if errors.Is(err, ErrProposalNotFound) {
+			return nil
+		}
+		return err
+	}
+	if _, err := s.cancel(ctx, ticket, correlationID); err != nil && !errors.Is(err, ErrTicketNotActive) {
+		return err
+	}
+	return nil
+}
+
+// timeOut drops a ticket that waited past its queue's timeout and publishes matchmaking.timed_out. The
+// ticket is only finished once the event is out.
+func (s *Service) timeOut(ctx context.Context, ticket Ticket) error {
+	claimed, err := s.queue.Claim(ctx, ticket.Queue, []Ticket{ticket}, s.now().Add(claimLease))
+	if err != nil || !claimed {
+		return err
+	}
+
+	eventID, err := s.newID()
+	if err != nil {
+		return err
+	}
+	payload := contracts.MatchmakingTimedOutV1{TicketID: ticket.ID, Queue: ticket.Queue, WaitedSeconds: int(s.now().Sub(ticket.EnqueuedAt).Seconds())}
+	raw, err := contracts.MarshalV1(eventID, contracts.EventMatchmakingTimedOut, s.now(), eventID, &ticket.UserID, payload)
+	if err != nil {
+		return err
+	}
+	if err := s.publisher.Publish(contracts.SubjectMatchmakingTimedOut, raw); err != nil {
+		return err
+	}
+	if err := s.queue.Finish(ctx, []Ticket{ticket}, TicketTimedOut, ""); err != nil {
+		return err
+	}
+	ticket.Status = TicketTimedOut
+	return s.pushTicketStatus(eventID, ticket)
+}
+
+// pushTicketStatus tells every player on ticket its current status.
+func (s *Service) pushTicketStatus(correlationID string, ticket Ticket) error {
+	message := ticketStatusMessage{Type: "ticket_status", TicketID: ticket.ID, Queue: ticket.Queue, Status: ticket.Status}
+	for _, userID := range ticket.Players() {
+		if err := s.sendToUser(correlationID, userID, message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package matchmaking
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/contracts"
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/login"
+)
+
+func TestTicketLifecycle(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	queue := &fakeRedisQueue{}
+	svc := NewService(queue, &fakePublisher{}).WithQueues([]QueueConfig{
+		{Name: "duel", Mode: "duel", TeamSize: 1, TeamCount: 2},
+		{Name: "squads", Mode: "battle", TeamSize: 2, TeamCount: 2},
+	})
+
+	first, err := svc.Enqueue(ctx, "u-1", "duel", "corr")
+	if err != nil || first.ID == "" || first.Status != TicketQueued {
+		t.Fatalf("unexpected ticket %+v (%v)", first, err)
+	}
+	again, err := svc.Enqueue(ctx, "u-1", "duel", "corr")
+	if err != nil || again.ID != first.ID {
+		t.Fatalf("re-enqueueing the same queue should return the same ticket, got %+v (%v)", again, err)
+	}
+	if len(queue.waiting("duel")) != 1 {
+		t.Fatalf("expected a single ticket in the queue, got %v", queue.waiting("duel"))
+	}
+	if other, err := svc.Enqueue(ctx, "u-1", "squads", "corr"); !errors.Is(err, ErrAlreadyQueued) || other.ID != first.ID {
+		t.Fatalf("expected ErrAlreadyQueued with the active ticket, got %+v (%v)", other, err)
+	}
+
+	if _, err := svc.GetTicket(ctx, "u-2", first.ID); !errors.Is(err, ErrTicketNotFound) {
+		t.Fatalf("another player's ticket must not be visible, got %v", err)
+	}
+	if _, err := svc.CancelTicket(ctx, "u-2", first.ID, "corr"); !errors.Is(err, ErrTicketNotFound) {
+		t.Fatalf("another player's ticket must not be cancellable, got %v", err)
+	}
+	cancelled, err := svc.CancelTicket(ctx, "u-1", first.ID, "corr")
+	if err != nil || cancelled.Status != TicketCancelled || len(queue.waiting("duel")) != 0 {
+		t.Fatalf("unexpected cancel result %+v (%v)", cancelled, err)
+	}
+	if _, err := svc.CancelTicket(ctx, "u-1", first.ID, "corr"); !errors.Is(err, ErrTicketNotActive) {
+		t.Fatalf("expected ErrTicketNotActive, got %v", err)
+	}
+	if got, err := svc.GetTicket(ctx, "u-1", first.ID); err != nil || got.Status != TicketCancelled {
+		t.Fatalf("expected the cancelled ticket to stay readable, got %+v (%v)", got, err)
+	}
+	if next, err := svc.Enqueue(ctx, "u-1", "squads", "corr"); err != nil || next.ID == first.ID {
+		t.Fatalf("expected a fresh ticket after cancelling, got %+v (%v)", next, err)
+	}
+}
+
+func TestTicketTimeout(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	queue := &fakeRedisQueue{}
+	publisher := &fakePublisher{}
+	svc := NewService(queue, publisher).WithQueues([]QueueConfig{{Name: "duel", Mode: "duel", TeamSize: 1, TeamCount: 2, TicketTimeoutSeconds: 60}})
+	svc.now = func() time.Time { return now }
+	ticket, err := svc.Enqueue(ctx, "u-1", "duel", "corr")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publisher.events = nil
+	now = now.Add(59 * time.Second)
+	if err := svc.ProcessOnce(ctx); err != nil || len(publisher.events) != 0 {
+		t.Fatalf("ticket should still be waiting: %d events (%v)", len(publisher.events), err)
+	}
+	now = now.Add(time.Second)
+	if err := svc.ProcessOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(publisher.events) != 2 || publisher.events[0].subject != contracts.SubjectMatchmakingTimedOut || publisher.events[1].subject != contracts.SubjectGatewaySendToUser {
+		t.Fatalf("expected a timed_out event and a status push, got %+v", publisher.events)
+	}
+	env, err := contracts.UnmarshalEnvelope(publisher.events[1].data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var send contracts.GatewaySendToUserV1
+	if err := json.Unmarshal(env.Payload, &send); err != nil {
+		t.Fatal(err)
+	}
+	var status ticketStatusMessage
+	if err := json.Unmarshal(send.Message, &status); err != nil || status.Type != "ticket_status" || status.Status != TicketTimedOut || status.TicketID != ticket.ID {
+		t.Fatalf("unexpected status push %s (%v)", send.Message, err)
+	}
+	if got, _ := svc.GetTicket(ctx, "u-1", ticket.ID); got.Status != TicketTimedOut {
+		t.Fatalf("expected the ticket to be timed out, got %+v", got)
+	}
+}
+
+func TestHTTPTicketEndpoints(t *testing.T) {
+	t.Parallel()
+	svc := NewService(&fakeRedisQueue{}, &fakePublisher{})
+	auth := login.NewAuthenticator("test-secret", time.Hour)
+	mux := http.NewServeMux()
+	NewHandler(svc, auth).Register(mux)
+	owner, _ := auth.GenerateToken("u-1", "player1")
+	stranger, _ := auth.GenerateToken("u-2", "player2")
+
+	do := func(method, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := do(http.MethodPost, "/v1/matchmaking/enqueue", owner)
+	var created TicketResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil || rr.Code != http.StatusAccepted || created.TicketID == "" || created.Status != TicketQueued {
+		t.Fatalf("unexpected enqueue response %d %s", rr.Code, rr.Body.String())
+	}
+	path := "/v1/matchmaking/tickets/" + created.TicketID
+	steps := []struct {
+		method string
+		token  string
+		code   int
+		want   string
+	}{
+		{http.MethodGet, owner, http.StatusOK, `"status":"queued"`},
+		{http.MethodGet, stranger, http.StatusNotFound, "ticket_not_found"},
+		{http.MethodDelete, stranger, http.StatusNotFound, "ticket_not_found"},
+		{http.MethodDelete, owner, http.StatusOK, `"status":"cancelled"`},
+		{http.MethodDelete, owner, http.StatusConflict, "ticket_not_active"},
+		{http.MethodPut, owner, http.StatusMethodNotAllowed, "method_not_allowed"},
+	}
+	for _, step := range steps {
+		rr := do(step.method, path, step.token)
+		if rr.Code != step.code || !strings.Contains(rr.Body.String(), step.want) {
+			t.Fatalf("%s %s: expected %d %s, got %d %s", step.method, path, step.code, step.want, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+func TestDeletedUserLeavesMatchmaking(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	queue := &fakeRedisQueue{}
+	svc := NewService(queue, &fakePublisher{}).
+		WithQueues([]QueueConfig{{Name: "squads", Mode: "battle", TeamSize: 2, TeamCount: 2}}).
+		WithParties(newFakePartyStore())
+	deleted := func(userID string) []byte {
+		t.Helper()
+		raw, err := contracts.MarshalV1("evt-"+userID, contracts.EventUserDeleted, time.Now().UTC(), "corr", &userID, contracts.UserDeletedV1{Reason: "user_request"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return raw
+	}
+
+	solo, err := svc.Enqueue(ctx, "solo", "squads", "corr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.HandleUserDeleted(ctx, deleted("solo")); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := queue.Ticket(ctx, solo.ID); got.Status != TicketCancelled {
+		t.Fatalf("expected the solo ticket to be cancelled, got %+v", got)
+	}
+
+	party, _ := svc.CreateParty(ctx, "lead", "corr")
+	_, _ = svc.Invite(ctx, "lead", party.ID, "mate", "corr")
+	if _, err := svc.AcceptInvite(ctx, "mate", party.ID, "corr"); err != nil {
+		t.Fatal(err)
+	}
+	queued, err := svc.Enqueue(ctx, "lead", "squads", "corr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.HandleUserDeleted(ctx, deleted("mate")); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := svc.Party(ctx, "lead"); len(got.Members) != 1 || got.Members[0] != "lead" {
+		t.Fatalf("expected the deleted member to leave the party, got %+v", got)
+	}
+	if got, _ := queue.Ticket(ctx, queued.ID); got.Status != TicketCancelled {
+		t.Fatalf("expected the party ticket to be cancelled, got %+v", got)
+	}
+
+	if err := svc.HandleUserDeleted(ctx, deleted("nobody")); err != nil {
+		t.Fatalf("a user outside matchmaking should be ignored, got %v", err)
+	}
+	raw, _ := contracts.MarshalV1("evt-x", contracts.EventUserDeleted, time.Now().UTC(), "corr", nil, contracts.UserDeletedV1{})
+	if err := svc.HandleUserDeleted(ctx, raw); !errors.Is(err, ErrInvalidDeletedEvent) {
+		t.Fatalf("expected ErrInvalidDeletedEvent, got %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+// Package mmsim replays a stream of matchmaking tickets through matchmaking.Service on a simulated
+// clock and reports how well, how fast and how fairly they were matched.
+package mmsim
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+)
+
+// Arrival is one ticket entering a queue At seconds into the stream. Members lists a party's players,
+// leader first; a solo ticket only sets UserID.
+type Arrival struct {
+	At         float64           `json:"at"`
+	UserID     string            `json:"user_id"`
+	Members    []string          `json:"members,omitempty"`
+	Queue      string            `json:"queue"`
+	Rating     float64           `json:"rating"`
+	Pings      map[string]int    `json:"pings,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Blocked    []string          `json:"blocked,omitempty"`
+}
+
+func (a Arrival) players() []string {
+	if len(a.Members) == 0 {
+		return []string{a.UserID}
+	}
+	return a.Members
+}
+
+// ReadArrivals reads one JSON arrival per line. Blank lines are skipped; arrivals need not be in order.
+func ReadArrivals(r io.Reader) ([]Arrival, error) {
+	var arrivals []Arrival
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var a Arrival
+		if err := json.Unmarshal(scanner.Bytes(), &a); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if a.UserID == "" || a.At < 0 {
+			return nil, fmt.Errorf("line %d: an arrival needs a user_id and a non-negative at", line)
+		}
+		arrivals = append(arrivals, a)
+	}
+	return arrivals, scanner.Err()
+}
+
+// WriteArrivals writes arrivals in the format ReadArrivals reads, so a synthetic stream can be kept
+// and replayed against other queue settings.
+func WriteArrivals(w io.Writer, arrivals []Arrival) error {
+	enc := json.NewEncoder(w)
+	for _, a := range arrivals {
+		if err := enc.Encode(a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Synthetic describes generated traffic: Tickets arrivals into Queue at PerSecond on average, with
+// normally distributed ratings. PartyRate of the tickets are parties of 2 up to MaxPartySize. Each
+// player gets a ping to every one of Regions, lowest to a home region picked at random.
+type Synthetic struct {
+	Tickets      int
+	PerSecond    float64
+	Queue        string
+	RatingMean   float64
+	RatingStdDev float64
+	PartyRate    float64
+	MaxPartySize int
+	Regions      []string
+	Seed         int64
+}
+
+// Generate returns the synthetic stream. The same settings and seed always give the same stream.
+func (s Synthetic) Generate() ([]Arrival, error) {
+	if s.Tickets <= 0 || s.PerSecond <= 0 || s.Queue == "" {
+		return nil, errors.New("synthetic traffic needs a positive ticket count and rate, and a queue")
+	}
+	if s.PartyRate < 0 || s.PartyRate > 1 {
+		return nil, errors.New("party rate must be between 0 and 1")
+	}
+	rng := rand.New(rand.NewSource(s.Seed))
+	arrivals := make([]Arrival, 0, s.Tickets)
+	at, player := 0.0, 0
+	nextPlayer := func() string {
+		player++
+		return "sim-" + strconv.Itoa(player)
+	}
+	for i := 0; i < s.Tickets; i++ {
+		at += rng.ExpFloat64() / s.PerSecond
+		a := Arrival{At: math.Round(at*1000) / 1000, UserID: nextPlayer(), Queue: s.Queue, Rating: math.Round(s.RatingMean + rng.NormFloat64()*s.RatingStdDev)}
+		if s.MaxPartySize >= 2 && rng.Float64() < s.PartyRate {
+			a.Members = []string{a.UserID}
+			for size := 2 + rng.Intn(s.MaxPartySize-1); len(a.Members) < size; {
+				a.Members = append(a.Members, nextPlayer())
+			}
+		}
+		if len(s.Regions) > 0 {
+			home := rng.Intn(len(s.Regions))
+			a.Pings = make(map[string]int, len(s.Regions))
+			for j, region := range s.Regions {
+				// Roughly 20-60ms at home and 80-200ms elsewhere.
+				ping := 80 + rng.Intn(121)
+				if j == home {
+					ping = 20 + rng.Intn(41)
+				}
+				a.Pings[region] = ping
+			}
+		}
+		arrivals = append(arrivals, a)
+	}
+	sort.SliceStable(arrivals, func(i, j int) bool { return arrivals[i].At < arrivals[j].At })
+	return arrivals, nil
+}
@@ -0,0 +1,257 @@
+package mmsim
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/matchmaking"
+)
+
+// ratingBand is the width of the rating groups in the fairness report.
+const ratingBand = 200
+
+// Report is the outcome of a simulation, queue by queue.
+type Report struct {
+	SimulatedSeconds float64       `json:"simulated_seconds"`
+	Rejected         int           `json:"rejected"`
+	Queues           []QueueReport `json:"queues"`
+}
+
+// QueueReport covers one queue. WaitSeconds is over matched tickets. RatingSpread is the gap between the
+// highest- and lowest-rated ticket of each match, TeamGap the gap between its strongest and weakest
+// team's mean rating, and PingMs the worst ping to its region among players who reported pings.
+type QueueReport struct {
+	Queue        string         `json:"queue"`
+	Tickets      int            `json:"tickets"`
+	Players      int            `json:"players"`
+	Matched      int            `json:"matched"`
+	TimedOut     int            `json:"timed_out"`
+	Waiting      int            `json:"waiting"`
+	Matches      int            `json:"matches"`
+	WaitSeconds  Distribution   `json:"wait_seconds"`
+	RatingSpread Distribution   `json:"rating_spread"`
+	TeamGap      Distribution   `json:"team_gap"`
+	PingMs       Distribution   `json:"ping_ms"`
+	Fairness     []FairnessRow  `json:"fairness"`
+	Regions      map[string]int `json:"regions,omitempty"`
+}
+
+// FairnessRow compares one group of tickets, such as a rating band or party size, with the rest.
+type FairnessRow struct {
+	Group       string       `json:"group"`
+	Tickets     int          `json:"tickets"`
+	Matched     int          `json:"matched"`
+	TimedOut    int          `json:"timed_out"`
+	WaitSeconds Distribution `json:"wait_seconds"`
+}
+
+// Distribution summarises a set of values.
+type Distribution struct {
+	Count int     `json:"count"`
+	Mean  float64 `json:"mean"`
+	P50   float64 `json:"p50"`
+	P90   float64 `json:"p90"`
+	P99   float64 `json:"p99"`
+	Max   float64 `json:"max"`
+}
+
+func newDistribution(values []float64) Distribution {
+	if len(values) == 0 {
+		return Distribution{}
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	total := 0.0
+	for _, v := range sorted {
+		total += v
+	}
+	rank := func(p float64) float64 {
+		i := int(math.Ceil(p*float64(len(sorted)))) - 1
+		if i < 0 {
+			i = 0
+		}
+		return sorted[i]
+	}
+	return Distribution{Count: len(sorted), Mean: total / float64(len(sorted)), P50: rank(0.5), P90: rank(0.9), P99: rank(0.99), Max: sorted[len(sorted)-1]}
+}
+
+func buildReport(queues []matchmaking.QueueConfig, tickets []*simTicket, matches map[string]simMatch, rejected int, simulated time.Duration) Report {
+	report := Report{SimulatedSeconds: simulated.Seconds(), Rejected: rejected}
+	for _, cfg := range queues {
+		var own []*simTicket
+		for _, t := range tickets {
+			if t.arrival.Queue == cfg.Name {
+				own = append(own, t)
+			}
+		}
+		report.Queues = append(report.Queues, queueReport(cfg.Name, own, matches))
+	}
+	return report
+}
+
+func queueReport(name string, tickets []*simTicket, matches map[string]simMatch) QueueReport {
+	q := QueueReport{Queue: name, Tickets: len(tickets)}
+	byMatch := map[string][]*simTicket{}
+	groups := map[fairnessGroup][]*simTicket{}
+	var waits []float64
+	for _, t := range tickets {
+		q.Players += len(t.arrival.players())
+		switch t.status {
+		case matchmaking.TicketMatched:
+			q.Matched++
+			waits = append(waits, t.finishedAt.Sub(t.enqueuedAt).Seconds())
+			byMatch[t.matchID] = append(byMatch[t.matchID], t)
+		case matchmaking.TicketTimedOut:
+			q.TimedOut++
+		default:
+			q.Waiting++
+		}
+		band := int(math.Floor(t.arrival.Rating/ratingBand)) * ratingBand
+		size := len(t.arrival.players())
+		keys := []fairnessGroup{
+			{kind: 0, order: band, name: fmt.Sprintf("rating %d-%d", band, band+ratingBand-1)},
+			{kind: 1, order: size, name: "party of " + strconv.Itoa(size)},
+		}
+		if home := homeRegion(t.arrival.Pings); home != "" {
+			keys = append(keys, fairnessGroup{kind: 2, name: "home " + home})
+		}
+		for _, key := range keys {
+			groups[key] = append(groups[key], t)
+		}
+	}
+	q.WaitSeconds = newDistribution(waits)
+
+	var spreads, gaps, pings []float64
+	for matchID, group := range byMatch {
+		m := matches[matchID]
+		q.Matches++
+		if m.region != "" {
+			if q.Regions == nil {
+				q.Regions = map[string]int{}
+			}
+			q.Regions[m.region]++
+		}
+		low, high := math.Inf(1), math.Inf(-1)
+		rating := map[string]float64{}
+		worstPing := -1
+		for _, t := range group {
+			low, high = math.Min(low, t.arrival.Rating), math.Max(high, t.arrival.Rating)
+			for _, userID := range t.arrival.players() {
+				rating[userID] = t.arrival.Rating
+			}
+			if ping, ok := t.arrival.Pings[m.region]; ok && ping > worstPing {
+				worstPing = ping
+			}
+		}
+		spreads = append(spreads, high-low)
+		if len(m.teams) > 1 {
+			weakest, strongest := math.Inf(1), math.Inf(-1)
+			for _, team := range m.teams {
+				total := 0.0
+				for _, userID := range team {
+					total += rating[userID]
+				}
+				mean := total / float64(len(team))
+				weakest, strongest = math.Min(weakest, mean), math.Max(strongest, mean)
+			}
+			gaps = append(gaps, strongest-weakest)
+		}
+		if worstPing >= 0 {
+			pings = append(pings, float64(worstPing))
+		}
+	}
+	q.RatingSpread, q.TeamGap, q.PingMs = newDistribution(spreads), newDistribution(gaps), newDistribution(pings)
+
+	keys := make([]fairnessGroup, 0, len(groups))
+	for group := range groups {
+		keys = append(keys, group)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.kind != b.kind {
+			return a.kind < b.kind
+		}
+		if a.order != b.order {
+			return a.order < b.order
+		}
+		return a.name < b.name
+	})
+	for _, group := range keys {
+		row := FairnessRow{Group: group.name, Tickets: len(groups[group])}
+		var groupWaits []float64
+		for _, t := range groups[group] {
+			switch t.status {
+			case matchmaking.TicketMatched:
+				row.Matched++
+				groupWaits = append(groupWaits, t.finishedAt.Sub(t.enqueuedAt).Seconds())
+			case matchmaking.TicketTimedOut:
+				row.TimedOut++
+			}
+		}
+		row.WaitSeconds = newDistribution(groupWaits)
+		q.Fairness = append(q.Fairness, row)
+	}
+	return q
+}
+
+// fairnessGroup names a group of tickets. Rating bands come first, then party sizes, then home regions,
+// each in ascending order.
+type fairnessGroup struct {
+	kind  int
+	order int
+	name  string
+}
+
+// homeRegion is the region with the lowest ping, or "" without pings.
+func homeRegion(pings map[string]int) string {
+	home := ""
+	for region, ping := range pings {
+		if home == "" || ping < pings[home] || (ping == pings[home] && region < home) {
+			home = region
+		}
+	}
+	return home
+}
+
+// WriteText writes the report as aligned tables.
+func (r Report) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintf(tw, "simulated %s", time.Duration(r.SimulatedSeconds*float64(time.Second)).Round(time.Second))
+	if r.Rejected > 0 {
+		_, _ = fmt.Fprintf(tw, ", %d arrivals rejected as already queued", r.Rejected)
+	}
+	_, _ = fmt.Fprintln(tw)
+	for _, q := range r.Queues {
+		_, _ = fmt.Fprintf(tw, "\nqueue %s: %d tickets (%d players), %d matched into %d matches, %d timed out, %d still waiting\n",
+			q.Queue, q.Tickets, q.Players, q.Matched, q.Matches, q.TimedOut, q.Waiting)
+		_, _ = fmt.Fprintln(tw, "\tcount\tmean\tp50\tp90\tp99\tmax")
+		for _, row := range []struct {
+			name string
+			d    Distribution
+		}{{"wait (s)", q.WaitSeconds}, {"rating spread", q.RatingSpread}, {"team gap", q.TeamGap}, {"ping (ms)", q.PingMs}} {
+			_, _ = fmt.Fprintf(tw, "%s\t%d\t%.1f\t%.1f\t%.1f\t%.1f\t%.1f\n", row.name, row.d.Count, row.d.Mean, row.d.P50, row.d.P90, row.d.P99, row.d.Max)
+		}
+		if len(q.Regions) > 0 {
+			regions := make([]string, 0, len(q.Regions))
+			for region := range q.Regions {
+				regions = append(regions, region)
+			}
+			sort.Strings(regions)
+			_, _ = fmt.Fprint(tw, "matches by region:")
+			for _, region := range regions {
+				_, _ = fmt.Fprintf(tw, " %s=%d", region, q.Regions[region])
+			}
+			_, _ = fmt.Fprintln(tw)
+		}
+		_, _ = fmt.Fprintln(tw, "\nfairness\ttickets\tmatched\ttimed out\twait p50\twait p90\twait max")
+		for _, row := range q.Fairness {
+			_, _ = fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%.1f\t%.1f\t%.1f\n", row.Group, row.Tickets, row.Matched, row.TimedOut, row.WaitSeconds.P50, row.WaitSeconds.P90, row.WaitSeconds.Max)
+		}
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,147 @@
+package mmsim
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/contracts"
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/matchmaking"
+)
+
+// DefaultStep is how often the simulated matcher runs, as matchmaking's Run does in production.
+const DefaultStep = 2 * time.Second
+
+// simStart is when every simulation's clock starts; arrivals are offsets from it.
+var simStart = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Options configures a simulation. Queues are set up as in MATCHMAKING_QUEUES.
+type Options struct {
+	Queues []matchmaking.QueueConfig
+	Step   time.Duration
+}
+
+type simTicket struct {
+	arrival    Arrival
+	id         string
+	enqueuedAt time.Time
+	status     string
+	matchID    string
+	finishedAt time.Time
+}
+
+type simMatch struct {
+	region string
+	teams  [][]string
+}
+
+// recorder is the service's publisher: it keeps the matches announced and ignores everything else.
+type recorder struct {
+	matches map[string]simMatch
+}
+
+func (r *recorder) Publish(subject string, data []byte) error {
+	if subject != contracts.SubjectMatchmakingMatch {
+		return nil
+	}
+	env, err := contracts.UnmarshalEnvelope(data)
+	if err != nil {
+		return err
+	}
+	var payload contracts.MatchmakingMatchedV1
+	if err := json.Unmarshal(env.Payload, &payload); err != nil {
+		return err
+	}
+	r.matches[payload.MatchID] = simMatch{region: payload.Region, teams: payload.Teams}
+	return nil
+}
+
+// Run enqueues each arrival when the simulated clock reaches it and runs the matcher every step, until
+// every ticket is matched or timed out. Nothing sleeps: a day of traffic replays in seconds.
+func Run(ctx context.Context, opts Options, arrivals []Arrival) (Report, error) {
+	if len(opts.Queues) == 0 {
+		return Report{}, errors.New("simulation needs at least one queue")
+	}
+	if opts.Step <= 0 {
+		opts.Step = DefaultStep
+	}
+	queues := make(map[string]matchmaking.QueueConfig, len(opts.Queues))
+	var longestTimeout time.Duration
+	for _, q := range opts.Queues {
+		queues[q.Name] = q
+		if q.TicketTimeout() > longestTimeout {
+			longestTimeout = q.TicketTimeout()
+		}
+	}
+	for i, a := range arrivals {
+		if _, ok := queues[a.Queue]; !ok {
+			return Report{}, fmt.Errorf("arrival %d: unknown queue %q", i, a.Queue)
+		}
+	}
+	arrivals = append([]Arrival(nil), arrivals...)
+	sort.SliceStable(arrivals, func(i, j int) bool { return arrivals[i].At < arrivals[j].At })
+
+	now := simStart
+	queue := matchmaking.NewMemoryQueue()
+	published := &recorder{matches: map[string]simMatch{}}
+	svc := matchmaking.NewService(queue, published).
+		WithQueues(opts.Queues).
+		WithClock(func() time.Time { return now })
+
+	tickets := make([]*simTicket, 0, len(arrivals))
+	pending := map[string]*simTicket{}
+	rejected, next := 0, 0
+	for {
+		for ; next < len(arrivals) && !simStart.Add(seconds(arrivals[next].At)).After(now); next++ {
+			a := arrivals[next]
+			// Tickets keep their exact arrival time, as if the client had queued between two passes.
+			t := &simTicket{arrival: a, id: "t-" + strconv.Itoa(next+1), enqueuedAt: simStart.Add(seconds(a.At)), status: matchmaking.TicketQueued}
+			_, err := queue.Enqueue(ctx, matchmaking.Ticket{
+				ID: t.id, UserID: a.UserID, Members: a.Members, Queue: a.Queue, Rating: a.Rating, Pings: a.Pings,
+				Attributes: a.Attributes, Blocked: a.Blocked, EnqueuedAt: t.enqueuedAt, Status: matchmaking.TicketQueued,
+			})
+			if errors.Is(err, matchmaking.ErrAlreadyQueued) {
+				// A recording can hold a player queued twice at once; the service would refuse the second.
+				rejected++
+				continue
+			}
+			if err != nil {
+				return Report{}, err
+			}
+			tickets = append(tickets, t)
+			pending[t.id] = t
+		}
+
+		if err := svc.ProcessOnce(ctx); err != nil {
+			return Report{}, err
+		}
+		for id, t := range pending {
+			stored, err := queue.Ticket(ctx, id)
+			if err != nil {
+				return Report{}, err
+			}
+			if stored.Status == matchmaking.TicketQueued {
+				continue
+			}
+			t.status, t.matchID, t.finishedAt = stored.Status, stored.MatchID, now
+			delete(pending, id)
+		}
+
+		if next == len(arrivals) && (len(pending) == 0 || now.Sub(simStart.Add(seconds(arrivals[len(arrivals)-1].At))) > longestTimeout+opts.Step) {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			return Report{}, err
+		}
+		now = now.Add(opts.Step)
+	}
+	return buildReport(opts.Queues, tickets, published.matches, rejected, now.Sub(simStart)), nil
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
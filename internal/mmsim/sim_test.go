@@ -0,0 +1,92 @@
+package mmsim
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/matchmaking"
+)
+
+func TestRunReplaysArrivals(t *testing.T) {
+	t.Parallel()
+	queues := []matchmaking.QueueConfig{{Name: "duel", Mode: "duel", TeamSize: 1, TeamCount: 2, TicketTimeoutSeconds: 60}}
+	arrivals, err := ReadArrivals(strings.NewReader(`
+{"at": 1, "user_id": "b", "queue": "duel", "rating": 1510, "pings": {"eu-west": 40}}
+{"at": 0, "user_id": "a", "queue": "duel", "rating": 1500, "pings": {"eu-west": 30, "us-east": 90}}
+{"at": 3, "user_id": "c", "queue": "duel", "rating": 2400}
+{"at": 3.5, "user_id": "a", "queue": "duel", "rating": 1500}
+{"at": 4, "user_id": "a", "queue": "duel", "rating": 1500}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Run(context.Background(), Options{Queues: queues}, arrivals)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := report.Queues[0]
+	if q.Tickets != 4 || q.Matched != 2 || q.TimedOut != 2 || q.Waiting != 0 || q.Matches != 1 || report.Rejected != 1 {
+		t.Fatalf("unexpected totals %+v, %d rejected", q, report.Rejected)
+	}
+	// a and b meet on the pass at 2s, having waited 2s and 1s.
+	if want := (Distribution{Count: 2, Mean: 1.5, P50: 1, P90: 2, P99: 2, Max: 2}); q.WaitSeconds != want {
+		t.Fatalf("expected waits %+v, got %+v", want, q.WaitSeconds)
+	}
+	if q.RatingSpread.Max != 10 || q.TeamGap.Max != 10 || q.PingMs.Max != 40 || !reflect.DeepEqual(q.Regions, map[string]int{"eu-west": 1}) {
+		t.Fatalf("unexpected match quality %+v", q)
+	}
+	groups := map[string]FairnessRow{}
+	for _, row := range q.Fairness {
+		groups[row.Group] = row
+	}
+	if row := groups["rating 2400-2599"]; row.Tickets != 1 || row.TimedOut != 1 {
+		t.Fatalf("expected the lone 2400 to time out, got %+v", q.Fairness)
+	}
+	if row := groups["home eu-west"]; row.Tickets != 2 || row.Matched != 2 {
+		t.Fatalf("expected both eu-west players matched, got %+v", q.Fairness)
+	}
+
+	var text bytes.Buffer
+	if err := report.WriteText(&text); err != nil || !strings.Contains(text.String(), "queue duel: 4 tickets (4 players), 2 matched into 1 matches, 2 timed out") {
+		t.Fatalf("unexpected text report (%v):\n%s", err, text.String())
+	}
+}
+
+func TestSyntheticIsReproducible(t *testing.T) {
+	t.Parallel()
+	synthetic := Synthetic{Tickets: 200, PerSecond: 4, Queue: "squads", RatingMean: 1500, RatingStdDev: 200, PartyRate: 0.3, MaxPartySize: 2, Regions: []string{"eu-west", "us-east"}, Seed: 7}
+	first, err := synthetic.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := synthetic.Generate()
+	if !reflect.DeepEqual(first, second) {
+		t.Fatal("expected the same seed to generate the same stream")
+	}
+
+	var buf bytes.Buffer
+	if err := WriteArrivals(&buf, first); err != nil {
+		t.Fatal(err)
+	}
+	replayed, err := ReadArrivals(&buf)
+	if err != nil || !reflect.DeepEqual(replayed, first) {
+		t.Fatalf("expected the stream to survive a round trip (%v)", err)
+	}
+
+	queues := []matchmaking.QueueConfig{{Name: "squads", Mode: "battle", TeamSize: 2, TeamCount: 2}}
+	report, err := Run(context.Background(), Options{Queues: queues}, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := report.Queues[0]
+	if q.Tickets != 200 || q.Matched+q.TimedOut+q.Waiting != q.Tickets || q.Matches == 0 {
+		t.Fatalf("unexpected totals %+v", q)
+	}
+	if _, err := Run(context.Background(), Options{Queues: queues}, []Arrival{{UserID: "a", Queue: "duel"}}); err == nil {
+		t.Fatal("expected an arrival for an unknown queue to be refused")
+	}
+}
@@ -0,0 +1,279 @@
+// Package oidcmock is a minimal OpenID Connect provider for local development and tests. It supports
+// discovery, the authorization-code flow with S256 PKCE, RS256 ID tokens and a JWKS endpoint. The
+// authorize endpoint approves every request immediately; the login_hint parameter picks the subject.
+package oidcmock
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/pkg/apierror"
+)
+
+const (
+	codeTTL    = 2 * time.Minute
+	idTokenTTL = 5 * time.Minute
+	defaultSub = "player"
+	signingKID = "mock-1"
+)
+
+// Client is an OAuth client registered with the mock provider.
+type Client struct {
+	ID           string
+	Secret       string
+	RedirectURIs []string
+}
+
+type authRequest struct {
+	clientID      string
+	redirectURI   string
+	nonce         string
+	codeChallenge string
+	subject       string
+	expiresAt     time.Time
+}
+
+type Server struct {
+	key     *rsa.PrivateKey
+	clients map[string]Client
+	now     func() time.Time
+
+	mu     sync.Mutex
+	issuer string
+	codes  map[string]authRequest
+}
+
+// New creates a provider with a fresh signing key. SetIssuer must be called with the public base URL
+// before serving requests.
+func New(clients ...Client) (*Server, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{key: key, clients: map[string]Client{}, codes: map[string]authRequest{}, now: time.Now}
+	for _, c := range clients {
+		s.clients[c.ID] = c
+	}
+	return s, nil
+}
+
+func (s *Server) SetIssuer(issuer string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.issuer = issuer
+}
+
+func (s *Server) Issuer() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.issuer
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/.well-known/openid-configuration":
+		s.handleDiscovery(w, r)
+	case "/authorize":
+		s.handleAuthorize(w, r)
+	case "/token":
+		s.handleToken(w, r)
+	case "/jwks":
+		s.handleJWKS(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) handleDiscovery(w http.ResponseWriter, _ *http.Request) {
+	issuer := s.Issuer()
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + "/authorize",
+		"token_endpoint":                        issuer + "/token",
+		"jwks_uri":                              issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (s *Server) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	client, ok := s.clients[q.Get("client_id")]
+	if !ok || !contains(client.RedirectURIs, q.Get("redirect_uri")) {
+		apierror.Write(w, http.StatusBadRequest, "invalid_client", "unknown client or redirect_uri")
+		return
+	}
+	if q.Get("response_type") != "code" || q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		apierror.Write(w, http.StatusBadRequest, "invalid_request", "authorization code flow with S256 PKCE is required")
+		return
+	}
+	subject := q.Get("login_hint")
+	if subject == "" {
+		subject = defaultSub
+	}
+	code, err := randomString(24)
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, "internal_error", err.Error())
+		return
+	}
+	s.mu.Lock()
+	s.codes[code] = authRequest{
+		clientID:      client.ID,
+		redirectURI:   q.Get("redirect_uri"),
+		nonce:         q.Get("nonce"),
+		codeChallenge: q.Get("code_challenge"),
+		subject:       subject,
+		expiresAt:     s.now().Add(codeTTL),
+	}
+	s.mu.Unlock()
+
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, "invalid_request", "invalid redirect_uri")
+		return
+	}
+	params := redirect.Query()
+	params.Set("code", code)
+	params.Set("state", q.Get("state"))
+	redirect.RawQuery = params.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.Write(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		apierror.Write(w, http.StatusBadRequest, "unsupported_grant_type", "grant_type must be authorization_code")
+		return
+	}
+	clientID, secret, ok := r.BasicAuth()
+	if ok {
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientID, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	client, known := s.clients[clientID]
+	if !known || subtle.ConstantTimeCompare([]byte(client.Secret), []byte(secret)) != 1 {
+		apierror.Write(w, http.StatusUnauthorized, "invalid_client", "invalid client credentials")
+		return
+	}
+
+	code := r.PostForm.Get("code")
+	s.mu.Lock()
+	req, found := s.codes[code]
+	delete(s.codes, code)
+	issuer := s.issuer
+	s.mu.Unlock()
+	switch {
+	case !found, req.expiresAt.Before(s.now()), req.clientID != clientID, req.redirectURI != r.PostForm.Get("redirect_uri"):
+		apierror.Write(w, http.StatusBadRequest, "invalid_grant", "invalid authorization code")
+		return
+	case pkceChallenge(r.PostForm.Get("code_verifier")) != req.codeChallenge:
+		apierror.Write(w, http.StatusBadRequest, "invalid_grant", "code_verifier does not match challenge")
+		return
+	}
+
+	now := s.now()
+	idToken, err := s.sign(map[string]any{
+		"iss":                issuer,
+		"sub":                "mock|" + req.subject,
+		"aud":                clientID,
+		"iat":                now.Unix(),
+		"exp":                now.Add(idTokenTTL).Unix(),
+		"nonce":              req.nonce,
+		"email":              req.subject + "@mock.invalid",
+		"email_verified":     true,
+		"preferred_username": req.subject,
+	})
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, "internal_error", err.Error())
+		return
+	}
+	accessToken, err := randomString(24)
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, "internal_error", err.Error())
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int(idTokenTTL.Seconds()),
+		"id_token":     idToken,
+	})
+}
+
+func (s *Server) handleJWKS(w http.ResponseWriter, _ *http.Request) {
+	pub := s.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": signingKID,
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+func (s *Server) sign(claims map[string]any) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": signingKID})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func contains(values []string, want string) bool {
+	for _, v := range values {
+		if v == want {
+			return true
+		}
+	}
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(value)
+}
@@ -0,0 +1,163 @@
+package ratings
+
+import "math"
+
+// Glicko-2 constants. glickoScale converts between the public rating scale and the internal one; tau
+// limits how fast volatility can change.
+const (
+	glickoScale  = 173.7178
+	tau          = 0.5
+	convergence  = 0.000001
+	maxIteration = 100
+)
+
+// Default rating values for a player who has not played in a queue yet.
+const (
+	DefaultRating     = 1500.0
+	DefaultDeviation  = 350.0
+	DefaultVolatility = 0.06
+)
+
+// Rating is a Glicko-2 rating on the public scale.
+type Rating struct {
+	Rating     float64 `json:"rating"`
+	Deviation  float64 `json:"deviation"`
+	Volatility float64 `json:"volatility"`
+}
+
+func Default() Rating {
+	return Rating{Rating: DefaultRating, Deviation: DefaultDeviation, Volatility: DefaultVolatility}
+}
+
+// Outcome is one game against Opponent. Score is 1 for a win, 0.5 for a draw and 0 for a loss.
+type Outcome struct {
+	Opponent Rating
+	Score    float64
+}
+
+// Update applies one rating period of outcomes to r, following Glickman's "Example of the Glicko-2
+// system". Without outcomes only the deviation grows.
+func Update(r Rating, outcomes []Outcome) Rating {
+	mu := (r.Rating - DefaultRating) / glickoScale
+	phi := r.Deviation / glickoScale
+	sigma := r.Volatility
+
+	if len(outcomes) == 0 {
+		return Rating{Rating: r.Rating, Deviation: math.Sqrt(phi*phi+sigma*sigma) * glickoScale, Volatility: sigma}
+	}
+
+	var vInv, sum float64
+	for _, o := range outcomes {
+		muJ := (o.Opponent.Rating - DefaultRating) / glickoScale
+		g := gFactor(o.Opponent.Deviation / glickoScale)
+		e := expected(mu, muJ, g)
+		vInv += g * g * e * (1 - e)
+		sum += g * (o.Score - e)
+	}
+	v := 1 / vInv
+	delta := v * sum
+
+	sigma = newVolatility(phi, sigma, v, delta)
+	phiStar := math.Sqrt(phi*phi + sigma*sigma)
+	phi = 1 / math.Sqrt(1/(phiStar*phiStar)+1/v)
+	mu += phi * phi * sum
+
+	return Rating{Rating: mu*glickoScale + DefaultRating, Deviation: phi * glickoScale, Volatility: sigma}
+}
+
+func gFactor(phi float64) float64 {
+	return 1 / math.Sqrt(1+3*phi*phi/(math.Pi*math.Pi))
+}
+
+func expected(mu, muJ, g float64) float64 {
+	return 1 / (1 + math.Exp(-g*(mu-muJ)))
+}
+
+// newVolatility solves for the new volatility with the Illinois algorithm (step 5 of the paper).
+func newVolatility(phi, sigma, v, delta float64) float64 {
+	a := math.Log(sigma * sigma)
+	f := func(x float64) float64 {
+		ex := math.Exp(x)
+		d := phi*phi + v + ex
+		return ex*(delta*delta-d)/(2*d*d) - (x-a)/(tau*tau)
+	}
+
+	A := a
+	var B float64
+	if delta*delta > phi*phi+v {
+		B = math.Log(delta*delta - phi*phi - v)
+	} else {
+		k := 1.0
+		for f(a-k*tau) < 0 {
+			k++
+		}
+		B = a - k*tau
+	}
+	fA, fB := f(A), f(B)
+	for i := 0; math.Abs(B-A) > convergence && i < maxIteration; i++ {
+		C := A + (A-B)*fA/(fB-fA)
+		fC := f(C)
+		if fC*fB <= 0 {
+			A, fA = B, fB
+		} else {
+			fA /= 2
+		}
+		B, fB = C, fC
+	}
+	return math.Exp(A / 2)
+}
+
+// composite stands a whole team in for a single opponent: the mean rating and the root mean square
+// deviation of its members.
+func composite(team []Rating) Rating {
+	var rating, variance, volatility float64
+	for _, r := range team {
+		rating += r.Rating
+		variance += r.Deviation * r.Deviation
+		volatility += r.Volatility
+	}
+	n := float64(len(team))
+	return Rating{Rating: rating / n, Deviation: math.Sqrt(variance / n), Volatility: volatility / n}
+}
+
+// RateMatch returns the new rating of every player in teams. Each player is rated against every other
+// team as one composite opponent: a win against it if their team won, a loss if that team won, and a
+// draw otherwise. A nil winner is a draw for everyone. Players missing from current start at Default.
+func RateMatch(teams [][]string, winner *int, current map[string]Rating) map[string]Rating {
+	ratingOf := func(userID string) Rating {
+		if r, ok := current[userID]; ok {
+			return r
+		}
+		return Default()
+	}
+	composites := make([]Rating, len(teams))
+	for i, team := range teams {
+		members := make([]Rating, len(team))
+		for j, userID := range team {
+			members[j] = ratingOf(userID)
+		}
+		composites[i] = composite(members)
+	}
+
+	updated := make(map[string]Rating)
+	for i, team := range teams {
+		var outcomes []Outcome
+		for j := range teams {
+			if j == i {
+				continue
+			}
+			score := 0.5
+			switch {
+			case winner != nil && *winner == i:
+				score = 1
+			case winner != nil && *winner == j:
+				score = 0
+			}
+			outcomes = append(outcomes, Outcome{Opponent: composites[j], Score: score})
+		}
+		for _, userID := range team {
+			updated[userID] = Update(ratingOf(userID), outcomes)
+		}
+	}
+	return updated
+}
@@ -0,0 +1,64 @@
+package ratings
+
+import (
+	"math"
+	"testing"
+)
+
+func near(got, want, tolerance float64) bool { return math.Abs(got-want) <= tolerance }
+
+// TestUpdateMatchesGlickmanExample checks the worked example from Glickman's Glicko-2 paper.
+func TestUpdateMatchesGlickmanExample(t *testing.T) {
+	t.Parallel()
+	got := Update(Rating{Rating: 1500, Deviation: 200, Volatility: 0.06}, []Outcome{
+		{Opponent: Rating{Rating: 1400, Deviation: 30}, Score: 1},
+		{Opponent: Rating{Rating: 1550, Deviation: 100}, Score: 0},
+		{Opponent: Rating{Rating: 1700, Deviation: 300}, Score: 0},
+	})
+	if !near(got.Rating, 1464.06, 0.01) || !near(got.Deviation, 151.52, 0.01) || !near(got.Volatility, 0.05999, 0.00001) {
+		t.Fatalf("unexpected rating %+v", got)
+	}
+}
+
+func TestUpdateWithoutGamesOnlyWidensDeviation(t *testing.T) {
+	t.Parallel()
+	r := Rating{Rating: 1700, Deviation: 50, Volatility: 0.06}
+	got := Update(r, nil)
+	if got.Rating != r.Rating || got.Deviation <= r.Deviation || got.Volatility != r.Volatility {
+		t.Fatalf("unexpected rating %+v", got)
+	}
+}
+
+func TestRateMatch(t *testing.T) {
+	t.Parallel()
+	teams := [][]string{{"a", "b"}, {"c", "d"}}
+	winner := 0
+	current := map[string]Rating{"a": {Rating: 1600, Deviation: 80, Volatility: 0.06}}
+
+	won := RateMatch(teams, &winner, current)
+	if len(won) != 4 {
+		t.Fatalf("expected every player to be rated, got %v", won)
+	}
+	for _, id := range []string{"a", "b"} {
+		before := Default()
+		if r, ok := current[id]; ok {
+			before = r
+		}
+		if won[id].Rating <= before.Rating {
+			t.Fatalf("winner %s should gain rating: %+v -> %+v", id, before, won[id])
+		}
+	}
+	for _, id := range []string{"c", "d"} {
+		if won[id].Rating >= DefaultRating {
+			t.Fatalf("loser %s should lose rating, got %+v", id, won[id])
+		}
+	}
+	if won["a"].Rating-1600 >= won["b"].Rating-DefaultRating {
+		t.Fatalf("an established player should move less than a new one: a=%+v b=%+v", won["a"], won["b"])
+	}
+
+	drawn := RateMatch([][]string{{"x"}, {"y"}}, nil, nil)
+	if !near(drawn["x"].Rating, DefaultRating, 0.001) || !near(drawn["y"].Rating, DefaultRating, 0.001) {
+		t.Fatalf("a draw between equals should not move ratings: %+v", drawn)
+	}
+}
@@ -0,0 +1,120 @@
+package ratings
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/authz"
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/pkg/apierror"
+)
+
+// Verifier accepts player tokens for reading ratings and service tokens for reporting results.
+type Verifier interface {
+	authz.Verifier
+	authz.ServiceVerifier
+}
+
+type Handler struct {
+	svc      *Service
+	verifier Verifier
+}
+
+func NewHandler(svc *Service, verifier Verifier) *Handler {
+	return &Handler{svc: svc, verifier: verifier}
+}
+
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/v1/matches/", authz.RequireService(h.verifier, authz.ScopeMatchResultsWrite)(h.handleMatchResult))
+	mux.HandleFunc("/v1/ratings/", h.handleRatings)
+}
+
+// handleMatchResult serves POST /v1/matches/{id}/results for game servers.
+func (h *Handler) handleMatchResult(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/v1/matches/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] != "results" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		apierror.Write(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+	var report ResultReport
+	if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+		apierror.Write(w, http.StatusBadRequest, "invalid_json", "invalid json")
+		return
+	}
+	reporter, _ := authz.FromContext(r.Context())
+	resp, err := h.svc.ReportResult(r.Context(), reporter, parts[0], report, r.Header.Get("X-Correlation-Id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrMatchNotFound):
+			apierror.Write(w, http.StatusNotFound, "match_not_found", "match not found")
+		case errors.Is(err, ErrNotMatchHost):
+			apierror.Write(w, http.StatusForbidden, "not_match_host", err.Error())
+		case errors.Is(err, ErrMatchAlreadyCompleted):
+			apierror.Write(w, http.StatusConflict, "match_already_completed", "a result was already reported for this match")
+		case errors.Is(err, ErrInvalidResult):
+			apierror.Write(w, http.StatusBadRequest, "invalid_result", err.Error())
+		default:
+			apierror.Write(w, http.StatusInternalServerError, "internal_error", "could not record result")
+		}
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleRatings serves GET /v1/ratings/{user_id} and GET /v1/ratings/{user_id}/history?queue=&limit=.
+// "me" stands for the caller.
+func (h *Handler) handleRatings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.Write(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+	caller, err := authz.Authenticate(h.verifier, r)
+	if err != nil {
+		apierror.Write(w, http.StatusUnauthorized, "unauthorized", "unauthorized")
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/v1/ratings/"), "/")
+	userID := parts[0]
+	if userID == "me" {
+		userID = caller.Subject
+	}
+	switch {
+	case userID == "":
+		http.NotFound(w, r)
+	case len(parts) == 1:
+		list, err := h.svc.Ratings(r.Context(), userID)
+		if err != nil {
+			apierror.Write(w, http.StatusInternalServerError, "internal_error", "could not load ratings")
+			return
+		}
+		writeJSON(w, http.StatusOK, RatingsResponse{UserID: userID, Ratings: list})
+	case len(parts) == 2 && parts[1] == "history":
+		limit := 0
+		if raw := r.URL.Query().Get("limit"); raw != "" {
+			if limit, err = strconv.Atoi(raw); err != nil || limit < 1 {
+				apierror.Write(w, http.StatusBadRequest, "invalid_limit", "limit must be a positive integer")
+				return
+			}
+		}
+		history, err := h.svc.History(r.Context(), userID, r.URL.Query().Get("queue"), limit)
+		if err != nil {
+			apierror.Write(w, http.StatusInternalServerError, "internal_error", "could not load rating history")
+			return
+		}
+		writeJSON(w, http.StatusOK, HistoryResponse{UserID: userID, History: history})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(value)
+}
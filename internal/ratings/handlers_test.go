@@ -0,0 +1,76 @@
+package ratings
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/authz"
+)
+
+type fakeVerifier struct{}
+
+func (fakeVerifier) ParsePrincipal(token string) (authz.Principal, error) {
+	if token == "player" {
+		return authz.Principal{Kind: authz.KindUser, Subject: "u-1"}, nil
+	}
+	return authz.Principal{}, errors.New("invalid token")
+}
+
+func (fakeVerifier) ParseServicePrincipal(token string) (authz.Principal, error) {
+	switch token {
+	case "game-server":
+		return gameServer, nil
+	case "other-server":
+		return otherServer, nil
+	case "gateway-svc":
+		return authz.Principal{Kind: authz.KindService, Subject: "ops", Scopes: []string{authz.ScopeGatewaySend}}, nil
+	}
+	return authz.Principal{}, errors.New("invalid token")
+}
+
+func TestHandlers(t *testing.T) {
+	t.Parallel()
+	repo := newFakeRepo()
+	_ = repo.RecordMatch(context.Background(), "m-1", "duel", "duel", [][]string{{"u-1"}, {"u-2"}})
+	_ = repo.SetMatchHost(context.Background(), "m-1", gameServer.Subject)
+	mux := http.NewServeMux()
+	NewHandler(NewService(repo, &fakePublisher{}), fakeVerifier{}).Register(mux)
+
+	steps := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   string
+		code   int
+		want   string
+	}{
+		{"player cannot report", http.MethodPost, "/v1/matches/m-1/results", "player", `{"winning_team":0}`, http.StatusUnauthorized, "unauthorized"},
+		{"wrong scope", http.MethodPost, "/v1/matches/m-1/results", "gateway-svc", `{"winning_team":0}`, http.StatusForbidden, "forbidden"},
+		{"unknown match", http.MethodPost, "/v1/matches/m-9/results", "game-server", `{"winning_team":0}`, http.StatusNotFound, "match_not_found"},
+		{"not the host", http.MethodPost, "/v1/matches/m-1/results", "other-server", `{"winning_team":0}`, http.StatusForbidden, "not_match_host"},
+		{"invalid result", http.MethodPost, "/v1/matches/m-1/results", "game-server", `{"winning_team":5}`, http.StatusBadRequest, "invalid_result"},
+		{"reported", http.MethodPost, "/v1/matches/m-1/results", "game-server", `{"winning_team":0,"team_scores":[10,4]}`, http.StatusOK, `"match_id":"m-1"`},
+		{"reported again", http.MethodPost, "/v1/matches/m-1/results", "game-server", `{"winning_team":0,"team_scores":[10,4]}`, http.StatusOK, `"match_id":"m-1"`},
+		{"reported twice", http.MethodPost, "/v1/matches/m-1/results", "game-server", `{"winning_team":0}`, http.StatusConflict, "match_already_completed"},
+		{"ratings need a token", http.MethodGet, "/v1/ratings/me", "", "", http.StatusUnauthorized, "unauthorized"},
+		{"own ratings", http.MethodGet, "/v1/ratings/me", "player", "", http.StatusOK, `"queue":"duel"`},
+		{"history", http.MethodGet, "/v1/ratings/u-2/history?queue=duel", "player", "", http.StatusOK, `"match_id":"m-1"`},
+		{"bad limit", http.MethodGet, "/v1/ratings/u-2/history?limit=x", "player", "", http.StatusBadRequest, "invalid_limit"},
+	}
+	for _, step := range steps {
+		req := httptest.NewRequest(step.method, step.path, strings.NewReader(step.body))
+		if step.token != "" {
+			req.Header.Set("Authorization", "Bearer "+step.token)
+		}
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		if rr.Code != step.code || !strings.Contains(rr.Body.String(), step.want) {
+			t.Fatalf("%s: expected %d %s, got %d %s", step.name, step.code, step.want, rr.Code, rr.Body.String())
+		}
+	}
+}
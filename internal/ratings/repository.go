@@ -0,0 +1,303 @@
+package ratings
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"sort"
+)
+
+type Repository interface {
+	// RecordMatch stores a formed match. Recording a match that is already stored changes nothing.
+	RecordMatch(ctx context.Context, matchID, queue, mode string, teams [][]string) error
+	// SetMatchHost records the owner of the game server now hosting a match that has not completed.
+	SetMatchHost(ctx context.Context, matchID, owner string) error
+	GetMatch(ctx context.Context, matchID string) (Match, error)
+	// CompleteMatch stores result and replaces the players' ratings with rate(current) in one
+	// transaction, so a match moves ratings exactly once.
+	CompleteMatch(ctx context.Context, result Result, rate func(current map[string]Rating) map[string]Rating) ([]RatingChange, error)
+	// GetResult returns the stored result of a completed match and the rating changes it made.
+	GetResult(ctx context.Context, matchID string) (Result, []RatingChange, error)
+	Rating(ctx context.Context, userID, queue string) (float64, error)
+	ListRatings(ctx context.Context, userID string) ([]PlayerRating, error)
+	ListHistory(ctx context.Context, userID, queue string, limit int) ([]HistoryEntry, error)
+}
+
+type PostgresRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresRepository(db *sql.DB) *PostgresRepository {
+	return &PostgresRepository{db: db}
+}
+
+func (r *PostgresRepository) RecordMatch(ctx context.Context, matchID, queue, mode string, teams [][]string) error {
+	raw, err := json.Marshal(teams)
+	if err != nil {
+		return err
+	}
+	const q = `INSERT INTO matches (id, queue, mode, teams) VALUES ($1, $2, $3, $4) ON CONFLICT (id) DO NOTHING`
+	_, err = r.db.ExecContext(ctx, q, matchID, queue, mode, raw)
+	return err
+}
+
+// JoinMatch adds players who joined a running match to one of its teams, so that its result rates them
+// too. Players already in the match stay where they are.
+func (r *PostgresRepository) JoinMatch(ctx context.Context, matchID string, team int, userIDs []string) error {
+	return r.updateTeams(ctx, matchID, func(teams [][]string) error {
+		if team < 0 || team >= len(teams) {
+			return ErrUnknownTeam
+		}
+		for _, userID := range userIDs {
+			if !(Match{Teams: teams}).hasPlayer(userID) {
+				teams[team] = append(teams[team], userID)
+			}
+		}
+		return nil
+	})
+}
+
+// LeaveMatch takes players back out of a match's teams.
+func (r *PostgresRepository) LeaveMatch(ctx context.Context, matchID string, userIDs []string) error {
+	return r.updateTeams(ctx, matchID, func(teams [][]string) error {
+		for i, team := range teams {
+			kept := team[:0]
+			for _, id := range team {
+				if !contains(userIDs, id) {
+					kept = append(kept, id)
+				}
+			}
+			teams[i] = kept
+		}
+		return nil
+	})
+}
+
+// updateTeams applies fn to the teams of a match that has not completed and saves them.
+func (r *PostgresRepository) updateTeams(ctx context.Context, matchID string, fn func(teams [][]string) error) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	const lockMatch = `SELECT ` + matchColumns + ` FROM matches WHERE id = $1 FOR UPDATE`
+	match, err := scanMatch(tx.QueryRowContext(ctx, lockMatch, matchID))
+	if err != nil {
+		return err
+	}
+	if match.CompletedAt != nil {
+		return ErrMatchAlreadyCompleted
+	}
+	if err := fn(match.Teams); err != nil {
+		return err
+	}
+	teams, err := json.Marshal(match.Teams)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE matches SET teams = $2 WHERE id = $1`, matchID, teams); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// SetMatchHost records who may report the result of a match that has not completed. An unknown or
+// completed match is left alone.
+func (r *PostgresRepository) SetMatchHost(ctx context.Context, matchID, owner string) error {
+	const q = `UPDATE matches SET host_owner = $2 WHERE id = $1 AND completed_at IS NULL`
+	_, err := r.db.ExecContext(ctx, q, matchID, owner)
+	return err
+}
+
+func (r *PostgresRepository) GetMatch(ctx context.Context, matchID string) (Match, error) {
+	const q = `SELECT ` + matchColumns + ` FROM matches WHERE id = $1`
+	return scanMatch(r.db.QueryRowContext(ctx, q, matchID))
+}
+
+const matchColumns = `id::text, queue, mode, teams, completed_at, host_owner`
+
+func scanMatch(row *sql.Row) (Match, error) {
+	var m Match
+	var teams []byte
+	var completedAt sql.NullTime
+	if err := row.Scan(&m.ID, &m.Queue, &m.Mode, &teams, &completedAt, &m.HostOwner); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Match{}, ErrMatchNotFound
+		}
+		return Match{}, err
+	}
+	if err := json.Unmarshal(teams, &m.Teams); err != nil {
+		return Match{}, err
+	}
+	if completedAt.Valid {
+		m.CompletedAt = &completedAt.Time
+	}
+	return m, nil
+}
+
+func (r *PostgresRepository) CompleteMatch(ctx context.Context, result Result, rate func(current map[string]Rating) map[string]Rating) ([]RatingChange, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	const lockMatch = `SELECT ` + matchColumns + ` FROM matches WHERE id = $1 FOR UPDATE`
+	match, err := scanMatch(tx.QueryRowContext(ctx, lockMatch, result.MatchID))
+	if err != nil {
+		return nil, err
+	}
+	if match.CompletedAt != nil {
+		return nil, ErrMatchAlreadyCompleted
+	}
+	// Lock rating rows in user ID order so concurrent reports sharing players cannot deadlock.
+	var players []string
+	for _, team := range match.Teams {
+		players = append(players, team...)
+	}
+	sort.Strings(players)
+	const ensure = `INSERT INTO player_ratings (user_id, queue) VALUES ($1, $2) ON CONFLICT (user_id, queue) DO NOTHING`
+	const lockRating = `SELECT rating, deviation, volatility FROM player_ratings WHERE user_id = $1 AND queue = $2 FOR UPDATE`
+	current := make(map[string]Rating, len(players))
+	for _, userID := range players {
+		if _, err := tx.ExecContext(ctx, ensure, userID, match.Queue); err != nil {
+			return nil, err
+		}
+		var cur Rating
+		if err := tx.QueryRowContext(ctx, lockRating, userID, match.Queue).Scan(&cur.Rating, &cur.Deviation, &cur.Volatility); err != nil {
+			return nil, err
+		}
+		current[userID] = cur
+	}
+
+	updated := rate(current)
+	const update = `
+		UPDATE player_ratings
+		SET rating = $3, deviation = $4, volatility = $5, games_played = games_played + 1, updated_at = $6
+		WHERE user_id = $1 AND queue = $2`
+	const history = `
+		INSERT INTO rating_history (user_id, queue, match_id, rating_before, rating_after, deviation_after, volatility_after, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	changes := make([]RatingChange, 0, len(players))
+	for _, userID := range players {
+		after := updated[userID]
+		if _, err := tx.ExecContext(ctx, update, userID, match.Queue, after.Rating, after.Deviation, after.Volatility, result.CompletedAt); err != nil {
+			return nil, err
+		}
+		if _, err := tx.ExecContext(ctx, history, userID, match.Queue, match.ID, current[userID].Rating, after.Rating, after.Deviation, after.Volatility, result.CompletedAt); err != nil {
+			return nil, err
+		}
+		changes = append(changes, RatingChange{UserID: userID, Before: current[userID], After: after})
+	}
+
+	report, err := json.Marshal(result.Report)
+	if err != nil {
+		return nil, err
+	}
+	// The changes are kept with the result so that a repeated report can be answered the same way.
+	changed, err := json.Marshal(changes)
+	if err != nil {
+		return nil, err
+	}
+	const complete = `UPDATE matches SET completed_at = $2, result = $3, reported_by = $4, rating_changes = $5 WHERE id = $1`
+	if _, err := tx.ExecContext(ctx, complete, match.ID, result.CompletedAt, report, result.ReportedBy, changed); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+func (r *PostgresRepository) GetResult(ctx context.Context, matchID string) (Result, []RatingChange, error) {
+	const q = `
+		SELECT completed_at, result, reported_by, rating_changes
+		FROM matches WHERE id = $1 AND completed_at IS NOT NULL`
+	result := Result{MatchID: matchID}
+	var report, changed []byte
+	err := r.db.QueryRowContext(ctx, q, matchID).Scan(&result.CompletedAt, &report, &result.ReportedBy, &changed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Result{}, nil, ErrMatchNotFound
+	}
+	if err != nil {
+		return Result{}, nil, err
+	}
+	if err := json.Unmarshal(report, &result.Report); err != nil {
+		return Result{}, nil, err
+	}
+	var changes []RatingChange
+	if err := json.Unmarshal(changed, &changes); err != nil {
+		return Result{}, nil, err
+	}
+	return result, changes, nil
+}
+
+// Rating returns the player's rating in queue, or DefaultRating if they have not played it yet.
+func (r *PostgresRepository) Rating(ctx context.Context, userID, queue string) (float64, error) {
+	const q = `SELECT rating FROM player_ratings WHERE user_id = $1 AND queue = $2`
+	var rating float64
+	err := r.db.QueryRowContext(ctx, q, userID, queue).Scan(&rating)
+	if errors.Is(err, sql.ErrNoRows) {
+		return DefaultRating, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return rating, nil
+}
+
+func (r *PostgresRepository) ListRatings(ctx context.Context, userID string) ([]PlayerRating, error) {
+	const q = `
+		SELECT queue, rating, deviation, volatility, games_played, updated_at
+		FROM player_ratings WHERE user_id = $1 ORDER BY queue`
+	rows, err := r.db.QueryContext(ctx, q, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []PlayerRating{}
+	for rows.Next() {
+		var p PlayerRating
+		if err := rows.Scan(&p.Queue, &p.Rating.Rating, &p.Rating.Deviation, &p.Rating.Volatility, &p.GamesPlayed, &p.UpdatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+// ListHistory returns the newest entries first. An empty queue lists every queue.
+func (r *PostgresRepository) ListHistory(ctx context.Context, userID, queue string, limit int) ([]HistoryEntry, error) {
+	const q = `
+		SELECT match_id::text, queue, rating_before, rating_after, deviation_after, volatility_after, created_at
+		FROM rating_history
+		WHERE user_id = $1 AND ($2 = '' OR queue = $2)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $3`
+	rows, err := r.db.QueryContext(ctx, q, userID, queue, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []HistoryEntry{}
+	for rows.Next() {
+		var h HistoryEntry
+		if err := rows.Scan(&h.MatchID, &h.Queue, &h.Before, &h.After.Rating, &h.After.Deviation, &h.After.Volatility, &h.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, h)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,149 @@
+// Package ratings turns reported match results into Glicko-2 rating updates. Matchmaking records every
+// match it forms; game servers report how it ended, and the players' ratings in that queue move once.
+package ratings
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/authz"
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/contracts"
+)
+
+type Publisher interface {
+	Publish(subject string, data []byte) error
+}
+
+type Service struct {
+	repo      Repository
+	publisher Publisher
+	now       func() time.Time
+	newID     func() (string, error)
+}
+
+func NewService(repo Repository, publisher Publisher) *Service {
+	return &Service{repo: repo, publisher: publisher, now: func() time.Time { return time.Now().UTC() }, newID: newUUID}
+}
+
+// ReportResult completes matchID with report, updates the players' ratings and publishes
+// match.completed. Only the owner of the game server hosting the match may report it; others get
+// ErrNotMatchHost. A match can be completed only once; see repeatResult for a report sent again.
+func (s *Service) ReportResult(ctx context.Context, reporter authz.Principal, matchID string, report ResultReport, correlationID string) (ResultResponse, error) {
+	match, err := s.repo.GetMatch(ctx, matchID)
+	if err != nil {
+		return ResultResponse{}, err
+	}
+	if match.HostOwner == "" || match.HostOwner != reporter.Subject {
+		return ResultResponse{}, ErrNotMatchHost
+	}
+	if match.CompletedAt != nil {
+		return s.repeatResult(ctx, reporter, match, report, correlationID)
+	}
+	if err := report.Validate(match); err != nil {
+		return ResultResponse{}, err
+	}
+
+	result := Result{MatchID: match.ID, Report: report, ReportedBy: reporter.Subject, CompletedAt: s.now()}
+	changes, err := s.repo.CompleteMatch(ctx, result, func(current map[string]Rating) map[string]Rating {
+		return RateMatch(match.Teams, report.WinningTeam, current)
+	})
+	if errors.Is(err, ErrMatchAlreadyCompleted) {
+		return s.repeatResult(ctx, reporter, match, report, correlationID)
+	}
+	if err != nil {
+		return ResultResponse{}, err
+	}
+
+	if err := s.publishCompleted(match, result, changes, correlationID); err != nil {
+		return ResultResponse{}, err
+	}
+	return ResultResponse{MatchID: match.ID, Queue: match.Queue, Changes: changes}, nil
+}
+
+// repeatResult answers a report for a match that is already completed. The same report from the
+// reporter that completed the match gets the original response, and match.completed is published
+// again, so a reporter whose first attempt failed after the ratings moved can retry. Any other report
+// fails with ErrMatchAlreadyCompleted.
+func (s *Service) repeatResult(ctx context.Context, reporter authz.Principal, match Match, report ResultReport, correlationID string) (ResultResponse, error) {
+	result, changes, err := s.repo.GetResult(ctx, match.ID)
+	if err != nil {
+		return ResultResponse{}, err
+	}
+	if result.ReportedBy != reporter.Subject || !sameReport(result.Report, report) {
+		return ResultResponse{}, ErrMatchAlreadyCompleted
+	}
+	if err := s.publishCompleted(match, result, changes, correlationID); err != nil {
+		return ResultResponse{}, err
+	}
+	return ResultResponse{MatchID: match.ID, Queue: match.Queue, Changes: changes}, nil
+}
+
+// HandleSessionAssigned records the owner of the game server a match's session was assigned, from a
+// session.assigned_server event. A session moved to another server hands the match to that server.
+func (s *Service) HandleSessionAssigned(ctx context.Context, data []byte) error {
+	env, err := contracts.UnmarshalEnvelope(data)
+	if err != nil {
+		return err
+	}
+	if env.Type != contracts.EventSessionAssigned {
+		return nil
+	}
+	var assigned contracts.SessionAssignedServerV1
+	if err := json.Unmarshal(env.Payload, &assigned); err != nil {
+		return err
+	}
+	if assigned.MatchID == "" || assigned.ServerOwner == "" {
+		return nil
+	}
+	return s.repo.SetMatchHost(ctx, assigned.MatchID, assigned.ServerOwner)
+}
+
+// sameReport compares reports as they are stored, so that omitted and empty fields are alike.
+func sameReport(a, b ResultReport) bool {
+	rawA, errA := json.Marshal(a)
+	rawB, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(rawA, rawB)
+}
+
+func (s *Service) Ratings(ctx context.Context, userID string) ([]PlayerRating, error) {
+	return s.repo.ListRatings(ctx, userID)
+}
+
+// History returns up to limit rating changes of userID, newest first, optionally for one queue.
+func (s *Service) History(ctx context.Context, userID, queue string, limit int) ([]HistoryEntry, error) {
+	if limit <= 0 || limit > maxHistoryLimit {
+		limit = maxHistoryLimit
+	}
+	return s.repo.ListHistory(ctx, userID, queue, limit)
+}
+
+func (s *Service) publishCompleted(match Match, result Result, changes []RatingChange, correlationID string) error {
+	eventID, err := s.newID()
+	if err != nil {
+		return err
+	}
+	if correlationID == "" {
+		correlationID = eventID
+	}
+	payload := contracts.MatchCompletedV1{
+		MatchID:     match.ID,
+		Queue:       match.Queue,
+		Mode:        match.Mode,
+		Teams:       match.Teams,
+		WinningTeam: result.Report.WinningTeam,
+		TeamScores:  result.Report.TeamScores,
+		PlayerStats: result.Report.PlayerStats,
+		ReportedBy:  result.ReportedBy,
+	}
+	for _, c := range changes {
+		payload.RatingChanges = append(payload.RatingChanges, contracts.MatchRatingChangeV1{UserID: c.UserID, RatingBefore: c.Before.Rating, RatingAfter: c.After.Rating})
+	}
+	raw, err := contracts.MarshalV1(eventID, contracts.EventMatchCompleted, s.now(), correlationID, nil, payload)
+	if err != nil {
+		return err
+	}
+	return s.publisher.Publish(contracts.SubjectMatchCompleted, raw)
+}
@@ -0,0 +1,272 @@
+package ratings
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/authz"
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/contracts"
+)
+
+type fakeRepo struct {
+	matches map[string]Match
+	ratings map[string]map[string]Rating // queue -> user -> rating
+	history map[string][]HistoryEntry
+	results []Result
+	changes map[string][]RatingChange // match ID -> changes it made
+}
+
+func newFakeRepo() *fakeRepo {
+	return &fakeRepo{matches: map[string]Match{}, ratings: map[string]map[string]Rating{}, history: map[string][]HistoryEntry{}, changes: map[string][]RatingChange{}}
+}
+
+func (f *fakeRepo) RecordMatch(_ context.Context, matchID, queue, mode string, teams [][]string) error {
+	f.matches[matchID] = Match{ID: matchID, Queue: queue, Mode: mode, Teams: teams}
+	return nil
+}
+
+func (f *fakeRepo) SetMatchHost(_ context.Context, matchID, owner string) error {
+	if m, ok := f.matches[matchID]; ok && m.CompletedAt == nil {
+		m.HostOwner = owner
+		f.matches[matchID] = m
+	}
+	return nil
+}
+
+func (f *fakeRepo) GetMatch(_ context.Context, matchID string) (Match, error) {
+	m, ok := f.matches[matchID]
+	if !ok {
+		return Match{}, ErrMatchNotFound
+	}
+	return m, nil
+}
+
+func (f *fakeRepo) CompleteMatch(_ context.Context, result Result, rate func(map[string]Rating) map[string]Rating) ([]RatingChange, error) {
+	m, ok := f.matches[result.MatchID]
+	if !ok {
+		return nil, ErrMatchNotFound
+	}
+	if m.CompletedAt != nil {
+		return nil, ErrMatchAlreadyCompleted
+	}
+	m.CompletedAt = &result.CompletedAt
+	f.matches[m.ID] = m
+	f.results = append(f.results, result)
+
+	if f.ratings[m.Queue] == nil {
+		f.ratings[m.Queue] = map[string]Rating{}
+	}
+	current := map[string]Rating{}
+	var players []string
+	for _, team := range m.Teams {
+		for _, id := range team {
+			players = append(players, id)
+			if r, ok := f.ratings[m.Queue][id]; ok {
+				current[id] = r
+			} else {
+				current[id] = Default()
+			}
+		}
+	}
+	sort.Strings(players)
+	updated := rate(current)
+	var changes []RatingChange
+	for _, id := range players {
+		f.ratings[m.Queue][id] = updated[id]
+		f.history[id] = append([]HistoryEntry{{MatchID: m.ID, Queue: m.Queue, Before: current[id].Rating, After: updated[id], CreatedAt: result.CompletedAt}}, f.history[id]...)
+		changes = append(changes, RatingChange{UserID: id, Before: current[id], After: updated[id]})
+	}
+	f.changes[m.ID] = changes
+	return changes, nil
+}
+
+func (f *fakeRepo) GetResult(_ context.Context, matchID string) (Result, []RatingChange, error) {
+	for _, r := range f.results {
+		if r.MatchID == matchID {
+			return r, f.changes[matchID], nil
+		}
+	}
+	return Result{}, nil, ErrMatchNotFound
+}
+
+func (f *fakeRepo) Rating(_ context.Context, userID, queue string) (float64, error) {
+	if r, ok := f.ratings[queue][userID]; ok {
+		return r.Rating, nil
+	}
+	return DefaultRating, nil
+}
+
+func (f *fakeRepo) ListRatings(_ context.Context, userID string) ([]PlayerRating, error) {
+	out := []PlayerRating{}
+	for queue, users := range f.ratings {
+		if r, ok := users[userID]; ok {
+			out = append(out, PlayerRating{Queue: queue, Rating: r})
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeRepo) ListHistory(_ context.Context, userID, queue string, limit int) ([]HistoryEntry, error) {
+	out := []HistoryEntry{}
+	for _, h := range f.history[userID] {
+		if (queue == "" || h.Queue == queue) && len(out) < limit {
+			out = append(out, h)
+		}
+	}
+	return out, nil
+}
+
+type fakePublisher struct {
+	events []published
+	err    error
+}
+type published struct {
+	subject string
+	data    []byte
+}
+
+func (f *fakePublisher) Publish(subject string, data []byte) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.events = append(f.events, published{subject: subject, data: append([]byte(nil), data...)})
+	return nil
+}
+
+var (
+	gameServer  = authz.Principal{Kind: authz.KindService, Subject: "gs-eu-1", Scopes: []string{authz.ScopeMatchResultsWrite}}
+	otherServer = authz.Principal{Kind: authz.KindService, Subject: "gs-eu-2", Scopes: []string{authz.ScopeMatchResultsWrite}}
+)
+
+// assigned is the session.assigned_server event of matchID's session landing on a server owned by
+// owner.
+func assigned(t *testing.T, matchID, owner string) []byte {
+	t.Helper()
+	payload := contracts.SessionAssignedServerV1{SessionID: "sess-" + matchID, ServerID: "srv-1", MatchID: matchID, ServerOwner: owner}
+	raw, err := contracts.MarshalV1("evt-"+matchID, contracts.EventSessionAssigned, time.Now().UTC(), "corr", nil, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func intPtr(v int) *int { return &v }
+
+func TestReportResult(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	repo := newFakeRepo()
+	publisher := &fakePublisher{}
+	svc := NewService(repo, publisher)
+	svc.now = func() time.Time { return time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC) }
+	_ = repo.RecordMatch(ctx, "m-1", "duel", "duel", [][]string{{"u-1"}, {"u-2"}})
+
+	report := ResultReport{WinningTeam: intPtr(1), TeamScores: []float64{3, 5}, PlayerStats: map[string]map[string]float64{"u-2": {"kills": 5}}}
+	if _, err := svc.ReportResult(ctx, gameServer, "m-1", report, "corr-1"); !errors.Is(err, ErrNotMatchHost) {
+		t.Fatalf("expected a report before any server hosts the match to be refused, got %v", err)
+	}
+	if err := svc.HandleSessionAssigned(ctx, assigned(t, "m-1", "gs-eu-1")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.ReportResult(ctx, otherServer, "m-1", report, "corr-1"); !errors.Is(err, ErrNotMatchHost) {
+		t.Fatalf("expected another service account to be refused, got %v", err)
+	}
+	resp, err := svc.ReportResult(ctx, gameServer, "m-1", report, "corr-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Changes) != 2 || resp.Changes[1].UserID != "u-2" || resp.Changes[1].After.Rating <= DefaultRating || resp.Changes[0].After.Rating >= DefaultRating {
+		t.Fatalf("unexpected changes %+v", resp.Changes)
+	}
+	if len(repo.results) != 1 || repo.results[0].ReportedBy != "gs-eu-1" {
+		t.Fatalf("expected the result to be stored with its reporter, got %+v", repo.results)
+	}
+
+	if len(publisher.events) != 1 || publisher.events[0].subject != contracts.SubjectMatchCompleted {
+		t.Fatalf("expected one match.completed event, got %+v", publisher.events)
+	}
+	env, err := contracts.UnmarshalEnvelope(publisher.events[0].data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var completed contracts.MatchCompletedV1
+	if err := json.Unmarshal(env.Payload, &completed); err != nil {
+		t.Fatal(err)
+	}
+	if env.CorrelationID != "corr-1" || completed.WinningTeam == nil || *completed.WinningTeam != 1 || len(completed.RatingChanges) != 2 || completed.ReportedBy != "gs-eu-1" {
+		t.Fatalf("unexpected event %+v / %+v", env, completed)
+	}
+
+	if _, err := svc.ReportResult(ctx, gameServer, "m-1", ResultReport{WinningTeam: intPtr(0)}, "corr-2"); !errors.Is(err, ErrMatchAlreadyCompleted) {
+		t.Fatalf("expected a different second report to be refused, got %v", err)
+	}
+	if _, err := svc.ReportResult(ctx, otherServer, "m-1", report, "corr-2"); !errors.Is(err, ErrNotMatchHost) {
+		t.Fatalf("expected another reporter to be refused, got %v", err)
+	}
+	history, err := svc.History(ctx, "u-2", "", 0)
+	if err != nil || len(history) != 1 || history[0].MatchID != "m-1" {
+		t.Fatalf("unexpected history %+v (%v)", history, err)
+	}
+}
+
+func TestReportResultRetriedAfterPublishFailure(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	repo := newFakeRepo()
+	publisher := &fakePublisher{err: errors.New("nats unavailable")}
+	svc := NewService(repo, publisher)
+	_ = repo.RecordMatch(ctx, "m-1", "duel", "duel", [][]string{{"u-1"}, {"u-2"}})
+	_ = repo.SetMatchHost(ctx, "m-1", gameServer.Subject)
+
+	report := ResultReport{WinningTeam: intPtr(0), TeamScores: []float64{}}
+	if _, err := svc.ReportResult(ctx, gameServer, "m-1", report, "corr-1"); err == nil {
+		t.Fatal("expected the report to fail while match.completed cannot be published")
+	}
+	publisher.err = nil
+	// The retry carries the same result, here with team_scores left out rather than empty.
+	resp, err := svc.ReportResult(ctx, gameServer, "m-1", ResultReport{WinningTeam: intPtr(0)}, "corr-1")
+	if err != nil {
+		t.Fatalf("expected the retry to succeed, got %v", err)
+	}
+	if len(repo.results) != 1 || len(resp.Changes) != 2 || resp.Changes[0].After.Rating <= DefaultRating {
+		t.Fatalf("ratings must move once and the retry must get the original changes, got %+v / %+v", repo.results, resp.Changes)
+	}
+	if len(publisher.events) != 1 || publisher.events[0].subject != contracts.SubjectMatchCompleted {
+		t.Fatalf("expected match.completed to be published by the retry, got %+v", publisher.events)
+	}
+}
+
+func TestResultReportValidate(t *testing.T) {
+	t.Parallel()
+	match := Match{ID: "m-1", Teams: [][]string{{"a", "b"}, {"c", "d"}}}
+	tests := []struct {
+		name   string
+		report ResultReport
+		valid  bool
+	}{
+		{"winner", ResultReport{WinningTeam: intPtr(0)}, true},
+		{"draw", ResultReport{Draw: true, TeamScores: []float64{1, 1}}, true},
+		{"no outcome", ResultReport{}, false},
+		{"draw with winner", ResultReport{Draw: true, WinningTeam: intPtr(0)}, false},
+		{"winner out of range", ResultReport{WinningTeam: intPtr(2)}, false},
+		{"scores per team", ResultReport{WinningTeam: intPtr(0), TeamScores: []float64{1}}, false},
+		{"stats for a stranger", ResultReport{WinningTeam: intPtr(0), PlayerStats: map[string]map[string]float64{"z": {"kills": 1}}}, false},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			err := tc.report.Validate(match)
+			if tc.valid && err != nil {
+				t.Fatalf("expected valid, got %v", err)
+			}
+			if !tc.valid && !errors.Is(err, ErrInvalidResult) {
+				t.Fatalf("expected ErrInvalidResult, got %v", err)
+			}
+		})
+	}
+}
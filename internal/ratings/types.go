@@ -0,0 +1,116 @@
+package ratings
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrMatchNotFound         = errors.New("match not found")
+	ErrMatchAlreadyCompleted = errors.New("match already completed")
+	ErrInvalidResult         = errors.New("invalid result")
+	ErrUnknownTeam           = errors.New("match has no such team")
+	ErrNotMatchHost          = errors.New("only the game server hosting the match may report its result")
+)
+
+const maxHistoryLimit = 100
+
+// Match is a match formed by matchmaking, as recorded for result reporting. HostOwner is the subject
+// of the service account that registered the game server hosting it, empty until one does.
+type Match struct {
+	ID          string
+	Queue       string
+	Mode        string
+	Teams       [][]string
+	CompletedAt *time.Time
+	HostOwner   string
+}
+
+func (m Match) hasPlayer(userID string) bool {
+	for _, team := range m.Teams {
+		for _, id := range team {
+			if id == userID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ResultReport is what a game server sends when a match ends. WinningTeam indexes the match's teams;
+// a draw sets Draw instead. TeamScores, when given, has one entry per team.
+type ResultReport struct {
+	WinningTeam *int                          `json:"winning_team,omitempty"`
+	Draw        bool                          `json:"draw,omitempty"`
+	TeamScores  []float64                     `json:"team_scores,omitempty"`
+	PlayerStats map[string]map[string]float64 `json:"player_stats,omitempty"`
+}
+
+// Validate checks the report against the match it is for.
+func (r ResultReport) Validate(m Match) error {
+	switch {
+	case r.Draw && r.WinningTeam != nil:
+		return fmt.Errorf("%w: a draw has no winning_team", ErrInvalidResult)
+	case !r.Draw && r.WinningTeam == nil:
+		return fmt.Errorf("%w: winning_team or draw is required", ErrInvalidResult)
+	case r.WinningTeam != nil && (*r.WinningTeam < 0 || *r.WinningTeam >= len(m.Teams)):
+		return fmt.Errorf("%w: winning_team must be between 0 and %d", ErrInvalidResult, len(m.Teams)-1)
+	case r.TeamScores != nil && len(r.TeamScores) != len(m.Teams):
+		return fmt.Errorf("%w: team_scores must have one entry per team", ErrInvalidResult)
+	}
+	for userID := range r.PlayerStats {
+		if !m.hasPlayer(userID) {
+			return fmt.Errorf("%w: %s did not play in this match", ErrInvalidResult, userID)
+		}
+	}
+	return nil
+}
+
+// Result is a completed match as stored.
+type Result struct {
+	MatchID     string
+	Report      ResultReport
+	ReportedBy  string
+	CompletedAt time.Time
+}
+
+// RatingChange is one player's rating before and after a match.
+type RatingChange struct {
+	UserID string `json:"user_id"`
+	Before Rating `json:"before"`
+	After  Rating `json:"after"`
+}
+
+type ResultResponse struct {
+	MatchID string         `json:"match_id"`
+	Queue   string         `json:"queue"`
+	Changes []RatingChange `json:"changes"`
+}
+
+// PlayerRating is a player's current rating in one queue.
+type PlayerRating struct {
+	Queue       string    `json:"queue"`
+	Rating      Rating    `json:"rating"`
+	GamesPlayed int       `json:"games_played"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type RatingsResponse struct {
+	UserID  string         `json:"user_id"`
+	Ratings []PlayerRating `json:"ratings"`
+}
+
+// HistoryEntry records how one match moved a player's rating.
+type HistoryEntry struct {
+	MatchID   string    `json:"match_id"`
+	Queue     string    `json:"queue"`
+	Before    float64   `json:"rating_before"`
+	After     Rating    `json:"rating_after"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type HistoryResponse struct {
+	UserID  string         `json:"user_id"`
+	History []HistoryEntry `json:"history"`
+}
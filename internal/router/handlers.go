@@ -6,6 +6,7 @@ import (
 	"errors"
 	"net/http"
 
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/authz"
 	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/pkg/apierror"
 )
 
@@ -14,13 +15,16 @@ type Router interface {
 }
 
 type Handler struct {
-	router Router
+	router   Router
+	verifier authz.ServiceVerifier
 }
 
-func NewHandler(router Router) *Handler { return &Handler{router: router} }
+func NewHandler(router Router, verifier authz.ServiceVerifier) *Handler {
+	return &Handler{router: router, verifier: verifier}
+}
 
 func (h *Handler) Register(mux *http.ServeMux) {
-	mux.HandleFunc("/v1/route", h.handleRoute)
+	mux.HandleFunc("/v1/route", authz.RequireService(h.verifier, authz.ScopeRouterRoute)(h.handleRoute))
 }
 
 type RouteRequest struct {
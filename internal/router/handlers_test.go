@@ -9,6 +9,7 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/authz"
 	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/pkg/apierror"
 )
 
@@ -21,28 +22,46 @@ func (f fakeRouter) Route(context.Context, string, json.RawMessage) (string, err
 	return f.instanceID, f.err
 }
 
+type fakeVerifier struct{}
+
+func (fakeVerifier) ParseServicePrincipal(token string) (authz.Principal, error) {
+	switch token {
+	case "router-svc":
+		return authz.Principal{Kind: authz.KindService, Subject: "sessions", Scopes: []string{authz.ScopeRouterRoute}}, nil
+	case "gateway-svc":
+		return authz.Principal{Kind: authz.KindService, Subject: "ops", Scopes: []string{authz.ScopeGatewaySend}}, nil
+	}
+	return authz.Principal{}, errors.New("invalid token")
+}
+
 func TestHandleRoute(t *testing.T) {
 	t.Parallel()
 	tests := []struct {
 		name    string
+		token   string
 		body    string
 		r       fakeRouter
 		code    int
 		errCode string
 	}{
-		{"accepted", `{"user_id":"u1","message":{"type":"ping"}}`, fakeRouter{instanceID: "gw-1"}, http.StatusAccepted, ""},
-		{"offline", `{"user_id":"u1","message":{"type":"ping"}}`, fakeRouter{err: ErrOffline}, http.StatusNotFound, "offline"},
-		{"badrequest", `{"message":{"type":"ping"}}`, fakeRouter{}, http.StatusBadRequest, "validation_failed"},
-		{"internal", `{"user_id":"u1","message":{"type":"ping"}}`, fakeRouter{err: errors.New("boom")}, http.StatusInternalServerError, "internal_error"},
+		{"accepted", "router-svc", `{"user_id":"u1","message":{"type":"ping"}}`, fakeRouter{instanceID: "gw-1"}, http.StatusAccepted, ""},
+		{"offline", "router-svc", `{"user_id":"u1","message":{"type":"ping"}}`, fakeRouter{err: ErrOffline}, http.StatusNotFound, "offline"},
+		{"badrequest", "router-svc", `{"message":{"type":"ping"}}`, fakeRouter{}, http.StatusBadRequest, "validation_failed"},
+		{"internal", "router-svc", `{"user_id":"u1","message":{"type":"ping"}}`, fakeRouter{err: errors.New("boom")}, http.StatusInternalServerError, "internal_error"},
+		{"unauthenticated", "", `{"user_id":"u1","message":{"type":"ping"}}`, fakeRouter{instanceID: "gw-1"}, http.StatusUnauthorized, "unauthorized"},
+		{"wrong scope", "gateway-svc", `{"user_id":"u1","message":{"type":"ping"}}`, fakeRouter{instanceID: "gw-1"}, http.StatusForbidden, "forbidden"},
 	}
 	for _, tc := range tests {
 		tc := tc
 		t.Run(tc.name, func(t *testing.T) {
 			t.Parallel()
-			h := NewHandler(tc.r)
+			h := NewHandler(tc.r, fakeVerifier{})
 			mux := http.NewServeMux()
 			h.Register(mux)
 			req := httptest.NewRequest(http.MethodPost, "/v1/route", bytes.NewBufferString(tc.body))
+			if tc.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
 			res := httptest.NewRecorder()
 			mux.ServeHTTP(res, req)
 			if res.Code != tc.code {
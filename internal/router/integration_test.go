@@ -11,7 +11,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/authz"
 	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/itest"
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/login"
 )
 
 func TestRouteWithRealRedisAndNATS(t *testing.T) {
@@ -30,10 +32,16 @@ func TestRouteWithRealRedisAndNATS(t *testing.T) {
 	}
 
 	svc := NewService(NewRedisLookup(redis), nc, false)
-	hdl := NewHandler(svc)
+	auth := login.NewAuthenticator("local-dev-secret", time.Hour)
+	hdl := NewHandler(svc, auth)
 	mux := http.NewServeMux()
 	hdl.Register(mux)
+	token, err := auth.GenerateServiceToken("itest", []string{authz.ScopeRouterRoute}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
 	req := httptest.NewRequest(http.MethodPost, "/v1/route", bytes.NewBufferString(`{"user_id":"u1","message":{"type":"ping"}}`))
+	req.Header.Set("Authorization", "Bearer "+token)
 	res := httptest.NewRecorder()
 	mux.ServeHTTP(res, req)
 	if res.Code != http.StatusAccepted {
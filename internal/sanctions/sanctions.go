@@ -0,0 +1,197 @@
+// Package sanctions holds the ban, suspension and mute model shared by the services that enforce it.
+// The login service owns the user_sanctions table and mirrors active sanctions into Redis; the gateway
+// and matchmaking read the mirror so they do not need database access.
+package sanctions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Sanction types. Bans and suspensions lock the user out; mutes are recorded and mirrored for chat
+// consumers but do not block login, matchmaking or gateway connections.
+const (
+	TypeBan        = "ban"
+	TypeSuspension = "suspension"
+	TypeMute       = "mute"
+)
+
+var types = []string{TypeBan, TypeSuspension, TypeMute}
+
+func ValidType(t string) bool {
+	switch t {
+	case TypeBan, TypeSuspension, TypeMute:
+		return true
+	}
+	return false
+}
+
+// Sanction is one row of user_sanctions. A nil ExpiresAt means the sanction lasts until lifted.
+type Sanction struct {
+	ID        string     `json:"id"`
+	UserID    string     `json:"user_id"`
+	Type      string     `json:"type"`
+	Reason    string     `json:"reason"`
+	IssuedBy  string     `json:"issued_by,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	LiftedAt  *time.Time `json:"lifted_at,omitempty"`
+}
+
+// Active reports whether the sanction applies at now.
+func (s Sanction) Active(now time.Time) bool {
+	return s.LiftedAt == nil && (s.ExpiresAt == nil || s.ExpiresAt.After(now))
+}
+
+// BlocksAccess reports whether the sanction keeps the user from logging in, queueing or connecting.
+func (s Sanction) BlocksAccess() bool {
+	return s.Type == TypeBan || s.Type == TypeSuspension
+}
+
+// ErrUnavailable is returned when sanctions cannot be checked. Services refuse the action rather than
+// let a possibly sanctioned user through.
+var ErrUnavailable = errors.New("sanctions could not be checked, try again")
+
+// Error is returned when an action is refused because of a sanction.
+type Error struct {
+	Sanction Sanction
+}
+
+func (e *Error) Error() string {
+	if e.Sanction.ExpiresAt != nil {
+		return fmt.Sprintf("account %s until %s: %s", pastTense(e.Sanction.Type), e.Sanction.ExpiresAt.UTC().Format(time.RFC3339), e.Sanction.Reason)
+	}
+	return fmt.Sprintf("account %s: %s", pastTense(e.Sanction.Type), e.Sanction.Reason)
+}
+
+// Code is the API error code for the sanction, e.g. account_banned.
+func (e *Error) Code() string { return "account_" + pastTense(e.Sanction.Type) }
+
+func pastTense(t string) string {
+	switch t {
+	case TypeBan:
+		return "banned"
+	case TypeSuspension:
+		return "suspended"
+	case TypeMute:
+		return "muted"
+	}
+	return "sanctioned"
+}
+
+// FirstBlocking returns an access-blocking sanction from active, preferring bans, or nil.
+func FirstBlocking(active []Sanction, now time.Time) *Sanction {
+	var found *Sanction
+	for i := range active {
+		s := active[i]
+		if !s.BlocksAccess() || !s.Active(now) {
+			continue
+		}
+		if found == nil || (s.Type == TypeBan && found.Type != TypeBan) {
+			found = &s
+		}
+	}
+	return found
+}
+
+// Checker answers whether a user is currently locked out. It returns nil when they are not. When it
+// fails, callers refuse access with ErrUnavailable.
+type Checker interface {
+	Blocking(ctx context.Context, userID string) (*Sanction, error)
+}
+
+type redisClient interface {
+	MGet(ctx context.Context, keys ...string) *redis.SliceCmd
+	TxPipelined(ctx context.Context, fn func(redis.Pipeliner) error) ([]redis.Cmder, error)
+}
+
+// RedisStore mirrors each user's longest-running active sanction per type under its own key, with a
+// TTL matching the expiry, so readers never see a sanction that has run out.
+type RedisStore struct {
+	client redisClient
+	now    func() time.Time
+}
+
+func NewRedisStore(client redisClient) *RedisStore {
+	return &RedisStore{client: client, now: time.Now}
+}
+
+func key(sanctionType, userID string) string {
+	return "pcgb:sanctions:" + sanctionType + ":" + userID
+}
+
+// Sync replaces the mirrored state of userID with active, the user's unlifted sanctions.
+func (r *RedisStore) Sync(ctx context.Context, userID string, active []Sanction) error {
+	now := r.now()
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, t := range types {
+			pipe.Del(ctx, key(t, userID))
+		}
+		for _, s := range longestByType(active, now) {
+			raw, err := json.Marshal(s)
+			if err != nil {
+				return err
+			}
+			var ttl time.Duration
+			if s.ExpiresAt != nil {
+				ttl = s.ExpiresAt.Sub(now)
+			}
+			pipe.Set(ctx, key(s.Type, userID), raw, ttl)
+		}
+		return nil
+	})
+	return err
+}
+
+func (r *RedisStore) Blocking(ctx context.Context, userID string) (*Sanction, error) {
+	values, err := r.client.MGet(ctx, key(TypeBan, userID), key(TypeSuspension, userID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	var mirrored []Sanction
+	for _, v := range values {
+		raw, ok := v.(string)
+		if !ok {
+			continue
+		}
+		var s Sanction
+		if err := json.Unmarshal([]byte(raw), &s); err != nil {
+			return nil, err
+		}
+		mirrored = append(mirrored, s)
+	}
+	return FirstBlocking(mirrored, r.now()), nil
+}
+
+// longestByType keeps, per type, the active sanction that ends last. Permanent sanctions win.
+func longestByType(active []Sanction, now time.Time) []Sanction {
+	var out []Sanction
+	for _, t := range types {
+		var best *Sanction
+		for i := range active {
+			s := active[i]
+			if s.Type != t || !s.Active(now) {
+				continue
+			}
+			if best == nil || endsLater(s, *best) {
+				best = &s
+			}
+		}
+		if best != nil {
+			out = append(out, *best)
+		}
+	}
+	return out
+}
+
+func endsLater(a, b Sanction) bool {
+	if b.ExpiresAt == nil {
+		return false
+	}
+	return a.ExpiresAt == nil || a.ExpiresAt.After(*b.ExpiresAt)
+}
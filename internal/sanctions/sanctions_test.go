@@ -0,0 +1,88 @@
+package sanctions
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func timePtr(t time.Time) *time.Time { return &t }
+
+func TestFirstBlocking(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		active []Sanction
+		want   string
+	}{
+		{name: "none", want: ""},
+		{name: "mute does not block", active: []Sanction{{ID: "m", Type: TypeMute}}, want: ""},
+		{name: "expired suspension", active: []Sanction{{ID: "s", Type: TypeSuspension, ExpiresAt: timePtr(now.Add(-time.Minute))}}, want: ""},
+		{name: "lifted ban", active: []Sanction{{ID: "b", Type: TypeBan, LiftedAt: timePtr(now)}}, want: ""},
+		{name: "suspension", active: []Sanction{{ID: "s", Type: TypeSuspension, ExpiresAt: timePtr(now.Add(time.Hour))}}, want: "s"},
+		{name: "ban wins", active: []Sanction{{ID: "s", Type: TypeSuspension, ExpiresAt: timePtr(now.Add(time.Hour))}, {ID: "b", Type: TypeBan}}, want: "b"},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			got := FirstBlocking(tc.active, now)
+			if (got == nil && tc.want != "") || (got != nil && got.ID != tc.want) {
+				t.Fatalf("expected %q, got %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestLongestByType(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	got := longestByType([]Sanction{
+		{ID: "s1", Type: TypeSuspension, ExpiresAt: timePtr(now.Add(time.Hour))},
+		{ID: "s2", Type: TypeSuspension, ExpiresAt: timePtr(now.Add(2 * time.Hour))},
+		{ID: "m1", Type: TypeMute, ExpiresAt: timePtr(now.Add(time.Hour))},
+		{ID: "m2", Type: TypeMute},
+	}, now)
+	if len(got) != 2 || got[0].ID != "s2" || got[1].ID != "m2" {
+		t.Fatalf("unexpected selection %+v", got)
+	}
+}
+
+type fakeMGet struct {
+	values []any
+}
+
+func (f fakeMGet) MGet(context.Context, ...string) *redis.SliceCmd {
+	return redis.NewSliceResult(f.values, nil)
+}
+
+func (f fakeMGet) TxPipelined(context.Context, func(redis.Pipeliner) error) ([]redis.Cmder, error) {
+	return nil, nil
+}
+
+func TestRedisStoreBlocking(t *testing.T) {
+	t.Parallel()
+	raw, _ := json.Marshal(Sanction{ID: "s1", UserID: "u1", Type: TypeSuspension, Reason: "toxicity", ExpiresAt: timePtr(time.Now().Add(time.Hour))})
+	store := NewRedisStore(fakeMGet{values: []any{nil, string(raw)}})
+	got, err := store.Blocking(context.Background(), "u1")
+	if err != nil || got == nil || got.ID != "s1" {
+		t.Fatalf("expected mirrored suspension, got %+v (%v)", got, err)
+	}
+
+	store = NewRedisStore(fakeMGet{values: []any{nil, nil}})
+	if got, err := store.Blocking(context.Background(), "u1"); err != nil || got != nil {
+		t.Fatalf("expected no sanction, got %+v (%v)", got, err)
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	t.Parallel()
+	err := &Error{Sanction: Sanction{Type: TypeBan, Reason: "cheating"}}
+	if err.Code() != "account_banned" || err.Error() != "account banned: cheating" {
+		t.Fatalf("unexpected error %q / %q", err.Code(), err.Error())
+	}
+}
@@ -0,0 +1,140 @@
+package sessions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/contracts"
+)
+
+// MaxBackfillTeams bounds the open_slots of a backfill request.
+const MaxBackfillTeams = 16
+
+var ErrInvalidBackfill = errors.New("backfill needs a queue and open_slots with one non-negative count per team, at least one of them positive")
+
+// BackfillRequest asks matchmaking for OpenSlots[i] more players on team i of a running session.
+// Attributes are matched against the queue's rules as if the session were a ticket.
+type BackfillRequest struct {
+	Queue      string            `json:"queue"`
+	OpenSlots  []int             `json:"open_slots"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+func (r BackfillRequest) validate() error {
+	if r.Queue == "" || len(r.OpenSlots) == 0 || len(r.OpenSlots) > MaxBackfillTeams {
+		return ErrInvalidBackfill
+	}
+	open := 0
+	for _, n := range r.OpenSlots {
+		if n < 0 {
+			return ErrInvalidBackfill
+		}
+		open += n
+	}
+	if open == 0 {
+		return ErrInvalidBackfill
+	}
+	return nil
+}
+
+// RequestBackfill lets the session's owner ask matchmaking to fill open places in a session that has not
+// ended. It returns the backfill's ID; the queue decides whether the request fits it, and players are
+// added as they are found.
+func (s *Service) RequestBackfill(ctx context.Context, userID, sessionID string, req BackfillRequest, correlationID string) (string, error) {
+	if err := req.validate(); err != nil {
+		return "", err
+	}
+	session, err := s.repo.GetSession(ctx, sessionID)
+	if err != nil {
+		return "", err
+	}
+	if session.OwnerUserID != userID {
+		return "", ErrForbidden
+	}
+	if ended(session.Status) {
+		return "", ErrSessionEnded
+	}
+	members, err := s.repo.ListMembers(ctx, sessionID)
+	if err != nil {
+		return "", err
+	}
+	backfillID, err := newUUID()
+	if err != nil {
+		return "", err
+	}
+	payload := contracts.SessionBackfillRequestedV1{
+		BackfillID: backfillID, SessionID: sessionID, MatchID: session.MatchID, Queue: req.Queue, Region: session.Region,
+		OpenSlots: req.OpenSlots, Members: members, Attributes: req.Attributes,
+	}
+	if err := s.publishBackfillRequested(correlationID, userID, payload); err != nil {
+		return "", err
+	}
+	return backfillID, nil
+}
+
+// HandleBackfilledEvent adds the players matchmaking found for a backfill to their session. Each player
+// added is announced with session.member_joined; a redelivered event adds nobody twice. A session that
+// has ended takes nobody: matchmaking closes its backfills when it hears of the end, but may have filled
+// one in the meantime.
+func (s *Service) HandleBackfilledEvent(msg *nats.Msg) {
+	env, err := contracts.UnmarshalEnvelope(msg.Data)
+	if err != nil || env.Type != contracts.EventMatchmakingBackfill {
+		return
+	}
+	var payload contracts.MatchmakingBackfilledV1
+	if err := json.Unmarshal(env.Payload, &payload); err != nil {
+		return
+	}
+	session, err := s.repo.GetSession(context.Background(), payload.SessionID)
+	if err != nil || ended(session.Status) {
+		return
+	}
+	for _, userID := range payload.UserIDs {
+		added, err := s.repo.AddMember(context.Background(), payload.SessionID, userID)
+		if err != nil || !added {
+			continue
+		}
+		_ = s.publishMemberJoined(env.CorrelationID, userID, contracts.SessionMemberJoinedV1{SessionID: payload.SessionID, Team: payload.Team, BackfillID: payload.BackfillID})
+	}
+}
+
+func (s *Service) publishBackfillRequested(correlationID, userID string, payload contracts.SessionBackfillRequestedV1) error {
+	if s.nc == nil {
+		return nil
+	}
+	eventID, err := newUUID()
+	if err != nil {
+		return err
+	}
+	raw, err := contracts.MarshalV1(eventID, contracts.EventSessionBackfill, time.Now().UTC(), correlationID, &userID, payload)
+	if err != nil {
+		return err
+	}
+	msg := nats.NewMsg(contracts.SubjectSessionBackfill)
+	msg.Data = raw
+	msg.Header.Set("correlation_id", correlationID)
+	msg.Header.Set("content-type", "application/json")
+	return s.nc.PublishMsg(msg)
+}
+
+func (s *Service) publishMemberJoined(correlationID, userID string, payload contracts.SessionMemberJoinedV1) error {
+	if s.nc == nil {
+		return nil
+	}
+	eventID, err := newUUID()
+	if err != nil {
+		return err
+	}
+	raw, err := contracts.MarshalV1(eventID, contracts.EventSessionMemberJoined, time.Now().UTC(), correlationID, &userID, payload)
+	if err != nil {
+		return err
+	}
+	msg := nats.NewMsg(contracts.SubjectSessionMemberJoined)
+	msg.Data = raw
+	msg.Header.Set("correlation_id", correlationID)
+	msg.Header.Set("content-type", "application/json")
+	return s.nc.PublishMsg(msg)
+}
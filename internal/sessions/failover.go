@@ -0,0 +1,290 @@
+package sessions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/contracts"
+)
+
+// Health a game server reports in its heartbeat.
+const (
+	HealthOK        = "ok"
+	HealthUnhealthy = "unhealthy"
+)
+
+// Reasons a server is declared lost.
+const (
+	LostHeartbeatMissed = "heartbeat_missed"
+	LostUnhealthy       = "unhealthy"
+)
+
+// lostServerRetention is how long a lost server stays listed before it is forgotten.
+const lostServerRetention = time.Hour
+
+var (
+	ErrInvalidHeartbeat = errors.New("heartbeat health must be ok or unhealthy, and player counts non-negative")
+
+	// errServerRecovered stops a failover when the server heartbeated again in the meantime.
+	errServerRecovered = errors.New("game server recovered")
+)
+
+// ServerHeartbeat is what a game server reports every HeartbeatInterval. Players counts the players
+// connected to each of its sessions. An empty Health means ok.
+type ServerHeartbeat struct {
+	Health  string         `json:"health,omitempty"`
+	Players map[string]int `json:"players,omitempty"`
+}
+
+func (h ServerHeartbeat) validate() error {
+	if h.Health != "" && h.Health != HealthOK && h.Health != HealthUnhealthy {
+		return ErrInvalidHeartbeat
+	}
+	for _, n := range h.Players {
+		if n < 0 {
+			return ErrInvalidHeartbeat
+		}
+	}
+	return nil
+}
+
+// serverLostMessage is pushed to every member of a session whose server was lost. Server is where the
+// session moved to, or missing if no server could take it yet; assign-server tries again.
+type serverLostMessage struct {
+	Type      string            `json:"type"`
+	SessionID string            `json:"session_id"`
+	ServerID  string            `json:"server_id"`
+	Reason    string            `json:"reason"`
+	Server    *ServerAllocation `json:"server,omitempty"`
+}
+
+// Heartbeat records that the server is alive, with its health and player counts. Counts for sessions
+// it does not host are dropped. The reply lists the sessions it should be hosting; a server that was
+// declared lost gets ErrServerLost and must register again.
+func (s *Service) Heartbeat(ctx context.Context, serverID string, hb ServerHeartbeat) (GameServer, error) {
+	if err := hb.validate(); err != nil {
+		return GameServer{}, err
+	}
+	now := s.now().UTC()
+	return s.fleet.Update(ctx, serverID, func(g *GameServer) error {
+		if g.State == ServerLost {
+			return ErrServerLost
+		}
+		g.HeartbeatAt, g.Health, g.Players = now, HealthOK, nil
+		if hb.Health != "" {
+			g.Health = hb.Health
+		}
+		for sessionID, n := range hb.Players {
+			if !g.hosts(sessionID) {
+				continue
+			}
+			if g.Players == nil {
+				g.Players = map[string]int{}
+			}
+			g.Players[sessionID] = n
+		}
+		return nil
+	})
+}
+
+// lostReason reports why the server should be declared lost, or "" if it is fine.
+func (g GameServer) lostReason(now time.Time) string {
+	switch {
+	case g.State == ServerLost:
+		return ""
+	case !g.alive(now):
+		return LostHeartbeatMissed
+	case g.Health == HealthUnhealthy:
+		return LostUnhealthy
+	}
+	return ""
+}
+
+// RunFailover checks the fleet every interval until ctx is done.
+func (s *Service) RunFailover(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_ = s.CheckServers(ctx)
+		}
+	}
+}
+
+// CheckServers declares lost every server that missed its heartbeats or reported itself unhealthy and
+// moves its sessions to other servers, as allocation would but requiring the lost server's labels.
+// Taking a server's sessions is atomic, so replicas checking at once take each session once. A session
+// stays in the server's Moving until it has been moved, so one that failed to move is tried again on
+// the next check. Lost servers are forgotten after lostServerRetention once nothing is left to move.
+func (s *Service) CheckServers(ctx context.Context) error {
+	servers, err := s.fleet.List(ctx)
+	if err != nil {
+		return err
+	}
+	now := s.now()
+	var errs []error
+	for _, server := range servers {
+		if reason := server.lostReason(now); reason != "" {
+			lost, err := s.fleet.Update(ctx, server.ID, func(g *GameServer) error {
+				if g.lostReason(now) == "" {
+					return errServerRecovered
+				}
+				g.Moving = append(g.Moving, g.Sessions...)
+				g.State, g.LostReason, g.Sessions, g.Players = ServerLost, reason, []string{}, nil
+				return nil
+			})
+			if errors.Is(err, errServerRecovered) || errors.Is(err, ErrServerNotFound) {
+				continue
+			}
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			server = lost
+		}
+		switch {
+		case len(server.Moving) > 0:
+			errs = append(errs, s.moveSessions(ctx, server))
+		case server.State == ServerLost && now.Sub(server.HeartbeatAt) > lostServerRetention:
+			errs = append(errs, s.forgetServer(ctx, server.ID))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// moveSessions fails over each session still to move off the server, and drops it from Moving once it
+// has moved. Sessions that no longer exist are dropped too.
+func (s *Service) moveSessions(ctx context.Context, server GameServer) error {
+	var errs []error
+	for _, sessionID := range server.Moving {
+		err := s.failOver(ctx, sessionID, server, server.LostReason)
+		if err != nil && !errors.Is(err, ErrSessionNotFound) {
+			errs = append(errs, err)
+			continue
+		}
+		_, err = s.fleet.Update(ctx, server.ID, func(g *GameServer) error {
+			kept := g.Moving[:0]
+			for _, id := range g.Moving {
+				if id != sessionID {
+					kept = append(kept, id)
+				}
+			}
+			g.Moving = kept
+			return nil
+		})
+		if err != nil && !errors.Is(err, ErrServerNotFound) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// forgetServer removes a lost server unless it registered again or has sessions to move in the
+// meantime.
+func (s *Service) forgetServer(ctx context.Context, serverID string) error {
+	_, err := s.fleet.Update(ctx, serverID, func(g *GameServer) error {
+		if g.State != ServerLost || len(g.Moving) > 0 {
+			return errServerRecovered
+		}
+		return nil
+	})
+	if errors.Is(err, errServerRecovered) || errors.Is(err, ErrServerNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return s.fleet.Remove(ctx, serverID)
+}
+
+// failOver moves one session off a lost server, announces session.server_lost, and tells its members
+// where to reconnect. The session is allocating again until another server takes it. A session that an
+// earlier attempt already placed keeps its new server and status, and only the announcements are
+// made again.
+func (s *Service) failOver(ctx context.Context, sessionID string, lost GameServer, reason string) error {
+	correlationID, err := newUUID()
+	if err != nil {
+		return err
+	}
+	session, err := s.repo.GetSession(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	if ended(session.Status) {
+		return nil
+	}
+	payload := contracts.SessionServerLostV1{SessionID: sessionID, ServerID: lost.ID, Reason: reason}
+	message := serverLostMessage{Type: "server_lost", SessionID: sessionID, ServerID: lost.ID, Reason: reason}
+	moved, placed, err := s.hostOf(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	if !placed {
+		if session, err = s.transition(ctx, session, StatusAllocating, ActorSystem, reason, correlationID); err != nil {
+			return err
+		}
+		moved, err = s.allocate(ctx, sessionID, session.Region, lost.Labels)
+		placed = err == nil
+		if err != nil && !errors.Is(err, ErrNoServerAvailable) {
+			return err
+		}
+	}
+	if placed {
+		if session.Status == StatusAllocating {
+			if _, err := s.transition(ctx, session, StatusReady, ActorSystem, reason, correlationID); err != nil {
+				return err
+			}
+		}
+		server := moved.Allocation()
+		payload.NewServerID, payload.IP, payload.Port, payload.Region = server.ID, server.IP, server.Port, server.Region
+		message.Server = &server
+	}
+
+	if err := s.publishServerLost(correlationID, session.OwnerUserID, payload); err != nil {
+		return err
+	}
+	if message.Server != nil {
+		if err := s.publishSessionAssigned(correlationID, session.OwnerUserID, session, *message.Server); err != nil {
+			return err
+		}
+	}
+	members, err := s.repo.ListMembers(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	raw, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	for _, userID := range members {
+		if err := s.publishGatewaySendToUser(correlationID, userID, raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Service) publishServerLost(correlationID, userID string, payload contracts.SessionServerLostV1) error {
+	if s.nc == nil {
+		return nil
+	}
+	eventID, err := newUUID()
+	if err != nil {
+		return err
+	}
+	raw, err := contracts.MarshalV1(eventID, contracts.EventSessionServerLost, time.Now().UTC(), correlationID, &userID, payload)
+	if err != nil {
+		return err
+	}
+	msg := nats.NewMsg(contracts.SubjectSessionServerLost)
+	msg.Data = raw
+	msg.Header.Set("correlation_id", correlationID)
+	msg.Header.Set("content-type", "application/json")
+	return s.nc.PublishMsg(msg)
+}
@@ -0,0 +1,184 @@
+package sessions
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckServersMovesSessionsOffLostServers(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	fleet := newFakeFleet()
+	repo := &fakeCreateRepo{region: "eu-west", members: []string{"user-1", "u2"}}
+	svc := NewService(repo, fakeAuth{}, nil, nil).WithFleet(fleet)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	svc.now = func() time.Time { return now }
+
+	ranked := map[string]string{"mode": "ranked"}
+	for _, reg := range []ServerRegistration{
+		{ID: "eu-1", IP: "10.0.1.5", Port: 7777, Region: "eu-west", Capacity: 2, Labels: ranked},
+		{ID: "eu-2", IP: "10.0.1.6", Port: 7777, Region: "eu-west", Capacity: 2, Labels: ranked},
+		{ID: "eu-3", IP: "10.0.1.7", Port: 7777, Region: "eu-west", Capacity: 2, Labels: map[string]string{"mode": "casual"}},
+	} {
+		if _, err := svc.RegisterServer(ctx, reg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assign := func(sessionID string) string {
+		t.Helper()
+		resp, err := svc.AssignServer(ctx, "user-1", sessionID, AssignServerRequest{}, "corr-1")
+		if err != nil {
+			t.Fatalf("assign %s: %v", sessionID, err)
+		}
+		return resp.Server.ID
+	}
+	heartbeat := func(serverID, health string) {
+		t.Helper()
+		if _, err := svc.Heartbeat(ctx, serverID, ServerHeartbeat{Health: health}); err != nil {
+			t.Fatalf("heartbeat %s: %v", serverID, err)
+		}
+	}
+	hosted := func(serverID string) string {
+		server, _ := fleet.Get(ctx, serverID)
+		return server.State + " " + strings.Join(server.Sessions, ",")
+	}
+	if assign("sess-a") != "eu-1" || assign("sess-b") != "eu-1" {
+		t.Fatalf("expected both sessions on eu-1, got %s", hosted("eu-1"))
+	}
+
+	// eu-1 goes silent; its sessions need a ranked server, so they move to eu-2 and not eu-3.
+	now = now.Add(ServerHeartbeatTimeout + time.Second)
+	heartbeat("eu-2", "")
+	heartbeat("eu-3", HealthOK)
+	if err := svc.CheckServers(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := hosted("eu-1"); got != "lost " {
+		t.Fatalf("expected eu-1 lost and empty, got %q", got)
+	}
+	if got := hosted("eu-2"); got != "full sess-a,sess-b" {
+		t.Fatalf("expected the sessions on eu-2, got %q", got)
+	}
+	if got := repo.transitions["sess-b"]; len(got) != 4 || got[2].To != StatusAllocating || got[3].Actor != ActorSystem || got[3].Reason != LostHeartbeatMissed {
+		t.Fatalf("expected sess-b to go through allocating again, got %+v", got)
+	}
+	if assign("sess-a") != "eu-2" {
+		t.Fatal("expected assign-server to return the new server")
+	}
+	if _, err := svc.Heartbeat(ctx, "eu-1", ServerHeartbeat{}); !errors.Is(err, ErrServerLost) {
+		t.Fatalf("expected a lost server's heartbeat to be refused, got %v", err)
+	}
+	if _, err := svc.Heartbeat(ctx, "eu-2", ServerHeartbeat{Health: "sick"}); !errors.Is(err, ErrInvalidHeartbeat) {
+		t.Fatalf("expected ErrInvalidHeartbeat, got %v", err)
+	}
+
+	// eu-1 comes back empty, then eu-2 reports itself unhealthy.
+	if _, err := svc.RegisterServer(ctx, ServerRegistration{ID: "eu-1", IP: "10.0.1.5", Port: 7777, Region: "eu-west", Capacity: 2, Labels: ranked}); err != nil {
+		t.Fatal(err)
+	}
+	heartbeat("eu-2", HealthUnhealthy)
+	for i := 0; i < 2; i++ {
+		if err := svc.CheckServers(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := hosted("eu-1"); got != "full sess-a,sess-b" {
+		t.Fatalf("expected the sessions back on eu-1, got %q", got)
+	}
+
+	// With no ranked server left, the sessions wait until assign-server finds them one.
+	heartbeat("eu-1", HealthUnhealthy)
+	if err := svc.CheckServers(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if hosted("eu-1") != "lost " || hosted("eu-3") != "ready " {
+		t.Fatalf("expected the sessions unplaced, got eu-1 %q and eu-3 %q", hosted("eu-1"), hosted("eu-3"))
+	}
+	if repo.statuses["sess-a"] != StatusAllocating {
+		t.Fatalf("expected sess-a allocating, got %q", repo.statuses["sess-a"])
+	}
+	if assign("sess-a") != "eu-3" {
+		t.Fatal("expected assign-server to place the session again")
+	}
+
+	// Lost servers are forgotten after a while.
+	now = now.Add(lostServerRetention + time.Minute)
+	heartbeat("eu-3", "")
+	if err := svc.CheckServers(ctx); err != nil {
+		t.Fatal(err)
+	}
+	servers, _ := svc.ListServers(ctx)
+	if len(servers) != 1 || servers[0].ID != "eu-3" {
+		t.Fatalf("expected only eu-3 left, got %+v", servers)
+	}
+}
+
+func TestCheckServersRetriesSessionsThatFailedToMove(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	fleet := newFakeFleet()
+	repo := &fakeCreateRepo{region: "eu-west", members: []string{"user-1"}}
+	svc := NewService(repo, fakeAuth{}, nil, nil).WithFleet(fleet)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	svc.now = func() time.Time { return now }
+
+	for _, id := range []string{"eu-1", "eu-2"} {
+		if _, err := svc.RegisterServer(ctx, ServerRegistration{ID: id, IP: "10.0.1.5", Port: 7777, Region: "eu-west", Capacity: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if resp, err := svc.AssignServer(ctx, "user-1", "sess-a", AssignServerRequest{}, "corr-1"); err != nil || resp.Server.ID != "eu-1" {
+		t.Fatalf("expected sess-a on eu-1, got %+v (%v)", resp, err)
+	}
+
+	// eu-1 goes silent, and telling the members fails once sess-a is already on eu-2.
+	now = now.Add(ServerHeartbeatTimeout + time.Second)
+	if _, err := svc.Heartbeat(ctx, "eu-2", ServerHeartbeat{}); err != nil {
+		t.Fatal(err)
+	}
+	repo.membersErr = errors.New("database unavailable")
+	if err := svc.CheckServers(ctx); !errors.Is(err, repo.membersErr) {
+		t.Fatalf("expected the failover to fail, got %v", err)
+	}
+	lost, _ := fleet.Get(ctx, "eu-1")
+	if lost.State != ServerLost || strings.Join(lost.Moving, ",") != "sess-a" || lost.LostReason != LostHeartbeatMissed {
+		t.Fatalf("expected sess-a kept on the lost eu-1 to move, got %+v", lost)
+	}
+	moved := len(repo.transitions["sess-a"])
+
+	// A lost server with sessions left to move is not forgotten.
+	now = now.Add(lostServerRetention + time.Minute)
+	if _, err := svc.Heartbeat(ctx, "eu-2", ServerHeartbeat{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.CheckServers(ctx); err == nil {
+		t.Fatal("expected the failover to fail again")
+	}
+	if _, err := fleet.Get(ctx, "eu-1"); err != nil {
+		t.Fatalf("expected eu-1 kept while sess-a has not moved, got %v", err)
+	}
+
+	repo.membersErr = nil
+	if err := svc.CheckServers(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if lost, _ := fleet.Get(ctx, "eu-1"); len(lost.Moving) != 0 {
+		t.Fatalf("expected nothing left to move, got %+v", lost.Moving)
+	}
+	if got := repo.transitions["sess-a"]; len(got) != moved || repo.statuses["sess-a"] != StatusReady {
+		t.Fatalf("expected sess-a to stay ready on eu-2 without moving again, got %+v", got)
+	}
+	if server, _ := fleet.Get(ctx, "eu-2"); strings.Join(server.Sessions, ",") != "sess-a" {
+		t.Fatalf("expected sess-a on eu-2, got %+v", server.Sessions)
+	}
+
+	if err := svc.CheckServers(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fleet.Get(ctx, "eu-1"); !errors.Is(err, ErrServerNotFound) {
+		t.Fatalf("expected eu-1 forgotten once its sessions moved, got %v", err)
+	}
+}
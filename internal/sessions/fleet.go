@@ -0,0 +1,315 @@
+package sessions
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Game server states. A ready server takes new sessions, a full one has no room left until one is
+// released, and a draining one finishes the sessions it hosts but takes no new ones. A lost server
+// missed its heartbeats or reported itself unhealthy; its sessions were moved elsewhere and it must
+// register again.
+const (
+	ServerReady    = "ready"
+	ServerFull     = "full"
+	ServerDraining = "draining"
+	ServerLost     = "lost"
+)
+
+const (
+	// HeartbeatInterval is how often game servers are expected to heartbeat.
+	HeartbeatInterval = 10 * time.Second
+	// ServerHeartbeatTimeout is how long a server may go without a heartbeat before it is no longer
+	// allocated sessions.
+	ServerHeartbeatTimeout = 3 * HeartbeatInterval
+	// MaxServerLabels bounds the labels a server registers with.
+	MaxServerLabels = 16
+	maxServerIDLen  = 64
+)
+
+var (
+	ErrServerNotFound    = errors.New("game server not found")
+	ErrInvalidServer     = errors.New("game server needs an id, an ip, a port between 1 and 65535, a region, a positive capacity and at most 16 labels")
+	ErrNoServerAvailable = errors.New("no game server available for the session")
+	ErrServerBusy        = errors.New("game server still hosts sessions; drain it and wait for them to end")
+	ErrServerLost        = errors.New("game server was declared lost; register again")
+
+	// errServerUnavailable turns a server down during allocation, which then tries the next one.
+	errServerUnavailable = errors.New("game server cannot take the session")
+)
+
+// GameServer is a dedicated server in the fleet. Capacity is how many sessions it hosts at once, and
+// Sessions the ones it hosts now. Health and Players are as of its last heartbeat. Moving holds the
+// sessions taken from it when it was last lost, for LostReason, that have not been moved elsewhere yet.
+// Owner is the subject of the principal that registered it, the only one allowed to act for it.
+type GameServer struct {
+	ID           string            `json:"id"`
+	Owner        string            `json:"owner"`
+	IP           string            `json:"ip"`
+	Port         int               `json:"port"`
+	Region       string            `json:"region"`
+	Capacity     int               `json:"capacity"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	State        string            `json:"state"`
+	Sessions     []string          `json:"sessions"`
+	Health       string            `json:"health"`
+	Players      map[string]int    `json:"players,omitempty"`
+	RegisteredAt time.Time         `json:"registered_at"`
+	HeartbeatAt  time.Time         `json:"heartbeat_at"`
+	Moving       []string          `json:"moving,omitempty"`
+	LostReason   string            `json:"lost_reason,omitempty"`
+}
+
+// Allocation is where players connect to the server.
+func (g GameServer) Allocation() ServerAllocation {
+	return ServerAllocation{ID: g.ID, IP: g.IP, Port: g.Port, Region: g.Region, Owner: g.Owner}
+}
+
+func (g GameServer) hosts(sessionID string) bool {
+	for _, id := range g.Sessions {
+		if id == sessionID {
+			return true
+		}
+	}
+	return false
+}
+
+// alive reports whether the server heartbeated within ServerHeartbeatTimeout.
+func (g GameServer) alive(now time.Time) bool {
+	return now.Sub(g.HeartbeatAt) <= ServerHeartbeatTimeout
+}
+
+// available reports whether the server can take a session in region that requires labels. Any region
+// will do for a session without one.
+func (g GameServer) available(region string, labels map[string]string, now time.Time) bool {
+	if g.State != ServerReady || g.Health == HealthUnhealthy || len(g.Sessions) >= g.Capacity || !g.alive(now) {
+		return false
+	}
+	if region != "" && g.Region != region {
+		return false
+	}
+	for key, value := range labels {
+		if g.Labels[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// updateState marks the server full or ready after its sessions changed. Draining is left alone.
+func (g *GameServer) updateState() {
+	if g.State == ServerDraining {
+		return
+	}
+	g.State = ServerReady
+	if len(g.Sessions) >= g.Capacity {
+		g.State = ServerFull
+	}
+}
+
+// ServerRegistration is what a game server reports about itself when it starts. The ID is chosen by
+// the server, so that it keeps its record across restarts. Owner is set from the caller's token, not the
+// body.
+type ServerRegistration struct {
+	ID       string            `json:"id"`
+	Owner    string            `json:"-"`
+	IP       string            `json:"ip"`
+	Port     int               `json:"port"`
+	Region   string            `json:"region"`
+	Capacity int               `json:"capacity"`
+	Labels   map[string]string `json:"labels,omitempty"`
+}
+
+func (r ServerRegistration) validate() error {
+	switch {
+	case r.ID == "" || len(r.ID) > maxServerIDLen || strings.ContainsAny(r.ID, "/ "):
+		return ErrInvalidServer
+	case r.IP == "" || r.Region == "" || r.Port < 1 || r.Port > 65535 || r.Capacity < 1:
+		return ErrInvalidServer
+	case len(r.Labels) > MaxServerLabels:
+		return ErrInvalidServer
+	}
+	for key := range r.Labels {
+		if key == "" {
+			return ErrInvalidServer
+		}
+	}
+	return nil
+}
+
+// WithFleet allocates sessions from registered game servers instead of the configured ones.
+func (s *Service) WithFleet(fleet FleetStore) *Service {
+	s.fleet = fleet
+	return s
+}
+
+// RegisterServer adds a game server to the fleet, ready for sessions. A server registering again, for
+// instance after a restart, keeps the sessions it hosts and stops draining. Only the server's owner may
+// register it again; another principal gets ErrForbidden.
+func (s *Service) RegisterServer(ctx context.Context, reg ServerRegistration) (GameServer, error) {
+	if err := reg.validate(); err != nil {
+		return GameServer{}, err
+	}
+	now := s.now().UTC()
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		server, err := s.fleet.Update(ctx, reg.ID, func(g *GameServer) error {
+			// Servers registered before owners were recorded are taken by the next to register them.
+			if g.Owner != "" && g.Owner != reg.Owner {
+				return ErrForbidden
+			}
+			g.Owner = reg.Owner
+			g.IP, g.Port, g.Region, g.Capacity, g.Labels = reg.IP, reg.Port, reg.Region, reg.Capacity, reg.Labels
+			if g.State == ServerLost {
+				// Its sessions were taken from it while it was gone, so it starts empty. Those not
+				// moved yet stay in Moving.
+				g.Sessions, g.Players = []string{}, nil
+			}
+			g.State, g.Health, g.HeartbeatAt = ServerReady, HealthOK, now
+			g.updateState()
+			return nil
+		})
+		if !errors.Is(err, ErrServerNotFound) {
+			return server, err
+		}
+		server = GameServer{
+			ID: reg.ID, Owner: reg.Owner, IP: reg.IP, Port: reg.Port, Region: reg.Region, Capacity: reg.Capacity, Labels: reg.Labels,
+			State: ServerReady, Sessions: []string{}, Health: HealthOK, RegisteredAt: now, HeartbeatAt: now,
+		}
+		added, err := s.fleet.Add(ctx, server)
+		if err != nil || added {
+			return server, err
+		}
+		// Another registration under the same ID won the race; update that one instead.
+	}
+	return GameServer{}, ErrConcurrentUpdate
+}
+
+// checkServerOwner fails with ErrForbidden unless the server was registered by subject.
+func (s *Service) checkServerOwner(ctx context.Context, serverID, subject string) error {
+	server, err := s.fleet.Get(ctx, serverID)
+	if err != nil {
+		return err
+	}
+	if server.Owner != subject {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// DrainServer stops allocating sessions to the server; the ones it hosts carry on.
+func (s *Service) DrainServer(ctx context.Context, serverID string) (GameServer, error) {
+	return s.fleet.Update(ctx, serverID, func(g *GameServer) error {
+		if g.State == ServerLost {
+			return ErrServerLost
+		}
+		g.State = ServerDraining
+		return nil
+	})
+}
+
+// ReleaseSession frees the session's place on the server once it has ended. Releasing a session the
+// server does not host changes nothing.
+func (s *Service) ReleaseSession(ctx context.Context, serverID, sessionID string) (GameServer, error) {
+	return s.fleet.Update(ctx, serverID, func(g *GameServer) error {
+		kept := g.Sessions[:0]
+		for _, id := range g.Sessions {
+			if id != sessionID {
+				kept = append(kept, id)
+			}
+		}
+		g.Sessions = kept
+		delete(g.Players, sessionID)
+		g.updateState()
+		return nil
+	})
+}
+
+// DeregisterServer removes an empty server from the fleet. A server still hosting sessions stays
+// registered and ErrServerBusy is returned: it should drain first. A lost server can always go.
+func (s *Service) DeregisterServer(ctx context.Context, serverID string) error {
+	_, err := s.fleet.Update(ctx, serverID, func(g *GameServer) error {
+		if len(g.Sessions) > 0 && g.State != ServerLost {
+			return ErrServerBusy
+		}
+		// Nothing can be allocated to it between this update and its removal.
+		g.State = ServerDraining
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return s.fleet.Remove(ctx, serverID)
+}
+
+func (s *Service) ListServers(ctx context.Context) ([]GameServer, error) {
+	servers, err := s.fleet.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if servers == nil {
+		servers = []GameServer{}
+	}
+	return servers, nil
+}
+
+// hostOf returns the server hosting the session, if any.
+func (s *Service) hostOf(ctx context.Context, sessionID string) (GameServer, bool, error) {
+	servers, err := s.fleet.List(ctx)
+	if err != nil {
+		return GameServer{}, false, err
+	}
+	for _, server := range servers {
+		if server.hosts(sessionID) {
+			return server, true, nil
+		}
+	}
+	return GameServer{}, false, nil
+}
+
+// allocate places the session on a live, ready server in its region carrying the labels asked for. A
+// session already placed keeps its server. Servers are filled before empty ones are used, so that
+// idle servers can be drained; each placement is checked again atomically, and a server that filled
+// up in the meantime is passed over for the next.
+func (s *Service) allocate(ctx context.Context, sessionID, region string, labels map[string]string) (GameServer, error) {
+	servers, err := s.fleet.List(ctx)
+	if err != nil {
+		return GameServer{}, err
+	}
+	now := s.now()
+	candidates := make([]GameServer, 0, len(servers))
+	for _, server := range servers {
+		if server.hosts(sessionID) {
+			return server, nil
+		}
+		if server.available(region, labels, now) {
+			candidates = append(candidates, server)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return len(candidates[i].Sessions) > len(candidates[j].Sessions)
+	})
+	for _, candidate := range candidates {
+		server, err := s.fleet.Update(ctx, candidate.ID, func(g *GameServer) error {
+			if g.hosts(sessionID) {
+				return nil
+			}
+			if !g.available(region, labels, now) {
+				return errServerUnavailable
+			}
+			g.Sessions = append(g.Sessions, sessionID)
+			g.updateState()
+			return nil
+		})
+		switch {
+		case errors.Is(err, errServerUnavailable), errors.Is(err, ErrServerNotFound), errors.Is(err, ErrConcurrentUpdate):
+			continue
+		case err != nil:
+			return GameServer{}, err
+		}
+		return server, nil
+	}
+	return GameServer{}, ErrNoServerAvailable
+}
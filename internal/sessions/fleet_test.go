@@ -0,0 +1,240 @@
+package sessions
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeFleet struct {
+	mu      sync.Mutex
+	servers map[string]GameServer
+}
+
+func newFakeFleet() *fakeFleet { return &fakeFleet{servers: map[string]GameServer{}} }
+
+func copyServer(g GameServer) GameServer {
+	g.Sessions = append([]string{}, g.Sessions...)
+	g.Moving = append([]string(nil), g.Moving...)
+	if g.Players != nil {
+		players := make(map[string]int, len(g.Players))
+		for sessionID, n := range g.Players {
+			players[sessionID] = n
+		}
+		g.Players = players
+	}
+	return g
+}
+
+func (f *fakeFleet) Add(_ context.Context, server GameServer) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.servers[server.ID]; ok {
+		return false, nil
+	}
+	f.servers[server.ID] = copyServer(server)
+	return true, nil
+}
+
+func (f *fakeFleet) Get(_ context.Context, id string) (GameServer, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	server, ok := f.servers[id]
+	if !ok {
+		return GameServer{}, ErrServerNotFound
+	}
+	return copyServer(server), nil
+}
+
+func (f *fakeFleet) List(_ context.Context) ([]GameServer, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	servers := make([]GameServer, 0, len(f.servers))
+	for _, server := range f.servers {
+		servers = append(servers, copyServer(server))
+	}
+	sort.Slice(servers, func(i, j int) bool { return servers[i].ID < servers[j].ID })
+	return servers, nil
+}
+
+func (f *fakeFleet) Update(_ context.Context, id string, fn func(*GameServer) error) (GameServer, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	server, ok := f.servers[id]
+	if !ok {
+		return GameServer{}, ErrServerNotFound
+	}
+	server = copyServer(server)
+	if err := fn(&server); err != nil {
+		return GameServer{}, err
+	}
+	f.servers[id] = copyServer(server)
+	return server, nil
+}
+
+func (f *fakeFleet) Remove(_ context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.servers, id)
+	return nil
+}
+
+func TestFleetAllocatesSessions(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	repo := &fakeCreateRepo{region: "eu-west"}
+	fleet := newFakeFleet()
+	svc := NewService(repo, fakeAuth{}, nil, nil).WithFleet(fleet)
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	svc.now = func() time.Time { return start }
+
+	for _, reg := range []ServerRegistration{
+		{ID: "eu-1", IP: "10.0.1.5", Port: 7777, Region: "eu-west", Capacity: 2},
+		{ID: "eu-2", IP: "10.0.1.6", Port: 7777, Region: "eu-west", Capacity: 2, Labels: map[string]string{"map": "dust"}},
+		{ID: "us-1", IP: "10.0.2.5", Port: 7777, Region: "us-east", Capacity: 1},
+	} {
+		if _, err := svc.RegisterServer(ctx, reg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := svc.RegisterServer(ctx, ServerRegistration{ID: "bad/id", IP: "10.0.1.7", Port: 7777, Region: "eu-west", Capacity: 1}); !errors.Is(err, ErrInvalidServer) {
+		t.Fatalf("expected ErrInvalidServer, got %v", err)
+	}
+
+	assign := func(sessionID string, labels map[string]string) (string, error) {
+		resp, err := svc.AssignServer(ctx, "user-1", sessionID, AssignServerRequest{Labels: labels}, "corr-1")
+		return resp.Server.ID, err
+	}
+	// eu-1 fills up before eu-2 is used, and a session asked about twice stays where it is.
+	steps := []struct {
+		session string
+		labels  map[string]string
+		want    string
+	}{
+		{"sess-a", nil, "eu-1"},
+		{"sess-b", nil, "eu-1"},
+		{"sess-a", nil, "eu-1"},
+		{"sess-c", map[string]string{"map": "dust"}, "eu-2"},
+		{"sess-d", nil, "eu-2"},
+	}
+	for _, step := range steps {
+		if got, err := assign(step.session, step.labels); err != nil || got != step.want {
+			t.Fatalf("%s: expected %s, got %q (%v)", step.session, step.want, got, err)
+		}
+	}
+	if _, err := assign("sess-e", nil); !errors.Is(err, ErrNoServerAvailable) {
+		t.Fatalf("expected the region to be full, got %v", err)
+	}
+	if server, _ := fleet.Get(ctx, "eu-1"); server.State != ServerFull {
+		t.Fatalf("expected eu-1 full, got %+v", server)
+	}
+
+	if server, err := svc.ReleaseSession(ctx, "eu-1", "sess-a"); err != nil || server.State != ServerReady || strings.Join(server.Sessions, ",") != "sess-b" {
+		t.Fatalf("expected sess-a released, got %+v (%v)", server, err)
+	}
+	if _, err := svc.DrainServer(ctx, "eu-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := assign("sess-e", nil); !errors.Is(err, ErrNoServerAvailable) {
+		t.Fatalf("expected a draining server to be passed over, got %v", err)
+	}
+	if err := svc.DeregisterServer(ctx, "eu-1"); !errors.Is(err, ErrServerBusy) {
+		t.Fatalf("expected ErrServerBusy, got %v", err)
+	}
+	if server, err := svc.RegisterServer(ctx, ServerRegistration{ID: "eu-1", IP: "10.0.1.5", Port: 7777, Region: "eu-west", Capacity: 2}); err != nil || server.State != ServerReady || len(server.Sessions) != 1 {
+		t.Fatalf("expected registering again to end draining and keep sessions, got %+v (%v)", server, err)
+	}
+
+	// us-1 has not heartbeated since it registered.
+	svc.now = func() time.Time { return start.Add(ServerHeartbeatTimeout + time.Second) }
+	repo.region = "us-east"
+	if _, err := assign("sess-f", nil); !errors.Is(err, ErrNoServerAvailable) {
+		t.Fatalf("expected a silent server to be passed over, got %v", err)
+	}
+	if _, err := svc.Heartbeat(ctx, "us-1", ServerHeartbeat{}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := assign("sess-f", nil); err != nil || got != "us-1" {
+		t.Fatalf("expected us-1 after its heartbeat, got %q (%v)", got, err)
+	}
+
+	for _, sessionID := range []string{"sess-c", "sess-d"} {
+		if _, err := svc.ReleaseSession(ctx, "eu-2", sessionID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := svc.DeregisterServer(ctx, "eu-2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Heartbeat(ctx, "eu-2", ServerHeartbeat{}); !errors.Is(err, ErrServerNotFound) {
+		t.Fatalf("expected eu-2 gone, got %v", err)
+	}
+}
+
+func TestFleetFallsBackToLocalServer(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	svc := NewService(&fakeCreateRepo{region: "eu-west"}, fakeAuth{}, nil, nil).WithFleet(newFakeFleet()).WithLocalFallback()
+
+	resp, err := svc.AssignServer(ctx, "user-1", "sess-1", AssignServerRequest{}, "corr-1")
+	if err != nil || resp.Server.ID != "local-7777" || resp.Server.IP != "127.0.0.1" {
+		t.Fatalf("expected the local server without a fleet server, got %+v (%v)", resp, err)
+	}
+	if _, err := svc.RegisterServer(ctx, ServerRegistration{ID: "eu-1", IP: "10.0.1.5", Port: 7777, Region: "eu-west", Capacity: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if resp, err := svc.AssignServer(ctx, "user-1", "sess-2", AssignServerRequest{}, "corr-1"); err != nil || resp.Server.ID != "eu-1" {
+		t.Fatalf("expected a registered server to be preferred, got %+v (%v)", resp, err)
+	}
+}
+
+func TestFleetEndpoints(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	NewHandler(NewService(&fakeCreateRepo{region: "eu-west"}, fakeAuth{}, nil, nil).WithFleet(newFakeFleet())).Register(mux)
+
+	steps := []struct {
+		method string
+		path   string
+		token  string
+		body   string
+		code   int
+		want   string
+	}{
+		{http.MethodPost, "/v1/fleet/servers", "token", `{}`, http.StatusUnauthorized, "unauthorized"},
+		{http.MethodPost, "/v1/fleet/servers", "server-token", `{"id":"gs-1","ip":"10.0.1.5","port":7777,"region":"eu-west"}`, http.StatusBadRequest, "invalid_server"},
+		{http.MethodPost, "/v1/fleet/servers", "server-token", `{"id":"gs-1","ip":"10.0.1.5","port":7777,"region":"eu-west","capacity":1,"labels":{"mode":"casual"}}`, http.StatusOK, `"state":"ready"`},
+		{http.MethodPost, "/v1/fleet/servers/gs-1/heartbeat", "server-token", ``, http.StatusOK, `"owner":"gs-fleet"`},
+		{http.MethodPost, "/v1/fleet/servers/gs-9/heartbeat", "server-token", ``, http.StatusNotFound, "server_not_found"},
+		// Only the principal that registered gs-1 may act for it.
+		{http.MethodPost, "/v1/fleet/servers", "other-server-token", `{"id":"gs-1","ip":"10.0.9.9","port":7777,"region":"eu-west","capacity":1}`, http.StatusForbidden, "forbidden"},
+		{http.MethodPost, "/v1/fleet/servers/gs-1/heartbeat", "other-server-token", ``, http.StatusForbidden, "forbidden"},
+		{http.MethodPost, "/v1/fleet/servers/gs-1/drain", "other-server-token", ``, http.StatusForbidden, "forbidden"},
+		{http.MethodDelete, "/v1/fleet/servers/gs-1", "other-server-token", ``, http.StatusForbidden, "forbidden"},
+		{http.MethodPost, "/v1/sessions/sess-1/assign-server", "token", `{"labels":{"mode":"ranked"}}`, http.StatusServiceUnavailable, "no_server_available"},
+		{http.MethodPost, "/v1/sessions/sess-1/assign-server", "token", ``, http.StatusOK, `"id":"gs-1"`},
+		{http.MethodPost, "/v1/fleet/servers/gs-1/heartbeat", "server-token", `{"health":"ok","players":{"sess-1":-1}}`, http.StatusBadRequest, "invalid_heartbeat"},
+		{http.MethodPost, "/v1/fleet/servers/gs-1/heartbeat", "server-token", `{"health":"ok","players":{"sess-1":3,"sess-9":2}}`, http.StatusOK, `"players":{"sess-1":3}`},
+		{http.MethodGet, "/admin/v1/fleet/servers", "admin-token", ``, http.StatusOK, `"state":"full"`},
+		{http.MethodDelete, "/v1/fleet/servers/gs-1", "server-token", ``, http.StatusConflict, "server_busy"},
+		{http.MethodPost, "/v1/fleet/servers/gs-1/sessions/sess-1/status", "other-server-token", `{"status":"in_progress"}`, http.StatusForbidden, "registered by another principal"},
+		{http.MethodDelete, "/v1/fleet/servers/gs-1/sessions/sess-1", "other-server-token", ``, http.StatusForbidden, "forbidden"},
+		{http.MethodDelete, "/v1/fleet/servers/gs-1/sessions/sess-1", "server-token", ``, http.StatusOK, `"sessions":[]`},
+		{http.MethodDelete, "/v1/fleet/servers/gs-1", "server-token", ``, http.StatusNoContent, ""},
+	}
+	for _, step := range steps {
+		req := httptest.NewRequest(step.method, step.path, strings.NewReader(step.body))
+		req.Header.Set("Authorization", "Bearer "+step.token)
+		res := httptest.NewRecorder()
+		mux.ServeHTTP(res, req)
+		if res.Code != step.code || !strings.Contains(res.Body.String(), step.want) {
+			t.Fatalf("%s %s: expected %d %s, got %d %s", step.method, step.path, step.code, step.want, res.Code, res.Body.String())
+		}
+	}
+}
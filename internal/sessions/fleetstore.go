@@ -0,0 +1,153 @@
+package sessions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	serverKeyPrefix = "pcgb:sessions:server:"
+	serversKey      = "pcgb:sessions:servers"
+	// maxUpdateAttempts bounds the optimistic retries of an update that keeps losing to other writers.
+	maxUpdateAttempts = 5
+)
+
+var ErrConcurrentUpdate = errors.New("game server was updated concurrently, try again")
+
+type FleetStore interface {
+	// Add stores a new server and reports false if a server is already registered under its ID.
+	Add(ctx context.Context, server GameServer) (bool, error)
+	Get(ctx context.Context, id string) (GameServer, error)
+	// List returns every registered server, ordered by ID.
+	List(ctx context.Context) ([]GameServer, error)
+	// Update applies fn to a registered server and saves the result atomically. An error from fn is
+	// returned as is and nothing is saved.
+	Update(ctx context.Context, id string, fn func(*GameServer) error) (GameServer, error)
+	Remove(ctx context.Context, id string) error
+}
+
+// RedisFleet keeps each game server as JSON under its own key, indexed in one set. Records do not
+// expire: a server that stops heartbeating stays registered, and is skipped, until it is removed.
+type RedisFleet struct {
+	client *redis.Client
+}
+
+func NewRedisFleet(client *redis.Client) *RedisFleet {
+	return &RedisFleet{client: client}
+}
+
+func serverKey(id string) string { return serverKeyPrefix + id }
+
+func (f *RedisFleet) Add(ctx context.Context, server GameServer) (bool, error) {
+	raw, err := json.Marshal(server)
+	if err != nil {
+		return false, err
+	}
+	created, err := f.client.SetNX(ctx, serverKey(server.ID), raw, 0).Result()
+	if err != nil || !created {
+		return false, err
+	}
+	return true, f.client.SAdd(ctx, serversKey, server.ID).Err()
+}
+
+func (f *RedisFleet) Get(ctx context.Context, id string) (GameServer, error) {
+	raw, err := f.client.Get(ctx, serverKey(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return GameServer{}, ErrServerNotFound
+	}
+	if err != nil {
+		return GameServer{}, err
+	}
+	var server GameServer
+	return server, json.Unmarshal(raw, &server)
+}
+
+func (f *RedisFleet) List(ctx context.Context) ([]GameServer, error) {
+	ids, err := f.client.SMembers(ctx, serversKey).Result()
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	sort.Strings(ids)
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = serverKey(id)
+	}
+	values, err := f.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	servers := make([]GameServer, 0, len(values))
+	var gone []any
+	for i, v := range values {
+		raw, ok := v.(string)
+		if !ok {
+			gone = append(gone, ids[i])
+			continue
+		}
+		var server GameServer
+		if err := json.Unmarshal([]byte(raw), &server); err != nil {
+			return nil, err
+		}
+		servers = append(servers, server)
+	}
+	if len(gone) > 0 {
+		// Drop index entries left behind by a removal that did not finish.
+		if err := f.client.SRem(ctx, serversKey, gone...).Err(); err != nil {
+			return nil, err
+		}
+	}
+	return servers, nil
+}
+
+func (f *RedisFleet) Update(ctx context.Context, id string, fn func(*GameServer) error) (GameServer, error) {
+	var updated GameServer
+	txn := func(tx *redis.Tx) error {
+		raw, err := tx.Get(ctx, serverKey(id)).Bytes()
+		if errors.Is(err, redis.Nil) {
+			return ErrServerNotFound
+		}
+		if err != nil {
+			return err
+		}
+		var server GameServer
+		if err := json.Unmarshal(raw, &server); err != nil {
+			return err
+		}
+		if err := fn(&server); err != nil {
+			return err
+		}
+		if raw, err = json.Marshal(server); err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, serverKey(id), raw, 0)
+			return nil
+		})
+		updated = server
+		return err
+	}
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		err := f.client.Watch(ctx, txn, serverKey(id))
+		if errors.Is(err, redis.TxFailedErr) {
+			continue
+		}
+		if err != nil {
+			return GameServer{}, err
+		}
+		return updated, nil
+	}
+	return GameServer{}, ErrConcurrentUpdate
+}
+
+func (f *RedisFleet) Remove(ctx context.Context, id string) error {
+	_, err := f.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, serverKey(id))
+		pipe.SRem(ctx, serversKey, id)
+		return nil
+	})
+	return err
+}
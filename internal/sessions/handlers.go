@@ -3,28 +3,33 @@ package sessions
 import (
 	"encoding/json"
 	"errors"
+	"io"
 	"net/http"
-	"os"
 	"strings"
 
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/authz"
 	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/pkg/apierror"
 )
 
 type Handler struct {
-	svc        *Service
-	adminToken string
+	svc *Service
 }
 
 func NewHandler(svc *Service) *Handler {
-	return &Handler{svc: svc, adminToken: os.Getenv("ADMIN_TOKEN")}
+	return &Handler{svc: svc}
 }
 
 func (h *Handler) Register(mux *http.ServeMux) {
 	mux.HandleFunc("/v1/sessions", h.handleCreateSession)
 	mux.HandleFunc("/v1/sessions/", h.handleSessionRoutes)
-	mux.HandleFunc("/admin/v1/users", h.handleAdminUsers)
-	mux.HandleFunc("/admin/v1/sessions", h.handleAdminSessions)
-	mux.HandleFunc("/admin/v1/broadcast", h.handleAdminBroadcast)
+	mux.HandleFunc("/admin/v1/users", authz.Require(h.svc, authz.ScopeAdminUsersRead)(h.handleAdminUsers))
+	mux.HandleFunc("/admin/v1/sessions", authz.Require(h.svc, authz.ScopeAdminSessionsRead)(h.handleAdminSessions))
+	mux.HandleFunc("/admin/v1/broadcast", authz.Require(h.svc, authz.ScopeAdminBroadcast)(h.handleAdminBroadcast))
+	if h.svc.fleet != nil {
+		mux.HandleFunc("/v1/fleet/servers", authz.RequireService(h.svc, authz.ScopeFleetWrite)(h.handleRegisterServer))
+		mux.HandleFunc("/v1/fleet/servers/", authz.RequireService(h.svc, authz.ScopeFleetWrite)(h.handleServerRoutes))
+		mux.HandleFunc("/admin/v1/fleet/servers", authz.Require(h.svc, authz.ScopeAdminSessionsRead)(h.handleAdminServers))
+	}
 }
 
 func (h *Handler) handleCreateSession(w http.ResponseWriter, r *http.Request) {
@@ -45,7 +50,16 @@ func (h *Handler) handleCreateSession(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) handleSessionRoutes(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/v1/sessions/"), "/")
+	if len(parts) != 2 || parts[0] == "" {
+		http.NotFound(w, r)
+		return
+	}
+	method := http.MethodPost
+	if parts[1] == "transitions" {
+		method = http.MethodGet
+	}
+	if r.Method != method {
 		apierror.Write(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
 		return
 	}
@@ -53,21 +67,278 @@ func (h *Handler) handleSessionRoutes(w http.ResponseWriter, r *http.Request) {
 	if !ok {
 		return
 	}
-	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/v1/sessions/"), "/")
-	if len(parts) != 2 || parts[0] == "" || parts[1] != "assign-server" {
+	switch parts[1] {
+	case "assign-server":
+		h.handleAssignServer(w, r, userID, parts[0], correlationID)
+	case "backfill":
+		h.handleBackfill(w, r, userID, parts[0], correlationID)
+	case "status":
+		h.handleSetStatus(w, r, userID, parts[0], correlationID)
+	case "transitions":
+		h.handleTransitions(w, r, userID, parts[0])
+	default:
 		http.NotFound(w, r)
+	}
+}
+
+func (h *Handler) handleAssignServer(w http.ResponseWriter, r *http.Request, userID, sessionID, correlationID string) {
+	// The body is optional; without one any server will do.
+	var req AssignServerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		apierror.Write(w, http.StatusBadRequest, "invalid_json", "invalid json body")
 		return
 	}
-	resp, err := h.svc.AssignServer(r.Context(), userID, parts[0], correlationID)
+	resp, err := h.svc.AssignServer(r.Context(), userID, sessionID, req, correlationID)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrForbidden):
+			apierror.Write(w, http.StatusForbidden, "forbidden", "forbidden")
+		case errors.Is(err, ErrSessionNotFound):
+			apierror.Write(w, http.StatusNotFound, "session_not_found", "session not found")
+		case errors.Is(err, ErrSessionEnded):
+			apierror.Write(w, http.StatusConflict, "session_ended", err.Error())
+		case errors.Is(err, ErrNoServerAvailable):
+			apierror.Write(w, http.StatusServiceUnavailable, "no_server_available", err.Error())
+		default:
+			apierror.Write(w, http.StatusInternalServerError, "internal_error", err.Error())
+		}
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *Handler) handleBackfill(w http.ResponseWriter, r *http.Request, userID, sessionID, correlationID string) {
+	var req BackfillRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, "invalid_json", "invalid json body")
+		return
+	}
+	backfillID, err := h.svc.RequestBackfill(r.Context(), userID, sessionID, req, correlationID)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidBackfill):
+			apierror.Write(w, http.StatusBadRequest, "invalid_backfill", err.Error())
+		case errors.Is(err, ErrSessionNotFound):
+			apierror.Write(w, http.StatusNotFound, "session_not_found", "session not found")
+		case errors.Is(err, ErrForbidden):
+			apierror.Write(w, http.StatusForbidden, "forbidden", "only the session owner can request backfill")
+		case errors.Is(err, ErrSessionEnded):
+			apierror.Write(w, http.StatusConflict, "session_ended", err.Error())
+		default:
+			apierror.Write(w, http.StatusInternalServerError, "internal_error", err.Error())
+		}
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"backfill_id": backfillID})
+}
+
+func (h *Handler) handleSetStatus(w http.ResponseWriter, r *http.Request, userID, sessionID, correlationID string) {
+	var req StatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, "invalid_json", "invalid json body")
+		return
+	}
+	session, err := h.svc.SetSessionStatus(r.Context(), userID, sessionID, req, correlationID)
 	if err != nil {
 		if errors.Is(err, ErrForbidden) {
+			apierror.Write(w, http.StatusForbidden, "forbidden", "only the session owner can change its status")
+			return
+		}
+		writeStatusError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]Session{"session": session})
+}
+
+func (h *Handler) handleTransitions(w http.ResponseWriter, r *http.Request, userID, sessionID string) {
+	transitions, err := h.svc.ListTransitions(r.Context(), userID, sessionID)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrSessionNotFound):
+			apierror.Write(w, http.StatusNotFound, "session_not_found", "session not found")
+		case errors.Is(err, ErrForbidden):
 			apierror.Write(w, http.StatusForbidden, "forbidden", "forbidden")
+		default:
+			apierror.Write(w, http.StatusInternalServerError, "internal_error", err.Error())
+		}
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string][]Transition{"transitions": transitions})
+}
+
+func writeStatusError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidStatus):
+		apierror.Write(w, http.StatusBadRequest, "invalid_status", err.Error())
+	case errors.Is(err, ErrSessionNotFound):
+		apierror.Write(w, http.StatusNotFound, "session_not_found", "session not found")
+	case errors.Is(err, ErrInvalidTransition):
+		apierror.Write(w, http.StatusConflict, "invalid_transition", err.Error())
+	case errors.Is(err, ErrStatusChanged):
+		apierror.Write(w, http.StatusConflict, "status_changed", "session status changed concurrently, try again")
+	default:
+		apierror.Write(w, http.StatusInternalServerError, "internal_error", err.Error())
+	}
+}
+
+// handleRegisterServer serves POST /v1/fleet/servers for game servers starting up.
+func (h *Handler) handleRegisterServer(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.Write(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+	var reg ServerRegistration
+	if err := json.NewDecoder(r.Body).Decode(&reg); err != nil {
+		apierror.Write(w, http.StatusBadRequest, "invalid_json", "invalid json body")
+		return
+	}
+	principal, _ := authz.FromContext(r.Context())
+	reg.Owner = principal.Subject
+	server, err := h.svc.RegisterServer(r.Context(), reg)
+	if err != nil {
+		writeFleetError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]GameServer{"server": server})
+}
+
+// handleServerRoutes serves a registered server's heartbeat, drain, session status, session release and
+// deregistration. Only the principal that registered the server may call them.
+func (h *Handler) handleServerRoutes(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/v1/fleet/servers/"), "/")
+	if parts[0] == "" {
+		http.NotFound(w, r)
+		return
+	}
+	principal, _ := authz.FromContext(r.Context())
+	if err := h.svc.checkServerOwner(r.Context(), parts[0], principal.Subject); err != nil {
+		writeFleetError(w, err)
+		return
+	}
+	if len(parts) == 4 && parts[1] == "sessions" && parts[2] != "" && parts[3] == "status" {
+		h.handleServerSetStatus(w, r, parts[0], parts[2])
+		return
+	}
+	var (
+		server GameServer
+		err    error
+	)
+	switch {
+	case len(parts) == 1:
+		if r.Method != http.MethodDelete {
+			apierror.Write(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+			return
+		}
+		if err := h.svc.DeregisterServer(r.Context(), parts[0]); err != nil {
+			writeFleetError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case len(parts) == 2 && (parts[1] == "heartbeat" || parts[1] == "drain"):
+		if r.Method != http.MethodPost {
+			apierror.Write(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+			return
+		}
+		if parts[1] == "drain" {
+			server, err = h.svc.DrainServer(r.Context(), parts[0])
+			break
+		}
+		// The body is optional; an empty heartbeat reports the server healthy.
+		var hb ServerHeartbeat
+		if err := json.NewDecoder(r.Body).Decode(&hb); err != nil && !errors.Is(err, io.EOF) {
+			apierror.Write(w, http.StatusBadRequest, "invalid_json", "invalid json body")
+			return
+		}
+		server, err = h.svc.Heartbeat(r.Context(), parts[0], hb)
+	case len(parts) == 3 && parts[1] == "sessions" && parts[2] != "":
+		if r.Method != http.MethodDelete {
+			apierror.Write(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+			return
+		}
+		server, err = h.svc.ReleaseSession(r.Context(), parts[0], parts[2])
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		writeFleetError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]GameServer{"server": server})
+}
+
+// handleServerSetStatus serves POST /v1/fleet/servers/{id}/sessions/{session_id}/status, with which a
+// game server reports that a session it hosts started or ended.
+func (h *Handler) handleServerSetStatus(w http.ResponseWriter, r *http.Request, serverID, sessionID string) {
+	if r.Method != http.MethodPost {
+		apierror.Write(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+	var req StatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, "invalid_json", "invalid json body")
+		return
+	}
+	correlationID := r.Header.Get("X-Correlation-Id")
+	if correlationID == "" {
+		var err error
+		correlationID, err = newUUID()
+		if err != nil {
+			apierror.Write(w, http.StatusInternalServerError, "internal_error", "could not create correlation id")
 			return
 		}
+	}
+	session, err := h.svc.SetSessionStatusFromServer(r.Context(), serverID, sessionID, req, correlationID)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrServerNotFound):
+			apierror.Write(w, http.StatusNotFound, "server_not_found", "game server not found")
+		case errors.Is(err, ErrForbidden):
+			apierror.Write(w, http.StatusForbidden, "forbidden", "the game server does not host the session")
+		default:
+			writeStatusError(w, err)
+		}
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]Session{"session": session})
+}
+
+func writeFleetError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidServer):
+		apierror.Write(w, http.StatusBadRequest, "invalid_server", err.Error())
+	case errors.Is(err, ErrServerNotFound):
+		apierror.Write(w, http.StatusNotFound, "server_not_found", "game server not found")
+	case errors.Is(err, ErrInvalidHeartbeat):
+		apierror.Write(w, http.StatusBadRequest, "invalid_heartbeat", err.Error())
+	case errors.Is(err, ErrServerLost):
+		apierror.Write(w, http.StatusGone, "server_lost", err.Error())
+	case errors.Is(err, ErrForbidden):
+		apierror.Write(w, http.StatusForbidden, "forbidden", "the game server was registered by another principal")
+	case errors.Is(err, ErrServerBusy):
+		apierror.Write(w, http.StatusConflict, "server_busy", err.Error())
+	case errors.Is(err, ErrConcurrentUpdate):
+		apierror.Write(w, http.StatusConflict, "concurrent_update", err.Error())
+	default:
+		apierror.Write(w, http.StatusInternalServerError, "internal_error", err.Error())
+	}
+}
+
+func (h *Handler) handleAdminServers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.Write(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+	if !h.audit(w, r, "fleet.list", "") {
+		return
+	}
+	servers, err := h.svc.ListServers(r.Context())
+	if err != nil {
 		apierror.Write(w, http.StatusInternalServerError, "internal_error", err.Error())
 		return
 	}
-	writeJSON(w, http.StatusOK, resp)
+	writeJSON(w, http.StatusOK, map[string][]GameServer{"servers": servers})
 }
 
 func (h *Handler) handleAdminUsers(w http.ResponseWriter, r *http.Request) {
@@ -75,7 +346,7 @@ func (h *Handler) handleAdminUsers(w http.ResponseWriter, r *http.Request) {
 		apierror.Write(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
 		return
 	}
-	if !h.adminAuth(w, r) {
+	if !h.audit(w, r, "users.list", "") {
 		return
 	}
 	users, err := h.svc.ListUsers(r.Context())
@@ -91,7 +362,7 @@ func (h *Handler) handleAdminSessions(w http.ResponseWriter, r *http.Request) {
 		apierror.Write(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
 		return
 	}
-	if !h.adminAuth(w, r) {
+	if !h.audit(w, r, "sessions.list", "") {
 		return
 	}
 	sessions, err := h.svc.ListSessions(r.Context())
@@ -111,9 +382,6 @@ func (h *Handler) handleAdminBroadcast(w http.ResponseWriter, r *http.Request) {
 		apierror.Write(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
 		return
 	}
-	if !h.adminAuth(w, r) {
-		return
-	}
 	var req adminBroadcastRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		apierror.Write(w, http.StatusBadRequest, "invalid_json", "invalid json body")
@@ -132,6 +400,9 @@ func (h *Handler) handleAdminBroadcast(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	}
+	if !h.audit(w, r, "broadcast", "") {
+		return
+	}
 	count, err := h.svc.BroadcastToOnlineUsers(r.Context(), correlationID, req.Message)
 	if err != nil {
 		apierror.Write(w, http.StatusInternalServerError, "internal_error", err.Error())
@@ -140,12 +411,18 @@ func (h *Handler) handleAdminBroadcast(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]any{"published": count})
 }
 
-func (h *Handler) adminAuth(w http.ResponseWriter, r *http.Request) bool {
-	token := r.Header.Get("X-Admin-Token")
-	if token == "" || h.adminToken == "" || token != h.adminToken {
+// audit records the admin action against the caller before it runs; the action is refused if it cannot be attributed.
+func (h *Handler) audit(w http.ResponseWriter, r *http.Request, action, target string) bool {
+	actor, ok := authz.FromContext(r.Context())
+	if !ok {
 		apierror.Write(w, http.StatusUnauthorized, "unauthorized", "unauthorized")
 		return false
 	}
+	entry := authz.NewAuditEntry(actor, action, target, r.Header.Get("X-Correlation-Id"))
+	if err := h.svc.RecordAdminAction(r.Context(), entry); err != nil {
+		apierror.Write(w, http.StatusInternalServerError, "internal_error", "could not record admin action")
+		return false
+	}
 	return true
 }
 
@@ -3,6 +3,7 @@ package sessions
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -10,6 +11,7 @@ import (
 	"time"
 
 	"github.com/nats-io/nats.go"
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/authz"
 	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/contracts"
 	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/pkg/apierror"
 )
@@ -18,17 +20,83 @@ type fakeAuth struct{}
 
 func (fakeAuth) ParseToken(string) (string, string, error) { return "user-1", "alice", nil }
 
+func (fakeAuth) ParsePrincipal(token string) (authz.Principal, error) {
+	switch token {
+	case "admin-token":
+		return authz.Principal{Subject: "admin-1", Username: "root", Roles: []string{authz.RoleAdmin}, Scopes: []string{authz.ScopeAdminUsersRead, authz.ScopeAdminSessionsRead, authz.ScopeAdminBroadcast}}, nil
+	case "moderator-token":
+		return authz.Principal{Subject: "mod-1", Username: "mod", Roles: []string{authz.RoleModerator}, Scopes: []string{authz.ScopeAdminUsersRead, authz.ScopeAdminSessionsRead}}, nil
+	}
+	return authz.Principal{Subject: "user-1", Username: "alice"}, nil
+}
+
+func (fakeAuth) ParseServicePrincipal(token string) (authz.Principal, error) {
+	switch token {
+	case "server-token":
+		return authz.Principal{Kind: authz.KindService, Subject: "gs-fleet", Scopes: []string{authz.ScopeFleetWrite}}, nil
+	case "other-server-token":
+		return authz.Principal{Kind: authz.KindService, Subject: "gs-other", Scopes: []string{authz.ScopeFleetWrite}}, nil
+	}
+	return authz.Principal{}, errors.New("not a service token")
+}
+
 type fakeCreateRepo struct {
 	createCalls int
 	members     []string
+	region      string
+	matchID     string
+	membersErr  error
+	audit       []authz.AuditEntry
+	// statuses holds each session's status once it has moved on from created; transitions its history.
+	statuses    map[string]string
+	transitions map[string][]Transition
 }
 
-func (f *fakeCreateRepo) CreateSession(_ context.Context, ownerUserID, status string, members []string) (Session, error) {
+func (f *fakeCreateRepo) CreateSession(_ context.Context, ownerUserID, status, region, matchID string, members []string) (Session, error) {
 	f.createCalls++
 	f.members = append([]string(nil), members...)
-	return Session{ID: "sess-1", OwnerUserID: ownerUserID, Status: status, CreatedAt: time.Now().UTC()}, nil
+	f.region, f.matchID = region, matchID
+	return Session{ID: "sess-1", OwnerUserID: ownerUserID, Status: status, Region: region, MatchID: matchID, CreatedAt: time.Now().UTC()}, nil
+}
+func (f *fakeCreateRepo) GetSession(_ context.Context, sessionID string) (Session, error) {
+	status := StatusCreated
+	if s, ok := f.statuses[sessionID]; ok {
+		status = s
+	}
+	return Session{ID: sessionID, OwnerUserID: "user-1", Status: status, Region: f.region, MatchID: f.matchID, CreatedAt: time.Now().UTC()}, nil
+}
+func (f *fakeCreateRepo) TransitionSession(ctx context.Context, sessionID, from, to, actor, reason string) (Session, error) {
+	session, _ := f.GetSession(ctx, sessionID)
+	if session.Status != from {
+		return Session{}, ErrStatusChanged
+	}
+	if f.statuses == nil {
+		f.statuses, f.transitions = map[string]string{}, map[string][]Transition{}
+	}
+	f.statuses[sessionID] = to
+	f.transitions[sessionID] = append(f.transitions[sessionID], Transition{From: from, To: to, Actor: actor, Reason: reason, At: time.Now().UTC()})
+	session.Status = to
+	return session, nil
+}
+func (f *fakeCreateRepo) ListTransitions(_ context.Context, sessionID string) ([]Transition, error) {
+	return append([]Transition{{To: StatusCreated, Actor: "user-1"}}, f.transitions[sessionID]...), nil
 }
 func (f *fakeCreateRepo) IsMember(_ context.Context, _, _ string) (bool, error) { return true, nil }
+func (f *fakeCreateRepo) ListMembers(_ context.Context, _ string) ([]string, error) {
+	if f.membersErr != nil {
+		return nil, f.membersErr
+	}
+	return append([]string(nil), f.members...), nil
+}
+func (f *fakeCreateRepo) AddMember(_ context.Context, _, userID string) (bool, error) {
+	for _, member := range f.members {
+		if member == userID {
+			return false, nil
+		}
+	}
+	f.members = append(f.members, userID)
+	return true, nil
+}
 func (f *fakeCreateRepo) ListUsers(_ context.Context) ([]User, error) {
 	return []User{{ID: "user-1", Username: "alice", CreatedAt: time.Now().UTC()}}, nil
 }
@@ -36,6 +104,11 @@ func (f *fakeCreateRepo) ListSessions(_ context.Context) ([]Session, error) {
 	return []Session{{ID: "sess-1", OwnerUserID: "user-1", Status: "created", CreatedAt: time.Now().UTC()}}, nil
 }
 
+func (f *fakeCreateRepo) RecordAdminAction(_ context.Context, entry authz.AuditEntry) error {
+	f.audit = append(f.audit, entry)
+	return nil
+}
+
 func TestCreateSessionHappyPath(t *testing.T) {
 	t.Parallel()
 	repo := &fakeCreateRepo{}
@@ -54,7 +127,7 @@ func TestCreateSessionHappyPath(t *testing.T) {
 }
 
 func TestAdminUsersRequiresToken(t *testing.T) {
-	t.Setenv("ADMIN_TOKEN", "dev-admin")
+	t.Parallel()
 	svc := NewService(&fakeCreateRepo{}, fakeAuth{}, nil, nil)
 	h := NewHandler(svc)
 	mux := http.NewServeMux()
@@ -73,13 +146,14 @@ func TestAdminUsersRequiresToken(t *testing.T) {
 }
 
 func TestAdminUsersHappyPath(t *testing.T) {
-	t.Setenv("ADMIN_TOKEN", "dev-admin")
-	svc := NewService(&fakeCreateRepo{}, fakeAuth{}, nil, nil)
+	t.Parallel()
+	repo := &fakeCreateRepo{}
+	svc := NewService(repo, fakeAuth{}, nil, nil)
 	h := NewHandler(svc)
 	mux := http.NewServeMux()
 	h.Register(mux)
 	req := httptest.NewRequest(http.MethodGet, "/admin/v1/users", nil)
-	req.Header.Set("X-Admin-Token", "dev-admin")
+	req.Header.Set("Authorization", "Bearer admin-token")
 	res := httptest.NewRecorder()
 	mux.ServeHTTP(res, req)
 	if res.Code != http.StatusOK {
@@ -88,18 +162,145 @@ func TestAdminUsersHappyPath(t *testing.T) {
 	if !strings.Contains(res.Body.String(), "alice") {
 		t.Fatalf("expected alice in response body: %s", res.Body.String())
 	}
+	if len(repo.audit) != 1 || repo.audit[0].ActorUserID != "admin-1" || repo.audit[0].Action != "users.list" {
+		t.Fatalf("expected attributed audit entry, got %+v", repo.audit)
+	}
+}
+
+func TestAdminScopesAreLeastPrivilege(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name  string
+		token string
+		path  string
+		code  int
+	}{
+		{name: "player cannot list users", token: "player-token", path: "/admin/v1/users", code: http.StatusForbidden},
+		{name: "moderator lists sessions", token: "moderator-token", path: "/admin/v1/sessions", code: http.StatusOK},
+		{name: "moderator cannot broadcast", token: "moderator-token", path: "/admin/v1/broadcast", code: http.StatusForbidden},
+		{name: "admin broadcasts", token: "admin-token", path: "/admin/v1/broadcast", code: http.StatusOK},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			mux := http.NewServeMux()
+			NewHandler(NewService(&fakeCreateRepo{}, fakeAuth{}, nil, nil)).Register(mux)
+			method, body := http.MethodGet, strings.NewReader("")
+			if strings.HasSuffix(tc.path, "broadcast") {
+				method, body = http.MethodPost, strings.NewReader(`{"message":{"type":"notice"}}`)
+			}
+			req := httptest.NewRequest(method, tc.path, body)
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+			res := httptest.NewRecorder()
+			mux.ServeHTTP(res, req)
+			if res.Code != tc.code {
+				t.Fatalf("expected %d got %d: %s", tc.code, res.Code, res.Body.String())
+			}
+		})
+	}
 }
 
 func TestHandleMatchedEventCreatesSession(t *testing.T) {
 	t.Parallel()
 	repo := &fakeCreateRepo{}
 	svc := NewService(repo, fakeAuth{}, nil, nil)
-	raw, err := contracts.MarshalV1("evt-1", contracts.EventMatchmakingMatched, time.Now().UTC(), "corr-1", nil, contracts.MatchmakingMatchedV1{MatchID: "m1", UserIDs: []string{"u1", "u2"}})
+	raw, err := contracts.MarshalV1("evt-1", contracts.EventMatchmakingMatched, time.Now().UTC(), "corr-1", nil, contracts.MatchmakingMatchedV1{MatchID: "m1", Region: "eu-west", UserIDs: []string{"u1", "u2"}})
 	if err != nil {
 		t.Fatal(err)
 	}
 	svc.HandleMatchedEvent(&nats.Msg{Data: raw})
-	if repo.createCalls != 1 {
-		t.Fatalf("expected one create call, got %d", repo.createCalls)
+	if repo.createCalls != 1 || repo.region != "eu-west" || repo.matchID != "m1" {
+		t.Fatalf("expected one create call for m1 in eu-west, got %d for %q in %q", repo.createCalls, repo.matchID, repo.region)
+	}
+}
+
+func TestAssignServerHonorsSessionRegion(t *testing.T) {
+	t.Parallel()
+	servers, err := ParseServers([]byte(`[{"ip":"10.0.1.5","port":7777,"region":"eu-west"},{"ip":"10.0.2.5","port":7777,"region":"us-east"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		region string
+		want   ServerAllocation
+	}{
+		{"us-east", ServerAllocation{ID: "us-east-7777", IP: "10.0.2.5", Port: 7777, Region: "us-east"}},
+		{"ap-south", ServerAllocation{ID: "local-7777", IP: "127.0.0.1", Port: 7777, Region: "local"}},
+		{"", ServerAllocation{ID: "local-7777", IP: "127.0.0.1", Port: 7777, Region: "local"}},
+	}
+	for _, tc := range tests {
+		svc := NewService(&fakeCreateRepo{region: tc.region}, fakeAuth{}, nil, nil).WithServers(servers)
+		resp, err := svc.AssignServer(context.Background(), "user-1", "sess-1", AssignServerRequest{}, "corr-1")
+		if err != nil || resp.Server != tc.want {
+			t.Fatalf("region %q: expected %+v, got %+v (%v)", tc.region, tc.want, resp.Server, err)
+		}
+	}
+
+	for _, raw := range []string{
+		`[{"ip":"","port":7777,"region":"eu-west"}]`,
+		`[{"ip":"10.0.1.5","port":0,"region":"eu-west"}]`,
+		`[{"ip":"10.0.1.5","port":7777,"region":"eu-west"},{"ip":"10.0.1.6","port":7777,"region":"eu-west"}]`,
+	} {
+		if _, err := ParseServers([]byte(raw)); err == nil {
+			t.Fatalf("expected %s to be rejected", raw)
+		}
+	}
+}
+
+func TestBackfillRequestAndJoin(t *testing.T) {
+	t.Parallel()
+	repo := &fakeCreateRepo{members: []string{"user-1", "u2"}}
+	mux := http.NewServeMux()
+	svc := NewService(repo, fakeAuth{}, nil, nil)
+	NewHandler(svc).Register(mux)
+
+	steps := []struct {
+		body string
+		code int
+		want string
+	}{
+		{`{"queue":"duel"}`, http.StatusBadRequest, "invalid_backfill"},
+		{`{"queue":"duel","open_slots":[0,0]}`, http.StatusBadRequest, "invalid_backfill"},
+		{`{"queue":"duel","open_slots":[0,1]}`, http.StatusAccepted, "backfill_id"},
+	}
+	for _, step := range steps {
+		req := httptest.NewRequest(http.MethodPost, "/v1/sessions/sess-1/backfill", strings.NewReader(step.body))
+		req.Header.Set("Authorization", "Bearer token")
+		res := httptest.NewRecorder()
+		mux.ServeHTTP(res, req)
+		if res.Code != step.code || !strings.Contains(res.Body.String(), step.want) {
+			t.Fatalf("%s: expected %d %s, got %d %s", step.body, step.code, step.want, res.Code, res.Body.String())
+		}
+	}
+
+	raw, err := contracts.MarshalV1("evt-1", contracts.EventMatchmakingBackfill, time.Now().UTC(), "corr-1", nil, contracts.MatchmakingBackfilledV1{BackfillID: "bf-1", SessionID: "sess-1", Queue: "duel", TicketID: "t-3", Team: 1, UserIDs: []string{"u3"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc.HandleBackfilledEvent(&nats.Msg{Data: raw})
+	svc.HandleBackfilledEvent(&nats.Msg{Data: raw})
+	if want := []string{"user-1", "u2", "u3"}; strings.Join(repo.members, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected members %v, got %v", want, repo.members)
+	}
+
+	// A session that ended takes no more players, even if matchmaking filled a backfill before closing it.
+	repo.statuses = map[string]string{"sess-1": StatusCompleted}
+	raw, err = contracts.MarshalV1("evt-2", contracts.EventMatchmakingBackfill, time.Now().UTC(), "corr-2", nil, contracts.MatchmakingBackfilledV1{BackfillID: "bf-1", SessionID: "sess-1", Queue: "duel", TicketID: "t-4", Team: 0, UserIDs: []string{"u4"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc.HandleBackfilledEvent(&nats.Msg{Data: raw})
+	if want := []string{"user-1", "u2", "u3"}; strings.Join(repo.members, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected an ended session to keep members %v, got %v", want, repo.members)
+	}
+}
+
+func TestBackfillRequiresSessionOwner(t *testing.T) {
+	t.Parallel()
+	svc := NewService(&fakeCreateRepo{}, fakeAuth{}, nil, nil)
+	_, err := svc.RequestBackfill(context.Background(), "u2", "sess-1", BackfillRequest{Queue: "duel", OpenSlots: []int{1}}, "corr-1")
+	if !errors.Is(err, ErrForbidden) {
+		t.Fatalf("expected ErrForbidden, got %v", err)
 	}
 }
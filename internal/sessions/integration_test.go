@@ -5,7 +5,9 @@ package sessions
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"os"
+	"sync"
 	"testing"
 	"time"
 
@@ -52,3 +54,43 @@ func TestMatchedEventCreatesSession(t *testing.T) {
 	}
 	t.Fatal("expected sessions row created")
 }
+
+func TestRedisFleetAllocatesEachPlaceOnce(t *testing.T) {
+	h := itest.Start(t)
+	ctx := context.Background()
+	fleet := NewRedisFleet(itest.Redis(t, h.RedisAddr))
+	_ = fleet.Remove(ctx, "itest-gs")
+	svc := NewService(nil, nil, nil, nil).WithFleet(fleet)
+	if _, err := svc.RegisterServer(ctx, ServerRegistration{ID: "itest-gs", IP: "10.0.9.1", Port: 7777, Region: "itest", Capacity: 2}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = fleet.Remove(ctx, "itest-gs") }()
+
+	// Five sessions race for two places; exactly two may win.
+	var wg sync.WaitGroup
+	errs := make([]error, 5)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = svc.allocate(ctx, "itest-sess-"+string(rune('a'+i)), "itest", nil)
+		}(i)
+	}
+	wg.Wait()
+	placed := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			placed++
+		case !errors.Is(err, ErrNoServerAvailable):
+			t.Fatal(err)
+		}
+	}
+	server, err := fleet.Get(ctx, "itest-gs")
+	if err != nil || placed != 2 || len(server.Sessions) != 2 || server.State != ServerFull {
+		t.Fatalf("expected two sessions placed on a full server, got %d and %+v (%v)", placed, server, err)
+	}
+	if err := svc.DeregisterServer(ctx, "itest-gs"); !errors.Is(err, ErrServerBusy) {
+		t.Fatalf("expected ErrServerBusy, got %v", err)
+	}
+}
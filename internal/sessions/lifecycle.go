@@ -0,0 +1,193 @@
+package sessions
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/contracts"
+)
+
+// Session statuses. A session is created by a player or a match, allocating while it waits for a game
+// server, ready once it has one and in_progress when its server says the game started. Completed and
+// abandoned sessions are over and leave their server.
+const (
+	StatusCreated    = "created"
+	StatusAllocating = "allocating"
+	StatusReady      = "ready"
+	StatusInProgress = "in_progress"
+	StatusCompleted  = "completed"
+	StatusAbandoned  = "abandoned"
+)
+
+// ActorSystem is recorded for transitions the service makes on its own, such as moving a session off a
+// lost server. Players are recorded by user ID and game servers as "server:{id}".
+const ActorSystem = "system"
+
+// MaxTransitionReason bounds the reason given with a status change.
+const MaxTransitionReason = 256
+
+var (
+	ErrInvalidTransition = errors.New("session cannot move to that status from its current one")
+	ErrInvalidStatus     = errors.New("status must be in_progress, completed or abandoned, with a reason of at most 256 bytes")
+	ErrSessionEnded      = errors.New("session has completed or been abandoned")
+)
+
+// transitions lists the statuses each status may move to. A session in play goes back to allocating
+// when its server is lost.
+var transitions = map[string][]string{
+	StatusCreated:    {StatusAllocating, StatusAbandoned},
+	StatusAllocating: {StatusReady, StatusAbandoned},
+	StatusReady:      {StatusAllocating, StatusInProgress, StatusAbandoned},
+	StatusInProgress: {StatusAllocating, StatusCompleted, StatusAbandoned},
+}
+
+// CanTransition reports whether a session may move from one status to another.
+func CanTransition(from, to string) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// ended reports whether the status is terminal.
+func ended(status string) bool {
+	return status == StatusCompleted || status == StatusAbandoned
+}
+
+// StatusRequest is the body of a status change by a session's owner or its game server. Only the
+// statuses the game decides can be set this way; the service moves sessions through allocation itself.
+type StatusRequest struct {
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+func (r StatusRequest) validate() error {
+	switch r.Status {
+	case StatusInProgress, StatusCompleted, StatusAbandoned:
+	default:
+		return ErrInvalidStatus
+	}
+	if len(r.Reason) > MaxTransitionReason {
+		return ErrInvalidStatus
+	}
+	return nil
+}
+
+// SetSessionStatus lets the session's owner move it on, usually to abandon it.
+func (s *Service) SetSessionStatus(ctx context.Context, userID, sessionID string, req StatusRequest, correlationID string) (Session, error) {
+	if err := req.validate(); err != nil {
+		return Session{}, err
+	}
+	session, err := s.repo.GetSession(ctx, sessionID)
+	if err != nil {
+		return Session{}, err
+	}
+	if session.OwnerUserID != userID {
+		return Session{}, ErrForbidden
+	}
+	return s.transition(ctx, session, req.Status, userID, req.Reason, correlationID)
+}
+
+// SetSessionStatusFromServer lets the game server hosting the session report that it started or ended.
+func (s *Service) SetSessionStatusFromServer(ctx context.Context, serverID, sessionID string, req StatusRequest, correlationID string) (Session, error) {
+	if err := req.validate(); err != nil {
+		return Session{}, err
+	}
+	server, err := s.fleet.Get(ctx, serverID)
+	if err != nil {
+		return Session{}, err
+	}
+	if !server.hosts(sessionID) {
+		return Session{}, ErrForbidden
+	}
+	session, err := s.repo.GetSession(ctx, sessionID)
+	if err != nil {
+		return Session{}, err
+	}
+	return s.transition(ctx, session, req.Status, "server:"+serverID, req.Reason, correlationID)
+}
+
+// ListTransitions returns the session's recorded transitions to one of its members.
+func (s *Service) ListTransitions(ctx context.Context, userID, sessionID string) ([]Transition, error) {
+	if _, err := s.repo.GetSession(ctx, sessionID); err != nil {
+		return nil, err
+	}
+	isMember, err := s.repo.IsMember(ctx, sessionID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !isMember {
+		return nil, ErrForbidden
+	}
+	return s.repo.ListTransitions(ctx, sessionID)
+}
+
+// transition moves the session to status to, records it and announces session.status_changed. Moving
+// to the status the session is already in changes nothing. If the session changed status in the
+// meantime, the move is checked again against its new status. A session that ends leaves its server.
+func (s *Service) transition(ctx context.Context, session Session, to, actor, reason, correlationID string) (Session, error) {
+	for attempt := 0; ; attempt++ {
+		if session.Status == to {
+			return session, nil
+		}
+		if !CanTransition(session.Status, to) {
+			return Session{}, ErrInvalidTransition
+		}
+		from := session.Status
+		updated, err := s.repo.TransitionSession(ctx, session.ID, from, to, actor, reason)
+		if errors.Is(err, ErrStatusChanged) && attempt+1 < maxUpdateAttempts {
+			if session, err = s.repo.GetSession(ctx, session.ID); err != nil {
+				return Session{}, err
+			}
+			continue
+		}
+		if err != nil {
+			return Session{}, err
+		}
+		payload := contracts.SessionStatusChangedV1{SessionID: session.ID, From: from, To: to, Actor: actor, Reason: reason}
+		if err := s.publishStatusChanged(correlationID, updated.OwnerUserID, payload); err != nil {
+			return Session{}, err
+		}
+		if ended(to) && s.fleet != nil {
+			s.releaseEnded(ctx, session.ID)
+		}
+		return updated, nil
+	}
+}
+
+// releaseEnded frees the place of an ended session on whichever server hosts it. A failure leaves the
+// place taken until the server releases it itself.
+func (s *Service) releaseEnded(ctx context.Context, sessionID string) {
+	servers, err := s.fleet.List(ctx)
+	if err != nil {
+		return
+	}
+	for _, server := range servers {
+		if server.hosts(sessionID) {
+			_, _ = s.ReleaseSession(ctx, server.ID, sessionID)
+		}
+	}
+}
+
+func (s *Service) publishStatusChanged(correlationID, userID string, payload contracts.SessionStatusChangedV1) error {
+	if s.nc == nil {
+		return nil
+	}
+	eventID, err := newUUID()
+	if err != nil {
+		return err
+	}
+	raw, err := contracts.MarshalV1(eventID, contracts.EventSessionStatus, time.Now().UTC(), correlationID, &userID, payload)
+	if err != nil {
+		return err
+	}
+	msg := nats.NewMsg(contracts.SubjectSessionStatus)
+	msg.Data = raw
+	msg.Header.Set("correlation_id", correlationID)
+	msg.Header.Set("content-type", "application/json")
+	return s.nc.PublishMsg(msg)
+}
@@ -0,0 +1,78 @@
+package sessions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCanTransition(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		from, to string
+		want     bool
+	}{
+		{StatusCreated, StatusAllocating, true},
+		{StatusCreated, StatusInProgress, false},
+		{StatusAllocating, StatusReady, true},
+		{StatusReady, StatusInProgress, true},
+		{StatusReady, StatusAllocating, true},
+		{StatusInProgress, StatusAllocating, true},
+		{StatusInProgress, StatusCompleted, true},
+		{StatusReady, StatusCompleted, false},
+		{StatusCreated, StatusAbandoned, true},
+		{StatusCompleted, StatusAbandoned, false},
+		{StatusAbandoned, StatusCreated, false},
+		{"", StatusCreated, false},
+	}
+	for _, tc := range cases {
+		if got := CanTransition(tc.from, tc.to); got != tc.want {
+			t.Fatalf("%s -> %s: expected %v, got %v", tc.from, tc.to, tc.want, got)
+		}
+	}
+}
+
+func TestSessionLifecycleEndpoints(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	NewHandler(NewService(&fakeCreateRepo{region: "eu-west"}, fakeAuth{}, nil, nil).WithFleet(newFakeFleet())).Register(mux)
+
+	steps := []struct {
+		method string
+		path   string
+		token  string
+		body   string
+		code   int
+		want   string
+	}{
+		{http.MethodGet, "/v1/sessions/sess-1/transitions", "token", ``, http.StatusOK, `"to":"created"`},
+		{http.MethodPost, "/v1/sessions/sess-1/transitions", "token", ``, http.StatusMethodNotAllowed, "method_not_allowed"},
+		{http.MethodPost, "/v1/sessions/sess-1/status", "token", `{"status":"allocating"}`, http.StatusBadRequest, "invalid_status"},
+		{http.MethodPost, "/v1/sessions/sess-1/status", "token", `{"status":"in_progress"}`, http.StatusConflict, "invalid_transition"},
+		{http.MethodPost, "/v1/fleet/servers", "server-token", `{"id":"gs-1","ip":"10.0.1.5","port":7777,"region":"eu-west","capacity":1}`, http.StatusOK, `"state":"ready"`},
+		{http.MethodPost, "/v1/fleet/servers/gs-1/sessions/sess-1/status", "server-token", `{"status":"in_progress"}`, http.StatusForbidden, "forbidden"},
+		{http.MethodPost, "/v1/sessions/sess-1/assign-server", "token", ``, http.StatusOK, `"id":"gs-1"`},
+		{http.MethodGet, "/v1/sessions/sess-1/transitions", "token", ``, http.StatusOK, `"from":"allocating","to":"ready","actor":"user-1"`},
+		{http.MethodPost, "/v1/fleet/servers/gs-9/sessions/sess-1/status", "server-token", `{"status":"in_progress"}`, http.StatusNotFound, "server_not_found"},
+		{http.MethodPost, "/v1/fleet/servers/gs-1/sessions/sess-1/status", "token", `{"status":"in_progress"}`, http.StatusUnauthorized, "unauthorized"},
+		{http.MethodPost, "/v1/fleet/servers/gs-1/sessions/sess-1/status", "server-token", `{"status":"in_progress"}`, http.StatusOK, `"status":"in_progress"`},
+		{http.MethodPost, "/v1/fleet/servers/gs-1/sessions/sess-1/status", "server-token", `{"status":"in_progress"}`, http.StatusOK, `"status":"in_progress"`},
+		{http.MethodPost, "/v1/fleet/servers/gs-1/sessions/sess-1/status", "server-token", `{"status":"completed","reason":"red team won"}`, http.StatusOK, `"status":"completed"`},
+		// Completing the session gave its place back.
+		{http.MethodPost, "/v1/fleet/servers/gs-1/heartbeat", "server-token", ``, http.StatusOK, `"sessions":[]`},
+		{http.MethodPost, "/v1/sessions/sess-1/assign-server", "token", ``, http.StatusConflict, "session_ended"},
+		{http.MethodPost, "/v1/sessions/sess-1/backfill", "token", `{"queue":"duel","open_slots":[1]}`, http.StatusConflict, "session_ended"},
+		{http.MethodPost, "/v1/sessions/sess-1/status", "token", `{"status":"abandoned"}`, http.StatusConflict, "invalid_transition"},
+		{http.MethodGet, "/v1/sessions/sess-1/transitions", "token", ``, http.StatusOK, `"to":"completed","actor":"server:gs-1","reason":"red team won"`},
+	}
+	for _, step := range steps {
+		req := httptest.NewRequest(step.method, step.path, strings.NewReader(step.body))
+		req.Header.Set("Authorization", "Bearer "+step.token)
+		res := httptest.NewRecorder()
+		mux.ServeHTTP(res, req)
+		if res.Code != step.code || !strings.Contains(res.Body.String(), step.want) {
+			t.Fatalf("%s %s: expected %d %s, got %d %s", step.method, step.path, step.code, step.want, res.Code, res.Body.String())
+		}
+	}
+}
@@ -3,15 +3,43 @@ package sessions
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/authz"
+)
+
+var (
+	ErrSessionNotFound = errors.New("session not found")
+	// ErrStatusChanged means the session was no longer in the status a transition started from.
+	ErrStatusChanged = errors.New("session status changed")
 )
 
 type Repository interface {
-	CreateSession(ctx context.Context, ownerUserID, status string, members []string) (Session, error)
+	// CreateSession stores a session to be played in region; an empty region means any. A session
+	// created for a formed match keeps its matchID. Its first transition, into status, is recorded
+	// against the owner.
+	CreateSession(ctx context.Context, ownerUserID, status, region, matchID string, members []string) (Session, error)
+	GetSession(ctx context.Context, sessionID string) (Session, error)
+	// TransitionSession moves the session from one status to another and records the transition. It
+	// returns ErrStatusChanged, and changes nothing, if the session is no longer in from.
+	TransitionSession(ctx context.Context, sessionID, from, to, actor, reason string) (Session, error)
+	// ListTransitions returns the session's transitions, oldest first.
+	ListTransitions(ctx context.Context, sessionID string) ([]Transition, error)
 	IsMember(ctx context.Context, sessionID, userID string) (bool, error)
+	ListMembers(ctx context.Context, sessionID string) ([]string, error)
+	// AddMember adds a player to a session and reports false if they were already in it.
+	AddMember(ctx context.Context, sessionID, userID string) (bool, error)
 	ListUsers(ctx context.Context) ([]User, error)
 	ListSessions(ctx context.Context) ([]Session, error)
+	RecordAdminAction(ctx context.Context, entry authz.AuditEntry) error
 }
 
+const (
+	sessionColumns    = `id::text, owner_user_id::text, status, region, match_id, created_at, updated_at`
+	qInsertTransition = `INSERT INTO session_transitions (session_id, from_status, to_status, actor, reason) VALUES ($1, $2, $3, $4, $5)`
+)
+
 type PostgresRepository struct {
 	db *sql.DB
 }
@@ -20,7 +48,7 @@ func NewPostgresRepository(db *sql.DB) *PostgresRepository {
 	return &PostgresRepository{db: db}
 }
 
-func (r *PostgresRepository) CreateSession(ctx context.Context, ownerUserID, status string, members []string) (Session, error) {
+func (r *PostgresRepository) CreateSession(ctx context.Context, ownerUserID, status, region, matchID string, members []string) (Session, error) {
 	sessionID, err := newUUID()
 	if err != nil {
 		return Session{}, err
@@ -31,9 +59,12 @@ func (r *PostgresRepository) CreateSession(ctx context.Context, ownerUserID, sta
 	}
 	defer func() { _ = tx.Rollback() }()
 
-	const qInsertSession = `INSERT INTO sessions (id, owner_user_id, status) VALUES ($1, $2, $3) RETURNING id::text, owner_user_id::text, status, created_at`
+	const qInsertSession = `INSERT INTO sessions (id, owner_user_id, status, region, match_id) VALUES ($1, $2, $3, $4, $5) RETURNING ` + sessionColumns
 	var out Session
-	if err := tx.QueryRowContext(ctx, qInsertSession, sessionID, ownerUserID, status).Scan(&out.ID, &out.OwnerUserID, &out.Status, &out.CreatedAt); err != nil {
+	if err := tx.QueryRowContext(ctx, qInsertSession, sessionID, ownerUserID, status, region, matchID).Scan(&out.ID, &out.OwnerUserID, &out.Status, &out.Region, &out.MatchID, &out.CreatedAt, &out.UpdatedAt); err != nil {
+		return Session{}, err
+	}
+	if _, err := tx.ExecContext(ctx, qInsertTransition, sessionID, "", status, ownerUserID, ""); err != nil {
 		return Session{}, err
 	}
 
@@ -54,6 +85,66 @@ func (r *PostgresRepository) CreateSession(ctx context.Context, ownerUserID, sta
 	return out, nil
 }
 
+func (r *PostgresRepository) GetSession(ctx context.Context, sessionID string) (Session, error) {
+	const q = `SELECT ` + sessionColumns + ` FROM sessions WHERE id = $1`
+	var out Session
+	err := r.db.QueryRowContext(ctx, q, sessionID).Scan(&out.ID, &out.OwnerUserID, &out.Status, &out.Region, &out.MatchID, &out.CreatedAt, &out.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Session{}, ErrSessionNotFound
+	}
+	return out, err
+}
+
+func (r *PostgresRepository) TransitionSession(ctx context.Context, sessionID, from, to, actor, reason string) (Session, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Session{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	const qUpdate = `UPDATE sessions SET status = $3, updated_at = NOW() WHERE id = $1 AND status = $2 RETURNING ` + sessionColumns
+	var out Session
+	err = tx.QueryRowContext(ctx, qUpdate, sessionID, from, to).Scan(&out.ID, &out.OwnerUserID, &out.Status, &out.Region, &out.MatchID, &out.CreatedAt, &out.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		if _, err := r.GetSession(ctx, sessionID); err != nil {
+			return Session{}, err
+		}
+		return Session{}, ErrStatusChanged
+	}
+	if err != nil {
+		return Session{}, err
+	}
+	if _, err := tx.ExecContext(ctx, qInsertTransition, sessionID, from, to, actor, reason); err != nil {
+		return Session{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Session{}, err
+	}
+	return out, nil
+}
+
+func (r *PostgresRepository) ListTransitions(ctx context.Context, sessionID string) ([]Transition, error) {
+	const q = `SELECT from_status, to_status, actor, reason, created_at FROM session_transitions WHERE session_id = $1 ORDER BY id`
+	rows, err := r.db.QueryContext(ctx, q, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	transitions := make([]Transition, 0)
+	for rows.Next() {
+		var t Transition
+		if err := rows.Scan(&t.From, &t.To, &t.Actor, &t.Reason, &t.At); err != nil {
+			return nil, err
+		}
+		transitions = append(transitions, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return transitions, nil
+}
+
 func (r *PostgresRepository) IsMember(ctx context.Context, sessionID, userID string) (bool, error) {
 	const q = `SELECT EXISTS (SELECT 1 FROM session_members WHERE session_id = $1 AND user_id = $2)`
 	var exists bool
@@ -61,6 +152,38 @@ func (r *PostgresRepository) IsMember(ctx context.Context, sessionID, userID str
 	return exists, err
 }
 
+func (r *PostgresRepository) ListMembers(ctx context.Context, sessionID string) ([]string, error) {
+	const q = `SELECT user_id::text FROM session_members WHERE session_id = $1 ORDER BY joined_at, user_id`
+	rows, err := r.db.QueryContext(ctx, q, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	members := make([]string, 0)
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		members = append(members, userID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+func (r *PostgresRepository) AddMember(ctx context.Context, sessionID, userID string) (bool, error) {
+	const q = `INSERT INTO session_members (session_id, user_id, role) VALUES ($1, $2, 'player') ON CONFLICT DO NOTHING`
+	res, err := r.db.ExecContext(ctx, q, sessionID, userID)
+	if err != nil {
+		return false, err
+	}
+	added, err := res.RowsAffected()
+	return added > 0, err
+}
+
 func (r *PostgresRepository) ListUsers(ctx context.Context) ([]User, error) {
 	const q = `SELECT id::text, username, created_at FROM users ORDER BY created_at DESC`
 	rows, err := r.db.QueryContext(ctx, q)
@@ -84,7 +207,7 @@ func (r *PostgresRepository) ListUsers(ctx context.Context) ([]User, error) {
 }
 
 func (r *PostgresRepository) ListSessions(ctx context.Context) ([]Session, error) {
-	const q = `SELECT id::text, owner_user_id::text, status, created_at FROM sessions ORDER BY created_at DESC`
+	const q = `SELECT ` + sessionColumns + ` FROM sessions ORDER BY created_at DESC`
 	rows, err := r.db.QueryContext(ctx, q)
 	if err != nil {
 		return nil, err
@@ -94,7 +217,7 @@ func (r *PostgresRepository) ListSessions(ctx context.Context) ([]Session, error
 	sessions := make([]Session, 0)
 	for rows.Next() {
 		var session Session
-		if err := rows.Scan(&session.ID, &session.OwnerUserID, &session.Status, &session.CreatedAt); err != nil {
+		if err := rows.Scan(&session.ID, &session.OwnerUserID, &session.Status, &session.Region, &session.MatchID, &session.CreatedAt, &session.UpdatedAt); err != nil {
 			return nil, err
 		}
 		sessions = append(sessions, session)
@@ -104,3 +227,15 @@ func (r *PostgresRepository) ListSessions(ctx context.Context) ([]Session, error
 	}
 	return sessions, nil
 }
+
+func (r *PostgresRepository) RecordAdminAction(ctx context.Context, entry authz.AuditEntry) error {
+	id, err := newUUID()
+	if err != nil {
+		return err
+	}
+	const q = `
+		INSERT INTO admin_audit_log (id, actor_user_id, actor_roles, action, target, correlation_id)
+		VALUES ($1, $2, $3, $4, $5, $6)`
+	_, err = r.db.ExecContext(ctx, q, id, entry.ActorUserID, strings.Join(entry.ActorRoles, ","), entry.Action, entry.Target, entry.CorrelationID)
+	return err
+}
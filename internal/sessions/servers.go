@@ -0,0 +1,31 @@
+package sessions
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ParseServers reads a JSON array of ServerAllocation objects, one per region, and validates it. A
+// server without an id is named after its region and port, as in "eu-west-7777".
+func ParseServers(raw []byte) ([]ServerAllocation, error) {
+	var servers []ServerAllocation
+	if err := json.Unmarshal(raw, &servers); err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	for i, server := range servers {
+		switch {
+		case server.IP == "" || server.Region == "":
+			return nil, fmt.Errorf("game server %s:%d: ip and region are required", server.IP, server.Port)
+		case server.Port < 1 || server.Port > 65535:
+			return nil, fmt.Errorf("game server %s:%d: port must be between 1 and 65535", server.IP, server.Port)
+		case seen[server.Region]:
+			return nil, fmt.Errorf("region %q has more than one game server", server.Region)
+		}
+		seen[server.Region] = true
+		if server.ID == "" {
+			servers[i].ID = fmt.Sprintf("%s-%d", server.Region, server.Port)
+		}
+	}
+	return servers, nil
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/nats-io/nats.go"
+	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/authz"
 	"github.com/paul-cloud-game-backend/paul-cloud-game-backend/internal/contracts"
 	"github.com/redis/go-redis/v9"
 )
@@ -16,6 +17,8 @@ var ErrForbidden = errors.New("forbidden")
 
 type TokenParser interface {
 	ParseToken(token string) (string, string, error)
+	ParsePrincipal(token string) (authz.Principal, error)
+	ParseServicePrincipal(token string) (authz.Principal, error)
 }
 
 type Service struct {
@@ -24,10 +27,40 @@ type Service struct {
 	nc     *nats.Conn
 	redis  *redis.Client
 	server ServerAllocation
+	// servers are the game servers configured per region; server is used for sessions in other regions.
+	servers []ServerAllocation
+	// fleet, when set, replaces the configured servers with registered ones.
+	fleet FleetStore
+	// localFallback hands out server when the fleet has none for a session.
+	localFallback bool
+	now           func() time.Time
 }
 
 func NewService(repo Repository, auth TokenParser, nc *nats.Conn, redisClient *redis.Client) *Service {
-	return &Service{repo: repo, auth: auth, nc: nc, redis: redisClient, server: ServerAllocation{IP: "127.0.0.1", Port: 7777, Region: "local"}}
+	return &Service{repo: repo, auth: auth, nc: nc, redis: redisClient, server: ServerAllocation{ID: "local-7777", IP: "127.0.0.1", Port: 7777, Region: "local"}, now: time.Now}
+}
+
+// WithServers configures game servers by region. A session is assigned the first server in its region,
+// or the default local server if there is none. It is not used once WithFleet is set.
+func (s *Service) WithServers(servers []ServerAllocation) *Service {
+	s.servers = servers
+	return s
+}
+
+// WithLocalFallback assigns the default local server to sessions the fleet has no server for, instead
+// of failing with ErrNoServerAvailable. It is meant for local development without a game server.
+func (s *Service) WithLocalFallback() *Service {
+	s.localFallback = true
+	return s
+}
+
+func (s *Service) serverFor(region string) ServerAllocation {
+	for _, server := range s.servers {
+		if server.Region == region {
+			return server
+		}
+	}
+	return s.server
 }
 
 func (s *Service) ParseToken(token string) (string, error) {
@@ -35,8 +68,20 @@ func (s *Service) ParseToken(token string) (string, error) {
 	return userID, err
 }
 
+func (s *Service) ParsePrincipal(token string) (authz.Principal, error) {
+	return s.auth.ParsePrincipal(token)
+}
+
+func (s *Service) ParseServicePrincipal(token string) (authz.Principal, error) {
+	return s.auth.ParseServicePrincipal(token)
+}
+
+func (s *Service) RecordAdminAction(ctx context.Context, entry authz.AuditEntry) error {
+	return s.repo.RecordAdminAction(ctx, entry)
+}
+
 func (s *Service) CreateSessionForUser(ctx context.Context, userID, correlationID string) (Session, error) {
-	session, err := s.repo.CreateSession(ctx, userID, "created", []string{userID})
+	session, err := s.repo.CreateSession(ctx, userID, StatusCreated, "", "", []string{userID})
 	if err != nil {
 		return Session{}, err
 	}
@@ -46,7 +91,12 @@ func (s *Service) CreateSessionForUser(ctx context.Context, userID, correlationI
 	return session, nil
 }
 
-func (s *Service) AssignServer(ctx context.Context, userID, sessionID, correlationID string) (AssignServerResponse, error) {
+// AssignServer returns the game server hosting the session, allocating one from the fleet the first time
+// it is asked. Labels in req narrow the fleet to servers carrying them; configured servers have none.
+// With WithLocalFallback, a session the fleet has no server for gets the default local server.
+// The session is allocating until a server takes it and ready from then on. Ended sessions get
+// ErrSessionEnded.
+func (s *Service) AssignServer(ctx context.Context, userID, sessionID string, req AssignServerRequest, correlationID string) (AssignServerResponse, error) {
 	isMember, err := s.repo.IsMember(ctx, sessionID, userID)
 	if err != nil {
 		return AssignServerResponse{}, err
@@ -54,10 +104,38 @@ func (s *Service) AssignServer(ctx context.Context, userID, sessionID, correlati
 	if !isMember {
 		return AssignServerResponse{}, ErrForbidden
 	}
-	if err := s.publishSessionAssigned(correlationID, userID, sessionID); err != nil {
+	session, err := s.repo.GetSession(ctx, sessionID)
+	if err != nil {
+		return AssignServerResponse{}, err
+	}
+	if ended(session.Status) {
+		return AssignServerResponse{}, ErrSessionEnded
+	}
+	if session.Status == StatusCreated {
+		if session, err = s.transition(ctx, session, StatusAllocating, userID, "", correlationID); err != nil {
+			return AssignServerResponse{}, err
+		}
+	}
+	server := s.serverFor(session.Region)
+	if s.fleet != nil {
+		allocated, err := s.allocate(ctx, sessionID, session.Region, req.Labels)
+		switch {
+		case errors.Is(err, ErrNoServerAvailable) && s.localFallback:
+		case err != nil:
+			return AssignServerResponse{}, err
+		default:
+			server = allocated.Allocation()
+		}
+	}
+	if session.Status == StatusAllocating {
+		if _, err := s.transition(ctx, session, StatusReady, userID, "", correlationID); err != nil {
+			return AssignServerResponse{}, err
+		}
+	}
+	if err := s.publishSessionAssigned(correlationID, userID, session, server); err != nil {
 		return AssignServerResponse{}, err
 	}
-	return AssignServerResponse{Server: s.server}, nil
+	return AssignServerResponse{Server: server}, nil
 }
 
 func (s *Service) ListUsers(ctx context.Context) ([]User, error) {
@@ -107,7 +185,7 @@ func (s *Service) HandleMatchedEvent(msg *nats.Msg) {
 		return
 	}
 	owner := members[0]
-	session, err := s.repo.CreateSession(context.Background(), owner, "created", members)
+	session, err := s.repo.CreateSession(context.Background(), owner, StatusCreated, payload.Region, payload.MatchID, members)
 	if err != nil {
 		return
 	}
@@ -134,7 +212,7 @@ func (s *Service) publishSessionCreated(correlationID, userID, sessionID string)
 	return s.nc.PublishMsg(msg)
 }
 
-func (s *Service) publishSessionAssigned(correlationID, userID, sessionID string) error {
+func (s *Service) publishSessionAssigned(correlationID, userID string, session Session, server ServerAllocation) error {
 	if s.nc == nil {
 		return nil
 	}
@@ -142,7 +220,7 @@ func (s *Service) publishSessionAssigned(correlationID, userID, sessionID string
 	if err != nil {
 		return err
 	}
-	payload := contracts.SessionAssignedServerV1{SessionID: sessionID, ServerID: "local-7777"}
+	payload := contracts.SessionAssignedServerV1{SessionID: session.ID, ServerID: server.ID, IP: server.IP, Port: server.Port, Region: server.Region, MatchID: session.MatchID, ServerOwner: server.Owner}
 	raw, err := contracts.MarshalV1(eventID, contracts.EventSessionAssigned, time.Now().UTC(), correlationID, &userID, payload)
 	if err != nil {
 		return err
@@ -6,7 +6,19 @@ type Session struct {
 	ID          string    `json:"id"`
 	OwnerUserID string    `json:"owner_user_id"`
 	Status      string    `json:"status"`
+	Region      string    `json:"region,omitempty"`
+	MatchID     string    `json:"match_id,omitempty"`
 	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Transition is one recorded step of a session's lifecycle. The first one comes from "".
+type Transition struct {
+	From   string    `json:"from"`
+	To     string    `json:"to"`
+	Actor  string    `json:"actor"`
+	Reason string    `json:"reason,omitempty"`
+	At     time.Time `json:"at"`
 }
 
 type User struct {
@@ -16,9 +28,17 @@ type User struct {
 }
 
 type ServerAllocation struct {
+	ID     string `json:"id"`
 	IP     string `json:"ip"`
 	Port   int    `json:"port"`
 	Region string `json:"region"`
+	// Owner is the registering principal of a fleet server; players are not shown it.
+	Owner string `json:"-"`
+}
+
+// AssignServerRequest is the optional body of an assign-server call.
+type AssignServerRequest struct {
+	Labels map[string]string `json:"labels,omitempty"`
 }
 
 type AssignServerResponse struct {
@@ -5,6 +5,7 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
+	"io"
 	"net/http"
 	"strconv"
 	"strings"
@@ -112,8 +113,19 @@ var (
 	startedAt     = time.Now()
 	requestTotals sync.Map
 	totalRequests atomic.Int64
+
+	extraMetricsMu sync.Mutex
+	extraMetrics   []func(w io.Writer, serviceName string)
 )
 
+// RegisterMetrics adds a service's own metrics to /metrics. fn writes them in Prometheus text format
+// after the shared HTTP and process metrics.
+func RegisterMetrics(fn func(w io.Writer, serviceName string)) {
+	extraMetricsMu.Lock()
+	defer extraMetricsMu.Unlock()
+	extraMetrics = append(extraMetrics, fn)
+}
+
 func incRequestCounter(method, path string, status int) {
 	key := metricsKey{method: method, path: path, status: status}
 	counter, _ := requestTotals.LoadOrStore(key, &atomic.Int64{})
@@ -147,5 +159,12 @@ func metricsHandler(serviceName string) http.HandlerFunc {
 		_, _ = fmt.Fprintf(w, "# HELP pcgb_process_uptime_seconds Process uptime in seconds.\n")
 		_, _ = fmt.Fprintf(w, "# TYPE pcgb_process_uptime_seconds gauge\n")
 		_, _ = fmt.Fprintf(w, "pcgb_process_uptime_seconds{service=%q} %.0f\n", serviceName, time.Since(startedAt).Seconds())
+
+		extraMetricsMu.Lock()
+		writers := append([]func(w io.Writer, serviceName string){}, extraMetrics...)
+		extraMetricsMu.Unlock()
+		for _, write := range writers {
+			write(w, serviceName)
+		}
 	}
 }
@@ -30,7 +30,8 @@ PIDS=""
 start_service gateway 8080
 start_service login 8081
 start_service router 8082
-start_service sessions 8083
+# Sessions get 127.0.0.1:7777 while no game server has registered.
+SESSIONS_LOCAL_FALLBACK=true start_service sessions 8083
 start_service matchmaking 8084
 
 echo "[demo] services started. Logs in .tmp/*.log"